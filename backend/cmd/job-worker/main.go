@@ -0,0 +1,146 @@
+// Command job-worker runs background jobs read from the shared Redis broker. API
+// nodes enqueue jobs in the shared Postgres store and publish them to the broker;
+// worker processes, e.g. on machines with GPUs or Blender, run the types they
+// are started for.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/compozit/vision/backend/internal/application/jobs"
+	"github.com/compozit/vision/backend/internal/application/metering"
+	"github.com/compozit/vision/backend/internal/infrastructure/ai"
+	"github.com/compozit/vision/backend/internal/infrastructure/modeling"
+	"github.com/compozit/vision/backend/internal/infrastructure/storage"
+	"github.com/compozit/vision/backend/pkg/logger"
+)
+
+type WorkerConfig struct {
+	DatabaseURL  string
+	RedisURL     string
+	BrokerPrefix string
+	Types        string // comma-separated job types, empty for all
+	Concurrency  int
+	DrainTimeout time.Duration
+}
+
+func main() {
+	config := parseFlags()
+
+	types, err := jobs.ParseJobTypes(config.Types)
+	if err != nil {
+		log.Fatalf("Invalid job types: %v", err)
+	}
+
+	appLogger := logger.New("job-worker")
+
+	db, err := sqlx.Connect("postgres", config.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	redisOptions, err := redis.ParseURL(config.RedisURL)
+	if err != nil {
+		log.Fatalf("Invalid REDIS_URL: %v", err)
+	}
+	redisClient := redis.NewClient(redisOptions)
+	defer redisClient.Close()
+
+	blobs, err := storage.New(storage.LoadConfig())
+	if err != nil {
+		log.Fatalf("Failed to create blob storage: %v", err)
+	}
+
+	aiConfig := ai.LoadConfig()
+	if err := aiConfig.Validate(); err != nil {
+		log.Fatalf("Invalid AI configuration: %v", err)
+	}
+	// Webhooks reach the API process, whose prediction tracker does not know the
+	// renders running here; workers poll their predictions instead
+	aiConfig.WebhookURL, aiConfig.WebhookSecret = "", ""
+
+	// The renderer and queue run until the queue drained; a signal only starts the drain
+	runCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// No depth estimator is deployed, so structure control conditions on edges only
+	renderer, err := aiConfig.NewRenderer(runCtx, ai.NewCacheWithOptions(nil, aiConfig.CacheOptions()), nil, appLogger)
+	if err != nil {
+		log.Fatalf("Failed to create AI renderer: %v", err)
+	}
+	renderer.EnableDurableStorage(blobs)
+	renderer.SetStyleResolver(ai.NewPostgresStyleResolver(db))
+	renderer.SetSpaceAnalysisSource(ai.NewPostgresSpaceAnalysisSource(db))
+
+	queue := jobs.NewQueue(appLogger, renderer, modeling.NewGenerator(appLogger), config.Concurrency)
+	queue.SetStore(jobs.NewPostgresJobStore(db))
+	queue.SetDeadLetterStore(jobs.NewPostgresDeadLetterStore(db))
+	queue.SetIdempotencyStore(jobs.NewPostgresIdempotencyStore(db))
+	queue.SetArchive(jobs.NewPostgresJobArchive(db), blobs)
+	queue.SetMeter(metering.NewMeter(metering.NewPostgresStore(db), metering.DefaultPricing(), appLogger))
+	queue.SetBroker(jobs.NewRedisBroker(redisClient, config.BrokerPrefix), jobs.RoleWorker, types...)
+
+	if err := queue.Start(runCtx); err != nil {
+		log.Fatalf("Failed to start job queue: %v", err)
+	}
+	appLogger.Info("Job worker started", "types", config.Types, "workers", config.Concurrency)
+
+	signals, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-signals.Done()
+
+	// Running jobs get DrainTimeout to finish; the rest are requeued for other workers
+	appLogger.Info("Job worker draining", "timeout", config.DrainTimeout)
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), config.DrainTimeout)
+	defer cancelDrain()
+	if err := queue.Stop(drainCtx); err != nil {
+		appLogger.Warn("Job worker drain incomplete", "error", err)
+	}
+}
+
+func parseFlags() WorkerConfig {
+	config := WorkerConfig{
+		DatabaseURL:  os.Getenv("DATABASE_URL"),
+		RedisURL:     envOr("REDIS_URL", "redis://localhost:6379/0"),
+		BrokerPrefix: envOr("JOB_BROKER_PREFIX", "jobs"),
+		Concurrency:  4,
+		DrainTimeout: 30 * time.Second,
+	}
+	if concurrency, err := strconv.Atoi(os.Getenv("JOB_WORKER_CONCURRENCY")); err == nil && concurrency > 0 {
+		config.Concurrency = concurrency
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("JOB_DRAIN_TIMEOUT")); err == nil && timeout > 0 {
+		config.DrainTimeout = timeout
+	}
+
+	flag.StringVar(&config.Types, "types", os.Getenv("JOB_WORKER_TYPES"), "Comma-separated job types to run (default all)")
+	flag.IntVar(&config.Concurrency, "workers", config.Concurrency, "Number of jobs run at once")
+	flag.DurationVar(&config.DrainTimeout, "drain-timeout", config.DrainTimeout, "How long running jobs may finish on shutdown")
+	flag.Parse()
+
+	if config.DatabaseURL == "" {
+		log.Fatal("DATABASE_URL is required")
+	}
+
+	return config
+}
+
+// envOr returns an environment variable, or fallback when it is unset
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
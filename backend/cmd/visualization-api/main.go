@@ -0,0 +1,158 @@
+// Command visualization-api serves the visualization HTTP API. Jobs are kept in
+// the shared Postgres store; with REDIS_URL set they are published to the
+// broker for job-worker processes, otherwise this process runs them itself.
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/compozit/vision/backend/internal/api/routes"
+	"github.com/compozit/vision/backend/internal/application/jobs"
+	"github.com/compozit/vision/backend/internal/application/metering"
+	"github.com/compozit/vision/backend/internal/infrastructure/ai"
+	"github.com/compozit/vision/backend/internal/infrastructure/modeling"
+	"github.com/compozit/vision/backend/internal/infrastructure/storage"
+	"github.com/compozit/vision/backend/pkg/logger"
+)
+
+type APIConfig struct {
+	Addr         string
+	DatabaseURL  string
+	RedisURL     string // empty to run jobs in this process
+	BrokerPrefix string
+	Concurrency  int
+	DrainTimeout time.Duration
+}
+
+func main() {
+	config := parseConfig()
+
+	appLogger := logger.New("visualization-api")
+
+	db, err := sqlx.Connect("postgres", config.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	blobs, err := storage.New(storage.LoadConfig())
+	if err != nil {
+		log.Fatalf("Failed to create blob storage: %v", err)
+	}
+
+	aiConfig := ai.LoadConfig()
+	if err := aiConfig.Validate(); err != nil {
+		log.Fatalf("Invalid AI configuration: %v", err)
+	}
+
+	// The renderer reloads prompts and the queue runs until the server stopped
+	runCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// No depth estimator is deployed, so structure control conditions on edges only
+	renderer, err := aiConfig.NewRenderer(runCtx, ai.NewCacheWithOptions(nil, aiConfig.CacheOptions()), nil, appLogger)
+	if err != nil {
+		log.Fatalf("Failed to create AI renderer: %v", err)
+	}
+	renderer.EnableDurableStorage(blobs)
+	renderer.SetStyleResolver(ai.NewPostgresStyleResolver(db))
+	renderer.SetSpaceAnalysisSource(ai.NewPostgresSpaceAnalysisSource(db))
+
+	modelGen := modeling.NewGenerator(appLogger)
+	queue := jobs.NewQueue(appLogger, renderer, modelGen, config.Concurrency)
+	queue.SetStore(jobs.NewPostgresJobStore(db))
+	queue.SetDeadLetterStore(jobs.NewPostgresDeadLetterStore(db))
+	queue.SetIdempotencyStore(jobs.NewPostgresIdempotencyStore(db))
+	queue.SetArchive(jobs.NewPostgresJobArchive(db), blobs)
+	queue.SetMeter(metering.NewMeter(metering.NewPostgresStore(db), metering.DefaultPricing(), appLogger))
+
+	if config.RedisURL != "" {
+		redisOptions, err := redis.ParseURL(config.RedisURL)
+		if err != nil {
+			log.Fatalf("Invalid REDIS_URL: %v", err)
+		}
+		redisClient := redis.NewClient(redisOptions)
+		defer redisClient.Close()
+
+		queue.SetBroker(jobs.NewRedisBroker(redisClient, config.BrokerPrefix), jobs.RoleEnqueue)
+	}
+
+	if err := queue.Start(runCtx); err != nil {
+		log.Fatalf("Failed to start job queue: %v", err)
+	}
+
+	router := mux.NewRouter()
+	routes.SetupVisualizationRoutes(router, queue, renderer, modelGen, appLogger)
+
+	server := &http.Server{
+		Addr:              config.Addr,
+		Handler:           router,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("HTTP server failed: %v", err)
+		}
+	}()
+	appLogger.Info("Visualization API started", "addr", config.Addr, "broker", config.RedisURL != "")
+
+	signals, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-signals.Done()
+
+	// Draining first makes the readiness endpoint report 503 while running
+	// jobs finish; requests in flight are served until the deadline
+	appLogger.Info("Visualization API draining", "timeout", config.DrainTimeout)
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), config.DrainTimeout)
+	defer cancelDrain()
+	if err := queue.Stop(drainCtx); err != nil {
+		appLogger.Warn("Job queue drain incomplete", "error", err)
+	}
+	if err := server.Shutdown(drainCtx); err != nil {
+		appLogger.Warn("HTTP server shutdown incomplete", "error", err)
+	}
+}
+
+func parseConfig() APIConfig {
+	config := APIConfig{
+		Addr:         envOr("HTTP_ADDR", ":8080"),
+		DatabaseURL:  os.Getenv("DATABASE_URL"),
+		RedisURL:     os.Getenv("REDIS_URL"),
+		BrokerPrefix: envOr("JOB_BROKER_PREFIX", "jobs"),
+		Concurrency:  4,
+		DrainTimeout: 30 * time.Second,
+	}
+	if concurrency, err := strconv.Atoi(os.Getenv("JOB_WORKER_CONCURRENCY")); err == nil && concurrency > 0 {
+		config.Concurrency = concurrency
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("JOB_DRAIN_TIMEOUT")); err == nil && timeout > 0 {
+		config.DrainTimeout = timeout
+	}
+
+	if config.DatabaseURL == "" {
+		log.Fatal("DATABASE_URL is required")
+	}
+
+	return config
+}
+
+// envOr returns an environment variable, or fallback when it is unset
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/compozit/vision/backend/internal/application/jobs"
+	"github.com/compozit/vision/backend/pkg/logger"
+	"github.com/gorilla/mux"
+)
+
+// JobAdminHandler handles the operator endpoints of the job queue
+type JobAdminHandler struct {
+	jobQueue *jobs.Queue
+	logger   logger.Logger
+}
+
+// NewJobAdminHandler creates a new job admin handler
+func NewJobAdminHandler(jobQueue *jobs.Queue, logger logger.Logger) *JobAdminHandler {
+	return &JobAdminHandler{
+		jobQueue: jobQueue,
+		logger:   logger,
+	}
+}
+
+// UpdateDeadLetterRequest replaces the data a dead-lettered job runs with
+type UpdateDeadLetterRequest struct {
+	Data map[string]interface{} `json:"data"`
+}
+
+// ListDeadLetters returns the jobs that exhausted their retries, newest failure first
+func (ah *JobAdminHandler) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := 50 // Default limit
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+
+	filter := jobs.DeadLetterFilter{
+		UserID: query.Get("user_id"),
+		Limit:  limit,
+	}
+	if offset, err := strconv.Atoi(query.Get("offset")); err == nil && offset > 0 {
+		filter.Offset = offset
+	}
+	if jobType := query.Get("type"); jobType != "" {
+		filter.Types = []jobs.JobType{jobs.JobType(jobType)}
+	}
+
+	letters, err := ah.jobQueue.ListDeadLetters(r.Context(), filter)
+	if err != nil {
+		ah.logger.Error("Failed to list dead letters", "error", err)
+		http.Error(w, "Failed to list dead letters", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"dead_letters": letters,
+		"count":        len(letters),
+		"offset":       filter.Offset,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetDeadLetter returns a dead-lettered job with its last error
+func (ah *JobAdminHandler) GetDeadLetter(w http.ResponseWriter, r *http.Request) {
+	jobID := mux.Vars(r)["id"]
+
+	letter, err := ah.jobQueue.GetDeadLetter(r.Context(), jobID)
+	if err != nil {
+		ah.writeDeadLetterError(w, jobID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(letter)
+}
+
+// UpdateDeadLetter edits the data of a dead-lettered job before it is requeued
+func (ah *JobAdminHandler) UpdateDeadLetter(w http.ResponseWriter, r *http.Request) {
+	jobID := mux.Vars(r)["id"]
+
+	var req UpdateDeadLetterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Data == nil {
+		http.Error(w, "data is required", http.StatusBadRequest)
+		return
+	}
+
+	letter, err := ah.jobQueue.UpdateDeadLetter(r.Context(), jobID, req.Data)
+	if err != nil {
+		if writePayloadError(w, err) {
+			return
+		}
+		ah.writeDeadLetterError(w, jobID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(letter)
+}
+
+// RequeueDeadLetter runs a dead-lettered job again
+func (ah *JobAdminHandler) RequeueDeadLetter(w http.ResponseWriter, r *http.Request) {
+	jobID := mux.Vars(r)["id"]
+
+	job, err := ah.jobQueue.RequeueDeadLetter(r.Context(), jobID)
+	if err != nil {
+		if writeQuotaError(w, err) {
+			return
+		}
+		if errors.Is(err, jobs.ErrJobNotRequeueable) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		ah.writeDeadLetterError(w, jobID, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"job_id":  job.ID,
+		"status":  job.Status,
+		"message": "Job requeued successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// DeleteDeadLetter discards a dead-lettered job
+func (ah *JobAdminHandler) DeleteDeadLetter(w http.ResponseWriter, r *http.Request) {
+	jobID := mux.Vars(r)["id"]
+
+	if err := ah.jobQueue.DeleteDeadLetter(r.Context(), jobID); err != nil {
+		ah.writeDeadLetterError(w, jobID, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeDeadLetterError maps a dead-letter operation error to a response
+func (ah *JobAdminHandler) writeDeadLetterError(w http.ResponseWriter, jobID string, err error) {
+	if errors.Is(err, jobs.ErrDeadLetterNotFound) {
+		http.Error(w, "Dead letter not found", http.StatusNotFound)
+		return
+	}
+	ah.logger.Error("Dead letter operation failed", "job_id", jobID, "error", err)
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
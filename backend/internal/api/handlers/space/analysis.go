@@ -2,15 +2,13 @@ package space
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/compozit/compozit-vision-api/internal/domain/entities"
+	"github.com/compozit/vision/backend/internal/domain/entities"
 )
 
 // SpaceAnalysisService interface for space analysis operations
@@ -2,17 +2,25 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/compozit/vision/backend/internal/application/jobs"
+	"github.com/compozit/vision/backend/internal/application/metering"
 	"github.com/compozit/vision/backend/internal/infrastructure/ai"
 	"github.com/compozit/vision/backend/internal/infrastructure/modeling"
 	"github.com/compozit/vision/backend/pkg/logger"
 	"github.com/gorilla/mux"
 )
 
+// idempotencyKeyHeader carries the client's key for safely resending a job submission
+const idempotencyKeyHeader = "Idempotency-Key"
+
 // VisualizationHandler handles visualization-related HTTP requests
 type VisualizationHandler struct {
 	jobQueue   *jobs.Queue
@@ -38,8 +46,13 @@ type AIRenderQuickRequest struct {
 	ProjectID    string                 `json:"project_id"`
 	InputImage   string                 `json:"input_image"`
 	Style        string                 `json:"style"`
+	StyleReferenceID string `json:"style_reference_id,omitempty"` // curated style, overrides Style
+	AmbianceOptionID string `json:"ambiance_option_id,omitempty"`
+	PaletteIndex     int    `json:"palette_index,omitempty"`
 	RoomType     string                 `json:"room_type"`
 	Prompt       string                 `json:"prompt,omitempty"`
+	Variants     int                    `json:"variants,omitempty"`
+	Seed         *int64                 `json:"seed,omitempty"`
 	Parameters   map[string]interface{} `json:"parameters,omitempty"`
 }
 
@@ -48,12 +61,21 @@ type AIRenderDetailedRequest struct {
 	ProjectID       string                 `json:"project_id"`
 	InputImage      string                 `json:"input_image"`
 	Style           string                 `json:"style"`
+	StyleReferenceID string `json:"style_reference_id,omitempty"` // curated style, overrides Style
+	AmbianceOptionID string `json:"ambiance_option_id,omitempty"`
+	PaletteIndex     int    `json:"palette_index,omitempty"`
 	RoomType        string                 `json:"room_type"`
 	FurnitureItems  []string               `json:"furniture_items,omitempty"`
 	ColorScheme     []string               `json:"color_scheme,omitempty"`
 	Lighting        string                 `json:"lighting,omitempty"`
 	Additional      []string               `json:"additional,omitempty"`
+	Variants        int                    `json:"variants,omitempty"`
+	Seed            *int64                 `json:"seed,omitempty"`
 	Parameters      map[string]interface{} `json:"parameters,omitempty"`
+
+	// Re-render a stored variant (typically a quick preview) at detailed quality
+	SourceJobID  string `json:"source_job_id,omitempty"`
+	VariantIndex int    `json:"variant_index,omitempty"`
 }
 
 // ModelingRequest represents a 3D modeling request
@@ -66,12 +88,40 @@ type ModelingRequest struct {
 	Parameters map[string]interface{}    `json:"parameters,omitempty"`
 }
 
+// DesignPackageRequest requests a detailed render, a 3D model built from it and
+// a floor plan drawn from the model, run as one pipeline
+type DesignPackageRequest struct {
+	ProjectID        string                 `json:"project_id"`
+	InputImage       string                 `json:"input_image"`
+	Style            string                 `json:"style"`
+	StyleReferenceID string                 `json:"style_reference_id,omitempty"` // curated style, overrides Style
+	AmbianceOptionID string                 `json:"ambiance_option_id,omitempty"`
+	PaletteIndex     int                    `json:"palette_index,omitempty"`
+	RoomType         string                 `json:"room_type"`
+	FurnitureItems   []string               `json:"furniture_items,omitempty"`
+	ColorScheme      []string               `json:"color_scheme,omitempty"`
+	Lighting         string                 `json:"lighting,omitempty"`
+	Seed             *int64                 `json:"seed,omitempty"`
+	Room             *modeling.Room         `json:"room"` // dimensions from the room analysis
+	Furniture        []modeling.Furniture   `json:"furniture,omitempty"`
+	Lights           []modeling.Light       `json:"lights,omitempty"`
+	Materials        []modeling.Material    `json:"materials,omitempty"`
+	ModelParameters  map[string]interface{} `json:"model_parameters,omitempty"`
+	ExportFormat     string                 `json:"export_format,omitempty"` // defaults to pdf
+}
+
 // InpaintingRequest represents an inpainting request
 type InpaintingRequest struct {
 	ProjectID      string  `json:"project_id"`
 	BaseImage      string  `json:"base_image"`
 	MaskImage      string  `json:"mask_image"`
+	MaskSpec       *ai.MaskSpec `json:"mask_spec,omitempty"` // generates the mask when mask_image is empty
 	Prompt         string  `json:"prompt"`
+	FurnitureType  string  `json:"furniture_type,omitempty"`
+	Style          string  `json:"style,omitempty"`
+	StyleReferenceID string `json:"style_reference_id,omitempty"` // curated style, overrides Style
+	AmbianceOptionID string `json:"ambiance_option_id,omitempty"`
+	PaletteIndex     int    `json:"palette_index,omitempty"`
 	NegativePrompt string  `json:"negative_prompt,omitempty"`
 	Strength       float32 `json:"strength"`
 	GuidanceScale  float32 `json:"guidance_scale"`
@@ -83,9 +133,44 @@ type StyleTransferRequest struct {
 	ProjectID    string  `json:"project_id"`
 	ContentImage string  `json:"content_image"`
 	Style        string  `json:"style"`
+	StyleReferenceID string `json:"style_reference_id,omitempty"` // curated style, overrides Style
+	AmbianceOptionID string `json:"ambiance_option_id,omitempty"`
+	PaletteIndex     int    `json:"palette_index,omitempty"`
 	Strength     float32 `json:"strength"`
 }
 
+// UpscaleRequest represents a request to upscale a completed render
+type UpscaleRequest struct {
+	ProjectID    string `json:"project_id"`
+	SourceJobID  string `json:"source_job_id"`
+	VariantIndex int    `json:"variant_index,omitempty"`
+	Scale        int    `json:"scale"` // 2 or 4
+}
+
+// ComposeRender selects a completed render for a composition
+type ComposeRender struct {
+	SourceJobID  string `json:"source_job_id"`
+	VariantIndex int    `json:"variant_index,omitempty"`
+	Caption      string `json:"caption,omitempty"`
+}
+
+// ComposeRequest represents a request for a before/after presentation image
+type ComposeRequest struct {
+	ProjectID       string          `json:"project_id"`
+	OriginalImage   string          `json:"original_image,omitempty"` // defaults to the first render's input image
+	OriginalCaption string          `json:"original_caption,omitempty"`
+	Renders         []ComposeRender `json:"renders"`
+	Layout          string          `json:"layout"` // side_by_side, slider or grid
+	Aspect          string          `json:"aspect,omitempty"`
+	Format          string          `json:"format,omitempty"`
+	Captions        bool            `json:"captions"`
+	StyleName       string          `json:"style_name,omitempty"` // defaults to the first render's style
+	CostTotal       *float64        `json:"cost_total,omitempty"`
+	Currency        string          `json:"currency,omitempty"`
+	Watermark       string          `json:"watermark,omitempty"`
+	SliderPosition  float64         `json:"slider_position,omitempty"`
+}
+
 // RenderQuick handles quick AI rendering requests (2-5 seconds)
 func (vh *VisualizationHandler) RenderQuick(w http.ResponseWriter, r *http.Request) {
 	userID := r.Header.Get("X-User-ID") // Get from JWT middleware
@@ -100,6 +185,20 @@ func (vh *VisualizationHandler) RenderQuick(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	if err := (&ai.RenderRequest{Variants: req.Variants, Seed: req.Seed}).Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Reject disallowed content before any credits are reserved
+	if writeModerationError(w, vh.aiRenderer.ModerateText(userID, map[string]string{
+		"prompt":    req.Prompt,
+		"style":     req.Style,
+		"room_type": req.RoomType,
+	})) {
+		return
+	}
+
 	// Create job
 	job := &jobs.Job{
 		UserID:    userID,
@@ -108,13 +207,22 @@ func (vh *VisualizationHandler) RenderQuick(w http.ResponseWriter, r *http.Reque
 		Data: map[string]interface{}{
 			"input_image": req.InputImage,
 			"style":       req.Style,
+			"style_reference_id": req.StyleReferenceID,
+			"ambiance_option_id": req.AmbianceOptionID,
+			"palette_index":      req.PaletteIndex,
 			"room_type":   req.RoomType,
 			"prompt":      req.Prompt,
+			"variants":    req.Variants,
+			"seed":        req.Seed,
 			"parameters":  req.Parameters,
 		},
+		IdempotencyKey: r.Header.Get(idempotencyKeyHeader),
 	}
 
 	if err := vh.jobQueue.AddJob(job); err != nil {
+		if writeAddJobError(w, err) {
+			return
+		}
 		vh.logger.Error("Failed to add quick render job", "error", err)
 		http.Error(w, "Failed to queue job", http.StatusInternalServerError)
 		return
@@ -124,7 +232,7 @@ func (vh *VisualizationHandler) RenderQuick(w http.ResponseWriter, r *http.Reque
 
 	response := map[string]interface{}{
 		"job_id":     job.ID,
-		"status":     "queued",
+		"status":     job.Status,
 		"message":    "Quick AI rendering started",
 		"estimated_time": "2-5 seconds",
 	}
@@ -147,6 +255,54 @@ func (vh *VisualizationHandler) RenderDetailed(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	// Reuse the seed of a stored variant so the detailed render matches the preview
+	if req.SourceJobID != "" {
+		variant, source, err := vh.findRenderVariant(userID, req.SourceJobID, req.VariantIndex)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		seed := variant.Seed
+		req.Seed = &seed
+		req.Variants = 1
+		if req.InputImage == "" {
+			req.InputImage, _ = source.Data["input_image"].(string)
+		}
+		if req.Style == "" {
+			req.Style, _ = source.Data["style"].(string)
+		}
+		if req.StyleReferenceID == "" {
+			req.StyleReferenceID, _ = source.Data["style_reference_id"].(string)
+			req.AmbianceOptionID, _ = source.Data["ambiance_option_id"].(string)
+			switch index := source.Data["palette_index"].(type) {
+			case int:
+				req.PaletteIndex = index
+			case float64:
+				req.PaletteIndex = int(index)
+			}
+		}
+		if req.RoomType == "" {
+			req.RoomType, _ = source.Data["room_type"].(string)
+		}
+	}
+
+	if err := (&ai.RenderRequest{Variants: req.Variants, Seed: req.Seed}).Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if writeModerationError(w, vh.aiRenderer.ModerateText(userID, map[string]string{
+		"style":           req.Style,
+		"room_type":       req.RoomType,
+		"lighting":        req.Lighting,
+		"furniture_items": strings.Join(req.FurnitureItems, ", "),
+		"color_scheme":    strings.Join(req.ColorScheme, ", "),
+		"additional":      strings.Join(req.Additional, ", "),
+	})) {
+		return
+	}
+
 	job := &jobs.Job{
 		UserID:    userID,
 		ProjectID: req.ProjectID,
@@ -154,16 +310,26 @@ func (vh *VisualizationHandler) RenderDetailed(w http.ResponseWriter, r *http.Re
 		Data: map[string]interface{}{
 			"input_image":     req.InputImage,
 			"style":          req.Style,
+			"style_reference_id": req.StyleReferenceID,
+			"ambiance_option_id": req.AmbianceOptionID,
+			"palette_index":      req.PaletteIndex,
 			"room_type":      req.RoomType,
 			"furniture_items": req.FurnitureItems,
 			"color_scheme":   req.ColorScheme,
 			"lighting":       req.Lighting,
 			"additional":     req.Additional,
+			"variants":       req.Variants,
+			"seed":           req.Seed,
+			"source_job_id":  req.SourceJobID,
 			"parameters":     req.Parameters,
 		},
+		IdempotencyKey: r.Header.Get(idempotencyKeyHeader),
 	}
 
 	if err := vh.jobQueue.AddJob(job); err != nil {
+		if writeAddJobError(w, err) {
+			return
+		}
 		vh.logger.Error("Failed to add detailed render job", "error", err)
 		http.Error(w, "Failed to queue job", http.StatusInternalServerError)
 		return
@@ -171,7 +337,7 @@ func (vh *VisualizationHandler) RenderDetailed(w http.ResponseWriter, r *http.Re
 
 	response := map[string]interface{}{
 		"job_id":     job.ID,
-		"status":     "queued",
+		"status":     job.Status,
 		"message":    "Detailed AI rendering started",
 		"estimated_time": "10-30 seconds",
 	}
@@ -180,6 +346,243 @@ func (vh *VisualizationHandler) RenderDetailed(w http.ResponseWriter, r *http.Re
 	json.NewEncoder(w).Encode(response)
 }
 
+// findRenderVariant returns a variant of a completed render job owned by the user
+func (vh *VisualizationHandler) findRenderVariant(userID, jobID string, index int) (*ai.RenderVariant, *jobs.Job, error) {
+	source, exists := vh.jobQueue.GetJob(jobID)
+	if !exists || source.UserID != userID {
+		return nil, nil, fmt.Errorf("source job not found: %s", jobID)
+	}
+
+	result, ok := source.Result.(*ai.RenderResult)
+	if source.Status != jobs.JobStatusCompleted || !ok {
+		return nil, nil, fmt.Errorf("source job has no completed render")
+	}
+
+	for i := range result.Variants {
+		if result.Variants[i].Index == index {
+			return &result.Variants[i], source, nil
+		}
+	}
+
+	return nil, nil, fmt.Errorf("variant %d not found in job %s", index, jobID)
+}
+
+// RenderUpscale handles super-resolution upscaling of a completed render
+func (vh *VisualizationHandler) RenderUpscale(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "User ID required", http.StatusUnauthorized)
+		return
+	}
+
+	var req UpscaleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.SourceJobID == "" {
+		http.Error(w, "source_job_id is required", http.StatusBadRequest)
+		return
+	}
+
+	imageURL, imageHash, source, err := vh.findRenderImage(userID, req.SourceJobID, req.VariantIndex)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	upscale := &ai.UpscaleRequest{SourceImage: imageURL, Scale: req.Scale}
+	if err := upscale.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.ProjectID == "" {
+		req.ProjectID = source.ProjectID
+	}
+
+	job := &jobs.Job{
+		UserID:    userID,
+		ProjectID: req.ProjectID,
+		Type:      jobs.JobTypeUpscale,
+		Data: map[string]interface{}{
+			"source_job_id":  req.SourceJobID,
+			"source_variant": req.VariantIndex,
+			"source_image":   imageURL,
+			"source_hash":    imageHash,
+			"scale":          req.Scale,
+		},
+		IdempotencyKey: r.Header.Get(idempotencyKeyHeader),
+	}
+
+	if err := vh.jobQueue.AddJob(job); err != nil {
+		if writeAddJobError(w, err) {
+			return
+		}
+		vh.logger.Error("Failed to add upscale job", "error", err)
+		http.Error(w, "Failed to queue job", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"job_id":         job.ID,
+		"status":         job.Status,
+		"message":        "Upscaling started",
+		"estimated_time": "10-60 seconds",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ComposeDesign handles before/after presentation images of completed renders
+func (vh *VisualizationHandler) ComposeDesign(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "User ID required", http.StatusUnauthorized)
+		return
+	}
+
+	var req ComposeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Renders) == 0 {
+		http.Error(w, "renders is required", http.StatusBadRequest)
+		return
+	}
+
+	compose := &ai.ComposeRequest{
+		OriginalImage:   req.OriginalImage,
+		OriginalCaption: req.OriginalCaption,
+		Layout:          ai.ComposeLayout(req.Layout),
+		Aspect:          req.Aspect,
+		Format:          req.Format,
+		Captions:        req.Captions,
+		StyleName:       req.StyleName,
+		CostTotal:       req.CostTotal,
+		Currency:        req.Currency,
+		Watermark:       req.Watermark,
+		SliderPosition:  req.SliderPosition,
+	}
+
+	var first *jobs.Job
+	for _, render := range req.Renders {
+		imageURL, imageHash, source, err := vh.findRenderImage(userID, render.SourceJobID, render.VariantIndex)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if first == nil {
+			first = source
+		}
+		compose.Renders = append(compose.Renders, ai.ComposeSource{
+			ImageURL:      imageURL,
+			Caption:       render.Caption,
+			SourceJobID:   render.SourceJobID,
+			SourceVariant: render.VariantIndex,
+			ImageHash:     imageHash,
+		})
+	}
+
+	if compose.OriginalImage == "" {
+		compose.OriginalImage = renderInputImage(first)
+	}
+	if compose.StyleName == "" {
+		compose.StyleName = renderStyleName(first)
+	}
+	if err := compose.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.ProjectID == "" {
+		req.ProjectID = first.ProjectID
+	}
+
+	job := &jobs.Job{
+		UserID:    userID,
+		ProjectID: req.ProjectID,
+		Type:      jobs.JobTypeCompose,
+		Data: map[string]interface{}{
+			"composition": compose,
+		},
+		IdempotencyKey: r.Header.Get(idempotencyKeyHeader),
+	}
+
+	if err := vh.jobQueue.AddJob(job); err != nil {
+		if writeAddJobError(w, err) {
+			return
+		}
+		vh.logger.Error("Failed to add compose job", "error", err)
+		http.Error(w, "Failed to queue job", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"job_id":         job.ID,
+		"status":         job.Status,
+		"message":        "Composition started",
+		"estimated_time": "2-10 seconds",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// renderInputImage returns the image a render job started from
+func renderInputImage(job *jobs.Job) string {
+	for _, key := range []string{"input_image", "base_image", "content_image"} {
+		if input, ok := job.Data[key].(string); ok && input != "" {
+			return input
+		}
+	}
+	return ""
+}
+
+// renderStyleName returns the curated style name of a render job, or its style
+func renderStyleName(job *jobs.Job) string {
+	if result, ok := job.Result.(*ai.RenderResult); ok {
+		if reference, ok := result.Metadata["style_reference"].(map[string]interface{}); ok {
+			if name, ok := reference["name"].(string); ok && name != "" {
+				return name
+			}
+		}
+	}
+	style, _ := job.Data["style"].(string)
+	return style
+}
+
+// findRenderImage returns the image of a completed render job owned by the user:
+// the given variant, or the result image of renders without variants
+func (vh *VisualizationHandler) findRenderImage(userID, jobID string, index int) (string, string, *jobs.Job, error) {
+	source, exists := vh.jobQueue.GetJob(jobID)
+	if !exists || source.UserID != userID {
+		return "", "", nil, fmt.Errorf("source job not found: %s", jobID)
+	}
+
+	result, ok := source.Result.(*ai.RenderResult)
+	if source.Status != jobs.JobStatusCompleted || !ok {
+		return "", "", nil, fmt.Errorf("source job has no completed render")
+	}
+
+	if len(result.Variants) == 0 {
+		if index != 0 || result.ResultImageURL == "" {
+			return "", "", nil, fmt.Errorf("variant %d not found in job %s", index, jobID)
+		}
+		return result.ResultImageURL, result.ImageHash, source, nil
+	}
+
+	variant, source, err := vh.findRenderVariant(userID, jobID, index)
+	if err != nil {
+		return "", "", nil, err
+	}
+	return variant.ImageURL, variant.ImageHash, source, nil
+}
+
 // Generate3DModel handles 3D model generation requests
 func (vh *VisualizationHandler) Generate3DModel(w http.ResponseWriter, r *http.Request) {
 	userID := r.Header.Get("X-User-ID")
@@ -205,9 +608,13 @@ func (vh *VisualizationHandler) Generate3DModel(w http.ResponseWriter, r *http.R
 			"materials":  req.Materials,
 			"parameters": req.Parameters,
 		},
+		IdempotencyKey: r.Header.Get(idempotencyKeyHeader),
 	}
 
 	if err := vh.jobQueue.AddJob(job); err != nil {
+		if writeAddJobError(w, err) {
+			return
+		}
 		vh.logger.Error("Failed to add 3D modeling job", "error", err)
 		http.Error(w, "Failed to queue job", http.StatusInternalServerError)
 		return
@@ -215,7 +622,7 @@ func (vh *VisualizationHandler) Generate3DModel(w http.ResponseWriter, r *http.R
 
 	response := map[string]interface{}{
 		"job_id":     job.ID,
-		"status":     "queued",
+		"status":     job.Status,
 		"message":    "3D model generation started",
 		"estimated_time": "30-60 seconds",
 	}
@@ -224,6 +631,140 @@ func (vh *VisualizationHandler) Generate3DModel(w http.ResponseWriter, r *http.R
 	json.NewEncoder(w).Encode(response)
 }
 
+// SubmitDesignPackage queues a detailed render, a 3D model using the render as
+// reference and a floor plan export of the model. Each step starts once the
+// previous one completed; a failed step cancels the rest.
+func (vh *VisualizationHandler) SubmitDesignPackage(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "User ID required", http.StatusUnauthorized)
+		return
+	}
+
+	var req DesignPackageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Room == nil {
+		http.Error(w, "Room dimensions required", http.StatusBadRequest)
+		return
+	}
+	if req.ExportFormat == "" {
+		req.ExportFormat = "pdf"
+	}
+
+	if writeModerationError(w, vh.aiRenderer.ModerateText(userID, map[string]string{
+		"style":           req.Style,
+		"room_type":       req.RoomType,
+		"lighting":        req.Lighting,
+		"furniture_items": strings.Join(req.FurnitureItems, ", "),
+		"color_scheme":    strings.Join(req.ColorScheme, ", "),
+	})) {
+		return
+	}
+
+	pipeline := &jobs.Pipeline{
+		UserID:         userID,
+		ProjectID:      req.ProjectID,
+		IdempotencyKey: r.Header.Get(idempotencyKeyHeader),
+		Steps: []jobs.PipelineStep{
+			{
+				Name: "render",
+				Type: jobs.JobTypeAIDetailed,
+				Data: map[string]interface{}{
+					"input_image":        req.InputImage,
+					"style":              req.Style,
+					"style_reference_id": req.StyleReferenceID,
+					"ambiance_option_id": req.AmbianceOptionID,
+					"palette_index":      req.PaletteIndex,
+					"room_type":          req.RoomType,
+					"furniture_items":    req.FurnitureItems,
+					"color_scheme":       req.ColorScheme,
+					"lighting":           req.Lighting,
+					"variants":           1,
+					"seed":               req.Seed,
+				},
+			},
+			{
+				Name: "model",
+				Type: jobs.JobType3DModel,
+				Data: map[string]interface{}{
+					"room":       req.Room,
+					"furniture":  req.Furniture,
+					"lights":     req.Lights,
+					"materials":  req.Materials,
+					"parameters": req.ModelParameters,
+				},
+				DependsOn: []string{"render"},
+				Inputs:    []jobs.InputMapping{{From: "render", Field: "result_image_url", To: "reference_image"}},
+			},
+			{
+				Name: "floor_plan",
+				Type: jobs.JobTypeExport,
+				Data: map[string]interface{}{
+					"format":  req.ExportFormat,
+					"drawing": "floor_plan",
+				},
+				DependsOn: []string{"model"},
+				Inputs:    []jobs.InputMapping{{From: "model", Field: "model_url", To: "model_url"}},
+			},
+		},
+	}
+
+	pipelineJobs, err := vh.jobQueue.SubmitPipeline(pipeline)
+	if err != nil {
+		if writeAddJobError(w, err) {
+			return
+		}
+		vh.logger.Error("Failed to add design package pipeline", "error", err)
+		http.Error(w, "Failed to queue pipeline", http.StatusInternalServerError)
+		return
+	}
+
+	steps := make(map[string]string, len(pipelineJobs))
+	for _, job := range pipelineJobs {
+		steps[job.Pipeline.Step] = job.ID
+	}
+
+	response := map[string]interface{}{
+		"pipeline_id":    pipeline.ID,
+		"jobs":           steps,
+		"status":         "queued",
+		"message":        "Design package generation started",
+		"estimated_time": "1-3 minutes",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetPipelineStatus returns the aggregate status of a pipeline and its jobs
+func (vh *VisualizationHandler) GetPipelineStatus(w http.ResponseWriter, r *http.Request) {
+	pipelineID := mux.Vars(r)["id"]
+
+	status, err := vh.jobQueue.GetPipeline(r.Context(), pipelineID)
+	if errors.Is(err, jobs.ErrJobNotFound) {
+		http.Error(w, "Pipeline not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		vh.logger.Error("Failed to load pipeline", "pipeline_id", pipelineID, "error", err)
+		http.Error(w, "Failed to load pipeline", http.StatusInternalServerError)
+		return
+	}
+
+	// Check if user owns this pipeline
+	if status.UserID != r.Header.Get("X-User-ID") {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
 // RenderInpainting handles AI inpainting requests
 func (vh *VisualizationHandler) RenderInpainting(w http.ResponseWriter, r *http.Request) {
 	userID := r.Header.Get("X-User-ID")
@@ -238,6 +779,32 @@ func (vh *VisualizationHandler) RenderInpainting(w http.ResponseWriter, r *http.
 		return
 	}
 
+	// Without an uploaded mask one is generated from the spec; a furniture
+	// reference also supplies the base image
+	switch {
+	case req.MaskImage == "" && req.MaskSpec == nil:
+		http.Error(w, "mask_image or mask_spec is required", http.StatusBadRequest)
+		return
+	case req.MaskImage == "":
+		if err := req.MaskSpec.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.BaseImage == "" && req.MaskSpec.SpaceAnalysisID == "" {
+			http.Error(w, "base_image is required", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if writeModerationError(w, vh.aiRenderer.ModerateText(userID, map[string]string{
+		"prompt":          req.Prompt,
+		"negative_prompt": req.NegativePrompt,
+		"furniture_type":  req.FurnitureType,
+		"style":           req.Style,
+	})) {
+		return
+	}
+
 	job := &jobs.Job{
 		UserID:    userID,
 		ProjectID: req.ProjectID,
@@ -246,14 +813,26 @@ func (vh *VisualizationHandler) RenderInpainting(w http.ResponseWriter, r *http.
 			"base_image":      req.BaseImage,
 			"mask_image":      req.MaskImage,
 			"prompt":          req.Prompt,
+			"furniture_type":  req.FurnitureType,
+			"style":           req.Style,
+			"style_reference_id": req.StyleReferenceID,
+			"ambiance_option_id": req.AmbianceOptionID,
+			"palette_index":      req.PaletteIndex,
 			"negative_prompt": req.NegativePrompt,
 			"strength":        req.Strength,
 			"guidance_scale":  req.GuidanceScale,
 			"steps":           req.Steps,
 		},
+		IdempotencyKey: r.Header.Get(idempotencyKeyHeader),
+	}
+	if req.MaskSpec != nil {
+		job.Data["mask_spec"] = req.MaskSpec
 	}
 
 	if err := vh.jobQueue.AddJob(job); err != nil {
+		if writeAddJobError(w, err) {
+			return
+		}
 		vh.logger.Error("Failed to add inpainting job", "error", err)
 		http.Error(w, "Failed to queue job", http.StatusInternalServerError)
 		return
@@ -261,7 +840,7 @@ func (vh *VisualizationHandler) RenderInpainting(w http.ResponseWriter, r *http.
 
 	response := map[string]interface{}{
 		"job_id":     job.ID,
-		"status":     "queued",
+		"status":     job.Status,
 		"message":    "Inpainting started",
 		"estimated_time": "15-30 seconds",
 	}
@@ -270,6 +849,46 @@ func (vh *VisualizationHandler) RenderInpainting(w http.ResponseWriter, r *http.
 	json.NewEncoder(w).Encode(response)
 }
 
+// GenerateMaskRequest represents a request to preview an automatic inpainting mask
+type GenerateMaskRequest struct {
+	BaseImage string      `json:"base_image,omitempty"`
+	MaskSpec  ai.MaskSpec `json:"mask_spec"`
+}
+
+// GenerateMask builds an inpainting mask so the app can show it before rendering
+func (vh *VisualizationHandler) GenerateMask(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "User ID required", http.StatusUnauthorized)
+		return
+	}
+
+	var req GenerateMaskRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := req.MaskSpec.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mask, err := vh.aiRenderer.GenerateMask(r.Context(), req.BaseImage, &req.MaskSpec)
+	if err != nil {
+		if errors.Is(err, ai.ErrMaskRegionTooLarge) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		vh.logger.Error("Failed to generate mask", "error", err)
+		http.Error(w, "Failed to generate mask", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mask)
+}
+
 // RenderStyleTransfer handles style transfer requests
 func (vh *VisualizationHandler) RenderStyleTransfer(w http.ResponseWriter, r *http.Request) {
 	userID := r.Header.Get("X-User-ID")
@@ -284,6 +903,10 @@ func (vh *VisualizationHandler) RenderStyleTransfer(w http.ResponseWriter, r *ht
 		return
 	}
 
+	if writeModerationError(w, vh.aiRenderer.ModerateText(userID, map[string]string{"style": req.Style})) {
+		return
+	}
+
 	job := &jobs.Job{
 		UserID:    userID,
 		ProjectID: req.ProjectID,
@@ -291,11 +914,18 @@ func (vh *VisualizationHandler) RenderStyleTransfer(w http.ResponseWriter, r *ht
 		Data: map[string]interface{}{
 			"content_image": req.ContentImage,
 			"style":         req.Style,
+			"style_reference_id": req.StyleReferenceID,
+			"ambiance_option_id": req.AmbianceOptionID,
+			"palette_index":      req.PaletteIndex,
 			"strength":      req.Strength,
 		},
+		IdempotencyKey: r.Header.Get(idempotencyKeyHeader),
 	}
 
 	if err := vh.jobQueue.AddJob(job); err != nil {
+		if writeAddJobError(w, err) {
+			return
+		}
 		vh.logger.Error("Failed to add style transfer job", "error", err)
 		http.Error(w, "Failed to queue job", http.StatusInternalServerError)
 		return
@@ -303,7 +933,7 @@ func (vh *VisualizationHandler) RenderStyleTransfer(w http.ResponseWriter, r *ht
 
 	response := map[string]interface{}{
 		"job_id":     job.ID,
-		"status":     "queued",
+		"status":     job.Status,
 		"message":    "Style transfer started",
 		"estimated_time": "15-25 seconds",
 	}
@@ -312,6 +942,20 @@ func (vh *VisualizationHandler) RenderStyleTransfer(w http.ResponseWriter, r *ht
 	json.NewEncoder(w).Encode(response)
 }
 
+// GetJobSchema returns the JSON schema of a job type's payload
+func (vh *VisualizationHandler) GetJobSchema(w http.ResponseWriter, r *http.Request) {
+	jobType := jobs.JobType(mux.Vars(r)["type"])
+
+	schema, ok := jobs.PayloadSchema(jobType)
+	if !ok {
+		http.Error(w, "Unknown job type", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/schema+json")
+	json.NewEncoder(w).Encode(schema)
+}
+
 // GetJobStatus returns the status of a specific job
 func (vh *VisualizationHandler) GetJobStatus(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -331,10 +975,20 @@ func (vh *VisualizationHandler) GetJobStatus(w http.ResponseWriter, r *http.Requ
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+
+	// Queued jobs also report where they stand in the queue
+	if position, ok := vh.jobQueue.QueuePosition(jobID); ok && job.Status == jobs.JobStatusQueued {
+		json.NewEncoder(w).Encode(struct {
+			*jobs.Job
+			*jobs.QueuePosition
+		}{job, position})
+		return
+	}
 	json.NewEncoder(w).Encode(job)
 }
 
-// GetUserJobs returns all jobs for the authenticated user
+// GetUserJobs returns the job history of the authenticated user, newest first.
+// Pages run across recent and archived jobs.
 func (vh *VisualizationHandler) GetUserJobs(w http.ResponseWriter, r *http.Request) {
 	userID := r.Header.Get("X-User-ID")
 	if userID == "" {
@@ -343,37 +997,40 @@ func (vh *VisualizationHandler) GetUserJobs(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Parse query parameters
-	status := r.URL.Query().Get("status")
-	limitStr := r.URL.Query().Get("limit")
-	
+	query := r.URL.Query()
 	limit := 50 // Default limit
-	if limitStr != "" {
+	if limitStr := query.Get("limit"); limitStr != "" {
 		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
 			limit = l
 		}
 	}
 
-	jobs := vh.jobQueue.GetUserJobs(userID)
-
-	// Filter by status if specified
-	if status != "" {
-		filteredJobs := make([]*jobs.Job, 0)
-		for _, job := range jobs {
-			if string(job.Status) == status {
-				filteredJobs = append(filteredJobs, job)
-			}
-		}
-		jobs = filteredJobs
+	filter := jobs.JobFilter{
+		UserID:    userID,
+		ProjectID: query.Get("project_id"),
+		Limit:     limit,
+	}
+	if offset, err := strconv.Atoi(query.Get("offset")); err == nil && offset > 0 {
+		filter.Offset = offset
+	}
+	if status := query.Get("status"); status != "" {
+		filter.Statuses = []jobs.JobStatus{jobs.JobStatus(status)}
+	}
+	if jobType := query.Get("type"); jobType != "" {
+		filter.Types = []jobs.JobType{jobs.JobType(jobType)}
 	}
 
-	// Apply limit
-	if len(jobs) > limit {
-		jobs = jobs[:limit]
+	userJobs, err := vh.jobQueue.ListJobs(r.Context(), filter)
+	if err != nil {
+		vh.logger.Error("Failed to list jobs", "user_id", userID, "error", err)
+		http.Error(w, "Failed to list jobs", http.StatusInternalServerError)
+		return
 	}
 
 	response := map[string]interface{}{
-		"jobs":  jobs,
-		"count": len(jobs),
+		"jobs":   userJobs,
+		"count":  len(userJobs),
+		"offset": filter.Offset,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -435,20 +1092,275 @@ func (vh *VisualizationHandler) HandleWebSocket(w http.ResponseWriter, r *http.R
 	}
 }
 
+// HandleReplicateWebhook receives prediction completion callbacks from Replicate
+func (vh *VisualizationHandler) HandleReplicateWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := vh.aiRenderer.HandleWebhook(r.Header, body); err != nil {
+		vh.logger.Error("Rejected prediction webhook", "error", err)
+
+		switch {
+		case errors.Is(err, ai.ErrInvalidWebhookSignature):
+			http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		case errors.Is(err, ai.ErrWebhooksDisabled):
+			http.Error(w, "Webhooks not configured", http.StatusNotFound)
+		default:
+			http.Error(w, "Invalid webhook", http.StatusBadRequest)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetUsage returns the authenticated user's AI usage and credit balance.
+// The period defaults to the current month and can be set with from/to (RFC 3339).
+func (vh *VisualizationHandler) GetUsage(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "User ID required", http.StatusUnauthorized)
+		return
+	}
+
+	meter := vh.jobQueue.Meter()
+	if meter == nil {
+		http.Error(w, "Usage metering not enabled", http.StatusNotFound)
+		return
+	}
+
+	from, to, err := usagePeriod(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := meter.UserReport(r.Context(), userID, from, to)
+	if err != nil {
+		vh.logger.Error("Failed to build usage report", "user_id", userID, "error", err)
+		http.Error(w, "Failed to get usage", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// GetProjectUsage returns the authenticated user's AI usage for one project
+func (vh *VisualizationHandler) GetProjectUsage(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "User ID required", http.StatusUnauthorized)
+		return
+	}
+
+	meter := vh.jobQueue.Meter()
+	if meter == nil {
+		http.Error(w, "Usage metering not enabled", http.StatusNotFound)
+		return
+	}
+
+	from, to, err := usagePeriod(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	projectID := mux.Vars(r)["id"]
+	report, err := meter.ProjectReport(r.Context(), userID, projectID, from, to)
+	if err != nil {
+		vh.logger.Error("Failed to build project usage report", "project_id", projectID, "error", err)
+		http.Error(w, "Failed to get usage", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// usagePeriod parses the from/to query parameters, defaulting to the current month
+func usagePeriod(r *http.Request) (time.Time, time.Time, error) {
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid from: %w", err)
+		}
+		from = t
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid to: %w", err)
+		}
+		to = t
+	}
+
+	if !to.After(from) {
+		return from, to, fmt.Errorf("to must be after from")
+	}
+
+	return from, to, nil
+}
+
+// writeAddJobError responds to the errors AddJob returns for a rejected job
+// and reports whether it did; other errors are left to the caller
+func writeAddJobError(w http.ResponseWriter, err error) bool {
+	return writeQuotaError(w, err) ||
+		writeIdempotencyError(w, err) ||
+		writePayloadError(w, err) ||
+		writeDrainingError(w, err)
+}
+
+// writeIdempotencyError responds with 409 when err is an idempotency key conflict,
+// or 400 for an invalid key, and reports whether it did
+func writeIdempotencyError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, jobs.ErrIdempotencyConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, jobs.ErrInvalidIdempotencyKey):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		return false
+	}
+	return true
+}
+
+// writePayloadError responds with 400 when err reports job data that does not
+// match its payload schema, and reports whether it did
+func writePayloadError(w http.ResponseWriter, err error) bool {
+	var payloadErr *jobs.PayloadError
+	if !errors.As(err, &payloadErr) {
+		return false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":    "Invalid job payload",
+		"code":     "invalid_payload",
+		"job_type": payloadErr.Type,
+		"message":  payloadErr.Err.Error(),
+	})
+	return true
+}
+
+// writeDrainingError responds with 503 when err reports that the job queue is
+// shutting down, and reports whether it did
+func writeDrainingError(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, jobs.ErrQueueDraining) {
+		return false
+	}
+
+	w.Header().Set("Retry-After", "5")
+	http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	return true
+}
+
+// writeQuotaError responds with 402 when err is a quota error and reports whether it did
+func writeQuotaError(w http.ResponseWriter, err error) bool {
+	var quotaErr *metering.QuotaError
+	if !errors.As(err, &quotaErr) {
+		return false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusPaymentRequired)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":     "Insufficient credits",
+		"code":      quotaErr.Code,
+		"required":  quotaErr.Required,
+		"available": quotaErr.Available,
+	})
+	return true
+}
+
+// writeModerationError reports input rejected by content moderation. It returns
+// false when err is not a moderation error.
+func writeModerationError(w http.ResponseWriter, err error) bool {
+	var modErr *ai.ModerationError
+	if !errors.As(err, &modErr) {
+		return false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":  "Content rejected by moderation",
+		"code":   "content_moderation",
+		"field":  modErr.Field,
+		"reason": modErr.Reason,
+	})
+	return true
+}
+
+// GetReadiness reports whether this instance takes new jobs. It responds with
+// 503 once the job queue began draining, so load balancers stop routing to it.
+func (vh *VisualizationHandler) GetReadiness(w http.ResponseWriter, r *http.Request) {
+	state := vh.jobQueue.State()
+	ready := state == jobs.QueueStateRunning
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ready":     ready,
+		"job_queue": state,
+	})
+}
+
 // GetSystemStatus returns system status and statistics
 func (vh *VisualizationHandler) GetSystemStatus(w http.ResponseWriter, r *http.Request) {
 	// This could include queue length, processing times, etc.
+	services := map[string]string{
+		"ai_renderer":  "operational",
+		"3d_modeling":  "operational",
+		"job_queue":    "operational",
+	}
 	status := map[string]interface{}{
 		"timestamp": time.Now(),
 		"websocket": map[string]int{
 			"active_connections": vh.notifier.GetActiveConnections(),
 			"connected_users":    vh.notifier.GetConnectedUsers(),
 		},
-		"services": map[string]string{
-			"ai_renderer":  "operational",
-			"3d_modeling":  "operational",
-			"job_queue":    "operational",
-		},
+		"services":  services,
+		"job_queue": vh.jobQueue.SchedulerStats(),
+	}
+
+	if state := vh.jobQueue.State(); state != jobs.QueueStateRunning {
+		services["job_queue"] = string(state)
+	}
+
+	// With a shared broker, jobs run on the worker processes reporting heartbeats
+	if broker, err := vh.jobQueue.BrokerStatus(r.Context()); err != nil {
+		vh.logger.Error("Failed to load job broker status", "error", err)
+		services["job_queue"] = "degraded"
+	} else if broker != nil {
+		status["job_broker"] = broker
+		if len(broker.Workers) == 0 && services["job_queue"] == "operational" {
+			services["job_queue"] = "degraded"
+		}
+	}
+
+	if vh.aiRenderer != nil {
+		status["ai_cache"] = vh.aiRenderer.CacheStats()
+
+		// Any model with an open circuit degrades rendering for requests using it
+		providers := vh.aiRenderer.ProviderStatus()
+		status["ai_provider"] = providers
+		for _, breaker := range providers.Breakers {
+			if breaker.State != ai.BreakerClosed {
+				services["ai_renderer"] = "degraded"
+				break
+			}
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,52 @@
+package routes
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+
+	"github.com/compozit/vision/backend/internal/api/handlers"
+	"github.com/compozit/vision/backend/internal/application/jobs"
+	"github.com/compozit/vision/backend/pkg/logger"
+	"github.com/gorilla/mux"
+)
+
+// SetupJobAdminRoutes sets up the operator endpoints of the job queue. They are
+// authenticated by the JOB_ADMIN_TOKEN environment variable, sent in the
+// X-Admin-Token header, and disabled when it is not set.
+func SetupJobAdminRoutes(r *mux.Router, jobQueue *jobs.Queue, logger logger.Logger) {
+	token := os.Getenv("JOB_ADMIN_TOKEN")
+	if token == "" {
+		logger.Warn("JOB_ADMIN_TOKEN not set, job admin routes disabled")
+		return
+	}
+
+	adminHandler := handlers.NewJobAdminHandler(jobQueue, logger)
+
+	adminRouter := r.PathPrefix("/api/v1/admin/jobs").Subrouter()
+	adminRouter.Use(requireAdminToken(token))
+
+	// Dead-lettered jobs: inspect, edit, requeue and discard
+	deadLetterRouter := adminRouter.PathPrefix("/dead-letters").Subrouter()
+	deadLetterRouter.HandleFunc("", adminHandler.ListDeadLetters).Methods("GET")
+	deadLetterRouter.HandleFunc("/{id}", adminHandler.GetDeadLetter).Methods("GET")
+	deadLetterRouter.HandleFunc("/{id}", adminHandler.UpdateDeadLetter).Methods("PATCH")
+	deadLetterRouter.HandleFunc("/{id}", adminHandler.DeleteDeadLetter).Methods("DELETE")
+	deadLetterRouter.HandleFunc("/{id}/requeue", adminHandler.RequeueDeadLetter).Methods("POST")
+
+	logger.Info("Job admin routes initialized successfully")
+}
+
+// requireAdminToken rejects requests without the admin token
+func requireAdminToken(token string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			provided := r.Header.Get("X-Admin-Token")
+			if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -13,8 +13,8 @@ import (
 
 // SetupVisualizationRoutes sets up all visualization-related API routes
 func SetupVisualizationRoutes(r *mux.Router, jobQueue *jobs.Queue, aiRenderer *ai.Renderer, modelGen *modeling.Generator, logger logger.Logger) {
-	// Create WebSocket notifier for real-time updates
-	notifier := jobs.NewWebSocketNotifier(logger)
+	// WebSocket clients connect to the queue's notifier, which sends the job events
+	notifier := jobQueue.Notifier()
 	
 	// Initialize the visualization handler
 	vizHandler := handlers.NewVisualizationHandler(jobQueue, aiRenderer, modelGen, logger, notifier)
@@ -33,6 +33,15 @@ func SetupVisualizationRoutes(r *mux.Router, jobQueue *jobs.Queue, aiRenderer *a
 	
 	// AI inpainting for furniture placement
 	aiRouter.HandleFunc("/render/inpainting", vizHandler.RenderInpainting).Methods("POST")
+
+	// Super-resolution upscaling of a stored render
+	aiRouter.HandleFunc("/render/upscale", vizHandler.RenderUpscale).Methods("POST")
+
+	// Before/after presentation images of stored renders
+	aiRouter.HandleFunc("/compose", vizHandler.ComposeDesign).Methods("POST")
+
+	// Automatic inpainting mask preview
+	aiRouter.HandleFunc("/masks", vizHandler.GenerateMask).Methods("POST")
 	
 	// AI style transfer
 	aiRouter.HandleFunc("/render/style-transfer", vizHandler.RenderStyleTransfer).Methods("POST")
@@ -79,6 +88,9 @@ func SetupVisualizationRoutes(r *mux.Router, jobQueue *jobs.Queue, aiRenderer *a
 
 	// Job management endpoints
 	jobsRouter := vizRouter.PathPrefix("/jobs").Subrouter()
+
+	// Payload schema of a job type
+	jobsRouter.HandleFunc("/schemas/{type}", vizHandler.GetJobSchema).Methods("GET")
 	
 	// Get specific job status
 	jobsRouter.HandleFunc("/{id}", vizHandler.GetJobStatus).Methods("GET")
@@ -89,12 +101,31 @@ func SetupVisualizationRoutes(r *mux.Router, jobQueue *jobs.Queue, aiRenderer *a
 	// Get all user jobs
 	jobsRouter.HandleFunc("", vizHandler.GetUserJobs).Methods("GET")
 
+	// Multi-step pipelines
+	vizRouter.HandleFunc("/pipelines/design-package", vizHandler.SubmitDesignPackage).Methods("POST")
+	vizRouter.HandleFunc("/pipelines/{id}", vizHandler.GetPipelineStatus).Methods("GET")
+
+	// Provider webhooks (authenticated by signature, not by user)
+	vizRouter.HandleFunc("/webhooks/replicate", vizHandler.HandleReplicateWebhook).Methods("POST")
+
+	// AI usage and credit balance
+	vizRouter.HandleFunc("/usage", vizHandler.GetUsage).Methods("GET")
+	vizRouter.HandleFunc("/usage/projects/{id}", vizHandler.GetProjectUsage).Methods("GET")
+
+	// Stored render images, when the storage backend does not serve its own URLs
+	if assets := aiRenderer.AssetHandler(); assets != nil {
+		vizRouter.PathPrefix("/assets/").Handler(http.StripPrefix("/api/v1/visualization/assets/", assets)).Methods("GET", "HEAD")
+	}
+
 	// WebSocket endpoint for real-time updates
 	vizRouter.HandleFunc("/ws", vizHandler.HandleWebSocket)
 	
 	// System status endpoint
 	vizRouter.HandleFunc("/status", vizHandler.GetSystemStatus).Methods("GET")
 
+	// Readiness endpoint; 503 while the job queue drains
+	vizRouter.HandleFunc("/ready", vizHandler.GetReadiness).Methods("GET")
+
 	// Scene management endpoints (for 3D scenes)
 	sceneRouter := vizRouter.PathPrefix("/scenes").Subrouter()
 	
@@ -141,5 +172,8 @@ func SetupVisualizationRoutes(r *mux.Router, jobQueue *jobs.Queue, aiRenderer *a
 		// Implementation for deleting result
 	}).Methods("DELETE")
 
+	// Operator endpoints of the job queue
+	SetupJobAdminRoutes(r, jobQueue, logger)
+
 	logger.Info("Visualization routes initialized successfully")
 }
\ No newline at end of file
@@ -0,0 +1,61 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+)
+
+// JobArchive keeps finished jobs moved out of the job store by retention, so
+// users can still page through their history. Archived jobs are read only.
+type JobArchive interface {
+	// Put adds an archived job, replacing any entry for the same job
+	Put(ctx context.Context, job *Job) error
+	// Get returns an archived job, or ErrJobNotFound
+	Get(ctx context.Context, jobID string) (*Job, error)
+	List(ctx context.Context, filter JobFilter) ([]*Job, error)
+}
+
+// MemoryJobArchive is an in-memory JobArchive for development and tests
+type MemoryJobArchive struct {
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+// NewMemoryJobArchive creates a new in-memory job archive
+func NewMemoryJobArchive() *MemoryJobArchive {
+	return &MemoryJobArchive{
+		jobs: make(map[string]*Job),
+	}
+}
+
+func (a *MemoryJobArchive) Put(ctx context.Context, job *Job) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.jobs[job.ID] = copyJob(job)
+	return nil
+}
+
+func (a *MemoryJobArchive) Get(ctx context.Context, jobID string) (*Job, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	job, exists := a.jobs[jobID]
+	if !exists {
+		return nil, ErrJobNotFound
+	}
+	return copyJob(job), nil
+}
+
+func (a *MemoryJobArchive) List(ctx context.Context, filter JobFilter) ([]*Job, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var jobs []*Job
+	for _, job := range a.jobs {
+		if filter.matches(job) {
+			jobs = append(jobs, copyJob(job))
+		}
+	}
+	return filter.page(jobs), nil
+}
@@ -0,0 +1,412 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltJobsBucket holds every job keyed by ID
+var boltJobsBucket = []byte("jobs")
+
+// boltDeadLettersBucket holds the dead letters keyed by job ID
+var boltDeadLettersBucket = []byte("dead_letters")
+
+// boltIdempotencyBucket holds the idempotency records keyed by user and key
+var boltIdempotencyBucket = []byte("idempotency_keys")
+
+// boltArchiveBucket holds the archived jobs keyed by ID
+var boltArchiveBucket = []byte("archived_jobs")
+
+// BoltJobStore persists jobs in an embedded BoltDB file, for single-node
+// deployments without Postgres
+type BoltJobStore struct {
+	db *bolt.DB
+}
+
+// NewBoltJobStore opens or creates the job database at path
+func NewBoltJobStore(path string) (*BoltJobStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open job database: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{boltJobsBucket, boltDeadLettersBucket, boltIdempotencyBucket, boltArchiveBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialise job database: %w", err)
+	}
+
+	return &BoltJobStore{db: db}, nil
+}
+
+// Close closes the job database
+func (s *BoltJobStore) Close() error {
+	return s.db.Close()
+}
+
+// getBoltJob reads a job within a transaction
+func getBoltJob(bucket *bolt.Bucket, jobID string) (*Job, error) {
+	data := bucket.Get([]byte(jobID))
+	if data == nil {
+		return nil, ErrJobNotFound
+	}
+	return decodeJob(data)
+}
+
+// putBoltJob writes a job within a transaction
+func putBoltJob(bucket *bolt.Bucket, job *Job) error {
+	data, err := encodeJob(job)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(job.ID), data)
+}
+
+// modify applies fn to a stored job and writes it back when fn returns true
+func (s *BoltJobStore) modify(jobID string, fn func(job *Job) (bool, error)) (*Job, error) {
+	var modified *Job
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltJobsBucket)
+		job, err := getBoltJob(bucket, jobID)
+		if err != nil {
+			return err
+		}
+
+		changed, err := fn(job)
+		if err != nil || !changed {
+			return err
+		}
+
+		modified = job
+		return putBoltJob(bucket, job)
+	})
+	return modified, err
+}
+
+func (s *BoltJobStore) Create(ctx context.Context, job *Job) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltJobsBucket)
+		if bucket.Get([]byte(job.ID)) != nil {
+			return fmt.Errorf("job already exists: %s", job.ID)
+		}
+		return putBoltJob(bucket, job)
+	})
+}
+
+func (s *BoltJobStore) Get(ctx context.Context, jobID string) (*Job, error) {
+	var job *Job
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		job, err = getBoltJob(tx.Bucket(boltJobsBucket), jobID)
+		return err
+	})
+	return job, err
+}
+
+func (s *BoltJobStore) Update(ctx context.Context, job *Job) error {
+	_, err := s.modify(job.ID, func(stored *Job) (bool, error) {
+		workerID, lease := stored.WorkerID, stored.LeaseExpiresAt
+		*stored = *job
+		stored.WorkerID, stored.LeaseExpiresAt = workerID, lease
+		return true, nil
+	})
+	return err
+}
+
+func (s *BoltJobStore) Delete(ctx context.Context, jobID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltJobsBucket).Delete([]byte(jobID))
+	})
+}
+
+func (s *BoltJobStore) List(ctx context.Context, filter JobFilter) ([]*Job, error) {
+	var jobs []*Job
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltJobsBucket).ForEach(func(key, data []byte) error {
+			job, err := decodeJob(data)
+			if err != nil {
+				return err
+			}
+			if filter.matches(job) {
+				jobs = append(jobs, job)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return filter.page(jobs), nil
+}
+
+func (s *BoltJobStore) Claim(ctx context.Context, jobID, workerID string, lease time.Duration) (*Job, error) {
+	return s.modify(jobID, func(job *Job) (bool, error) {
+		if !claimJob(job, workerID, lease, time.Now()) {
+			return false, ErrJobNotClaimable
+		}
+		return true, nil
+	})
+}
+
+func (s *BoltJobStore) Heartbeat(ctx context.Context, jobID, workerID string, lease time.Duration) error {
+	_, err := s.modify(jobID, func(job *Job) (bool, error) {
+		if !extendLease(job, workerID, lease, time.Now()) {
+			return false, ErrLeaseLost
+		}
+		return true, nil
+	})
+	if err == ErrJobNotFound {
+		return ErrLeaseLost
+	}
+	return err
+}
+
+func (s *BoltJobStore) Release(ctx context.Context, jobID, workerID string) error {
+	_, err := s.modify(jobID, func(job *Job) (bool, error) {
+		if job.WorkerID != workerID {
+			return false, nil
+		}
+		job.WorkerID, job.LeaseExpiresAt = "", nil
+		return true, nil
+	})
+	if err == ErrJobNotFound {
+		return nil
+	}
+	return err
+}
+
+func (s *BoltJobStore) RecoverExpired(ctx context.Context, now time.Time) ([]*Job, error) {
+	var recovered []*Job
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltJobsBucket)
+
+		// Collect first; a bucket must not be modified while iterating it
+		var expired []*Job
+		err := bucket.ForEach(func(key, data []byte) error {
+			job, err := decodeJob(data)
+			if err != nil {
+				return err
+			}
+			if requeueExpired(job, now) {
+				expired = append(expired, job)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, job := range expired {
+			if err := putBoltJob(bucket, job); err != nil {
+				return err
+			}
+		}
+		recovered = expired
+		return nil
+	})
+	return recovered, err
+}
+
+func (s *BoltJobStore) Adopt(ctx context.Context, jobID, workerID string, lease time.Duration) (*Job, error) {
+	return s.modify(jobID, func(job *Job) (bool, error) {
+		if !adoptJob(job, workerID, lease, time.Now()) {
+			return false, ErrJobNotClaimable
+		}
+		return true, nil
+	})
+}
+
+// BoltDeadLetterStore keeps dead letters in the database file of a BoltJobStore
+type BoltDeadLetterStore struct {
+	db *bolt.DB
+}
+
+// NewBoltDeadLetterStore creates a dead-letter store sharing the job store's database
+func NewBoltDeadLetterStore(store *BoltJobStore) *BoltDeadLetterStore {
+	return &BoltDeadLetterStore{db: store.db}
+}
+
+func (s *BoltDeadLetterStore) Put(ctx context.Context, letter *DeadLetter) error {
+	data, err := encodeDeadLetter(letter)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltDeadLettersBucket).Put([]byte(letter.Job.ID), data)
+	})
+}
+
+func (s *BoltDeadLetterStore) Get(ctx context.Context, jobID string) (*DeadLetter, error) {
+	var letter *DeadLetter
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(boltDeadLettersBucket).Get([]byte(jobID))
+		if data == nil {
+			return ErrDeadLetterNotFound
+		}
+		var err error
+		letter, err = decodeDeadLetter(data)
+		return err
+	})
+	return letter, err
+}
+
+func (s *BoltDeadLetterStore) List(ctx context.Context, filter DeadLetterFilter) ([]*DeadLetter, error) {
+	var letters []*DeadLetter
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltDeadLettersBucket).ForEach(func(key, data []byte) error {
+			letter, err := decodeDeadLetter(data)
+			if err != nil {
+				return err
+			}
+			if filter.matches(letter) {
+				letters = append(letters, letter)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return filter.page(letters), nil
+}
+
+func (s *BoltDeadLetterStore) Delete(ctx context.Context, jobID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltDeadLettersBucket).Delete([]byte(jobID))
+	})
+}
+
+// BoltIdempotencyStore keeps idempotency keys in the database file of a BoltJobStore
+type BoltIdempotencyStore struct {
+	db *bolt.DB
+}
+
+// NewBoltIdempotencyStore creates an idempotency store sharing the job store's database
+func NewBoltIdempotencyStore(store *BoltJobStore) *BoltIdempotencyStore {
+	return &BoltIdempotencyStore{db: store.db}
+}
+
+func (s *BoltIdempotencyStore) Reserve(ctx context.Context, record *IdempotencyRecord, now time.Time) (*IdempotencyRecord, error) {
+	var existing *IdempotencyRecord
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltIdempotencyBucket)
+		id := []byte(idempotencyKey(record.UserID, record.Key))
+
+		if data := bucket.Get(id); data != nil {
+			var stored IdempotencyRecord
+			if err := json.Unmarshal(data, &stored); err != nil {
+				return fmt.Errorf("failed to decode idempotency record: %w", err)
+			}
+			if stored.ExpiresAt.After(now) {
+				existing = &stored
+				return nil
+			}
+		}
+
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(id, data)
+	})
+	return existing, err
+}
+
+func (s *BoltIdempotencyStore) Delete(ctx context.Context, userID, key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltIdempotencyBucket).Delete([]byte(idempotencyKey(userID, key)))
+	})
+}
+
+func (s *BoltIdempotencyStore) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	var deleted int
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltIdempotencyBucket)
+
+		// Collect first; a bucket must not be modified while iterating it
+		var expired [][]byte
+		err := bucket.ForEach(func(key, data []byte) error {
+			var record IdempotencyRecord
+			if err := json.Unmarshal(data, &record); err != nil {
+				return fmt.Errorf("failed to decode idempotency record: %w", err)
+			}
+			if !record.ExpiresAt.After(now) {
+				expired = append(expired, append([]byte(nil), key...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, key := range expired {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		deleted = len(expired)
+		return nil
+	})
+	return deleted, err
+}
+
+// BoltJobArchive keeps archived jobs in the database file of a BoltJobStore
+type BoltJobArchive struct {
+	db *bolt.DB
+}
+
+// NewBoltJobArchive creates a job archive sharing the job store's database
+func NewBoltJobArchive(store *BoltJobStore) *BoltJobArchive {
+	return &BoltJobArchive{db: store.db}
+}
+
+func (a *BoltJobArchive) Put(ctx context.Context, job *Job) error {
+	data, err := encodeJob(job)
+	if err != nil {
+		return err
+	}
+	return a.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltArchiveBucket).Put([]byte(job.ID), data)
+	})
+}
+
+func (a *BoltJobArchive) Get(ctx context.Context, jobID string) (*Job, error) {
+	var job *Job
+	err := a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		job, err = getBoltJob(tx.Bucket(boltArchiveBucket), jobID)
+		return err
+	})
+	return job, err
+}
+
+func (a *BoltJobArchive) List(ctx context.Context, filter JobFilter) ([]*Job, error) {
+	var jobs []*Job
+	err := a.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltArchiveBucket).ForEach(func(key, data []byte) error {
+			job, err := decodeJob(data)
+			if err != nil {
+				return err
+			}
+			if filter.matches(job) {
+				jobs = append(jobs, job)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return filter.page(jobs), nil
+}
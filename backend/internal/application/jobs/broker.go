@@ -0,0 +1,366 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Role is the part a queue plays among the processes sharing a broker
+type Role string
+
+const (
+	// RoleAll accepts jobs and runs them
+	RoleAll Role = "all"
+	// RoleEnqueue accepts jobs and leaves running them to worker processes,
+	// e.g. on API nodes without GPUs or Blender
+	RoleEnqueue Role = "enqueue"
+	// RoleWorker runs jobs read from the broker
+	RoleWorker Role = "worker"
+)
+
+// consumes reports whether a queue in this role runs jobs
+func (r Role) consumes() bool {
+	return r != RoleEnqueue
+}
+
+const (
+	// brokerBlock is how long a consumer waits for new deliveries per read
+	brokerBlock = 2 * time.Second
+
+	// brokerRetryInterval is how long a consumer backs off after the broker failed
+	// or while all of its workers are busy
+	brokerRetryInterval = 250 * time.Millisecond
+
+	// brokerReclaimCount bounds the deliveries taken over from other consumers at once
+	brokerReclaimCount = 100
+
+	// workerExpiry is how long a worker process is listed after its last heartbeat
+	workerExpiry = 3 * jobHeartbeatInterval
+)
+
+// Delivery is a queued job read from a broker. It stays pending with its consumer
+// until it is acknowledged; deliveries pending too long are reclaimed by others.
+type Delivery struct {
+	ID      string  `json:"id"`
+	JobID   string  `json:"job_id"`
+	JobType JobType `json:"job_type"`
+}
+
+// WorkerInfo is the heartbeat of a process consuming jobs from a broker
+type WorkerInfo struct {
+	ID        string     `json:"id"`
+	Role      Role       `json:"role"`
+	State     QueueState `json:"state"`
+	Types     []JobType  `json:"types"`
+	Workers   int        `json:"workers"`
+	Running   int        `json:"running"`
+	Queued    int        `json:"queued"`
+	StartedAt time.Time  `json:"started_at"`
+	LastSeen  time.Time  `json:"last_seen"`
+}
+
+// ConsumerStats describes one consumer of a job type's deliveries
+type ConsumerStats struct {
+	Name    string `json:"name"`
+	Pending int64  `json:"pending"`
+	// IdleSeconds is the time since the consumer last read or acknowledged
+	IdleSeconds float64 `json:"idle_seconds"`
+}
+
+// StreamStats describes the deliveries of one job type
+type StreamStats struct {
+	JobType JobType `json:"job_type"`
+	Group   string  `json:"group"`
+	// Length is the number of entries kept, including delivered ones
+	Length int64 `json:"length"`
+	// Pending counts deliveries read but not yet acknowledged
+	Pending int64 `json:"pending"`
+	// Lag counts entries not yet delivered, or -1 when unknown
+	Lag       int64           `json:"lag"`
+	Consumers []ConsumerStats `json:"consumers"`
+}
+
+// Broker carries queued jobs from the processes accepting them to the worker
+// processes running them. Jobs themselves stay in the shared JobStore; the
+// broker only delivers their IDs. A job may be delivered more than once, so
+// consumers claim it in the store before running it.
+type Broker interface {
+	// Publish announces a stored queued job to the consumers of its type
+	Publish(ctx context.Context, job *Job) error
+	// Consume reads up to count new deliveries of the given types, waiting up
+	// to block for one to arrive
+	Consume(ctx context.Context, consumer string, types []JobType, count int, block time.Duration) ([]Delivery, error)
+	// Ack removes a delivery from its consumer's pending entries
+	Ack(ctx context.Context, delivery Delivery) error
+	// Reclaim takes over deliveries of the given types left pending for at
+	// least minIdle, e.g. by a consumer that crashed
+	Reclaim(ctx context.Context, consumer string, types []JobType, minIdle time.Duration, count int) ([]Delivery, error)
+	// Heartbeat records that a worker process is alive
+	Heartbeat(ctx context.Context, worker WorkerInfo) error
+	// Workers lists the worker processes seen within workerExpiry
+	Workers(ctx context.Context) ([]WorkerInfo, error)
+	// Stats describes the deliveries of the given types
+	Stats(ctx context.Context, types []JobType) ([]StreamStats, error)
+}
+
+// BrokerStatus describes the broker a queue shares with other processes
+type BrokerStatus struct {
+	Role     Role          `json:"role"`
+	Consumer string        `json:"consumer"`
+	Types    []JobType     `json:"types,omitempty"`
+	Streams  []StreamStats `json:"streams"`
+	Workers  []WorkerInfo  `json:"workers"`
+}
+
+// ParseJobTypes parses a comma-separated list of job types, as given to worker
+// processes. An empty list selects every type.
+func ParseJobTypes(list string) ([]JobType, error) {
+	var types []JobType
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		jobType := JobType(name)
+		if _, ok := payloadSpecs[jobType]; !ok {
+			return nil, fmt.Errorf("unknown job type: %s", name)
+		}
+		types = append(types, jobType)
+	}
+	return types, nil
+}
+
+// SetBroker hands queued jobs to a broker shared with other processes instead
+// of this process's workers. The processes must share the job store too. role
+// decides whether this process also runs jobs from the broker; a consuming
+// process runs the given types, or every type when none are given. It must be
+// called before Start.
+func (q *Queue) SetBroker(broker Broker, role Role, types ...JobType) {
+	if len(types) == 0 {
+		types = PayloadTypes()
+	}
+	q.broker = broker
+	q.role = role
+	q.brokerTypes = types
+}
+
+// BrokerStatus describes the broker, its pending deliveries and the worker
+// processes alive. It returns nil when the queue runs jobs in process only.
+func (q *Queue) BrokerStatus(ctx context.Context) (*BrokerStatus, error) {
+	if q.broker == nil {
+		return nil, nil
+	}
+
+	streams, err := q.broker.Stats(ctx, PayloadTypes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load broker stats: %w", err)
+	}
+	workers, err := q.broker.Workers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load workers: %w", err)
+	}
+
+	status := &BrokerStatus{
+		Role:     q.role,
+		Consumer: q.instanceID,
+		Streams:  streams,
+		Workers:  workers,
+	}
+	if q.role.consumes() {
+		status.Types = q.brokerTypes
+	}
+	return status, nil
+}
+
+// startBroker starts consuming from the broker when this process runs jobs
+func (q *Queue) startBroker(ctx context.Context) {
+	if q.broker == nil || !q.role.consumes() {
+		return
+	}
+	q.startedAt = time.Now()
+	go q.consumeBroker(ctx)
+	go q.reclaimDeliveries(ctx)
+	go q.sendHeartbeats(ctx)
+}
+
+// consumeBroker reads deliveries into the scheduler while workers are free.
+// Reading no more than the free workers can start leaves the rest of the
+// backlog to other worker processes.
+func (q *Queue) consumeBroker(ctx context.Context) {
+	for ctx.Err() == nil && !q.scheduler.isClosed() {
+		queued, running := q.scheduler.load()
+		free := q.maxWorkers - queued - running
+		if free <= 0 {
+			sleepContext(ctx, brokerRetryInterval)
+			continue
+		}
+
+		deliveries, err := q.broker.Consume(ctx, q.instanceID, q.brokerTypes, free, brokerBlock)
+		if err != nil {
+			if ctx.Err() == nil {
+				q.logger.Error("Failed to read jobs from broker", "error", err)
+				sleepContext(ctx, brokerRetryInterval)
+			}
+			continue
+		}
+		for _, delivery := range deliveries {
+			q.acceptDelivery(ctx, delivery)
+		}
+	}
+}
+
+// reclaimDeliveries periodically takes over deliveries pending with consumers
+// that stopped, so their jobs are not stranded
+func (q *Queue) reclaimDeliveries(ctx context.Context) {
+	ticker := time.NewTicker(jobRecoveryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			q.reclaimPending(ctx, jobLeaseDuration)
+		}
+	}
+}
+
+// reclaimPending takes over the deliveries pending for at least minIdle
+func (q *Queue) reclaimPending(ctx context.Context, minIdle time.Duration) {
+	if q.draining.Load() {
+		return
+	}
+	deliveries, err := q.broker.Reclaim(ctx, q.instanceID, q.brokerTypes, minIdle, brokerReclaimCount)
+	if err != nil {
+		q.logger.Error("Failed to reclaim pending deliveries", "error", err)
+		return
+	}
+	for _, delivery := range deliveries {
+		q.logger.Warn("Reclaimed pending delivery", "job_id", delivery.JobID, "delivery_id", delivery.ID)
+		q.acceptDelivery(ctx, delivery)
+	}
+}
+
+// acceptDelivery schedules the job of a delivery, or acknowledges the delivery
+// right away when the job has nothing left to run here
+func (q *Queue) acceptDelivery(ctx context.Context, delivery Delivery) {
+	job, err := q.store.Get(ctx, delivery.JobID)
+	if err != nil && !errors.Is(err, ErrJobNotFound) {
+		// Left pending; it is reclaimed once the store is back
+		q.logger.Error("Failed to load delivered job", "job_id", delivery.JobID, "error", err)
+		return
+	}
+
+	switch {
+	case err != nil:
+		q.logger.Warn("Dropping delivery of unknown job", "job_id", delivery.JobID, "delivery_id", delivery.ID)
+		q.ackDelivery(ctx, delivery)
+		return
+	case job.Status != JobStatusQueued:
+		// Delivered twice, or cancelled before it ran
+		q.logger.Debug("Skipping delivery of job that is not queued", "job_id", job.ID, "status", job.Status)
+		q.ackDelivery(ctx, delivery)
+		return
+	case job.NextAttemptAt != nil && job.NextAttemptAt.After(time.Now()):
+		// A retry published early waits here and is published again when due
+		q.delayed.add(job, *job.NextAttemptAt)
+		q.ackDelivery(ctx, delivery)
+		return
+	}
+
+	q.deliveryMu.Lock()
+	_, duplicate := q.deliveries[job.ID]
+	if !duplicate {
+		q.deliveries[job.ID] = delivery
+	}
+	q.deliveryMu.Unlock()
+
+	if duplicate {
+		q.ackDelivery(ctx, delivery)
+		return
+	}
+	if !q.scheduler.push(job, q.userWeight(job.UserID)) {
+		// Read just before the queue began draining
+		q.handBack(job)
+	}
+}
+
+// settleDelivery acknowledges the delivery of a job once this process stopped
+// working on it, whatever the outcome. Retries are published again when due.
+func (q *Queue) settleDelivery(jobID string) {
+	if q.broker == nil {
+		return
+	}
+
+	q.deliveryMu.Lock()
+	delivery, exists := q.deliveries[jobID]
+	delete(q.deliveries, jobID)
+	q.deliveryMu.Unlock()
+
+	if exists {
+		q.ackDelivery(context.Background(), delivery)
+	}
+}
+
+// ackDelivery acknowledges a delivery. One that fails to be acknowledged is
+// eventually reclaimed and skipped, as its job is no longer queued.
+func (q *Queue) ackDelivery(ctx context.Context, delivery Delivery) {
+	if err := q.broker.Ack(ctx, delivery); err != nil {
+		q.logger.Error("Failed to acknowledge delivery", "job_id", delivery.JobID, "delivery_id", delivery.ID, "error", err)
+	}
+}
+
+// sendHeartbeats periodically reports this worker process to the broker
+func (q *Queue) sendHeartbeats(ctx context.Context) {
+	ticker := time.NewTicker(jobHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		q.sendHeartbeat(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendHeartbeat reports this worker process and its load to the broker
+func (q *Queue) sendHeartbeat(ctx context.Context) {
+	queued, running := q.scheduler.load()
+	err := q.broker.Heartbeat(ctx, WorkerInfo{
+		ID:        q.instanceID,
+		Role:      q.role,
+		State:     q.State(),
+		Types:     q.brokerTypes,
+		Workers:   q.maxWorkers,
+		Running:   running,
+		Queued:    queued,
+		StartedAt: q.startedAt,
+		LastSeen:  time.Now(),
+	})
+	if err != nil && ctx.Err() == nil {
+		q.logger.Error("Failed to send worker heartbeat", "error", err)
+	}
+}
+
+// sortWorkers orders worker processes by ID
+func sortWorkers(workers []WorkerInfo) {
+	sort.Slice(workers, func(i, j int) bool { return workers[i].ID < workers[j].ID })
+}
+
+// sleepContext waits for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
@@ -0,0 +1,58 @@
+package jobs
+
+import "context"
+
+// trackRunning registers the cancel function of a job a worker of this instance
+// started. It returns false when the job was cancelled before it was tracked.
+func (q *Queue) trackRunning(jobID string, cancel context.CancelFunc) bool {
+	q.runMu.Lock()
+	q.cancels[jobID] = cancel
+	q.runMu.Unlock()
+
+	// CancelJob saves the status before interrupting, so a cancel that missed the
+	// registration above is visible in the store
+	if job, exists := q.GetJob(jobID); exists && job.Status == JobStatusCancelled {
+		cancel()
+		return false
+	}
+	return true
+}
+
+// untrackRunning forgets a job once its worker stops running it
+func (q *Queue) untrackRunning(jobID string) {
+	q.runMu.Lock()
+	defer q.runMu.Unlock()
+
+	delete(q.cancels, jobID)
+}
+
+// interruptJob stops everything this instance does for a cancelled job: it is
+// taken out of the scheduler, its pending retry is dropped and its running
+// provider calls and Blender processes are cancelled through the job context.
+// A job running on another instance loses its lease at the next heartbeat,
+// which cancels it there. Callers must hold q.mu.
+func (q *Queue) interruptJob(jobID string) {
+	if q.scheduler.remove(jobID) {
+		q.settleDelivery(jobID)
+		q.logger.Info("Removed cancelled job from the queue", "job_id", jobID)
+	}
+
+	if q.delayed.remove(jobID) {
+		q.logger.Info("Dropped retry of cancelled job", "job_id", jobID)
+	}
+
+	q.runMu.Lock()
+	cancel, running := q.cancels[jobID]
+	q.runMu.Unlock()
+
+	if running {
+		cancel()
+		q.logger.Info("Interrupted running job", "job_id", jobID)
+	}
+}
+
+// isCancelled reports whether a job was cancelled, e.g. while a worker ran it
+func (q *Queue) isCancelled(jobID string) bool {
+	job, exists := q.GetJob(jobID)
+	return exists && job.Status == JobStatusCancelled
+}
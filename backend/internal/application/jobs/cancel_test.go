@@ -0,0 +1,93 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCancelQueuedJob(t *testing.T) {
+	q := NewQueue(testLogger{}, nil, nil, 1)
+	job := &Job{UserID: "user-1", Type: JobTypeExport}
+	if err := q.AddJob(job); err != nil {
+		t.Fatalf("AddJob failed: %v", err)
+	}
+
+	if err := q.CancelJob(job.ID); err != nil {
+		t.Fatalf("CancelJob failed: %v", err)
+	}
+	if q.scheduler.len() != 0 {
+		t.Errorf("Expected the job to leave the queue, %d still queued", q.scheduler.len())
+	}
+	if stored, _ := q.GetJob(job.ID); stored.Status != JobStatusCancelled {
+		t.Errorf("Expected a cancelled job, got %s", stored.Status)
+	}
+	if err := q.CancelJob(job.ID); err == nil {
+		t.Error("Expected a second cancel to fail")
+	}
+}
+
+func TestCancelScheduledRetry(t *testing.T) {
+	q := NewQueue(testLogger{}, nil, nil, 1)
+	job := &Job{UserID: "user-1", Type: JobTypeExport}
+	if err := q.AddJob(job); err != nil {
+		t.Fatalf("AddJob failed: %v", err)
+	}
+	q.scheduler.remove(job.ID)
+	q.delayed.add(job, time.Now().Add(time.Hour))
+
+	if err := q.CancelJob(job.ID); err != nil {
+		t.Fatalf("CancelJob failed: %v", err)
+	}
+
+	if q.delayed.len() != 0 {
+		t.Errorf("Expected the retry to be dropped, got %d pending", q.delayed.len())
+	}
+}
+
+func TestCancelRunningJob(t *testing.T) {
+	q := NewQueue(testLogger{}, nil, nil, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := q.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	// Exports take two seconds unless interrupted
+	job := &Job{UserID: "user-1", Type: JobTypeExport}
+	if err := q.AddJob(job); err != nil {
+		t.Fatalf("AddJob failed: %v", err)
+	}
+	waitFor(t, func() bool {
+		stored, _ := q.GetJob(job.ID)
+		return stored.Status == JobStatusProcessing
+	})
+
+	if err := q.CancelJob(job.ID); err != nil {
+		t.Fatalf("CancelJob failed: %v", err)
+	}
+	started := time.Now()
+	waitFor(t, func() bool {
+		return q.SchedulerStats().Running[LaneBatch.String()] == 0
+	})
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("Expected the worker to stop right away, took %s", elapsed)
+	}
+
+	stored, _ := q.GetJob(job.ID)
+	if stored.Status != JobStatusCancelled || stored.RetryCount != 0 {
+		t.Errorf("Expected a cancelled job without retries, got %s after %d retries", stored.Status, stored.RetryCount)
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for i := 0; i < 300; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Condition not met in time")
+}
@@ -0,0 +1,301 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrDeadLetterNotFound is returned when a dead-letter store has no entry for a job
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+	// ErrJobNotRequeueable is returned when a dead-lettered job already runs again
+	ErrJobNotRequeueable = errors.New("job cannot be requeued")
+)
+
+// DeadLetter is a job that failed after exhausting its retries, kept so an
+// operator can inspect it, fix its data and requeue it
+type DeadLetter struct {
+	Job      *Job      `json:"job"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// DeadLetterFilter narrows dead-letter queries. Results are ordered by failure
+// time, newest first.
+type DeadLetterFilter struct {
+	UserID string
+	Types  []JobType
+	Limit  int
+	Offset int
+}
+
+// matches reports whether a dead letter passes the filter, ignoring paging
+func (f DeadLetterFilter) matches(letter *DeadLetter) bool {
+	if f.UserID != "" && letter.Job.UserID != f.UserID {
+		return false
+	}
+	return len(f.Types) == 0 || containsType(f.Types, letter.Job.Type)
+}
+
+// page sorts dead letters newest first and applies the filter's offset and limit
+func (f DeadLetterFilter) page(letters []*DeadLetter) []*DeadLetter {
+	sort.Slice(letters, func(i, j int) bool {
+		return letters[i].FailedAt.After(letters[j].FailedAt)
+	})
+
+	if f.Offset > 0 {
+		if f.Offset >= len(letters) {
+			return nil
+		}
+		letters = letters[f.Offset:]
+	}
+	if f.Limit > 0 && len(letters) > f.Limit {
+		letters = letters[:f.Limit]
+	}
+	return letters
+}
+
+// DeadLetterStore keeps the jobs that exhausted their retries, keyed by job ID
+type DeadLetterStore interface {
+	// Put adds a dead letter, replacing any entry for the same job
+	Put(ctx context.Context, letter *DeadLetter) error
+	Get(ctx context.Context, jobID string) (*DeadLetter, error)
+	List(ctx context.Context, filter DeadLetterFilter) ([]*DeadLetter, error)
+	Delete(ctx context.Context, jobID string) error
+}
+
+// MemoryDeadLetterStore is an in-memory DeadLetterStore for development and tests
+type MemoryDeadLetterStore struct {
+	mu      sync.Mutex
+	letters map[string]*DeadLetter
+}
+
+// NewMemoryDeadLetterStore creates a new in-memory dead-letter store
+func NewMemoryDeadLetterStore() *MemoryDeadLetterStore {
+	return &MemoryDeadLetterStore{
+		letters: make(map[string]*DeadLetter),
+	}
+}
+
+// copyDeadLetter returns a copy of a dead letter so callers never share the stored value
+func copyDeadLetter(letter *DeadLetter) *DeadLetter {
+	c := *letter
+	c.Job = copyJob(letter.Job)
+	return &c
+}
+
+func (s *MemoryDeadLetterStore) Put(ctx context.Context, letter *DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.letters[letter.Job.ID] = copyDeadLetter(letter)
+	return nil
+}
+
+func (s *MemoryDeadLetterStore) Get(ctx context.Context, jobID string) (*DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	letter, exists := s.letters[jobID]
+	if !exists {
+		return nil, ErrDeadLetterNotFound
+	}
+	return copyDeadLetter(letter), nil
+}
+
+func (s *MemoryDeadLetterStore) List(ctx context.Context, filter DeadLetterFilter) ([]*DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var letters []*DeadLetter
+	for _, letter := range s.letters {
+		if filter.matches(letter) {
+			letters = append(letters, copyDeadLetter(letter))
+		}
+	}
+	return filter.page(letters), nil
+}
+
+func (s *MemoryDeadLetterStore) Delete(ctx context.Context, jobID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.letters, jobID)
+	return nil
+}
+
+// deadLetterRecord is the serialized form of a dead letter; the job keeps its
+// typed result through encodeJob
+type deadLetterRecord struct {
+	Job      json.RawMessage `json:"job"`
+	Error    string          `json:"error"`
+	Attempts int             `json:"attempts"`
+	FailedAt time.Time       `json:"failed_at"`
+}
+
+// encodeDeadLetter serializes a dead letter
+func encodeDeadLetter(letter *DeadLetter) ([]byte, error) {
+	job, err := encodeJob(letter.Job)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(deadLetterRecord{Job: job, Error: letter.Error, Attempts: letter.Attempts, FailedAt: letter.FailedAt})
+}
+
+// decodeDeadLetter deserializes a dead letter written by encodeDeadLetter
+func decodeDeadLetter(data []byte) (*DeadLetter, error) {
+	var record deadLetterRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to decode dead letter: %w", err)
+	}
+
+	job, err := decodeJob(record.Job)
+	if err != nil {
+		return nil, err
+	}
+	return &DeadLetter{Job: job, Error: record.Error, Attempts: record.Attempts, FailedAt: record.FailedAt}, nil
+}
+
+// SetDeadLetterStore replaces the in-memory dead-letter store with a durable
+// one. It must be called before Start.
+func (q *Queue) SetDeadLetterStore(store DeadLetterStore) {
+	q.deadLetters = store
+}
+
+// deadLetter keeps a job that failed after its last retry
+func (q *Queue) deadLetter(job *Job, err error) {
+	// A job cancelled while its last attempt failed is not dead-lettered
+	stored, exists := q.GetJob(job.ID)
+	if !exists || stored.Status != JobStatusFailed {
+		return
+	}
+
+	letter := &DeadLetter{
+		Job:      stored,
+		Error:    err.Error(),
+		Attempts: job.RetryCount + 1,
+		FailedAt: time.Now(),
+	}
+	if err := q.deadLetters.Put(context.Background(), letter); err != nil {
+		q.logger.Error("Failed to dead-letter job", "job_id", job.ID, "error", err)
+		return
+	}
+
+	q.logger.Warn("Job moved to dead-letter store", "job_id", job.ID, "type", job.Type, "attempts", letter.Attempts)
+}
+
+// ListDeadLetters returns the jobs that exhausted their retries
+func (q *Queue) ListDeadLetters(ctx context.Context, filter DeadLetterFilter) ([]*DeadLetter, error) {
+	return q.deadLetters.List(ctx, filter)
+}
+
+// GetDeadLetter returns the dead letter of a job
+func (q *Queue) GetDeadLetter(ctx context.Context, jobID string) (*DeadLetter, error) {
+	return q.deadLetters.Get(ctx, jobID)
+}
+
+// UpdateDeadLetter replaces the data a dead-lettered job runs with once requeued,
+// e.g. to fix a parameter that made every attempt fail
+func (q *Queue) UpdateDeadLetter(ctx context.Context, jobID string, data map[string]interface{}) (*DeadLetter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	letter, err := q.deadLetters.Get(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Edited data is written in the current payload version
+	edited := *letter.Job
+	edited.Data = data
+	if err := validatePayload(&edited); err != nil {
+		return nil, err
+	}
+
+	letter.Job.Data, letter.Job.DataVersion = edited.Data, edited.DataVersion
+	if err := q.deadLetters.Put(ctx, letter); err != nil {
+		return nil, err
+	}
+
+	q.logger.Info("Dead-lettered job edited", "job_id", jobID)
+	return letter, nil
+}
+
+// DeleteDeadLetter discards a dead letter without running the job again
+func (q *Queue) DeleteDeadLetter(ctx context.Context, jobID string) error {
+	if _, err := q.deadLetters.Get(ctx, jobID); err != nil {
+		return err
+	}
+	return q.deadLetters.Delete(ctx, jobID)
+}
+
+// RequeueDeadLetter runs a dead-lettered job again from scratch with its
+// possibly edited data. Credits are reserved again as for a new job. Pipeline
+// steps that were cancelled because the job failed are not restarted.
+func (q *Queue) RequeueDeadLetter(ctx context.Context, jobID string) (*Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	letter, err := q.deadLetters.Get(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := q.store.Get(ctx, jobID)
+	exists := err == nil
+	if errors.Is(err, ErrJobNotFound) {
+		job = letter.Job
+	} else if err != nil {
+		return nil, err
+	}
+	if exists && job.Status != JobStatusFailed {
+		return nil, fmt.Errorf("%w: job is %s", ErrJobNotRequeueable, job.Status)
+	}
+
+	job.Data = letter.Job.Data
+	job.DataVersion = letter.Job.DataVersion
+	job.Status = JobStatusQueued
+	job.Progress = 0
+	job.Result = nil
+	job.Error = ""
+	job.Failure = nil
+	job.StartedAt = nil
+	job.CompletedAt = nil
+	job.NextAttemptAt = nil
+	job.RetryCount = 0
+	job.MaxRetries = q.retryPolicy(job.Type).MaxRetries
+
+	if q.meter != nil {
+		variants, _ := dataInt64(job.Data["variants"])
+		credits := q.meter.JobCredits(string(job.Type), int(variants))
+		if err := q.meter.Reserve(ctx, job.UserID, credits); err != nil {
+			return nil, err
+		}
+		job.ReservedCredits = credits
+	}
+
+	if exists {
+		err = q.store.Update(ctx, job)
+	} else {
+		err = q.store.Create(ctx, job)
+	}
+	if err != nil {
+		q.settleCredits(job.UserID, job.ReservedCredits, false)
+		return nil, fmt.Errorf("failed to requeue job: %w", err)
+	}
+
+	if err := q.deadLetters.Delete(ctx, jobID); err != nil {
+		q.logger.Error("Failed to remove requeued dead letter", "job_id", jobID, "error", err)
+	}
+
+	q.dispatch(job)
+	q.logger.Info("Dead-lettered job requeued", "job_id", jobID, "type", job.Type)
+	q.notifier.NotifyJobUpdated(job)
+	return job, nil
+}
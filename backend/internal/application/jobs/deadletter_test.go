@@ -0,0 +1,126 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// testDeadLetterStores returns the dead-letter stores that run without external services
+func testDeadLetterStores(t *testing.T) map[string]DeadLetterStore {
+	stores := testStores(t)
+	return map[string]DeadLetterStore{
+		"memory": NewMemoryDeadLetterStore(),
+		"bolt":   NewBoltDeadLetterStore(stores["bolt"].(*BoltJobStore)),
+	}
+}
+
+func TestDeadLetterStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	for name, store := range testDeadLetterStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for i, id := range []string{"job_1", "job_2", "job_3"} {
+				job := newStoredJob(id, "user-1", JobTypeAIQuick, now)
+				if id == "job_3" {
+					job.UserID, job.Type = "user-2", JobType3DModel
+				}
+				job.Status = JobStatusFailed
+				letter := &DeadLetter{Job: job, Error: "provider unavailable", Attempts: 4, FailedAt: now.Add(time.Duration(i) * time.Minute)}
+				if err := store.Put(ctx, letter); err != nil {
+					t.Fatalf("Put failed: %v", err)
+				}
+			}
+
+			letter, err := store.Get(ctx, "job_1")
+			if err != nil {
+				t.Fatalf("Get failed: %v", err)
+			}
+			if letter.Error != "provider unavailable" || letter.Attempts != 4 || letter.Job.Data["style"] != "modern" {
+				t.Errorf("Unexpected dead letter: %+v", letter)
+			}
+
+			// Newest failure first
+			letters, err := store.List(ctx, DeadLetterFilter{})
+			if err != nil {
+				t.Fatalf("List failed: %v", err)
+			}
+			if ids := deadLetterIDs(letters); len(ids) != 3 || ids[0] != "job_3" || ids[2] != "job_1" {
+				t.Errorf("Unexpected order: %v", ids)
+			}
+
+			letters, _ = store.List(ctx, DeadLetterFilter{UserID: "user-1", Limit: 1, Offset: 1})
+			if ids := deadLetterIDs(letters); len(ids) != 1 || ids[0] != "job_1" {
+				t.Errorf("Expected the second page of user-1 to hold job_1, got %v", ids)
+			}
+			letters, _ = store.List(ctx, DeadLetterFilter{Types: []JobType{JobType3DModel}})
+			if ids := deadLetterIDs(letters); len(ids) != 1 || ids[0] != "job_3" {
+				t.Errorf("Expected only the 3D job, got %v", ids)
+			}
+
+			if err := store.Delete(ctx, "job_1"); err != nil {
+				t.Fatalf("Delete failed: %v", err)
+			}
+			if _, err := store.Get(ctx, "job_1"); !errors.Is(err, ErrDeadLetterNotFound) {
+				t.Errorf("Expected ErrDeadLetterNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRequeueDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	q := NewQueue(testLogger{}, nil, nil, 1)
+	job := &Job{UserID: "user-1", Type: JobTypeExport, Data: map[string]interface{}{"format": "dwg"}}
+	if err := q.AddJob(job); err != nil {
+		t.Fatalf("AddJob failed: %v", err)
+	}
+	q.scheduler.remove(job.ID)
+
+	// The last retry failed
+	failure := errors.New("exporter crashed")
+	q.UpdateJob(job.ID, JobStatusFailed, 40, nil, failure)
+	job.RetryCount = job.MaxRetries
+	q.deadLetter(job, failure)
+
+	letter, err := q.GetDeadLetter(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Expected the job to be dead-lettered: %v", err)
+	}
+	if letter.Attempts != job.MaxRetries+1 || letter.Error != "exporter crashed" {
+		t.Errorf("Unexpected dead letter: %+v", letter)
+	}
+
+	if _, err := q.UpdateDeadLetter(ctx, job.ID, map[string]interface{}{"format": "pdf"}); err != nil {
+		t.Fatalf("UpdateDeadLetter failed: %v", err)
+	}
+
+	requeued, err := q.RequeueDeadLetter(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("RequeueDeadLetter failed: %v", err)
+	}
+	if requeued.Status != JobStatusQueued || requeued.RetryCount != 0 || requeued.Error != "" || requeued.Data["format"] != "pdf" {
+		t.Errorf("Unexpected requeued job: %+v", requeued)
+	}
+	if q.scheduler.len() != 1 {
+		t.Errorf("Expected the job to be queued, %d queued", q.scheduler.len())
+	}
+	if _, err := q.GetDeadLetter(ctx, job.ID); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Errorf("Expected the dead letter to be removed, got %v", err)
+	}
+
+	// A job that runs again is not requeued twice
+	q.deadLetter(job, failure)
+	if _, err := q.GetDeadLetter(ctx, job.ID); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Errorf("Expected a queued job not to be dead-lettered, got %v", err)
+	}
+}
+
+func deadLetterIDs(letters []*DeadLetter) []string {
+	ids := make([]string, len(letters))
+	for i, letter := range letters {
+		ids[i] = letter.Job.ID
+	}
+	return ids
+}
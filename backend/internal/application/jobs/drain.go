@@ -0,0 +1,154 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrQueueDraining is returned for jobs submitted while the queue shuts down
+var ErrQueueDraining = errors.New("job queue is draining")
+
+// drainInterruptGrace bounds how long Stop waits for workers once it interrupted
+// their jobs; a job ignoring its context is abandoned to lease recovery
+const drainInterruptGrace = 10 * time.Second
+
+// QueueState is the lifecycle stage of a queue, as reported for readiness
+type QueueState string
+
+const (
+	QueueStateRunning  QueueState = "running"
+	QueueStateDraining QueueState = "draining"
+	QueueStateStopped  QueueState = "stopped"
+)
+
+// State reports whether the queue takes jobs, is draining or has stopped
+func (q *Queue) State() QueueState {
+	switch {
+	case q.stopped.Load():
+		return QueueStateStopped
+	case q.draining.Load():
+		return QueueStateDraining
+	default:
+		return QueueStateRunning
+	}
+}
+
+// Stop drains the queue. It stops taking new jobs and hands back the jobs it
+// has not started, then waits for running jobs to finish until ctx is done.
+// Jobs still running then are interrupted and saved as queued with their
+// progress, without using a retry, for another worker or the next start to run.
+// Stop returns an error when it had to interrupt jobs; calling it again waits
+// for the same drain.
+func (q *Queue) Stop(ctx context.Context) error {
+	if q.draining.CompareAndSwap(false, true) {
+		q.logger.Info("Draining job queue", "workers", len(q.workers))
+
+		q.scheduler.close()
+		for _, worker := range q.workers {
+			worker.Stop()
+		}
+		q.handBackQueued()
+	}
+
+	if q.waitForWorkers(ctx) {
+		q.stopped.Store(true)
+		q.logger.Info("Job queue stopped")
+		return nil
+	}
+
+	interrupted := q.interruptRunning()
+	q.logger.Warn("Drain deadline passed, interrupting running jobs", "jobs", interrupted)
+
+	graceCtx, cancel := context.WithTimeout(context.Background(), drainInterruptGrace)
+	defer cancel()
+	if !q.waitForWorkers(graceCtx) {
+		q.logger.Error("Workers did not stop after their jobs were interrupted")
+		return fmt.Errorf("workers did not stop: %w", graceCtx.Err())
+	}
+
+	q.stopped.Store(true)
+	q.logger.Info("Job queue stopped", "interrupted", interrupted)
+	return fmt.Errorf("interrupted %d running jobs: %w", interrupted, ctx.Err())
+}
+
+// waitForWorkers reports whether every worker stopped before ctx was done
+func (q *Queue) waitForWorkers(ctx context.Context) bool {
+	for _, worker := range q.workers {
+		select {
+		case <-worker.done:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+// handBackQueued returns the jobs waiting in the scheduler. With a broker they
+// are published again for other workers; otherwise they stay queued in the
+// store and run at the next start.
+func (q *Queue) handBackQueued() {
+	queued := q.scheduler.drain()
+	for _, job := range queued {
+		q.handBack(job)
+	}
+	if len(queued) > 0 {
+		q.logger.Info("Handed back queued jobs", "jobs", len(queued))
+	}
+}
+
+// handBack returns a queued job this process will not run
+func (q *Queue) handBack(job *Job) {
+	if q.broker == nil {
+		return
+	}
+
+	// Publish before acknowledging; a delivery left pending is reclaimed anyway
+	if err := q.broker.Publish(context.Background(), job); err != nil {
+		q.logger.Error("Failed to publish handed back job", "job_id", job.ID, "error", err)
+		return
+	}
+	q.settleDelivery(job.ID)
+}
+
+// interruptRunning cancels the jobs running in this instance, returning how many
+// there were. Their workers requeue them instead of retrying them.
+func (q *Queue) interruptRunning() int {
+	q.interrupting.Store(true)
+
+	q.runMu.Lock()
+	defer q.runMu.Unlock()
+
+	for _, cancel := range q.cancels {
+		cancel()
+	}
+	return len(q.cancels)
+}
+
+// requeueInterrupted saves a job interrupted by a drain as queued again. The
+// attempt does not count as a retry, and the job keeps its progress until it
+// runs again.
+func (q *Queue) requeueInterrupted(job *Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stored, err := q.store.Get(context.Background(), job.ID)
+	if err != nil {
+		return err
+	}
+	if stored.Status != JobStatusProcessing {
+		return fmt.Errorf("job is %s", stored.Status)
+	}
+
+	stored.Status = JobStatusQueued
+	stored.StartedAt = nil
+	stored.NextAttemptAt = nil
+	if err := q.store.Update(context.Background(), stored); err != nil {
+		return err
+	}
+
+	q.notifier.NotifyJobUpdated(stored)
+	q.handBack(stored)
+	return nil
+}
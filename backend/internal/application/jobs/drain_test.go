@@ -0,0 +1,158 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// startLoadedQueue starts a queue with three workers and submits exports until
+// two run; the default policy keeps the others queued behind the batch cap
+func startLoadedQueue(t *testing.T, exports int) (*Queue, []*Job) {
+	t.Helper()
+	q := NewQueue(testLogger{}, nil, nil, 3)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if err := q.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	var submitted []*Job
+	for i := 0; i < exports; i++ {
+		job := &Job{UserID: fmt.Sprintf("user-%d", i), Type: JobTypeExport}
+		if err := q.AddJob(job); err != nil {
+			t.Fatalf("AddJob failed: %v", err)
+		}
+		submitted = append(submitted, job)
+	}
+	waitFor(t, func() bool {
+		_, running := q.scheduler.load()
+		return running == 2
+	})
+	return q, submitted
+}
+
+// countStatuses counts the stored jobs by status
+func countStatuses(q *Queue, submitted []*Job) map[JobStatus]int {
+	counts := make(map[JobStatus]int)
+	for _, job := range submitted {
+		stored, _ := q.GetJob(job.ID)
+		counts[stored.Status]++
+	}
+	return counts
+}
+
+func TestStopWaitsForRunningJobs(t *testing.T) {
+	q, submitted := startLoadedQueue(t, 5)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := q.Stop(ctx); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+
+	// The running exports finished; the queued ones wait for the next start
+	counts := countStatuses(q, submitted)
+	if counts[JobStatusCompleted] != 2 || counts[JobStatusQueued] != 3 {
+		t.Errorf("Expected 2 completed and 3 queued jobs, got %v", counts)
+	}
+	if q.State() != QueueStateStopped {
+		t.Errorf("Expected a stopped queue, got %s", q.State())
+	}
+	if err := q.AddJob(&Job{UserID: "user-1", Type: JobTypeExport}); !errors.Is(err, ErrQueueDraining) {
+		t.Errorf("Expected new jobs to be rejected, got %v", err)
+	}
+
+	// Stopping again returns right away
+	if err := q.Stop(ctx); err != nil {
+		t.Errorf("Expected a second Stop to succeed, got %v", err)
+	}
+}
+
+func TestStopRequeuesJobsAtDeadline(t *testing.T) {
+	q, submitted := startLoadedQueue(t, 3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	err := q.Stop(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the drain to hit its deadline, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("Expected Stop to return soon after its deadline, took %s", elapsed)
+	}
+
+	// Interrupted jobs are queued again without using a retry or keeping a lease
+	for _, job := range submitted {
+		stored, _ := q.store.Get(context.Background(), job.ID)
+		if stored.Status != JobStatusQueued || stored.RetryCount != 0 || stored.WorkerID != "" {
+			t.Errorf("Expected %s queued without retries or lease, got %s after %d retries held by %q",
+				job.ID, stored.Status, stored.RetryCount, stored.WorkerID)
+		}
+	}
+	if q.State() != QueueStateStopped {
+		t.Errorf("Expected a stopped queue, got %s", q.State())
+	}
+}
+
+func TestStopHandsBackBrokerJobs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	broker := newTestBroker(t)
+	store := NewMemoryJobStore()
+
+	api := NewQueue(testLogger{}, nil, nil, 1)
+	api.SetStore(store)
+	api.SetBroker(broker, RoleEnqueue)
+	if err := api.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	worker := NewQueue(testLogger{}, nil, nil, 3)
+	worker.SetStore(store)
+	worker.SetBroker(broker, RoleWorker, JobTypeExport)
+	if err := worker.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	var submitted []*Job
+	for i := 0; i < 4; i++ {
+		job := &Job{UserID: fmt.Sprintf("user-%d", i), Type: JobTypeExport}
+		if err := api.AddJob(job); err != nil {
+			t.Fatalf("AddJob failed: %v", err)
+		}
+		submitted = append(submitted, job)
+	}
+	waitFor(t, func() bool {
+		queued, running := worker.scheduler.load()
+		return queued == 1 && running == 2
+	})
+
+	drainCtx, cancelDrain := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancelDrain()
+	if err := worker.Stop(drainCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the drain to hit its deadline, got %v", err)
+	}
+
+	// Every job is left with nothing pending and can be read by another worker
+	stats, _ := broker.Stats(ctx, []JobType{JobTypeExport})
+	if stats[0].Pending != 0 {
+		t.Errorf("Expected no pending deliveries, got %d", stats[0].Pending)
+	}
+	deliveries, err := broker.Consume(ctx, "next", []JobType{JobTypeExport}, 10, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Consume failed: %v", err)
+	}
+	delivered := make(map[string]bool)
+	for _, delivery := range deliveries {
+		delivered[delivery.JobID] = true
+	}
+	for _, job := range submitted {
+		if !delivered[job.ID] {
+			t.Errorf("Expected %s to be delivered again", job.ID)
+		}
+	}
+}
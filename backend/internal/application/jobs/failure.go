@@ -0,0 +1,80 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/compozit/vision/backend/internal/infrastructure/ai"
+)
+
+// FailureKind classifies why a job failed
+type FailureKind string
+
+const (
+	// FailureInvalidPayload is job data that does not decode or validate
+	FailureInvalidPayload FailureKind = "invalid_payload"
+	// FailurePanic is a job whose processing panicked
+	FailurePanic FailureKind = "panic"
+	// FailureRejected is a request the provider or moderation refused
+	FailureRejected FailureKind = "rejected"
+	// FailurePermanent is any other failure retrying cannot fix
+	FailurePermanent FailureKind = "permanent"
+	// FailureTransient is a failure that persisted through every retry
+	FailureTransient FailureKind = "transient"
+)
+
+// JobFailure is the structured error of a failed job
+type JobFailure struct {
+	Kind    FailureKind `json:"kind"`
+	Message string      `json:"message"`
+	// Field is the payload field at fault, when known
+	Field string `json:"field,omitempty"`
+}
+
+// newJobFailure classifies the error a job failed with
+func newJobFailure(err error) *JobFailure {
+	failure := &JobFailure{Kind: FailureTransient, Message: err.Error()}
+
+	var payload *PayloadError
+	var panicked *PanicError
+	var moderation *ai.ModerationError
+	switch {
+	case errors.As(err, &payload):
+		failure.Kind = FailureInvalidPayload
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			failure.Field = typeErr.Field
+		}
+	case errors.As(err, &panicked):
+		failure.Kind = FailurePanic
+	case errors.As(err, &moderation):
+		failure.Kind = FailureRejected
+		failure.Field = moderation.Field
+	case ai.IsPermanent(err):
+		failure.Kind = FailureRejected
+	case !IsRetryable(err):
+		failure.Kind = FailurePermanent
+	}
+	return failure
+}
+
+// PanicError reports a panic while processing a job. The stack is logged, not
+// stored with the job.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("job panicked: %v", e.Value)
+}
+
+// recoverJobPanic turns a panic of the calling goroutine into a PanicError
+// stored in err. It must be deferred directly.
+func recoverJobPanic(err *error) {
+	if r := recover(); r != nil {
+		*err = &PanicError{Value: r, Stack: debug.Stack()}
+	}
+}
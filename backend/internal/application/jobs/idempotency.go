@@ -0,0 +1,203 @@
+package jobs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrIdempotencyConflict is returned when an idempotency key is reused with a
+	// different request, or while the request that first used it is still running
+	ErrIdempotencyConflict = errors.New("idempotency key conflict")
+
+	// ErrInvalidIdempotencyKey is returned for keys that are too long
+	ErrInvalidIdempotencyKey = errors.New("invalid idempotency key")
+)
+
+const (
+	// defaultIdempotencyWindow is how long a key returns the job it created
+	defaultIdempotencyWindow = 24 * time.Hour
+
+	// maxIdempotencyKeyLength bounds client-supplied keys
+	maxIdempotencyKeyLength = 255
+
+	// idempotencyPurgeInterval is how often expired keys are deleted
+	idempotencyPurgeInterval = time.Hour
+)
+
+// IdempotencyRecord links a user's idempotency key to the job its first request
+// created, with a hash of that request
+type IdempotencyRecord struct {
+	UserID      string    `json:"user_id"`
+	Key         string    `json:"key"`
+	RequestHash string    `json:"request_hash"`
+	JobID       string    `json:"job_id"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// IdempotencyStore keeps idempotency keys, scoped per user
+type IdempotencyStore interface {
+	// Reserve saves a record unless an unexpired one holds the same user and
+	// key, which it returns instead. Reserving is atomic, so of several requests
+	// racing with the same key exactly one gets nil.
+	Reserve(ctx context.Context, record *IdempotencyRecord, now time.Time) (*IdempotencyRecord, error)
+	// Delete frees a key whose request failed, so the client can retry it
+	Delete(ctx context.Context, userID, key string) error
+	// DeleteExpired removes the records expired at now
+	DeleteExpired(ctx context.Context, now time.Time) (int, error)
+}
+
+// idempotencyKey is the key of a record in the memory and Bolt stores
+func idempotencyKey(userID, key string) string {
+	return userID + "\x00" + key
+}
+
+// MemoryIdempotencyStore is an in-memory IdempotencyStore for development and tests
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]IdempotencyRecord
+}
+
+// NewMemoryIdempotencyStore creates a new in-memory idempotency store
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		records: make(map[string]IdempotencyRecord),
+	}
+}
+
+func (s *MemoryIdempotencyStore) Reserve(ctx context.Context, record *IdempotencyRecord, now time.Time) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := idempotencyKey(record.UserID, record.Key)
+	if existing, exists := s.records[id]; exists && existing.ExpiresAt.After(now) {
+		return &existing, nil
+	}
+	s.records[id] = *record
+	return nil, nil
+}
+
+func (s *MemoryIdempotencyStore) Delete(ctx context.Context, userID, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, idempotencyKey(userID, key))
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int
+	for id, record := range s.records {
+		if !record.ExpiresAt.After(now) {
+			delete(s.records, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// requestHash fingerprints the part of a request an idempotency key stands for
+func requestHash(request interface{}) (string, error) {
+	// Maps marshal with sorted keys, so equal requests hash equally
+	data, err := json.Marshal(request)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash request: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// SetIdempotencyStore replaces the in-memory idempotency store with a durable
+// one, which instances sharing a job store must also share. It must be called
+// before Start.
+func (q *Queue) SetIdempotencyStore(store IdempotencyStore) {
+	q.idempotency = store
+}
+
+// SetIdempotencyWindow sets how long an idempotency key returns the job it
+// created. It must be called before Start.
+func (q *Queue) SetIdempotencyWindow(window time.Duration) {
+	q.idempotencyWindow = window
+}
+
+// reserveIdempotencyKey claims a user's key for the job a request creates. When
+// an identical earlier request holds the key, it returns that request's job.
+func (q *Queue) reserveIdempotencyKey(userID, key string, request interface{}, jobID string) (*Job, error) {
+	if len(key) > maxIdempotencyKeyLength {
+		return nil, fmt.Errorf("%w: longer than %d characters", ErrInvalidIdempotencyKey, maxIdempotencyKeyLength)
+	}
+
+	hash, err := requestHash(request)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	existing, err := q.idempotency.Reserve(context.Background(), &IdempotencyRecord{
+		UserID:      userID,
+		Key:         key,
+		RequestHash: hash,
+		JobID:       jobID,
+		ExpiresAt:   now.Add(q.idempotencyWindow),
+	}, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+	if existing == nil {
+		return nil, nil
+	}
+
+	if existing.RequestHash != hash {
+		return nil, fmt.Errorf("%w: key was used for a different request", ErrIdempotencyConflict)
+	}
+
+	original, exists := q.GetJob(existing.JobID)
+	if !exists {
+		// The first request reserved the key but has not saved its job yet
+		return nil, fmt.Errorf("%w: the original request is still in progress", ErrIdempotencyConflict)
+	}
+
+	q.logger.Info("Returning job of repeated request", "job_id", original.ID, "user_id", userID)
+	return original, nil
+}
+
+// releaseIdempotencyKey frees a key after its request failed to queue a job
+func (q *Queue) releaseIdempotencyKey(userID, key string) {
+	if key == "" {
+		return
+	}
+	if err := q.idempotency.Delete(context.Background(), userID, key); err != nil {
+		q.logger.Error("Failed to release idempotency key", "user_id", userID, "error", err)
+	}
+}
+
+// purgeIdempotencyKeys periodically deletes expired idempotency keys
+func (q *Queue) purgeIdempotencyKeys(ctx context.Context) {
+	ticker := time.NewTicker(idempotencyPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := q.idempotency.DeleteExpired(ctx, time.Now())
+			if err != nil {
+				q.logger.Error("Failed to purge idempotency keys", "error", err)
+				continue
+			}
+			if deleted > 0 {
+				q.logger.Debug("Purged expired idempotency keys", "keys", deleted)
+			}
+		}
+	}
+}
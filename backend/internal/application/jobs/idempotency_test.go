@@ -0,0 +1,150 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	stores := testStores(t)
+	for name, store := range map[string]IdempotencyStore{
+		"memory": NewMemoryIdempotencyStore(),
+		"bolt":   NewBoltIdempotencyStore(stores["bolt"].(*BoltJobStore)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			first := &IdempotencyRecord{UserID: "user-1", Key: "key-1", RequestHash: "a", JobID: "job_1", ExpiresAt: now.Add(time.Hour)}
+			if existing, err := store.Reserve(ctx, first, now); err != nil || existing != nil {
+				t.Fatalf("Expected the key to be reserved, got %+v, %v", existing, err)
+			}
+
+			repeated := &IdempotencyRecord{UserID: "user-1", Key: "key-1", RequestHash: "b", JobID: "job_2", ExpiresAt: now.Add(time.Hour)}
+			existing, err := store.Reserve(ctx, repeated, now)
+			if err != nil {
+				t.Fatalf("Reserve failed: %v", err)
+			}
+			if existing == nil || existing.JobID != "job_1" || existing.RequestHash != "a" {
+				t.Errorf("Expected the first record, got %+v", existing)
+			}
+
+			// Keys are scoped per user
+			other := &IdempotencyRecord{UserID: "user-2", Key: "key-1", RequestHash: "a", JobID: "job_3", ExpiresAt: now.Add(time.Hour)}
+			if existing, _ := store.Reserve(ctx, other, now); existing != nil {
+				t.Errorf("Expected another user's key to be free, got %+v", existing)
+			}
+
+			// An expired key is reserved again
+			repeated.ExpiresAt = now.Add(3 * time.Hour)
+			if existing, _ := store.Reserve(ctx, repeated, now.Add(2*time.Hour)); existing != nil {
+				t.Errorf("Expected the expired key to be replaced, got %+v", existing)
+			}
+
+			deleted, err := store.DeleteExpired(ctx, now.Add(90*time.Minute))
+			if err != nil || deleted != 1 {
+				t.Errorf("Expected user-2's key to expire, deleted %d: %v", deleted, err)
+			}
+
+			if err := store.Delete(ctx, "user-1", "key-1"); err != nil {
+				t.Fatalf("Delete failed: %v", err)
+			}
+			if existing, _ := store.Reserve(ctx, first, now); existing != nil {
+				t.Errorf("Expected the deleted key to be free, got %+v", existing)
+			}
+		})
+	}
+}
+
+func TestAddJobIdempotency(t *testing.T) {
+	q := NewQueue(testLogger{}, nil, nil, 1)
+	newJob := func(userID, format string) *Job {
+		return &Job{
+			UserID:         userID,
+			Type:           JobTypeExport,
+			Data:           map[string]interface{}{"format": format},
+			IdempotencyKey: "resend-1",
+		}
+	}
+
+	first := newJob("user-1", "pdf")
+	if err := q.AddJob(first); err != nil {
+		t.Fatalf("AddJob failed: %v", err)
+	}
+
+	// The app resends the request
+	resent := newJob("user-1", "pdf")
+	if err := q.AddJob(resent); err != nil {
+		t.Fatalf("Expected the resent job to be accepted: %v", err)
+	}
+	if resent.ID != first.ID || resent.Status != JobStatusQueued {
+		t.Errorf("Expected the original job %s, got %s", first.ID, resent.ID)
+	}
+	if q.scheduler.len() != 1 {
+		t.Errorf("Expected one queued job, got %d", q.scheduler.len())
+	}
+
+	if err := q.AddJob(newJob("user-1", "dwg")); !errors.Is(err, ErrIdempotencyConflict) {
+		t.Errorf("Expected a conflict for a different payload, got %v", err)
+	}
+
+	other := newJob("user-2", "pdf")
+	if err := q.AddJob(other); err != nil || other.ID == first.ID {
+		t.Errorf("Expected another user's key to queue a new job, got %s: %v", other.ID, err)
+	}
+
+	long := newJob("user-1", "pdf")
+	long.IdempotencyKey = string(make([]byte, maxIdempotencyKeyLength+1))
+	if err := q.AddJob(long); !errors.Is(err, ErrInvalidIdempotencyKey) {
+		t.Errorf("Expected an overlong key to be rejected, got %v", err)
+	}
+}
+
+func TestAddJobIdempotencyWindow(t *testing.T) {
+	q := NewQueue(testLogger{}, nil, nil, 1)
+	q.SetIdempotencyWindow(time.Millisecond)
+
+	first := &Job{UserID: "user-1", Type: JobTypeExport, IdempotencyKey: "resend-1"}
+	if err := q.AddJob(first); err != nil {
+		t.Fatalf("AddJob failed: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	later := &Job{UserID: "user-1", Type: JobTypeExport, IdempotencyKey: "resend-1"}
+	if err := q.AddJob(later); err != nil {
+		t.Fatalf("AddJob failed: %v", err)
+	}
+	if later.ID == first.ID {
+		t.Error("Expected a key past its window to queue a new job")
+	}
+}
+
+func TestSubmitPipelineIdempotency(t *testing.T) {
+	q := NewQueue(testLogger{}, nil, nil, 1)
+
+	pipeline := designPipeline()
+	pipeline.IdempotencyKey = "package-1"
+	original, err := q.SubmitPipeline(pipeline)
+	if err != nil {
+		t.Fatalf("SubmitPipeline failed: %v", err)
+	}
+
+	resent := designPipeline()
+	resent.IdempotencyKey = "package-1"
+	replayed, err := q.SubmitPipeline(resent)
+	if err != nil {
+		t.Fatalf("Expected the resent pipeline to be accepted: %v", err)
+	}
+	if resent.ID != pipeline.ID || len(replayed) != len(original) || replayed[0].ID != original[0].ID {
+		t.Errorf("Expected the original pipeline %s, got %s", pipeline.ID, resent.ID)
+	}
+
+	changed := designPipeline()
+	changed.IdempotencyKey = "package-1"
+	changed.Steps[2].Data["style"] = "industrial"
+	if _, err := q.SubmitPipeline(changed); !errors.Is(err, ErrIdempotencyConflict) {
+		t.Errorf("Expected a conflict for a different pipeline, got %v", err)
+	}
+}
@@ -0,0 +1,321 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/compozit/vision/backend/internal/infrastructure/ai"
+)
+
+const (
+	// lateReconcileInterval is how often predictions that outlived their render call are polled
+	lateReconcileInterval = 30 * time.Second
+
+	// lateResultTimeout is how long a parked job waits for its late result before it fails
+	lateResultTimeout = 30 * time.Minute
+)
+
+// ErrLateResultTimeout is the error of a parked job whose result never arrived
+var ErrLateResultTimeout = errors.New("render result did not arrive in time")
+
+// LateRender records the provider predictions a job waits for after they
+// outlived the render wait timeout. It is stored with the job, so another
+// worker process resumes reconciling them when the one that parked it stops.
+type LateRender struct {
+	Predictions []LatePrediction `json:"predictions"`
+	Deadline    time.Time        `json:"deadline"`
+}
+
+// LatePrediction is a provider prediction a parked job waits for
+type LatePrediction struct {
+	ID    string `json:"id"`
+	Index int    `json:"index,omitempty"`
+	Seed  int64  `json:"seed,omitempty"`
+}
+
+// waitsFor reports whether the job still waits for a prediction
+func (l *LateRender) waitsFor(predictionID string) bool {
+	if l == nil {
+		return false
+	}
+	for _, prediction := range l.Predictions {
+		if prediction.ID == predictionID {
+			return true
+		}
+	}
+	return false
+}
+
+// without returns the late render minus a delivered prediction
+func (l *LateRender) without(predictionID string) *LateRender {
+	remaining := &LateRender{Deadline: l.Deadline}
+	for _, prediction := range l.Predictions {
+		if prediction.ID != predictionID {
+			remaining.Predictions = append(remaining.Predictions, prediction)
+		}
+	}
+	return remaining
+}
+
+// latePredictions returns the predictions a render still waits for when err
+// reports that they outlived the wait timeout, and the result of the variants
+// that completed in time, if any
+func latePredictions(err error) ([]LatePrediction, *ai.RenderResult, bool) {
+	var variants *ai.PendingVariantsError
+	if errors.As(err, &variants) {
+		predictions := make([]LatePrediction, len(variants.Pending))
+		for i, pending := range variants.Pending {
+			predictions[i] = LatePrediction{ID: pending.PredictionID, Index: pending.Index, Seed: pending.Seed}
+		}
+		return predictions, variants.Result, true
+	}
+
+	var pending *ai.PredictionPendingError
+	if errors.As(err, &pending) {
+		return []LatePrediction{{ID: pending.PredictionID, Index: pending.Index, Seed: pending.Seed}}, nil, true
+	}
+	return nil, nil, false
+}
+
+// awaitLateResult parks a job whose predictions outlived the render wait timeout.
+// The job stays processing until every prediction is reconciled, instead of
+// being retried and paying for them again; variants that completed in time are
+// its result meanwhile. A job that cannot be saved as parked gives up on the
+// predictions and fails with err instead.
+func (q *Queue) awaitLateResult(job *Job, err error) bool {
+	predictions, partial, ok := latePredictions(err)
+	if !ok {
+		return false
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	late := &LateRender{Predictions: predictions, Deadline: time.Now().Add(lateResultTimeout)}
+
+	stored, exists := q.GetJob(job.ID)
+	if !exists || stored.Status != JobStatusProcessing {
+		// Cancelled while it rendered, so nobody wants the results
+		q.cancelLateRender(late)
+		return true
+	}
+
+	stored.Progress = 90
+	stored.LateRender = late
+	if partial != nil {
+		stored.Result = partial
+	}
+	if err := q.store.Update(context.Background(), stored); err != nil {
+		q.logger.Error("Failed to park job for late result", "job_id", job.ID, "error", err)
+		q.cancelLateRender(late)
+		return false
+	}
+
+	for _, prediction := range predictions {
+		q.pendingPredictions[prediction.ID] = job.ID
+		q.logger.Info("Job awaiting late prediction result",
+			"job_id", job.ID,
+			"prediction_id", prediction.ID)
+	}
+
+	q.notifier.NotifyJobUpdated(stored)
+	return true
+}
+
+// handleLateRenderResult settles a late prediction of a parked job. Its variant
+// joins the job's result; the job completes once every prediction it waits for
+// has settled, and fails if none produced a variant. Results are applied under
+// the parked job's lease, so a job another process adopted while this one
+// stalled is not completed twice.
+func (q *Queue) handleLateRenderResult(predictionID string, result *ai.RenderResult, err error) {
+	q.mu.Lock()
+	jobID, exists := q.pendingPredictions[predictionID]
+	delete(q.pendingPredictions, predictionID)
+	q.mu.Unlock()
+
+	if !exists {
+		q.logger.Warn("Late prediction result has no matching job", "prediction_id", predictionID)
+		return
+	}
+
+	job, adoptErr := q.store.Adopt(context.Background(), jobID, q.instanceID, jobLeaseDuration)
+	if adoptErr != nil || !job.LateRender.waitsFor(predictionID) {
+		q.logger.Info("Discarding late prediction result",
+			"job_id", jobID,
+			"prediction_id", predictionID,
+			"reason", adoptErr)
+		return
+	}
+
+	merged, _ := job.Result.(*ai.RenderResult)
+	if err != nil {
+		q.logger.Error("Late prediction failed", "job_id", jobID, "prediction_id", predictionID, "error", err)
+	} else {
+		merged = withLateVariants(merged, result)
+	}
+
+	if remaining := job.LateRender.without(predictionID); len(remaining.Predictions) > 0 {
+		q.saveLateRender(jobID, remaining, merged)
+		return
+	}
+	defer q.releaseJob(jobID, q.instanceID)
+
+	if merged == nil {
+		q.UpdateJob(jobID, JobStatusFailed, job.Progress, nil, err)
+		return
+	}
+
+	if merged.RequestID == "" {
+		merged.RequestID = jobID
+	}
+	if job.Type == JobTypeUpscale {
+		q.attachDerivedAsset(job, merged)
+	}
+
+	q.UpdateJob(jobID, JobStatusCompleted, 100, merged, nil)
+}
+
+// saveLateRender records the predictions a parked job still waits for and the
+// variants it has so far
+func (q *Queue) saveLateRender(jobID string, late *LateRender, result *ai.RenderResult) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, exists := q.GetJob(jobID)
+	if !exists || job.Status != JobStatusProcessing {
+		return
+	}
+
+	job.LateRender = late
+	if result != nil {
+		job.Result = result
+	}
+	if err := q.store.Update(context.Background(), job); err != nil {
+		q.logger.Error("Failed to save late render", "job_id", jobID, "error", err)
+		return
+	}
+	q.notifier.NotifyJobUpdated(job)
+}
+
+// withLateVariants adds the variants of a late result to the result a parked
+// job has so far, keeping them in request order. The first variant stays the
+// primary image, as in results rendered without delay.
+func withLateVariants(partial, late *ai.RenderResult) *ai.RenderResult {
+	if partial == nil {
+		return late
+	}
+
+	merged := *partial
+	merged.Variants = append(append([]ai.RenderVariant(nil), partial.Variants...), late.Variants...)
+	sort.SliceStable(merged.Variants, func(i, j int) bool {
+		return merged.Variants[i].Index < merged.Variants[j].Index
+	})
+
+	primary := merged.Variants[0]
+	merged.ID = primary.PredictionID
+	merged.ResultImageURL = primary.ImageURL
+	merged.ThumbnailURL = primary.ThumbnailURL
+	merged.ImageHash = primary.ImageHash
+	merged.Seed = primary.Seed
+	merged.ProcessingTime = late.ProcessingTime
+	merged.CompletedAt = late.CompletedAt
+	return &merged
+}
+
+// reconcileLatePredictions adopts parked jobs, at start and then periodically,
+// and polls the predictions whose webhook never arrived
+func (q *Queue) reconcileLatePredictions(ctx context.Context) {
+	ticker := time.NewTicker(lateReconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		q.adoptLateRenders(ctx)
+		q.aiRenderer.ReconcileLatePredictions(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// adoptLateRenders leases the parked jobs of the types this process runs and
+// resumes the predictions it does not track yet, e.g. those of a process that
+// stopped. Renewing the lease every round keeps other processes from adopting
+// the same jobs. Jobs parked past their deadline fail.
+func (q *Queue) adoptLateRenders(ctx context.Context) {
+	processing, err := q.store.List(ctx, JobFilter{Types: q.brokerTypes, Statuses: []JobStatus{JobStatusProcessing}})
+	if err != nil {
+		q.logger.Error("Failed to list parked jobs", "error", err)
+		return
+	}
+
+	now := time.Now()
+	for _, job := range processing {
+		if job.LateRender == nil {
+			continue
+		}
+
+		// A job still leased to another live process is left to it
+		adopted, err := q.store.Adopt(ctx, job.ID, q.instanceID, jobLeaseDuration)
+		if err != nil {
+			if !errors.Is(err, ErrJobNotClaimable) {
+				q.logger.Error("Failed to adopt parked job", "job_id", job.ID, "error", err)
+			}
+			continue
+		}
+
+		if now.After(adopted.LateRender.Deadline) {
+			q.expireLateRender(adopted)
+			continue
+		}
+		q.resumeLateRender(adopted)
+	}
+}
+
+// resumeLateRender hands the predictions of an adopted job to the renderer
+func (q *Queue) resumeLateRender(job *Job) {
+	startedAt := job.CreatedAt
+	if job.StartedAt != nil {
+		startedAt = *job.StartedAt
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, prediction := range job.LateRender.Predictions {
+		q.pendingPredictions[prediction.ID] = job.ID
+		if q.aiRenderer.ResumePrediction(prediction.ID, job.ID, prediction.Index, prediction.Seed, startedAt) {
+			q.logger.Info("Resumed late prediction", "job_id", job.ID, "prediction_id", prediction.ID)
+		}
+	}
+}
+
+// expireLateRender fails a job whose late result did not arrive in time and
+// stops its predictions
+func (q *Queue) expireLateRender(job *Job) {
+	q.mu.Lock()
+	q.cancelLateRender(job.LateRender)
+	q.mu.Unlock()
+
+	q.logger.Warn("Late prediction result timed out", "job_id", job.ID, "timeout", lateResultTimeout)
+	q.UpdateJob(job.ID, JobStatusFailed, job.Progress, nil,
+		Permanent(fmt.Errorf("%w after %s", ErrLateResultTimeout, lateResultTimeout)))
+	q.releaseJob(job.ID, q.instanceID)
+}
+
+// cancelLateRender stops the predictions of a parked job whose result is no
+// longer wanted. Callers must hold q.mu.
+func (q *Queue) cancelLateRender(late *LateRender) {
+	if late == nil || q.aiRenderer == nil {
+		return
+	}
+	for _, prediction := range late.Predictions {
+		delete(q.pendingPredictions, prediction.ID)
+		q.aiRenderer.CancelPrediction(prediction.ID)
+	}
+}
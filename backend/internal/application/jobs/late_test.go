@@ -0,0 +1,158 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/compozit/vision/backend/internal/infrastructure/ai"
+)
+
+// newLateQueue returns a queue with a renderer sharing store, standing in for
+// the worker process instanceID
+func newLateQueue(store JobStore, instanceID string) *Queue {
+	q := NewQueue(testLogger{}, ai.NewRenderer("", nil, testLogger{}), nil, 1)
+	q.SetStore(store)
+	q.instanceID = instanceID
+	return q
+}
+
+func TestParkedJobResumesAfterRestart(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			first := newLateQueue(store, "worker-1")
+			job := newStoredJob("job_1", "user-1", JobTypeAIQuick, time.Now())
+			store.Create(ctx, job)
+			store.Claim(ctx, job.ID, "worker-a", time.Minute)
+
+			pending := fmt.Errorf("AI rendering failed: %w", &ai.PredictionPendingError{PredictionID: "p1", Seed: 7})
+			if !first.awaitLateResult(job, pending) {
+				t.Fatal("Expected the job to be parked")
+			}
+			store.Release(ctx, job.ID, "worker-a")
+
+			stored, _ := store.Get(ctx, job.ID)
+			if stored.Status != JobStatusProcessing || !stored.LateRender.waitsFor("p1") {
+				t.Fatalf("Expected the parked prediction to be stored, got %+v", stored)
+			}
+
+			// The first process stopped; another one sharing the store picks the prediction up
+			second := newLateQueue(store, "worker-2")
+			second.adoptLateRenders(ctx)
+			if second.pendingPredictions["p1"] != job.ID {
+				t.Fatalf("Expected p1 to be resumed, got %v", second.pendingPredictions)
+			}
+			if second.aiRenderer.ResumePrediction("p1", job.ID, 0, 7, time.Now()) {
+				t.Error("Expected the renderer to reconcile p1 already")
+			}
+
+			// Its lease keeps a third process from reconciling the job too
+			third := newLateQueue(store, "worker-3")
+			third.adoptLateRenders(ctx)
+			if len(third.pendingPredictions) != 0 {
+				t.Errorf("Expected the adopted job to be left alone, got %v", third.pendingPredictions)
+			}
+
+			second.handleLateRenderResult("p1", &ai.RenderResult{ID: "p1", Status: "completed", Seed: 7}, nil)
+			stored, _ = store.Get(ctx, job.ID)
+			if stored.Status != JobStatusCompleted || stored.LateRender != nil || stored.WorkerID != "" {
+				t.Errorf("Expected a completed job without late render or lease, got %+v", stored)
+			}
+			if result, ok := stored.Result.(*ai.RenderResult); !ok || result.RequestID != job.ID {
+				t.Errorf("Expected the late render result, got %#v", stored.Result)
+			}
+
+			// A copy of the result reaching the stopped process changes nothing
+			first.handleLateRenderResult("p1", nil, errors.New("prediction failed"))
+			if stored, _ = store.Get(ctx, job.ID); stored.Status != JobStatusCompleted {
+				t.Errorf("Expected the job to stay completed, got %s", stored.Status)
+			}
+		})
+	}
+}
+
+func TestParkedJobFailsAfterDeadline(t *testing.T) {
+	ctx := context.Background()
+	q := newLateQueue(NewMemoryJobStore(), "worker-1")
+
+	job := newStoredJob("job_1", "user-1", JobTypeAIQuick, time.Now().Add(-time.Hour))
+	job.Status = JobStatusProcessing
+	job.LateRender = &LateRender{Predictions: []LatePrediction{{ID: "p1"}}, Deadline: time.Now().Add(-time.Minute)}
+	q.store.Create(ctx, job)
+
+	q.adoptLateRenders(ctx)
+
+	stored, _ := q.GetJob(job.ID)
+	if stored.Status != JobStatusFailed || stored.LateRender != nil || stored.WorkerID != "" {
+		t.Fatalf("Expected the job to fail without late render or lease, got %+v", stored)
+	}
+	if stored.Failure == nil || stored.Failure.Kind != FailurePermanent || !strings.Contains(stored.Error, ErrLateResultTimeout.Error()) {
+		t.Errorf("Expected a permanent timeout failure, got %+v: %s", stored.Failure, stored.Error)
+	}
+	if len(q.pendingPredictions) != 0 {
+		t.Errorf("Expected the prediction to be dropped, got %v", q.pendingPredictions)
+	}
+}
+
+func TestParkedVariantsCompleteOnceAllSettle(t *testing.T) {
+	ctx := context.Background()
+	q := newLateQueue(NewMemoryJobStore(), "worker-1")
+
+	park := func(id string, err error) {
+		t.Helper()
+		job := newStoredJob(id, "user-1", JobTypeAIQuick, time.Now())
+		q.store.Create(ctx, job)
+		q.store.Claim(ctx, id, "worker-a", time.Minute)
+		if !q.awaitLateResult(job, err) {
+			t.Fatalf("Expected %s to be parked", id)
+		}
+		q.store.Release(ctx, id, "worker-a")
+	}
+	variant := func(index int) *ai.RenderResult {
+		v := ai.RenderVariant{Index: index, Seed: int64(100 + index), PredictionID: fmt.Sprintf("p%d", index)}
+		return &ai.RenderResult{ID: v.PredictionID, Status: "completed", Seed: v.Seed, Variants: []ai.RenderVariant{v}}
+	}
+
+	// One variant completed in time; the other two are parked together
+	park("job_1", &ai.PendingVariantsError{
+		Pending: []*ai.PredictionPendingError{{PredictionID: "p2", Index: 2, Seed: 102}, {PredictionID: "p1", Index: 1, Seed: 101}},
+		Result:  variant(0),
+	})
+	stored, _ := q.GetJob("job_1")
+	if len(stored.LateRender.Predictions) != 2 || len(stored.Result.(*ai.RenderResult).Variants) != 1 {
+		t.Fatalf("Expected two parked predictions and one variant, got %+v", stored)
+	}
+
+	q.handleLateRenderResult("p2", nil, errors.New("prediction failed"))
+	stored, _ = q.GetJob("job_1")
+	if stored.Status != JobStatusProcessing || stored.LateRender.waitsFor("p2") || !stored.LateRender.waitsFor("p1") {
+		t.Fatalf("Expected the job to keep waiting for p1 only, got %+v", stored.LateRender)
+	}
+
+	q.handleLateRenderResult("p1", variant(1), nil)
+	stored, _ = q.GetJob("job_1")
+	result, _ := stored.Result.(*ai.RenderResult)
+	if stored.Status != JobStatusCompleted || result == nil || len(result.Variants) != 2 {
+		t.Fatalf("Expected the job to complete with two variants, got %s: %#v", stored.Status, stored.Result)
+	}
+	if result.Variants[0].Index != 0 || result.Variants[1].Index != 1 || result.ID != "p0" || result.RequestID != "job_1" {
+		t.Errorf("Expected variants in request order with the first as primary, got %+v", result)
+	}
+
+	// Without any variant the job fails once its last prediction settles
+	park("job_2", &ai.PendingVariantsError{
+		Pending: []*ai.PredictionPendingError{{PredictionID: "p3"}, {PredictionID: "p4", Index: 1}},
+	})
+	q.handleLateRenderResult("p3", nil, errors.New("prediction failed"))
+	if stored, _ = q.GetJob("job_2"); stored.Status != JobStatusProcessing {
+		t.Fatalf("Expected job_2 to wait for p4, got %s", stored.Status)
+	}
+	q.handleLateRenderResult("p4", nil, errors.New("prediction canceled"))
+	if stored, _ = q.GetJob("job_2"); stored.Status != JobStatusFailed || stored.Error != "prediction canceled" {
+		t.Errorf("Expected job_2 to fail with the last error, got %s: %s", stored.Status, stored.Error)
+	}
+}
@@ -0,0 +1,325 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/compozit/vision/backend/internal/infrastructure/ai"
+	"github.com/compozit/vision/backend/internal/infrastructure/modeling"
+	"github.com/google/uuid"
+)
+
+// Payload is the typed data of a job. Job.Data holds it as a map so stores can
+// persist any job type; decodePayload turns the map back into the payload.
+type Payload interface {
+	// Validate reports why the payload cannot run
+	Validate() error
+}
+
+// PayloadSpec registers the payload of a job type
+type PayloadSpec struct {
+	// Version is stamped on new jobs as their DataVersion. Raise it whenever the
+	// payload changes in a way older data does not decode into.
+	Version int
+	// New returns an empty payload to decode job data into
+	New func() Payload
+	// Upgrade migrates data written with version to version+1. Nil means every
+	// older version decodes as is.
+	Upgrade func(version int, data map[string]interface{}) (map[string]interface{}, error)
+}
+
+// payloadSpecs holds the payload of every job type the queue runs
+var payloadSpecs = map[JobType]PayloadSpec{}
+
+// RegisterPayload registers the payload of a job type. Jobs of types without a
+// payload are rejected at submission. It is meant to be called from init.
+func RegisterPayload(jobType JobType, spec PayloadSpec) {
+	if spec.New == nil || spec.Version < 1 {
+		panic(fmt.Sprintf("invalid payload spec for job type %s", jobType))
+	}
+	payloadSpecs[jobType] = spec
+}
+
+// PayloadTypes returns the job types with a registered payload, sorted
+func PayloadTypes() []JobType {
+	types := make([]JobType, 0, len(payloadSpecs))
+	for jobType := range payloadSpecs {
+		types = append(types, jobType)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// PayloadError reports job data that does not decode into its type's payload or
+// fails its validation. Running the job again cannot fix it.
+type PayloadError struct {
+	Type JobType
+	Err  error
+}
+
+func (e *PayloadError) Error() string {
+	return fmt.Sprintf("invalid %s payload: %v", e.Type, e.Err)
+}
+
+func (e *PayloadError) Unwrap() error {
+	return e.Err
+}
+
+// decodePayload upgrades a job's data to the current version of its payload,
+// decodes and validates it
+func decodePayload(job *Job) (Payload, error) {
+	spec, ok := payloadSpecs[job.Type]
+	if !ok {
+		return nil, &PayloadError{Type: job.Type, Err: errors.New("unknown job type")}
+	}
+	if job.DataVersion > spec.Version {
+		return nil, &PayloadError{Type: job.Type, Err: fmt.Errorf("data version %d is newer than %d", job.DataVersion, spec.Version)}
+	}
+
+	data := job.Data
+	if spec.Upgrade != nil {
+		for version := job.DataVersion; version < spec.Version; version++ {
+			upgraded, err := spec.Upgrade(version, data)
+			if err != nil {
+				return nil, &PayloadError{Type: job.Type, Err: fmt.Errorf("failed to upgrade data version %d: %w", version, err)}
+			}
+			data = upgraded
+		}
+	}
+
+	// Data holds Go values for new jobs and JSON values for stored ones;
+	// a JSON round trip decodes both the same way
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, &PayloadError{Type: job.Type, Err: err}
+	}
+	payload := spec.New()
+	if err := json.Unmarshal(encoded, payload); err != nil {
+		return nil, &PayloadError{Type: job.Type, Err: err}
+	}
+
+	if err := payload.Validate(); err != nil {
+		return nil, &PayloadError{Type: job.Type, Err: err}
+	}
+	return payload, nil
+}
+
+// jobPayload decodes the payload of a job into the payload type P
+func jobPayload[P Payload](job *Job) (P, error) {
+	var typed P
+	payload, err := decodePayload(job)
+	if err != nil {
+		return typed, err
+	}
+
+	typed, ok := payload.(P)
+	if !ok {
+		return typed, &PayloadError{Type: job.Type, Err: fmt.Errorf("unexpected payload %T", payload)}
+	}
+	return typed, nil
+}
+
+// validatePayload checks a new job's data and stamps it with the payload version
+func validatePayload(job *Job) error {
+	job.DataVersion = 0
+	if _, err := decodePayload(job); err != nil {
+		return err
+	}
+	return stampPayloadVersion(job)
+}
+
+// stampPayloadVersion stamps a new job with the payload version of its type,
+// leaving its data to be validated when it runs
+func stampPayloadVersion(job *Job) error {
+	spec, ok := payloadSpecs[job.Type]
+	if !ok {
+		return &PayloadError{Type: job.Type, Err: errors.New("unknown job type")}
+	}
+	job.DataVersion = spec.Version
+	return nil
+}
+
+// StyleChoice selects a curated style for a render, overriding its style name
+type StyleChoice struct {
+	StyleReferenceID string `json:"style_reference_id,omitempty"`
+	AmbianceOptionID string `json:"ambiance_option_id,omitempty"`
+	PaletteIndex     int    `json:"palette_index,omitempty"`
+}
+
+// styleChoice is promoted to the payloads embedding a StyleChoice
+func (c StyleChoice) styleChoice() StyleChoice {
+	return c
+}
+
+// validate checks that the referenced style and ambiance are catalogue IDs
+func (c StyleChoice) validate() error {
+	if c.StyleReferenceID != "" {
+		if _, err := uuid.Parse(c.StyleReferenceID); err != nil {
+			return fmt.Errorf("style_reference_id is not a UUID: %q", c.StyleReferenceID)
+		}
+	}
+	if c.AmbianceOptionID != "" {
+		if _, err := uuid.Parse(c.AmbianceOptionID); err != nil {
+			return fmt.Errorf("ambiance_option_id is not a UUID: %q", c.AmbianceOptionID)
+		}
+	}
+	if c.PaletteIndex < 0 {
+		return fmt.Errorf("palette_index must not be negative: %d", c.PaletteIndex)
+	}
+	return nil
+}
+
+// RenderPayload is the data of quick and detailed room renders
+type RenderPayload struct {
+	// Type overrides the render type implied by the job type
+	Type       ai.RenderType `json:"type,omitempty"`
+	InputImage string        `json:"input_image,omitempty"`
+	Style      string        `json:"style,omitempty"`
+	StyleChoice
+	RoomType       string                 `json:"room_type,omitempty"`
+	Prompt         string                 `json:"prompt,omitempty"`
+	FurnitureItems []string               `json:"furniture_items,omitempty"`
+	ColorScheme    []string               `json:"color_scheme,omitempty"`
+	Lighting       string                 `json:"lighting,omitempty"`
+	Additional     []string               `json:"additional,omitempty"`
+	Variants       int                    `json:"variants,omitempty"`
+	Seed           *int64                 `json:"seed,omitempty"`
+	SourceJobID    string                 `json:"source_job_id,omitempty"` // detailed render of a preview variant
+	Parameters     map[string]interface{} `json:"parameters,omitempty"`
+}
+
+func (p *RenderPayload) Validate() error {
+	switch p.Type {
+	case "", ai.RenderTypeQuick, ai.RenderTypeDetailed:
+	default:
+		return fmt.Errorf("unknown render type: %q", p.Type)
+	}
+	if err := p.StyleChoice.validate(); err != nil {
+		return err
+	}
+	return (&ai.RenderRequest{Variants: p.Variants, Seed: p.Seed}).Validate()
+}
+
+// ModelPayload is the data of 3D model generation
+type ModelPayload struct {
+	Type       modeling.ModelType     `json:"type,omitempty"` // room unless set
+	Room       *modeling.Room         `json:"room" jsonschema:"required"`
+	Furniture  []modeling.Furniture   `json:"furniture,omitempty"`
+	Lights     []modeling.Light       `json:"lights,omitempty"`
+	Materials  []modeling.Material    `json:"materials,omitempty"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+	// ReferenceImage is the render a pipeline builds the model from
+	ReferenceImage string `json:"reference_image,omitempty"`
+}
+
+func (p *ModelPayload) Validate() error {
+	switch p.Type {
+	case "", modeling.ModelTypeRoom, modeling.ModelTypeFurniture, modeling.ModelTypeComplete:
+	default:
+		return fmt.Errorf("unknown model type: %q", p.Type)
+	}
+	if p.Room == nil {
+		return errors.New("room is required")
+	}
+	return nil
+}
+
+// InpaintingPayload is the data of furniture inpainting
+type InpaintingPayload struct {
+	BaseImage     string       `json:"base_image,omitempty"`
+	MaskImage     string       `json:"mask_image,omitempty"`
+	MaskSpec      *ai.MaskSpec `json:"mask_spec,omitempty"` // generates the mask when mask_image is empty
+	Prompt        string       `json:"prompt,omitempty"`
+	FurnitureType string       `json:"furniture_type,omitempty"`
+	Style         string       `json:"style,omitempty"`
+	StyleChoice
+	NegativePrompt string  `json:"negative_prompt,omitempty"`
+	Strength       float32 `json:"strength,omitempty"`
+	GuidanceScale  float32 `json:"guidance_scale,omitempty"`
+	Steps          int     `json:"steps,omitempty"`
+}
+
+func (p *InpaintingPayload) Validate() error {
+	if err := p.StyleChoice.validate(); err != nil {
+		return err
+	}
+	if p.MaskImage != "" {
+		if p.BaseImage == "" {
+			return errors.New("base_image is required")
+		}
+		return nil
+	}
+	if p.MaskSpec == nil {
+		return errors.New("mask_image or mask_spec is required")
+	}
+	if err := p.MaskSpec.Validate(); err != nil {
+		return err
+	}
+	// A furniture reference also supplies the base image
+	if p.BaseImage == "" && p.MaskSpec.SpaceAnalysisID == "" {
+		return errors.New("base_image is required")
+	}
+	return nil
+}
+
+// StyleTransferPayload is the data of style transfer
+type StyleTransferPayload struct {
+	ContentImage string `json:"content_image" jsonschema:"required"`
+	Style        string `json:"style,omitempty"`
+	StyleChoice
+	Strength float32 `json:"strength,omitempty"`
+}
+
+func (p *StyleTransferPayload) Validate() error {
+	if p.ContentImage == "" {
+		return errors.New("content_image is required")
+	}
+	return p.StyleChoice.validate()
+}
+
+// UpscalePayload is the data of upscaling a stored render
+type UpscalePayload struct {
+	SourceJobID   string `json:"source_job_id,omitempty"`
+	SourceVariant int    `json:"source_variant,omitempty"`
+	SourceImage   string `json:"source_image" jsonschema:"required"`
+	SourceHash    string `json:"source_hash,omitempty"`
+	Scale         int    `json:"scale" jsonschema:"required"`
+}
+
+func (p *UpscalePayload) Validate() error {
+	return (&ai.UpscaleRequest{SourceImage: p.SourceImage, Scale: p.Scale}).Validate()
+}
+
+// ComposePayload is the data of before/after presentation images
+type ComposePayload struct {
+	Composition ai.ComposeRequest `json:"composition" jsonschema:"required"`
+}
+
+func (p *ComposePayload) Validate() error {
+	return p.Composition.Validate()
+}
+
+// ExportPayload is the data of model and drawing exports
+type ExportPayload struct {
+	Format  string `json:"format,omitempty"`
+	Drawing string `json:"drawing,omitempty"`
+	// ModelURL is the model a pipeline exports from
+	ModelURL string `json:"model_url,omitempty"`
+}
+
+func (p *ExportPayload) Validate() error {
+	return nil
+}
+
+func init() {
+	RegisterPayload(JobTypeAIQuick, PayloadSpec{Version: 1, New: func() Payload { return &RenderPayload{} }})
+	RegisterPayload(JobTypeAIDetailed, PayloadSpec{Version: 1, New: func() Payload { return &RenderPayload{} }})
+	RegisterPayload(JobType3DModel, PayloadSpec{Version: 1, New: func() Payload { return &ModelPayload{} }})
+	RegisterPayload(JobTypeInpainting, PayloadSpec{Version: 1, New: func() Payload { return &InpaintingPayload{} }})
+	RegisterPayload(JobTypeStyleTransfer, PayloadSpec{Version: 1, New: func() Payload { return &StyleTransferPayload{} }})
+	RegisterPayload(JobTypeUpscale, PayloadSpec{Version: 1, New: func() Payload { return &UpscalePayload{} }})
+	RegisterPayload(JobTypeCompose, PayloadSpec{Version: 1, New: func() Payload { return &ComposePayload{} }})
+	RegisterPayload(JobTypeExport, PayloadSpec{Version: 1, New: func() Payload { return &ExportPayload{} }})
+}
@@ -0,0 +1,217 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/compozit/vision/backend/internal/infrastructure/ai"
+	"github.com/compozit/vision/backend/internal/infrastructure/modeling"
+)
+
+// renamedPayload is a test payload whose field was renamed in version 2
+type renamedPayload struct {
+	Title string `json:"title" jsonschema:"required"`
+}
+
+func (p *renamedPayload) Validate() error {
+	if p.Title == "" {
+		return errors.New("title is required")
+	}
+	return nil
+}
+
+func registerRenamedPayload(t *testing.T) JobType {
+	jobType := JobType("test_renamed")
+	RegisterPayload(jobType, PayloadSpec{
+		Version: 2,
+		New:     func() Payload { return &renamedPayload{} },
+		Upgrade: func(version int, data map[string]interface{}) (map[string]interface{}, error) {
+			if version < 1 {
+				return data, nil
+			}
+			upgraded := make(map[string]interface{}, len(data))
+			for key, value := range data {
+				upgraded[key] = value
+			}
+			upgraded["title"] = data["name"]
+			delete(upgraded, "name")
+			return upgraded, nil
+		},
+	})
+	t.Cleanup(func() { delete(payloadSpecs, jobType) })
+	return jobType
+}
+
+func TestDecodePayload(t *testing.T) {
+	job := &Job{Type: JobTypeAIDetailed, Data: map[string]interface{}{
+		"style":              "modern",
+		"style_reference_id": "7f1c2a3e-8d4b-4c6a-9e2f-1b3d5a7c9e0f",
+		"variants":           float64(2), // as decoded from a store
+		"seed":               int64(7),
+	}}
+
+	payload, err := jobPayload[*RenderPayload](job)
+	if err != nil {
+		t.Fatalf("jobPayload failed: %v", err)
+	}
+	if payload.Style != "modern" || payload.StyleReferenceID != "7f1c2a3e-8d4b-4c6a-9e2f-1b3d5a7c9e0f" || payload.Variants != 2 || *payload.Seed != 7 {
+		t.Errorf("Unexpected payload %+v", payload)
+	}
+
+	req, err := (&Queue{}).jobToRenderRequest(job)
+	if err != nil {
+		t.Fatalf("jobToRenderRequest failed: %v", err)
+	}
+	if req.Type != "detailed" {
+		t.Errorf("Expected the render type of the job type, got %s", req.Type)
+	}
+}
+
+func TestStyleSelectionFailuresAreNotRetried(t *testing.T) {
+	q := NewQueue(testLogger{}, ai.NewRenderer("", nil, testLogger{}), nil, 1)
+	job := &Job{ID: "job_1", Type: JobTypeAIQuick, Data: map[string]interface{}{
+		"style_reference_id": "7f1c2a3e-8d4b-4c6a-9e2f-1b3d5a7c9e0f",
+	}}
+
+	err := q.processAIQuickJob(context.Background(), job)
+	if !errors.Is(err, ai.ErrStylesNotConfigured) {
+		t.Fatalf("Expected ErrStylesNotConfigured, got %v", err)
+	}
+	if IsRetryable(err) {
+		t.Error("Expected a style that cannot be loaded not to be retried")
+	}
+}
+
+func TestDecodePayloadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		job  *Job
+	}{
+		{name: "missing room", job: &Job{Type: JobType3DModel, Data: map[string]interface{}{}}},
+		{name: "wrong type", job: &Job{Type: JobTypeUpscale, Data: map[string]interface{}{"source_image": "a.png", "scale": "two"}}},
+		{name: "invalid scale", job: &Job{Type: JobTypeUpscale, Data: map[string]interface{}{"source_image": "a.png", "scale": 3}}},
+		{name: "style reference not a UUID", job: &Job{Type: JobTypeAIQuick, Data: map[string]interface{}{"style_reference_id": "modern"}}},
+		{name: "ambiance not a UUID", job: &Job{Type: JobTypeStyleTransfer, Data: map[string]interface{}{"content_image": "a.png", "ambiance_option_id": "cozy"}}},
+		{name: "no mask", job: &Job{Type: JobTypeInpainting, Data: map[string]interface{}{"base_image": "a.png"}}},
+		{name: "unknown type", job: &Job{Type: JobType("unknown"), Data: map[string]interface{}{}}},
+		{name: "newer version", job: &Job{Type: JobTypeExport, DataVersion: 2, Data: map[string]interface{}{}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodePayload(tt.job)
+			var payloadErr *PayloadError
+			if !errors.As(err, &payloadErr) {
+				t.Fatalf("Expected a payload error, got %v", err)
+			}
+			if IsRetryable(err) {
+				t.Error("Expected an invalid payload not to be retried")
+			}
+		})
+	}
+}
+
+func TestDecodePayloadUpgradesOldVersions(t *testing.T) {
+	jobType := registerRenamedPayload(t)
+
+	for _, version := range []int{0, 1} {
+		t.Run(fmt.Sprintf("version %d", version), func(t *testing.T) {
+			job := &Job{Type: jobType, DataVersion: version, Data: map[string]interface{}{"name": "Loft"}}
+			payload, err := jobPayload[*renamedPayload](job)
+			if err != nil {
+				t.Fatalf("jobPayload failed: %v", err)
+			}
+			if payload.Title != "Loft" {
+				t.Errorf("Expected the upgraded title, got %q", payload.Title)
+			}
+		})
+	}
+
+	current := &Job{Type: jobType, DataVersion: 2, Data: map[string]interface{}{"title": "Studio"}}
+	if payload, err := jobPayload[*renamedPayload](current); err != nil || payload.Title != "Studio" {
+		t.Errorf("Expected current data to decode as is, got %+v: %v", payload, err)
+	}
+}
+
+func TestAddJobValidatesPayload(t *testing.T) {
+	q := NewQueue(testLogger{}, nil, nil, 1)
+
+	invalid := &Job{UserID: "user-1", Type: JobType3DModel, Data: map[string]interface{}{"type": "room"}}
+	var payloadErr *PayloadError
+	if err := q.AddJob(invalid); !errors.As(err, &payloadErr) {
+		t.Fatalf("Expected a payload error, got %v", err)
+	}
+	if q.scheduler.len() != 0 {
+		t.Error("Expected the invalid job not to be queued")
+	}
+
+	valid := &Job{UserID: "user-1", Type: JobType3DModel, Data: map[string]interface{}{"room": &modeling.Room{ID: "kitchen"}}}
+	if err := q.AddJob(valid); err != nil {
+		t.Fatalf("AddJob failed: %v", err)
+	}
+	if valid.DataVersion != 1 {
+		t.Errorf("Expected data version 1, got %d", valid.DataVersion)
+	}
+}
+
+func TestPayloadSchema(t *testing.T) {
+	schema, ok := PayloadSchema(JobTypeUpscale)
+	if !ok {
+		t.Fatal("Expected a schema for upscale jobs")
+	}
+
+	required, _ := schema["required"].([]string)
+	if len(required) != 2 || required[0] != "source_image" || required[1] != "scale" {
+		t.Errorf("Expected source_image and scale to be required, got %v", required)
+	}
+	properties := schema["properties"].(map[string]interface{})
+	if scale := properties["scale"].(map[string]interface{}); scale["type"] != "integer" {
+		t.Errorf("Expected an integer scale, got %v", scale)
+	}
+
+	// Embedded style choices are flattened into the payload
+	schema, _ = PayloadSchema(JobTypeAIQuick)
+	if _, ok := schema["properties"].(map[string]interface{})["style_reference_id"]; !ok {
+		t.Error("Expected style_reference_id among the render properties")
+	}
+
+	if _, ok := PayloadSchema(JobType("unknown")); ok {
+		t.Error("Expected no schema for an unknown job type")
+	}
+}
+
+func TestWorkerRecoversPanickingJob(t *testing.T) {
+	// Without a renderer, processing a render panics
+	q := NewQueue(testLogger{}, nil, nil, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := q.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	job := &Job{UserID: "user-1", Type: JobTypeAIQuick, Data: map[string]interface{}{"style": "modern"}}
+	if err := q.AddJob(job); err != nil {
+		t.Fatalf("AddJob failed: %v", err)
+	}
+	waitFor(t, func() bool {
+		stored, _ := q.GetJob(job.ID)
+		return stored.Status == JobStatusFailed
+	})
+
+	stored, _ := q.GetJob(job.ID)
+	if stored.Failure == nil || stored.Failure.Kind != FailurePanic || stored.RetryCount != 0 {
+		t.Errorf("Expected a panic failure without retries, got %+v after %d retries", stored.Failure, stored.RetryCount)
+	}
+
+	// The worker survives to run the next job
+	next := &Job{UserID: "user-1", Type: JobTypeExport}
+	if err := q.AddJob(next); err != nil {
+		t.Fatalf("AddJob failed: %v", err)
+	}
+	waitFor(t, func() bool {
+		stored, _ := q.GetJob(next.ID)
+		return stored.Status == JobStatusProcessing
+	})
+}
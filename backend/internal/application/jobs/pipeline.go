@@ -0,0 +1,488 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JobStatusWaiting marks a pipeline job whose parent jobs have not all completed
+const JobStatusWaiting JobStatus = "waiting"
+
+// InputMapping copies a field of a parent job's result into a job's data once
+// the parent completes
+type InputMapping struct {
+	// From is the parent's step name in a PipelineStep, and its job ID once submitted
+	From string `json:"from"`
+	// Field is a dotted path into the parent's result, e.g. "variants.0.image_url";
+	// empty copies the whole result
+	Field string `json:"field,omitempty"`
+	// To is the key set in the job's data
+	To string `json:"to"`
+}
+
+// PipelineStep is one job of a pipeline
+type PipelineStep struct {
+	Name      string                 `json:"name"`
+	Type      JobType                `json:"type"`
+	Data      map[string]interface{} `json:"data"`
+	DependsOn []string               `json:"depends_on,omitempty"` // names of parent steps
+	Inputs    []InputMapping         `json:"inputs,omitempty"`
+}
+
+// Pipeline is a set of jobs whose dependencies form a directed acyclic graph.
+// A job starts once all its parents completed; a failed or cancelled parent
+// cancels every job depending on it.
+type Pipeline struct {
+	ID        string         `json:"id"`
+	UserID    string         `json:"user_id"`
+	ProjectID string         `json:"project_id"`
+	Steps     []PipelineStep `json:"steps"`
+
+	// IdempotencyKey works as for Job.IdempotencyKey; a repeated submission
+	// returns the original pipeline's jobs
+	IdempotencyKey string `json:"-"`
+}
+
+// PipelineLink records a job's place in its pipeline
+type PipelineLink struct {
+	ID        string         `json:"id"`
+	Step      string         `json:"step"`
+	Index     int            `json:"index"`                // position of the step in dependency order
+	DependsOn []string       `json:"depends_on,omitempty"` // parent job IDs
+	Inputs    []InputMapping `json:"inputs,omitempty"`
+}
+
+// PipelineStatus is the aggregate state of a pipeline's jobs
+type PipelineStatus struct {
+	ID       string    `json:"id"`
+	UserID   string    `json:"user_id"`
+	Status   JobStatus `json:"status"`
+	Progress int       `json:"progress"`
+	Jobs     []*Job    `json:"jobs"`
+}
+
+// sortSteps validates a pipeline's steps and returns them so that every step
+// comes after its parents
+func (p *Pipeline) sortSteps() ([]PipelineStep, error) {
+	if len(p.Steps) == 0 {
+		return nil, fmt.Errorf("pipeline has no steps")
+	}
+
+	steps := make(map[string]PipelineStep, len(p.Steps))
+	for _, step := range p.Steps {
+		if step.Name == "" || step.Type == "" {
+			return nil, fmt.Errorf("pipeline steps need a name and a type")
+		}
+		if _, exists := steps[step.Name]; exists {
+			return nil, fmt.Errorf("duplicate pipeline step: %s", step.Name)
+		}
+		steps[step.Name] = step
+	}
+
+	// Kahn's algorithm, keeping the submitted order among ready steps
+	pending := make(map[string]int, len(p.Steps))
+	for _, step := range p.Steps {
+		for _, parent := range step.DependsOn {
+			if _, exists := steps[parent]; !exists || parent == step.Name {
+				return nil, fmt.Errorf("step %s depends on unknown step %s", step.Name, parent)
+			}
+		}
+		for _, input := range step.Inputs {
+			if !containsString(step.DependsOn, input.From) {
+				return nil, fmt.Errorf("step %s maps input from %s, which it does not depend on", step.Name, input.From)
+			}
+			if input.To == "" {
+				return nil, fmt.Errorf("step %s maps an input without a data key", step.Name)
+			}
+		}
+		pending[step.Name] = len(step.DependsOn)
+	}
+
+	sorted := make([]PipelineStep, 0, len(p.Steps))
+	for len(sorted) < len(p.Steps) {
+		progressed := false
+		for _, step := range p.Steps {
+			if pending[step.Name] != 0 {
+				continue
+			}
+			pending[step.Name] = -1
+			sorted = append(sorted, step)
+			progressed = true
+
+			for _, child := range p.Steps {
+				if containsString(child.DependsOn, step.Name) {
+					pending[child.Name]--
+				}
+			}
+		}
+		if !progressed {
+			return nil, fmt.Errorf("pipeline dependencies contain a cycle")
+		}
+	}
+	return sorted, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// SubmitPipeline queues every job of a pipeline. Credits for all steps are
+// reserved up front, so a pipeline is rejected as a whole when over quota.
+// A submission repeating an idempotency key returns the original jobs.
+func (q *Queue) SubmitPipeline(pipeline *Pipeline) ([]*Job, error) {
+	if q.draining.Load() {
+		return nil, ErrQueueDraining
+	}
+	steps, err := pipeline.sortSteps()
+	if err != nil {
+		return nil, err
+	}
+	if q.scheduler.len()+len(steps) > maxQueuedJobs {
+		return nil, fmt.Errorf("job queue is full")
+	}
+	if pipeline.ID == "" {
+		pipeline.ID = generatePipelineID()
+	}
+
+	now := time.Now()
+	baseID := generateJobID()
+	jobIDs := make(map[string]string, len(steps))
+	pipelineJobs := make([]*Job, 0, len(steps))
+
+	for i, step := range steps {
+		job := &Job{
+			ID:         baseID + "_" + strconv.Itoa(i),
+			UserID:     pipeline.UserID,
+			ProjectID:  pipeline.ProjectID,
+			Type:       step.Type,
+			Status:     JobStatusQueued,
+			Data:       step.Data,
+			CreatedAt:  now,
+			MaxRetries: q.retryPolicy(step.Type).MaxRetries,
+			Pipeline:   &PipelineLink{ID: pipeline.ID, Step: step.Name, Index: i},
+		}
+		if job.Data == nil {
+			job.Data = make(map[string]interface{})
+		}
+		// Steps taking inputs from their parents are validated once those are
+		// resolved, when the step runs
+		if len(step.Inputs) == 0 {
+			if err := validatePayload(job); err != nil {
+				return nil, fmt.Errorf("pipeline step %s: %w", step.Name, err)
+			}
+		} else if err := stampPayloadVersion(job); err != nil {
+			return nil, fmt.Errorf("pipeline step %s: %w", step.Name, err)
+		}
+		jobIDs[step.Name] = job.ID
+
+		// Later steps wait for their parents
+		for _, parent := range step.DependsOn {
+			job.Pipeline.DependsOn = append(job.Pipeline.DependsOn, jobIDs[parent])
+		}
+		for _, input := range step.Inputs {
+			input.From = jobIDs[input.From]
+			job.Pipeline.Inputs = append(job.Pipeline.Inputs, input)
+		}
+		if len(step.DependsOn) > 0 {
+			job.Status = JobStatusWaiting
+		}
+
+		pipelineJobs = append(pipelineJobs, job)
+	}
+
+	if key := pipeline.IdempotencyKey; key != "" {
+		request := map[string]interface{}{"project_id": pipeline.ProjectID, "steps": pipeline.Steps}
+		original, err := q.reserveIdempotencyKey(pipeline.UserID, key, request, pipelineJobs[0].ID)
+		if err != nil {
+			return nil, err
+		}
+		if original != nil {
+			return q.originalPipeline(pipeline, original)
+		}
+	}
+
+	if err := q.reservePipeline(pipelineJobs); err != nil {
+		q.releaseIdempotencyKey(pipeline.UserID, pipeline.IdempotencyKey)
+		return nil, err
+	}
+
+	for i, job := range pipelineJobs {
+		if err := q.store.Create(context.Background(), job); err != nil {
+			q.logger.Error("Failed to save pipeline job", "pipeline_id", pipeline.ID, "job_id", job.ID, "error", err)
+			for _, created := range pipelineJobs[:i] {
+				q.store.Delete(context.Background(), created.ID)
+			}
+			for _, job := range pipelineJobs {
+				q.settleCredits(job.UserID, job.ReservedCredits, false)
+			}
+			q.releaseIdempotencyKey(pipeline.UserID, pipeline.IdempotencyKey)
+			return nil, fmt.Errorf("failed to save pipeline: %w", err)
+		}
+	}
+
+	for _, job := range pipelineJobs {
+		if job.Status == JobStatusQueued {
+			q.dispatch(job)
+		}
+		q.notifier.NotifyJobQueued(job)
+	}
+
+	q.logger.Info("Pipeline added to queue", "pipeline_id", pipeline.ID, "jobs", len(pipelineJobs))
+	return pipelineJobs, nil
+}
+
+// originalPipeline returns the jobs of the pipeline a repeated submission
+// refers to, given its first job
+func (q *Queue) originalPipeline(pipeline *Pipeline, first *Job) ([]*Job, error) {
+	if first.Pipeline == nil {
+		return nil, fmt.Errorf("%w: key was used for a different request", ErrIdempotencyConflict)
+	}
+
+	status, err := q.GetPipeline(context.Background(), first.Pipeline.ID)
+	if err != nil {
+		return nil, err
+	}
+	pipeline.ID = status.ID
+	return status.Jobs, nil
+}
+
+// reservePipeline reserves the credits of every pipeline job, releasing them all
+// if any reservation fails
+func (q *Queue) reservePipeline(pipelineJobs []*Job) error {
+	if q.meter == nil {
+		return nil
+	}
+
+	for i, job := range pipelineJobs {
+		variants, _ := dataInt64(job.Data["variants"])
+		credits := q.meter.JobCredits(string(job.Type), int(variants))
+		if err := q.meter.Reserve(context.Background(), job.UserID, credits); err != nil {
+			for _, reserved := range pipelineJobs[:i] {
+				q.settleCredits(reserved.UserID, reserved.ReservedCredits, false)
+				reserved.ReservedCredits = 0
+			}
+			return err
+		}
+		job.ReservedCredits = credits
+	}
+	return nil
+}
+
+// GetPipeline returns the aggregate status of a pipeline
+func (q *Queue) GetPipeline(ctx context.Context, pipelineID string) (*PipelineStatus, error) {
+	pipelineJobs, err := q.ListJobs(ctx, JobFilter{PipelineID: pipelineID})
+	if err != nil {
+		return nil, err
+	}
+	if len(pipelineJobs) == 0 {
+		return nil, ErrJobNotFound
+	}
+
+	sort.Slice(pipelineJobs, func(i, j int) bool {
+		return pipelineJobs[i].Pipeline.Index < pipelineJobs[j].Pipeline.Index
+	})
+
+	status := &PipelineStatus{
+		ID:     pipelineID,
+		UserID: pipelineJobs[0].UserID,
+		Status: aggregateStatus(pipelineJobs),
+		Jobs:   pipelineJobs,
+	}
+
+	var progress int
+	for _, job := range pipelineJobs {
+		if job.Status == JobStatusCompleted {
+			progress += 100
+		} else {
+			progress += job.Progress
+		}
+	}
+	status.Progress = progress / len(pipelineJobs)
+	return status, nil
+}
+
+// aggregateStatus summarises the statuses of a pipeline's jobs
+func aggregateStatus(pipelineJobs []*Job) JobStatus {
+	counts := make(map[JobStatus]int)
+	for _, job := range pipelineJobs {
+		counts[job.Status]++
+	}
+
+	switch {
+	case counts[JobStatusFailed] > 0:
+		return JobStatusFailed
+	case counts[JobStatusCancelled] > 0:
+		return JobStatusCancelled
+	case counts[JobStatusCompleted] == len(pipelineJobs):
+		return JobStatusCompleted
+	case counts[JobStatusProcessing] > 0 || counts[JobStatusCompleted] > 0:
+		return JobStatusProcessing
+	default:
+		return JobStatusQueued
+	}
+}
+
+// advancePipeline starts the waiting jobs of a pipeline whose parents all
+// completed, and cancels those with a failed or cancelled parent. It is
+// idempotent, so recovery can call it for pipelines interrupted by a restart.
+func (q *Queue) advancePipeline(pipelineID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pipelineJobs, err := q.store.List(context.Background(), JobFilter{PipelineID: pipelineID})
+	if err != nil {
+		q.logger.Error("Failed to load pipeline", "pipeline_id", pipelineID, "error", err)
+		return
+	}
+
+	byID := make(map[string]*Job, len(pipelineJobs))
+	for _, job := range pipelineJobs {
+		byID[job.ID] = job
+	}
+
+	// Repeat until nothing changes, so cancellations cascade through every level
+	for changed := true; changed; {
+		changed = false
+		for _, job := range pipelineJobs {
+			if job.Status != JobStatusWaiting {
+				continue
+			}
+
+			ready := true
+			var cancelled error
+			for _, parentID := range job.Pipeline.DependsOn {
+				parent, exists := byID[parentID]
+				switch {
+				case !exists:
+					cancelled = fmt.Errorf("parent job %s no longer exists", parentID)
+				case parent.Status == JobStatusFailed || parent.Status == JobStatusCancelled:
+					cancelled = fmt.Errorf("parent job %s was %s", parentID, parent.Status)
+				case parent.Status != JobStatusCompleted:
+					ready = false
+				}
+			}
+
+			switch {
+			case cancelled != nil:
+				q.finishWaitingJob(job, JobStatusCancelled, cancelled)
+			case !ready:
+				continue
+			default:
+				if err := resolveInputs(job, byID); err != nil {
+					q.finishWaitingJob(job, JobStatusFailed, err)
+					break
+				}
+				job.Status = JobStatusQueued
+				if err := q.store.Update(context.Background(), job); err != nil {
+					q.logger.Error("Failed to queue pipeline job", "job_id", job.ID, "error", err)
+					continue
+				}
+				q.dispatch(job)
+				q.notifier.NotifyJobUpdated(job)
+			}
+			changed = true
+		}
+	}
+}
+
+// finishWaitingJob ends a pipeline job that never started; callers must hold the lock
+func (q *Queue) finishWaitingJob(job *Job, status JobStatus, err error) {
+	now := time.Now()
+	job.Status = status
+	job.Error = err.Error()
+	job.CompletedAt = &now
+
+	credits := job.ReservedCredits
+	job.ReservedCredits = 0
+	if saveErr := q.store.Update(context.Background(), job); saveErr != nil {
+		q.logger.Error("Failed to save pipeline job", "job_id", job.ID, "error", saveErr)
+		return
+	}
+	if credits > 0 {
+		go q.settleCredits(job.UserID, credits, false)
+	}
+
+	q.logger.Info("Pipeline job ended before starting", "job_id", job.ID, "status", status, "reason", err)
+	if status == JobStatusCancelled {
+		q.notifier.NotifyJobCancelled(job)
+		return
+	}
+	q.notifier.NotifyJobUpdated(job)
+}
+
+// resolveInputs copies the mapped fields of the parents' results into a job's data
+func resolveInputs(job *Job, byID map[string]*Job) error {
+	if len(job.Pipeline.Inputs) == 0 {
+		return nil
+	}
+
+	data := make(map[string]interface{}, len(job.Data)+len(job.Pipeline.Inputs))
+	for key, value := range job.Data {
+		data[key] = value
+	}
+
+	for _, input := range job.Pipeline.Inputs {
+		parent, exists := byID[input.From]
+		if !exists {
+			return fmt.Errorf("input %s from job %s: parent job no longer exists", input.To, input.From)
+		}
+		value, err := resultField(parent.Result, input.Field)
+		if err != nil {
+			return fmt.Errorf("input %s from job %s: %w", input.To, input.From, err)
+		}
+		data[input.To] = value
+	}
+
+	job.Data = data
+	return nil
+}
+
+// resultField reads a dotted path from a job result through its JSON form
+func resultField(result interface{}, path string) (interface{}, error) {
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := json.Unmarshal(encoded, &value); err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return value, nil
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		switch current := value.(type) {
+		case map[string]interface{}:
+			field, exists := current[key]
+			if !exists {
+				return nil, fmt.Errorf("result has no field %s", path)
+			}
+			value = field
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(current) {
+				return nil, fmt.Errorf("result has no field %s", path)
+			}
+			value = current[index]
+		default:
+			return nil, fmt.Errorf("result has no field %s", path)
+		}
+	}
+	return value, nil
+}
+
+// generatePipelineID creates a unique pipeline ID
+func generatePipelineID() string {
+	return fmt.Sprintf("pipeline_%d", time.Now().UnixNano())
+}
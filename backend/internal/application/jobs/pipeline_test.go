@@ -0,0 +1,178 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/compozit/vision/backend/internal/infrastructure/ai"
+	"github.com/compozit/vision/backend/internal/infrastructure/modeling"
+)
+
+type testLogger struct{}
+
+func (testLogger) Debug(msg string, kv ...interface{}) {}
+func (testLogger) Info(msg string, kv ...interface{})  {}
+func (testLogger) Warn(msg string, kv ...interface{})  {}
+func (testLogger) Error(msg string, kv ...interface{}) {}
+
+func designPipeline() *Pipeline {
+	return &Pipeline{
+		UserID: "user-1",
+		Steps: []PipelineStep{
+			{
+				Name:      "floor_plan",
+				Type:      JobTypeExport,
+				DependsOn: []string{"model"},
+				Inputs:    []InputMapping{{From: "model", Field: "model_url", To: "model_url"}},
+			},
+			{
+				Name:      "model",
+				Type:      JobType3DModel,
+				DependsOn: []string{"render"},
+				Inputs:    []InputMapping{{From: "render", Field: "result_image_url", To: "reference_image"}},
+			},
+			{Name: "render", Type: JobTypeAIDetailed, Data: map[string]interface{}{"style": "modern"}},
+		},
+	}
+}
+
+func TestPipelineSortSteps(t *testing.T) {
+	steps, err := designPipeline().sortSteps()
+	if err != nil {
+		t.Fatalf("sortSteps failed: %v", err)
+	}
+	if steps[0].Name != "render" || steps[1].Name != "model" || steps[2].Name != "floor_plan" {
+		t.Errorf("Expected steps in dependency order, got %v", steps)
+	}
+
+	cyclic := designPipeline()
+	cyclic.Steps[2].DependsOn = []string{"floor_plan"}
+	if _, err := cyclic.sortSteps(); err == nil {
+		t.Error("Expected a cycle to be rejected")
+	}
+
+	unknown := designPipeline()
+	unknown.Steps[1].DependsOn = []string{"analysis"}
+	if _, err := unknown.sortSteps(); err == nil {
+		t.Error("Expected an unknown dependency to be rejected")
+	}
+
+	unmapped := designPipeline()
+	unmapped.Steps[0].DependsOn = []string{"render"}
+	if _, err := unmapped.sortSteps(); err == nil {
+		t.Error("Expected an input from a step that is not a parent to be rejected")
+	}
+}
+
+func TestResultField(t *testing.T) {
+	result := &ai.RenderResult{
+		ResultImageURL: "https://example.com/render.png",
+		Variants:       []ai.RenderVariant{{ImageURL: "https://example.com/variant.png"}},
+	}
+
+	if value, err := resultField(result, "result_image_url"); err != nil || value != "https://example.com/render.png" {
+		t.Errorf("Expected the result image, got %v (%v)", value, err)
+	}
+	if value, err := resultField(result, "variants.0.image_url"); err != nil || value != "https://example.com/variant.png" {
+		t.Errorf("Expected the variant image, got %v (%v)", value, err)
+	}
+	for _, path := range []string{"missing", "variants.1.image_url", "result_image_url.url"} {
+		if _, err := resultField(result, path); err == nil {
+			t.Errorf("Expected no field at %s", path)
+		}
+	}
+}
+
+func TestPipelineRunsStepsInOrder(t *testing.T) {
+	q := NewQueue(testLogger{}, nil, nil, 1)
+	pipelineJobs, err := q.SubmitPipeline(designPipeline())
+	if err != nil {
+		t.Fatalf("SubmitPipeline failed: %v", err)
+	}
+	render, model, floorPlan := pipelineJobs[0], pipelineJobs[1], pipelineJobs[2]
+
+	if render.Status != JobStatusQueued || model.Status != JobStatusWaiting || floorPlan.Status != JobStatusWaiting {
+		t.Fatalf("Expected only the render to be queued, got %s %s %s", render.Status, model.Status, floorPlan.Status)
+	}
+	if q.scheduler.len() != 1 {
+		t.Errorf("Expected one job in the scheduler, got %d", q.scheduler.len())
+	}
+
+	q.UpdateJob(render.ID, JobStatusCompleted, 100, &ai.RenderResult{ResultImageURL: "https://example.com/render.png"}, nil)
+
+	stored, _ := q.GetJob(model.ID)
+	if stored.Status != JobStatusQueued || stored.Data["reference_image"] != "https://example.com/render.png" {
+		t.Errorf("Expected the model to be queued with the render as reference, got %s %v", stored.Status, stored.Data)
+	}
+
+	q.UpdateJob(model.ID, JobStatusCompleted, 100, &modeling.ModelingResult{ModelURL: "https://example.com/model.glb"}, nil)
+
+	status, err := q.GetPipeline(context.Background(), render.Pipeline.ID)
+	if err != nil {
+		t.Fatalf("GetPipeline failed: %v", err)
+	}
+	if status.Status != JobStatusProcessing || status.Progress != 66 {
+		t.Errorf("Expected a pipeline two thirds done, got %s at %d%%", status.Status, status.Progress)
+	}
+	if status.Jobs[2].Status != JobStatusQueued || status.Jobs[2].Data["model_url"] != "https://example.com/model.glb" {
+		t.Errorf("Expected the floor plan to be queued with the model, got %+v", status.Jobs[2])
+	}
+}
+
+func TestPipelineFailureCancelsDependents(t *testing.T) {
+	q := NewQueue(testLogger{}, nil, nil, 1)
+	pipelineJobs, err := q.SubmitPipeline(designPipeline())
+	if err != nil {
+		t.Fatalf("SubmitPipeline failed: %v", err)
+	}
+
+	q.UpdateJob(pipelineJobs[0].ID, JobStatusFailed, 0, nil, errors.New("provider unavailable"))
+
+	for _, job := range pipelineJobs[1:] {
+		stored, _ := q.GetJob(job.ID)
+		if stored.Status != JobStatusCancelled || stored.CompletedAt == nil {
+			t.Errorf("Expected %s to be cancelled, got %s", job.Pipeline.Step, stored.Status)
+		}
+	}
+
+	status, _ := q.GetPipeline(context.Background(), pipelineJobs[0].Pipeline.ID)
+	if status.Status != JobStatusFailed {
+		t.Errorf("Expected a failed pipeline, got %s", status.Status)
+	}
+
+	if _, err := q.GetPipeline(context.Background(), "pipeline_missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected an unknown pipeline to be not found, got %v", err)
+	}
+}
+
+func TestPipelineMissingParentCancelsDependents(t *testing.T) {
+	q := NewQueue(testLogger{}, nil, nil, 1)
+	pipelineJobs, err := q.SubmitPipeline(designPipeline())
+	if err != nil {
+		t.Fatalf("SubmitPipeline failed: %v", err)
+	}
+
+	// A parent removed from the store, e.g. by an admin, must not stall or crash the pipeline
+	render := pipelineJobs[0]
+	if err := q.store.Delete(context.Background(), render.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	q.advancePipeline(render.Pipeline.ID)
+
+	model, _ := q.GetJob(pipelineJobs[1].ID)
+	if model.Status != JobStatusCancelled || !strings.Contains(model.Error, render.ID) {
+		t.Errorf("Expected the model step cancelled naming its parent, got %s: %q", model.Status, model.Error)
+	}
+	if floorPlan, _ := q.GetJob(pipelineJobs[2].ID); floorPlan.Status != JobStatusCancelled {
+		t.Errorf("Expected the cancellation to cascade, got %s", floorPlan.Status)
+	}
+}
+
+func TestResolveInputsMissingParent(t *testing.T) {
+	job := &Job{Pipeline: &PipelineLink{Inputs: []InputMapping{{From: "job_gone", Field: "model_url", To: "model_url"}}}}
+	if err := resolveInputs(job, map[string]*Job{}); err == nil || !strings.Contains(err.Error(), "job_gone") {
+		t.Errorf("Expected an error naming the missing parent, got %v", err)
+	}
+}
@@ -0,0 +1,651 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// PostgresJobStore persists jobs in the background_jobs table. Several API
+// instances may share it; claims are atomic so each job runs once.
+type PostgresJobStore struct {
+	db *sqlx.DB
+}
+
+// NewPostgresJobStore creates a new Postgres-backed job store
+func NewPostgresJobStore(db *sqlx.DB) *PostgresJobStore {
+	return &PostgresJobStore{db: db}
+}
+
+// jobColumns are the columns read into a jobRow
+const jobColumns = `id, user_id, COALESCE(project_id, '') AS project_id, type, status, progress,
+	data, result, COALESCE(error, '') AS error, created_at, started_at, completed_at,
+	retry_count, max_retries, reserved_credits, COALESCE(worker_id, '') AS worker_id, lease_expires_at,
+	pipeline, next_attempt_at, data_version, failure, late_render`
+
+// jobRow is a background_jobs row
+type jobRow struct {
+	ID              string     `db:"id"`
+	UserID          string     `db:"user_id"`
+	ProjectID       string     `db:"project_id"`
+	Type            JobType    `db:"type"`
+	Status          JobStatus  `db:"status"`
+	Progress        int        `db:"progress"`
+	Data            string     `db:"data"`
+	Result          *string    `db:"result"` // NULL until the job produces a result
+	Error           string     `db:"error"`
+	CreatedAt       time.Time  `db:"created_at"`
+	StartedAt       *time.Time `db:"started_at"`
+	CompletedAt     *time.Time `db:"completed_at"`
+	RetryCount      int        `db:"retry_count"`
+	MaxRetries      int        `db:"max_retries"`
+	ReservedCredits int64      `db:"reserved_credits"`
+	WorkerID        string     `db:"worker_id"`
+	LeaseExpiresAt  *time.Time `db:"lease_expires_at"`
+	PipelineID      *string    `db:"pipeline_id"`
+	Pipeline        *string    `db:"pipeline"`
+	NextAttemptAt   *time.Time `db:"next_attempt_at"`
+	DataVersion     int        `db:"data_version"`
+	Failure         *string    `db:"failure"`     // NULL unless the job failed
+	LateRender      *string    `db:"late_render"` // NULL unless the job awaits a late result
+}
+
+// newJobRow serializes a job's data and result for storage
+func newJobRow(job *Job) (*jobRow, error) {
+	data, err := json.Marshal(job.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode data of job %s: %w", job.ID, err)
+	}
+
+	// JSONB parameters are sent as text; []byte would be encoded as bytea
+	var result *string
+	if job.Result != nil {
+		encoded, err := json.Marshal(job.Result)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode result of job %s: %w", job.ID, err)
+		}
+		resultText := string(encoded)
+		result = &resultText
+	}
+
+	row := &jobRow{
+		ID:              job.ID,
+		UserID:          job.UserID,
+		ProjectID:       job.ProjectID,
+		Type:            job.Type,
+		Status:          job.Status,
+		Progress:        job.Progress,
+		Data:            string(data),
+		Result:          result,
+		Error:           job.Error,
+		CreatedAt:       job.CreatedAt,
+		StartedAt:       job.StartedAt,
+		CompletedAt:     job.CompletedAt,
+		RetryCount:      job.RetryCount,
+		MaxRetries:      job.MaxRetries,
+		ReservedCredits: job.ReservedCredits,
+		NextAttemptAt:   job.NextAttemptAt,
+		DataVersion:     job.DataVersion,
+	}
+
+	if job.Failure != nil {
+		failure, err := json.Marshal(job.Failure)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode failure of job %s: %w", job.ID, err)
+		}
+		failureText := string(failure)
+		row.Failure = &failureText
+	}
+
+	if job.LateRender != nil {
+		lateRender, err := json.Marshal(job.LateRender)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode late render of job %s: %w", job.ID, err)
+		}
+		lateRenderText := string(lateRender)
+		row.LateRender = &lateRenderText
+	}
+
+	if job.Pipeline != nil {
+		pipeline, err := json.Marshal(job.Pipeline)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode pipeline of job %s: %w", job.ID, err)
+		}
+		pipelineText := string(pipeline)
+		row.PipelineID, row.Pipeline = &job.Pipeline.ID, &pipelineText
+	}
+	return row, nil
+}
+
+// job decodes a row into a job
+func (row *jobRow) job() (*Job, error) {
+	job := &Job{
+		ID:              row.ID,
+		UserID:          row.UserID,
+		ProjectID:       row.ProjectID,
+		Type:            row.Type,
+		Status:          row.Status,
+		Progress:        row.Progress,
+		Error:           row.Error,
+		CreatedAt:       row.CreatedAt,
+		StartedAt:       row.StartedAt,
+		CompletedAt:     row.CompletedAt,
+		RetryCount:      row.RetryCount,
+		MaxRetries:      row.MaxRetries,
+		ReservedCredits: row.ReservedCredits,
+		WorkerID:        row.WorkerID,
+		LeaseExpiresAt:  row.LeaseExpiresAt,
+		NextAttemptAt:   row.NextAttemptAt,
+		DataVersion:     row.DataVersion,
+	}
+
+	if row.Data != "" {
+		if err := json.Unmarshal([]byte(row.Data), &job.Data); err != nil {
+			return nil, fmt.Errorf("failed to decode data of job %s: %w", row.ID, err)
+		}
+	}
+
+	if row.Pipeline != nil {
+		if err := json.Unmarshal([]byte(*row.Pipeline), &job.Pipeline); err != nil {
+			return nil, fmt.Errorf("failed to decode pipeline of job %s: %w", row.ID, err)
+		}
+	}
+
+	if row.Failure != nil {
+		if err := json.Unmarshal([]byte(*row.Failure), &job.Failure); err != nil {
+			return nil, fmt.Errorf("failed to decode failure of job %s: %w", row.ID, err)
+		}
+	}
+
+	if row.LateRender != nil {
+		if err := json.Unmarshal([]byte(*row.LateRender), &job.LateRender); err != nil {
+			return nil, fmt.Errorf("failed to decode late render of job %s: %w", row.ID, err)
+		}
+	}
+
+	if row.Result != nil {
+		result, err := decodeJobResult(row.Type, []byte(*row.Result))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode result of job %s: %w", row.ID, err)
+		}
+		job.Result = result
+	}
+	return job, nil
+}
+
+// selectJobs runs a query returning job rows
+func (s *PostgresJobStore) selectJobs(ctx context.Context, query string, args ...interface{}) ([]*Job, error) {
+	var rows []*jobRow
+	if err := s.db.SelectContext(ctx, &rows, query, args...); err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	jobs := make([]*Job, 0, len(rows))
+	for _, row := range rows {
+		job, err := row.job()
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func (s *PostgresJobStore) Create(ctx context.Context, job *Job) error {
+	row, err := newJobRow(job)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO background_jobs (
+			id, user_id, project_id, type, status, progress, data, result, error,
+			created_at, started_at, completed_at, retry_count, max_retries, reserved_credits,
+			pipeline_id, pipeline, next_attempt_at, data_version, failure, late_render
+		) VALUES (
+			:id, :user_id, NULLIF(:project_id, ''), :type, :status, :progress, :data, :result, NULLIF(:error, ''),
+			:created_at, :started_at, :completed_at, :retry_count, :max_retries, :reserved_credits,
+			:pipeline_id, :pipeline, :next_attempt_at, :data_version, :failure, :late_render
+		)`
+
+	_, err = s.db.NamedExecContext(ctx, query, row)
+	return err
+}
+
+func (s *PostgresJobStore) Get(ctx context.Context, jobID string) (*Job, error) {
+	row := &jobRow{}
+	query := `SELECT ` + jobColumns + ` FROM background_jobs WHERE id = $1`
+
+	if err := s.db.GetContext(ctx, row, query, jobID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrJobNotFound
+		}
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+
+	return row.job()
+}
+
+func (s *PostgresJobStore) Update(ctx context.Context, job *Job) error {
+	row, err := newJobRow(job)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE background_jobs SET
+			status = :status, progress = :progress, data = :data, result = :result,
+			error = NULLIF(:error, ''), started_at = :started_at, completed_at = :completed_at,
+			retry_count = :retry_count, max_retries = :max_retries, reserved_credits = :reserved_credits,
+			next_attempt_at = :next_attempt_at, data_version = :data_version, failure = :failure,
+			late_render = :late_render
+		WHERE id = :id`
+
+	result, err := s.db.NamedExecContext(ctx, query, row)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+func (s *PostgresJobStore) Delete(ctx context.Context, jobID string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM background_jobs WHERE id = $1`, jobID)
+	return err
+}
+
+func (s *PostgresJobStore) List(ctx context.Context, filter JobFilter) ([]*Job, error) {
+	clauses, args := jobFilterClauses(filter)
+	query := `SELECT ` + jobColumns + ` FROM background_jobs` + clauses
+
+	return s.selectJobs(ctx, query, args...)
+}
+
+// jobFilterClauses builds the WHERE, ORDER BY and paging clauses of a job
+// filter, for tables with the job columns it filters on
+func jobFilterClauses(filter JobFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	addCondition := func(clause string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(clause, len(args)))
+	}
+
+	if filter.UserID != "" {
+		addCondition("user_id = $%d", filter.UserID)
+	}
+	if filter.ProjectID != "" {
+		addCondition("project_id = $%d", filter.ProjectID)
+	}
+	if filter.PipelineID != "" {
+		addCondition("pipeline_id = $%d", filter.PipelineID)
+	}
+	if len(filter.Types) > 0 {
+		types := make([]string, len(filter.Types))
+		for i, t := range filter.Types {
+			types[i] = string(t)
+		}
+		addCondition("type = ANY($%d)", pq.Array(types))
+	}
+	if len(filter.Statuses) > 0 {
+		statuses := make([]string, len(filter.Statuses))
+		for i, s := range filter.Statuses {
+			statuses[i] = string(s)
+		}
+		addCondition("status = ANY($%d)", pq.Array(statuses))
+	}
+	if !filter.From.IsZero() {
+		addCondition("created_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("created_at < $%d", filter.To)
+	}
+
+	var clauses string
+	if len(conditions) > 0 {
+		clauses = " WHERE " + strings.Join(conditions, " AND ")
+	}
+	clauses += " ORDER BY created_at DESC"
+	if filter.Limit > 0 {
+		clauses += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+	if filter.Offset > 0 {
+		clauses += fmt.Sprintf(" OFFSET %d", filter.Offset)
+	}
+	return clauses, args
+}
+
+func (s *PostgresJobStore) Claim(ctx context.Context, jobID, workerID string, lease time.Duration) (*Job, error) {
+	// The status check makes the claim atomic across instances
+	query := `UPDATE background_jobs
+		SET status = 'processing', started_at = NOW(), worker_id = $2,
+			lease_expires_at = NOW() + $3 * INTERVAL '1 millisecond', next_attempt_at = NULL
+		WHERE id = $1 AND status = 'queued'
+		RETURNING ` + jobColumns
+
+	jobs, err := s.selectJobs(ctx, query, jobID, workerID, lease.Milliseconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim job: %w", err)
+	}
+	if len(jobs) == 0 {
+		return nil, ErrJobNotClaimable
+	}
+	return jobs[0], nil
+}
+
+func (s *PostgresJobStore) Heartbeat(ctx context.Context, jobID, workerID string, lease time.Duration) error {
+	query := `UPDATE background_jobs
+		SET lease_expires_at = NOW() + $3 * INTERVAL '1 millisecond'
+		WHERE id = $1 AND worker_id = $2 AND status = 'processing'`
+
+	result, err := s.db.ExecContext(ctx, query, jobID, workerID, lease.Milliseconds())
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (s *PostgresJobStore) Release(ctx context.Context, jobID, workerID string) error {
+	query := `UPDATE background_jobs
+		SET worker_id = NULL, lease_expires_at = NULL
+		WHERE id = $1 AND worker_id = $2`
+
+	_, err := s.db.ExecContext(ctx, query, jobID, workerID)
+	return err
+}
+
+func (s *PostgresJobStore) RecoverExpired(ctx context.Context, now time.Time) ([]*Job, error) {
+	// SKIP LOCKED lets instances recovering at the same time split the work
+	query := `UPDATE background_jobs
+		SET status = 'queued', progress = 0, started_at = NULL, worker_id = NULL, lease_expires_at = NULL
+		WHERE id IN (
+			SELECT id FROM background_jobs
+			WHERE status = 'processing' AND lease_expires_at < $1 AND late_render IS NULL
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + jobColumns
+
+	return s.selectJobs(ctx, query, now)
+}
+
+func (s *PostgresJobStore) Adopt(ctx context.Context, jobID, workerID string, lease time.Duration) (*Job, error) {
+	// Like Claim, the conditions make adopting atomic across instances
+	query := `UPDATE background_jobs
+		SET worker_id = $2, lease_expires_at = NOW() + $3 * INTERVAL '1 millisecond'
+		WHERE id = $1 AND status = 'processing' AND late_render IS NOT NULL
+			AND (worker_id IS NULL OR worker_id = $2 OR lease_expires_at IS NULL OR lease_expires_at < NOW())
+		RETURNING ` + jobColumns
+
+	jobs, err := s.selectJobs(ctx, query, jobID, workerID, lease.Milliseconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to adopt job: %w", err)
+	}
+	if len(jobs) == 0 {
+		return nil, ErrJobNotClaimable
+	}
+	return jobs[0], nil
+}
+
+// PostgresDeadLetterStore persists dead letters in the background_job_dead_letters table
+type PostgresDeadLetterStore struct {
+	db *sqlx.DB
+}
+
+// NewPostgresDeadLetterStore creates a new Postgres-backed dead-letter store
+func NewPostgresDeadLetterStore(db *sqlx.DB) *PostgresDeadLetterStore {
+	return &PostgresDeadLetterStore{db: db}
+}
+
+// deadLetterRow is a background_job_dead_letters row
+type deadLetterRow struct {
+	JobID    string    `db:"job_id"`
+	UserID   string    `db:"user_id"`
+	Type     JobType   `db:"type"`
+	Job      string    `db:"job"`
+	Error    string    `db:"error"`
+	Attempts int       `db:"attempts"`
+	FailedAt time.Time `db:"failed_at"`
+}
+
+// letter decodes a row into a dead letter
+func (row *deadLetterRow) letter() (*DeadLetter, error) {
+	job, err := decodeJob([]byte(row.Job))
+	if err != nil {
+		return nil, err
+	}
+	return &DeadLetter{Job: job, Error: row.Error, Attempts: row.Attempts, FailedAt: row.FailedAt}, nil
+}
+
+func (s *PostgresDeadLetterStore) Put(ctx context.Context, letter *DeadLetter) error {
+	job, err := encodeJob(letter.Job)
+	if err != nil {
+		return err
+	}
+
+	row := &deadLetterRow{
+		JobID:    letter.Job.ID,
+		UserID:   letter.Job.UserID,
+		Type:     letter.Job.Type,
+		Job:      string(job),
+		Error:    letter.Error,
+		Attempts: letter.Attempts,
+		FailedAt: letter.FailedAt,
+	}
+
+	query := `
+		INSERT INTO background_job_dead_letters (job_id, user_id, type, job, error, attempts, failed_at)
+		VALUES (:job_id, :user_id, :type, :job, :error, :attempts, :failed_at)
+		ON CONFLICT (job_id) DO UPDATE SET
+			job = EXCLUDED.job, error = EXCLUDED.error, attempts = EXCLUDED.attempts, failed_at = EXCLUDED.failed_at`
+
+	_, err = s.db.NamedExecContext(ctx, query, row)
+	return err
+}
+
+func (s *PostgresDeadLetterStore) Get(ctx context.Context, jobID string) (*DeadLetter, error) {
+	row := &deadLetterRow{}
+	query := `SELECT job_id, user_id, type, job, error, attempts, failed_at
+		FROM background_job_dead_letters WHERE job_id = $1`
+
+	if err := s.db.GetContext(ctx, row, query, jobID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrDeadLetterNotFound
+		}
+		return nil, fmt.Errorf("failed to get dead letter: %w", err)
+	}
+
+	return row.letter()
+}
+
+func (s *PostgresDeadLetterStore) List(ctx context.Context, filter DeadLetterFilter) ([]*DeadLetter, error) {
+	var conditions []string
+	var args []interface{}
+
+	addCondition := func(clause string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(clause, len(args)))
+	}
+
+	if filter.UserID != "" {
+		addCondition("user_id = $%d", filter.UserID)
+	}
+	if len(filter.Types) > 0 {
+		types := make([]string, len(filter.Types))
+		for i, t := range filter.Types {
+			types[i] = string(t)
+		}
+		addCondition("type = ANY($%d)", pq.Array(types))
+	}
+
+	query := `SELECT job_id, user_id, type, job, error, attempts, failed_at FROM background_job_dead_letters`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY failed_at DESC"
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+	if filter.Offset > 0 {
+		query += fmt.Sprintf(" OFFSET %d", filter.Offset)
+	}
+
+	var rows []*deadLetterRow
+	if err := s.db.SelectContext(ctx, &rows, query, args...); err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	letters := make([]*DeadLetter, 0, len(rows))
+	for _, row := range rows {
+		letter, err := row.letter()
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, letter)
+	}
+	return letters, nil
+}
+
+func (s *PostgresDeadLetterStore) Delete(ctx context.Context, jobID string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM background_job_dead_letters WHERE job_id = $1`, jobID)
+	return err
+}
+
+// PostgresIdempotencyStore persists idempotency keys in the
+// background_job_idempotency_keys table, shared by every API instance
+type PostgresIdempotencyStore struct {
+	db *sqlx.DB
+}
+
+// NewPostgresIdempotencyStore creates a new Postgres-backed idempotency store
+func NewPostgresIdempotencyStore(db *sqlx.DB) *PostgresIdempotencyStore {
+	return &PostgresIdempotencyStore{db: db}
+}
+
+func (s *PostgresIdempotencyStore) Reserve(ctx context.Context, record *IdempotencyRecord, now time.Time) (*IdempotencyRecord, error) {
+	// The upsert only replaces an expired record, so one of several racing requests wins
+	query := `
+		INSERT INTO background_job_idempotency_keys (user_id, key, request_hash, job_id, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, key) DO UPDATE SET
+			request_hash = EXCLUDED.request_hash, job_id = EXCLUDED.job_id, expires_at = EXCLUDED.expires_at
+		WHERE background_job_idempotency_keys.expires_at <= $6
+		RETURNING job_id`
+
+	var jobID string
+	err := s.db.QueryRowxContext(ctx, query, record.UserID, record.Key, record.RequestHash, record.JobID, record.ExpiresAt, now).Scan(&jobID)
+	if err == nil {
+		return nil, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	existing := &IdempotencyRecord{}
+	query = `SELECT user_id, key, request_hash, job_id, expires_at
+		FROM background_job_idempotency_keys WHERE user_id = $1 AND key = $2`
+	if err := s.db.QueryRowxContext(ctx, query, record.UserID, record.Key).Scan(
+		&existing.UserID, &existing.Key, &existing.RequestHash, &existing.JobID, &existing.ExpiresAt,
+	); err != nil {
+		return nil, fmt.Errorf("failed to load idempotency record: %w", err)
+	}
+	return existing, nil
+}
+
+func (s *PostgresIdempotencyStore) Delete(ctx context.Context, userID, key string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM background_job_idempotency_keys WHERE user_id = $1 AND key = $2`, userID, key)
+	return err
+}
+
+func (s *PostgresIdempotencyStore) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM background_job_idempotency_keys WHERE expires_at <= $1`, now)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	return int(rows), err
+}
+
+// PostgresJobArchive keeps archived jobs in the background_job_archive table.
+// Each row holds the whole job; the filtered columns are copied out of it.
+type PostgresJobArchive struct {
+	db *sqlx.DB
+}
+
+// NewPostgresJobArchive creates a new Postgres-backed job archive
+func NewPostgresJobArchive(db *sqlx.DB) *PostgresJobArchive {
+	return &PostgresJobArchive{db: db}
+}
+
+func (a *PostgresJobArchive) Put(ctx context.Context, job *Job) error {
+	encoded, err := encodeJob(job)
+	if err != nil {
+		return err
+	}
+
+	var pipelineID *string
+	if job.Pipeline != nil {
+		pipelineID = &job.Pipeline.ID
+	}
+	var archivedAt time.Time
+	if job.ArchivedAt != nil {
+		archivedAt = *job.ArchivedAt
+	}
+
+	query := `
+		INSERT INTO background_job_archive (id, user_id, project_id, pipeline_id, type, status, created_at, archived_at, job)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (id) DO UPDATE SET
+			status = EXCLUDED.status, archived_at = EXCLUDED.archived_at, job = EXCLUDED.job`
+
+	_, err = a.db.ExecContext(ctx, query, job.ID, job.UserID, job.ProjectID, pipelineID,
+		job.Type, job.Status, job.CreatedAt, archivedAt, string(encoded))
+	return err
+}
+
+func (a *PostgresJobArchive) Get(ctx context.Context, jobID string) (*Job, error) {
+	var encoded string
+	err := a.db.GetContext(ctx, &encoded, `SELECT job FROM background_job_archive WHERE id = $1`, jobID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrJobNotFound
+		}
+		return nil, fmt.Errorf("failed to get archived job: %w", err)
+	}
+	return decodeJob([]byte(encoded))
+}
+
+func (a *PostgresJobArchive) List(ctx context.Context, filter JobFilter) ([]*Job, error) {
+	clauses, args := jobFilterClauses(filter)
+	query := `SELECT job FROM background_job_archive` + clauses
+
+	var rows []string
+	if err := a.db.SelectContext(ctx, &rows, query, args...); err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	jobs := make([]*Job, 0, len(rows))
+	for _, encoded := range rows {
+		job, err := decodeJob([]byte(encoded))
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
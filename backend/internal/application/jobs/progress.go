@@ -0,0 +1,98 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/compozit/vision/backend/internal/infrastructure/ai"
+)
+
+const (
+	// renderProgressStart and renderProgressEnd bound the job progress reported
+	// while the provider renders; the rest covers setup and completion
+	renderProgressStart = 25
+	renderProgressEnd   = 95
+
+	// progressInterval is the minimum time between progress notifications of a job
+	progressInterval = time.Second
+)
+
+// progressThrottle limits progress notifications to one per interval. Progress
+// never goes backwards; previews are always let through.
+type progressThrottle struct {
+	mu       sync.Mutex
+	interval time.Duration
+	sent     time.Time
+	progress int
+}
+
+// allow reports whether an update at progress should be sent now
+func (t *progressThrottle) allow(progress int, preview bool, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !preview && (progress <= t.progress || now.Sub(t.sent) < t.interval) {
+		return false
+	}
+	if progress > t.progress {
+		t.progress = progress
+	}
+	t.sent = now
+	return true
+}
+
+// renderProgress returns the ProgressFunc forwarding a render's progress to the
+// job and its WebSocket subscribers
+func (q *Queue) renderProgress(job *Job) ai.ProgressFunc {
+	throttle := &progressThrottle{interval: progressInterval, progress: renderProgressStart}
+
+	return func(update ai.RenderProgress) {
+		progress := renderProgressStart + int(update.Fraction*float64(renderProgressEnd-renderProgressStart))
+		if !throttle.allow(progress, update.PreviewURL != "", time.Now()) {
+			return
+		}
+		if progress < throttle.progress {
+			progress = throttle.progress
+		}
+
+		q.setJobProgress(job.ID, progress)
+		if update.PreviewURL != "" {
+			q.notifier.NotifyJobPreview(job.ID, job.UserID, progress, update.PreviewURL)
+			return
+		}
+		q.notifier.NotifyJobProgress(job.ID, job.UserID, progress, progressMessage(update))
+	}
+}
+
+// setJobProgress records the progress of a running job without a job_updated
+// notification, which would resend the whole job for every step
+func (q *Queue) setJobProgress(jobID string, progress int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, exists := q.GetJob(jobID)
+	if !exists || job.Status != JobStatusProcessing || progress <= job.Progress {
+		return
+	}
+
+	job.Progress = progress
+	if err := q.store.Update(context.Background(), job); err != nil {
+		q.logger.Error("Failed to save job progress", "job_id", jobID, "error", err)
+	}
+}
+
+// progressMessage describes a render progress update for display
+func progressMessage(update ai.RenderProgress) string {
+	switch update.Stage {
+	case ai.ProgressStageStarting:
+		return "Waiting for the renderer"
+	case ai.ProgressStageStoring:
+		return "Saving render"
+	}
+	if update.TotalSteps > 0 {
+		return fmt.Sprintf("Rendering step %d of %d", update.Step, update.TotalSteps)
+	}
+	return "Rendering"
+}
@@ -2,13 +2,17 @@ package jobs
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/compozit/vision/backend/internal/application/metering"
 	"github.com/compozit/vision/backend/internal/infrastructure/ai"
 	"github.com/compozit/vision/backend/internal/infrastructure/modeling"
+	"github.com/compozit/vision/backend/internal/infrastructure/storage"
 	"github.com/compozit/vision/backend/pkg/logger"
 )
 
@@ -22,6 +26,8 @@ const (
 	JobTypeInpainting  JobType = "inpainting"
 	JobTypeStyleTransfer JobType = "style_transfer"
 	JobTypeExport      JobType = "export"
+	JobTypeUpscale     JobType = "upscale"
+	JobTypeCompose     JobType = "compose"
 )
 
 // JobStatus represents job execution status
@@ -51,6 +57,38 @@ type Job struct {
 	CompletedAt *time.Time             `json:"completed_at,omitempty"`
 	RetryCount  int                    `json:"retry_count"`
 	MaxRetries  int                    `json:"max_retries"`
+
+	// DataVersion is the payload version Data was written with; see PayloadSpec
+	DataVersion int `json:"data_version,omitempty"`
+
+	// Failure classifies the error of a failed job
+	Failure *JobFailure `json:"failure,omitempty"`
+
+	// NextAttemptAt is when a job waiting for a retry becomes due
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+
+	// ReservedCredits are held against the user's balance until the job finishes
+	ReservedCredits int64 `json:"reserved_credits,omitempty"`
+
+	// Pipeline links the job to its parent jobs when it is a pipeline step
+	Pipeline *PipelineLink `json:"pipeline,omitempty"`
+
+	// ArchivedAt is set once retention moved the job to the archive; its result
+	// is then at ResultURL when results are archived to blob storage
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
+	ResultURL  string     `json:"result_url,omitempty"`
+
+	// IdempotencyKey is the client's key for the request submitting the job; a
+	// repeated request with the same key gets the original job. It is not stored.
+	IdempotencyKey string `json:"-"`
+
+	// WorkerID and LeaseExpiresAt record the worker running the job; see JobStore
+	WorkerID       string     `json:"-"`
+	LeaseExpiresAt *time.Time `json:"-"`
+
+	// LateRender lists the provider predictions a job parked for a late result
+	// waits for; like the lease it is stored but never sent to clients
+	LateRender *LateRender `json:"-"`
 }
 
 // JobResult represents the result of a completed job
@@ -62,8 +100,9 @@ type JobResult struct {
 
 // Queue manages background job processing
 type Queue struct {
-	jobs        map[string]*Job
-	jobChannel  chan *Job
+	store       JobStore
+	instanceID  string
+	scheduler   *scheduler
 	workers     []*Worker
 	mu          sync.RWMutex
 	logger      logger.Logger
@@ -71,55 +110,175 @@ type Queue struct {
 	modelGen    *modeling.Generator
 	notifier    *WebSocketNotifier
 	maxWorkers  int
-	maxRetries  int
+	meter       *metering.Meter
+
+	// retryPolicies set the backoff per job type; delayed holds jobs until
+	// their retry is due, and deadLetters those that exhausted their retries
+	retryPolicies map[JobType]RetryPolicy
+	delayed       *delayQueue
+	deadLetters   DeadLetterStore
+
+	// retentionPolicies set how long finished jobs stay in the store per job
+	// type; archive keeps them afterwards, with results in resultBlobs
+	retentionPolicies map[JobType]RetentionPolicy
+	historyLimit      int
+	archive           JobArchive
+	resultBlobs       storage.BlobStore
+
+	// idempotency maps client-supplied request keys to the jobs they created
+	idempotency       IdempotencyStore
+	idempotencyWindow time.Duration
+
+	// broker carries queued jobs to the worker processes sharing it; nil runs
+	// them in this process. deliveries holds the broker deliveries of jobs this
+	// process scheduled until they stop running.
+	broker      Broker
+	role        Role
+	brokerTypes []JobType
+	deliveryMu  sync.Mutex
+	deliveries  map[string]Delivery
+	startedAt   time.Time
+
+	// pendingPredictions maps provider prediction IDs to jobs awaiting a late result
+	pendingPredictions map[string]string
+
+	// cancels holds the context cancel functions of jobs running in this instance
+	runMu   sync.Mutex
+	cancels map[string]context.CancelFunc
+
+	// draining is set once Stop began, interrupting once it cancelled running
+	// jobs at its deadline, and stopped once every worker returned
+	draining     atomic.Bool
+	interrupting atomic.Bool
+	stopped      atomic.Bool
 }
 
+const (
+	// jobLeaseDuration is how long a claimed job stays with its worker without a heartbeat
+	jobLeaseDuration = 2 * time.Minute
+
+	// jobHeartbeatInterval is how often a worker renews the lease of its job
+	jobHeartbeatInterval = 30 * time.Second
+
+	// jobRecoveryInterval is how often jobs with an expired lease are requeued
+	jobRecoveryInterval = time.Minute
+)
+
 // NewQueue creates a new job queue
 func NewQueue(logger logger.Logger, aiRenderer *ai.Renderer, modelGen *modeling.Generator, maxWorkers int) *Queue {
-	return &Queue{
-		jobs:       make(map[string]*Job),
-		jobChannel: make(chan *Job, 100), // Buffered channel
+	q := &Queue{
+		store:      NewMemoryJobStore(),
+		instanceID: newInstanceID(),
+		scheduler:  newScheduler(DefaultSchedulingPolicy(maxWorkers), maxWorkers),
 		workers:    make([]*Worker, 0, maxWorkers),
 		logger:     logger,
 		aiRenderer: aiRenderer,
 		modelGen:   modelGen,
 		notifier:   NewWebSocketNotifier(logger),
 		maxWorkers: maxWorkers,
-		maxRetries: 3,
+
+		retryPolicies: DefaultRetryPolicies(),
+		delayed:       newDelayQueue(),
+		deadLetters:   NewMemoryDeadLetterStore(),
+
+		retentionPolicies: DefaultRetentionPolicies(),
+		historyLimit:      defaultHistoryLimit,
+
+		idempotency:       NewMemoryIdempotencyStore(),
+		idempotencyWindow: defaultIdempotencyWindow,
+
+		role:       RoleAll,
+		deliveries: make(map[string]Delivery),
+
+		pendingPredictions: make(map[string]string),
+		cancels:            make(map[string]context.CancelFunc),
+	}
+
+	if aiRenderer != nil {
+		aiRenderer.SetLateResultHandler(q.handleLateRenderResult)
+	}
+
+	return q
+}
+
+// SetMeter enables credit reservation for new jobs and provider usage recording
+func (q *Queue) SetMeter(meter *metering.Meter) {
+	q.meter = meter
+	if q.aiRenderer != nil && meter != nil {
+		q.aiRenderer.SetUsageRecorder(meter)
 	}
 }
 
+// Notifier returns the WebSocket notifier the queue sends job events to
+func (q *Queue) Notifier() *WebSocketNotifier {
+	return q.notifier
+}
+
+// Meter returns the queue's usage meter, or nil when metering is disabled
+func (q *Queue) Meter() *metering.Meter {
+	return q.meter
+}
+
+// SetStore replaces the in-memory job store with a durable one. It must be
+// called before Start.
+func (q *Queue) SetStore(store JobStore) {
+	q.store = store
+}
+
+// SetSchedulingPolicy replaces the default priority lanes and fair-share weights.
+// It must be called before Start.
+func (q *Queue) SetSchedulingPolicy(policy SchedulingPolicy) {
+	q.scheduler = newScheduler(policy, q.maxWorkers)
+}
+
+// newInstanceID identifies this process in worker leases
+func newInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "localhost"
+	}
+	return fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().Unix())
+}
+
 // Start initializes the job queue and starts workers
 func (q *Queue) Start(ctx context.Context) error {
 	q.logger.Info("Starting job queue", "max_workers", q.maxWorkers)
 
+	// Resume jobs left behind by a previous run before accepting new ones
+	if err := q.recoverJobs(ctx); err != nil {
+		return fmt.Errorf("failed to recover jobs: %w", err)
+	}
+	go q.recoverExpiredJobs(ctx)
+	go q.delayed.run(ctx, q.dispatch)
+	go q.purgeIdempotencyKeys(ctx)
+	go q.sweepRetention(ctx)
+
+	// An enqueue-only process leaves running jobs to the broker's workers
+	if !q.role.consumes() {
+		q.logger.Info("Job queue started in enqueue-only mode")
+		return nil
+	}
+	q.startBroker(ctx)
+
 	// Start workers
 	for i := 0; i < q.maxWorkers; i++ {
-		worker := NewWorker(i, q.jobChannel, q, q.logger)
+		worker := NewWorker(i, q, q.logger)
 		q.workers = append(q.workers, worker)
 		go worker.Start(ctx)
 	}
 
-	q.logger.Info("Job queue started successfully", "workers", len(q.workers))
-	return nil
-}
-
-// Stop gracefully stops the job queue
-func (q *Queue) Stop(ctx context.Context) error {
-	q.logger.Info("Stopping job queue")
-
-	close(q.jobChannel)
-
-	// Wait for workers to finish current jobs
-	for _, worker := range q.workers {
-		worker.Stop()
+	// Reconcile renders that outlived their wait timeout
+	if q.aiRenderer != nil {
+		go q.reconcileLatePredictions(ctx)
 	}
 
-	q.logger.Info("Job queue stopped")
+	q.logger.Info("Job queue started successfully", "workers", len(q.workers))
 	return nil
 }
 
-// AddJob adds a new job to the queue
+// AddJob adds a new job to the queue. When the job carries an idempotency key
+// already used by the same user for an identical job, the original job is
+// copied into job instead and nothing is queued or charged.
 func (q *Queue) AddJob(job *Job) error {
 	if job.ID == "" {
 		job.ID = generateJobID()
@@ -127,21 +286,65 @@ func (q *Queue) AddJob(job *Job) error {
 
 	job.Status = JobStatusQueued
 	job.CreatedAt = time.Now()
-	job.MaxRetries = q.maxRetries
+	job.MaxRetries = q.retryPolicy(job.Type).MaxRetries
 
-	q.mu.Lock()
-	q.jobs[job.ID] = job
-	q.mu.Unlock()
+	if q.draining.Load() {
+		return ErrQueueDraining
+	}
 
-	// Send job to workers
-	select {
-	case q.jobChannel <- job:
-		q.logger.Info("Job added to queue", "job_id", job.ID, "type", job.Type)
-	default:
+	// Reject malformed data now rather than when a worker runs the job
+	if err := validatePayload(job); err != nil {
+		return err
+	}
+
+	if q.scheduler.len() >= maxQueuedJobs {
 		q.logger.Error("Job queue is full", "job_id", job.ID)
 		return fmt.Errorf("job queue is full")
 	}
 
+	if key := job.IdempotencyKey; key != "" {
+		request := map[string]interface{}{"type": job.Type, "project_id": job.ProjectID, "data": job.Data}
+		original, err := q.reserveIdempotencyKey(job.UserID, key, request, job.ID)
+		if err != nil {
+			return err
+		}
+		if original != nil {
+			*job = *original
+			job.IdempotencyKey = key
+			return nil
+		}
+	}
+
+	// Reserve credits up front so over-quota users are rejected before any provider call
+	if q.meter != nil {
+		variants, _ := dataInt64(job.Data["variants"])
+		credits := q.meter.JobCredits(string(job.Type), int(variants))
+		if err := q.meter.Reserve(context.Background(), job.UserID, credits); err != nil {
+			q.releaseIdempotencyKey(job.UserID, job.IdempotencyKey)
+			return err
+		}
+		job.ReservedCredits = credits
+	}
+
+	if err := q.store.Create(context.Background(), job); err != nil {
+		q.logger.Error("Failed to save job", "job_id", job.ID, "error", err)
+		q.settleCredits(job.UserID, job.ReservedCredits, false)
+		q.releaseIdempotencyKey(job.UserID, job.IdempotencyKey)
+		return fmt.Errorf("failed to save job: %w", err)
+	}
+
+	// Send job to workers
+	if err := q.enqueue(job); err != nil {
+		q.logger.Error("Failed to publish job", "job_id", job.ID, "error", err)
+		if err := q.store.Delete(context.Background(), job.ID); err != nil {
+			q.logger.Error("Failed to delete unpublished job", "job_id", job.ID, "error", err)
+		}
+		q.settleCredits(job.UserID, job.ReservedCredits, false)
+		q.releaseIdempotencyKey(job.UserID, job.IdempotencyKey)
+		return fmt.Errorf("failed to queue job: %w", err)
+	}
+	q.logger.Info("Job added to queue", "job_id", job.ID, "type", job.Type)
+
 	// Notify via WebSocket
 	q.notifier.NotifyJobQueued(job)
 
@@ -150,24 +353,42 @@ func (q *Queue) AddJob(job *Job) error {
 
 // GetJob retrieves a job by ID
 func (q *Queue) GetJob(jobID string) (*Job, bool) {
-	q.mu.RLock()
-	defer q.mu.RUnlock()
-
-	job, exists := q.jobs[jobID]
-	return job, exists
+	job, err := q.store.Get(context.Background(), jobID)
+	if errors.Is(err, ErrJobNotFound) && q.archive != nil {
+		job, err = q.archive.Get(context.Background(), jobID)
+	}
+	if err != nil {
+		if !errors.Is(err, ErrJobNotFound) {
+			q.logger.Error("Failed to load job", "job_id", jobID, "error", err)
+		}
+		return nil, false
+	}
+	return job, true
 }
 
 // UpdateJob updates job status and progress
 func (q *Queue) UpdateJob(jobID string, status JobStatus, progress int, result interface{}, err error) {
 	q.mu.Lock()
-	defer q.mu.Unlock()
+	var finishedPipeline string
+	defer func() {
+		q.mu.Unlock()
+		if finishedPipeline != "" {
+			q.advancePipeline(finishedPipeline)
+		}
+	}()
 
-	job, exists := q.jobs[jobID]
+	job, exists := q.GetJob(jobID)
 	if !exists {
 		q.logger.Error("Job not found for update", "job_id", jobID)
 		return
 	}
 
+	// A cancelled job stays cancelled, whatever its interrupted worker reports
+	if job.Status == JobStatusCancelled {
+		q.logger.Debug("Ignoring update of cancelled job", "job_id", jobID, "status", status)
+		return
+	}
+
 	job.Status = status
 	job.Progress = progress
 
@@ -177,14 +398,37 @@ func (q *Queue) UpdateJob(jobID string, status JobStatus, progress int, result i
 
 	if err != nil {
 		job.Error = err.Error()
+		if status == JobStatusFailed {
+			job.Failure = newJobFailure(err)
+		}
 	}
 
+	var settled int64
 	now := time.Now()
 	switch status {
 	case JobStatusProcessing:
-		job.StartedAt = &now
+		if job.StartedAt == nil {
+			job.StartedAt = &now
+		}
 	case JobStatusCompleted, JobStatusFailed, JobStatusCancelled:
 		job.CompletedAt = &now
+		job.LateRender = nil
+		settled, job.ReservedCredits = job.ReservedCredits, 0
+	}
+
+	if err := q.store.Update(context.Background(), job); err != nil {
+		q.logger.Error("Failed to save job", "job_id", jobID, "error", err)
+		return
+	}
+
+	// Settle once the cleared reservation is saved, so a reload cannot settle it again
+	if settled > 0 {
+		go q.settleCredits(job.UserID, settled, status == JobStatusCompleted)
+	}
+
+	// A finished step may start or cancel the rest of its pipeline
+	if job.Pipeline != nil && job.CompletedAt != nil {
+		finishedPipeline = job.Pipeline.ID
 	}
 
 	q.logger.Info("Job updated", 
@@ -196,27 +440,49 @@ func (q *Queue) UpdateJob(jobID string, status JobStatus, progress int, result i
 	q.notifier.NotifyJobUpdated(job)
 }
 
-// GetUserJobs returns all jobs for a specific user
-func (q *Queue) GetUserJobs(userID string) []*Job {
-	q.mu.RLock()
-	defer q.mu.RUnlock()
-
-	var userJobs []*Job
-	for _, job := range q.jobs {
-		if job.UserID == userID {
-			userJobs = append(userJobs, job)
-		}
+// GetUserJobs returns a page of a user's jobs, recent and archived, newest first
+func (q *Queue) GetUserJobs(userID string, limit, offset int) []*Job {
+	userJobs, err := q.ListJobs(context.Background(), JobFilter{UserID: userID, Limit: limit, Offset: offset})
+	if err != nil {
+		q.logger.Error("Failed to list user jobs", "user_id", userID, "error", err)
+		return nil
 	}
-
 	return userJobs
 }
 
+// QueuePosition estimates when a queued job will start
+func (q *Queue) QueuePosition(jobID string) (*QueuePosition, bool) {
+	return q.scheduler.position(jobID, time.Now())
+}
+
+// SchedulerStats returns the queued and running jobs per lane, and the jobs
+// waiting for a retry
+func (q *Queue) SchedulerStats() SchedulerStats {
+	stats := q.scheduler.stats()
+	stats.Delayed = q.delayed.len()
+	return stats
+}
+
+// ListJobs queries the job history, including archived jobs
+func (q *Queue) ListJobs(ctx context.Context, filter JobFilter) ([]*Job, error) {
+	if q.archive != nil {
+		return q.listWithArchive(ctx, filter)
+	}
+	return q.store.List(ctx, filter)
+}
+
 // CancelJob cancels a queued or processing job
 func (q *Queue) CancelJob(jobID string) error {
 	q.mu.Lock()
-	defer q.mu.Unlock()
+	var cancelledPipeline string
+	defer func() {
+		q.mu.Unlock()
+		if cancelledPipeline != "" {
+			q.advancePipeline(cancelledPipeline)
+		}
+	}()
 
-	job, exists := q.jobs[jobID]
+	job, exists := q.GetJob(jobID)
 	if !exists {
 		return fmt.Errorf("job not found: %s", jobID)
 	}
@@ -224,19 +490,59 @@ func (q *Queue) CancelJob(jobID string) error {
 	if job.Status == JobStatusCompleted || job.Status == JobStatusFailed {
 		return fmt.Errorf("cannot cancel completed job")
 	}
+	if job.Status == JobStatusCancelled {
+		return fmt.Errorf("job is already cancelled")
+	}
 
 	job.Status = JobStatusCancelled
 	now := time.Now()
 	job.CompletedAt = &now
 
+	credits := job.ReservedCredits
+	job.ReservedCredits = 0
+	late := job.LateRender
+	job.LateRender = nil
+	if err := q.store.Update(context.Background(), job); err != nil {
+		return fmt.Errorf("failed to cancel job: %w", err)
+	}
+
+	// Stop the job wherever it is: queued, waiting for a retry, running, or
+	// waiting for a late result in whichever process reconciles it
+	q.interruptJob(jobID)
+	q.cancelLateRender(late)
+
+	if credits > 0 {
+		go q.settleCredits(job.UserID, credits, false)
+	}
+
 	q.logger.Info("Job cancelled", "job_id", jobID)
 
+	// Jobs depending on this one are cancelled too
+	if job.Pipeline != nil {
+		cancelledPipeline = job.Pipeline.ID
+	}
+
 	// Notify via WebSocket
-	q.notifier.NotifyJobUpdated(job)
+	q.notifier.NotifyJobCancelled(job)
 
 	return nil
 }
 
+// settleCredits charges a job's reservation when it completed, or releases it otherwise
+func (q *Queue) settleCredits(userID string, credits int64, succeeded bool) {
+	if q.meter == nil || credits <= 0 {
+		return
+	}
+
+	if err := q.meter.Settle(context.Background(), userID, credits, succeeded); err != nil {
+		q.logger.Error("Failed to settle job credits",
+			"user_id", userID,
+			"credits", credits,
+			"charged", succeeded,
+			"error", err)
+	}
+}
+
 // ProcessJob processes a single job based on its type
 func (q *Queue) ProcessJob(ctx context.Context, job *Job) error {
 	q.logger.Info("Processing job", "job_id", job.ID, "type", job.Type)
@@ -256,8 +562,12 @@ func (q *Queue) ProcessJob(ctx context.Context, job *Job) error {
 		return q.processStyleTransferJob(ctx, job)
 	case JobTypeExport:
 		return q.processExportJob(ctx, job)
+	case JobTypeUpscale:
+		return q.processUpscaleJob(ctx, job)
+	case JobTypeCompose:
+		return q.processComposeJob(ctx, job)
 	default:
-		return fmt.Errorf("unknown job type: %s", job.Type)
+		return Permanent(fmt.Errorf("unknown job type: %s", job.Type))
 	}
 }
 
@@ -266,14 +576,21 @@ func (q *Queue) processAIQuickJob(ctx context.Context, job *Job) error {
 	// Convert job data to render request
 	req, err := q.jobToRenderRequest(job)
 	if err != nil {
-		return fmt.Errorf("failed to convert job to render request: %w", err)
+		return Permanent(fmt.Errorf("failed to convert job to render request: %w", err))
+	}
+	if req.CustomStyle, err = q.jobStyleSelection(ctx, job); err != nil {
+		return Permanent(err)
 	}
 
-	q.UpdateJob(job.ID, JobStatusProcessing, 25, nil, nil)
+	q.UpdateJob(job.ID, JobStatusProcessing, renderProgressStart, nil, nil)
+	req.OnProgress = q.renderProgress(job)
 
 	// Render with AI
 	result, err := q.aiRenderer.RenderQuick(ctx, req)
 	if err != nil {
+		if q.awaitLateResult(job, err) {
+			return nil
+		}
 		return fmt.Errorf("AI rendering failed: %w", err)
 	}
 
@@ -285,13 +602,20 @@ func (q *Queue) processAIQuickJob(ctx context.Context, job *Job) error {
 func (q *Queue) processAIDetailedJob(ctx context.Context, job *Job) error {
 	req, err := q.jobToRenderRequest(job)
 	if err != nil {
-		return err
+		return Permanent(err)
+	}
+	if req.CustomStyle, err = q.jobStyleSelection(ctx, job); err != nil {
+		return Permanent(err)
 	}
 
-	q.UpdateJob(job.ID, JobStatusProcessing, 25, nil, nil)
+	q.UpdateJob(job.ID, JobStatusProcessing, renderProgressStart, nil, nil)
+	req.OnProgress = q.renderProgress(job)
 
 	result, err := q.aiRenderer.RenderDetailed(ctx, req)
 	if err != nil {
+		if q.awaitLateResult(job, err) {
+			return nil
+		}
 		return err
 	}
 
@@ -303,15 +627,21 @@ func (q *Queue) processAIDetailedJob(ctx context.Context, job *Job) error {
 func (q *Queue) process3DModelJob(ctx context.Context, job *Job) error {
 	req, err := q.jobToModelingRequest(job)
 	if err != nil {
-		return err
+		return Permanent(err)
 	}
 
 	q.UpdateJob(job.ID, JobStatusProcessing, 10, nil, nil)
 
-	// Progress updates during 3D modeling
+	// Progress updates during 3D modeling, until the model is done or cancelled
+	progressCtx, stopProgress := context.WithCancel(ctx)
+	defer stopProgress()
 	go func() {
 		for progress := 20; progress < 90; progress += 10 {
-			time.Sleep(5 * time.Second)
+			select {
+			case <-time.After(5 * time.Second):
+			case <-progressCtx.Done():
+				return
+			}
 			q.UpdateJob(job.ID, JobStatusProcessing, progress, nil, nil)
 		}
 	}()
@@ -329,13 +659,19 @@ func (q *Queue) process3DModelJob(ctx context.Context, job *Job) error {
 func (q *Queue) processInpaintingJob(ctx context.Context, job *Job) error {
 	req, err := q.jobToInpaintingRequest(job)
 	if err != nil {
-		return err
+		return Permanent(err)
+	}
+	if req.CustomStyle, err = q.jobStyleSelection(ctx, job); err != nil {
+		return Permanent(err)
 	}
 
 	q.UpdateJob(job.ID, JobStatusProcessing, 30, nil, nil)
 
 	result, err := q.aiRenderer.RenderInpainting(ctx, req)
 	if err != nil {
+		if q.awaitLateResult(job, err) {
+			return nil
+		}
 		return err
 	}
 
@@ -347,12 +683,58 @@ func (q *Queue) processInpaintingJob(ctx context.Context, job *Job) error {
 func (q *Queue) processStyleTransferJob(ctx context.Context, job *Job) error {
 	req, err := q.jobToStyleTransferRequest(job)
 	if err != nil {
-		return err
+		return Permanent(err)
+	}
+	if req.CustomStyle, err = q.jobStyleSelection(ctx, job); err != nil {
+		return Permanent(err)
 	}
 
 	q.UpdateJob(job.ID, JobStatusProcessing, 40, nil, nil)
 
 	result, err := q.aiRenderer.RenderStyleTransfer(ctx, req)
+	if err != nil {
+		if q.awaitLateResult(job, err) {
+			return nil
+		}
+		return err
+	}
+
+	q.UpdateJob(job.ID, JobStatusCompleted, 100, result, nil)
+	return nil
+}
+
+// processUpscaleJob upscales a stored render and attaches it to the source job
+func (q *Queue) processUpscaleJob(ctx context.Context, job *Job) error {
+	req, err := q.jobToUpscaleRequest(job)
+	if err != nil {
+		return Permanent(err)
+	}
+
+	q.UpdateJob(job.ID, JobStatusProcessing, 20, nil, nil)
+
+	result, err := q.aiRenderer.RenderUpscale(ctx, req)
+	if err != nil {
+		if q.awaitLateResult(job, err) {
+			return nil
+		}
+		return err
+	}
+
+	q.attachDerivedAsset(job, result)
+	q.UpdateJob(job.ID, JobStatusCompleted, 100, result, nil)
+	return nil
+}
+
+// processComposeJob draws a before/after presentation image from stored renders
+func (q *Queue) processComposeJob(ctx context.Context, job *Job) error {
+	req, err := q.jobToComposeRequest(job)
+	if err != nil {
+		return Permanent(err)
+	}
+
+	q.UpdateJob(job.ID, JobStatusProcessing, 20, nil, nil)
+
+	result, err := q.aiRenderer.RenderComposition(ctx, req)
 	if err != nil {
 		return err
 	}
@@ -361,102 +743,243 @@ func (q *Queue) processStyleTransferJob(ctx context.Context, job *Job) error {
 	return nil
 }
 
+// attachDerivedAsset records an upscale result on its source render job so the
+// original render lists every asset made from it
+func (q *Queue) attachDerivedAsset(job *Job, result *ai.RenderResult) {
+	asset, ok := ai.NewDerivedAsset(job.ID, result)
+	if !ok || asset.Provenance.SourceJobID == "" {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	source, exists := q.GetJob(asset.Provenance.SourceJobID)
+	if !exists {
+		q.logger.Warn("Source job of derived asset no longer exists",
+			"job_id", job.ID,
+			"source_job_id", asset.Provenance.SourceJobID)
+		return
+	}
+
+	sourceResult, ok := source.Result.(*ai.RenderResult)
+	if !ok {
+		return
+	}
+
+	// Copy rather than append in place; handlers may be encoding the old slice
+	derived := make([]ai.DerivedAsset, 0, len(sourceResult.Derived)+1)
+	derived = append(derived, sourceResult.Derived...)
+	updated := *sourceResult
+	updated.Derived = append(derived, asset)
+	source.Result = &updated
+
+	if err := q.store.Update(context.Background(), source); err != nil {
+		q.logger.Error("Failed to save derived asset on source job",
+			"job_id", job.ID,
+			"source_job_id", source.ID,
+			"error", err)
+	}
+}
+
 // processExportJob processes model/drawing export
 func (q *Queue) processExportJob(ctx context.Context, job *Job) error {
+	payload, err := jobPayload[*ExportPayload](job)
+	if err != nil {
+		return err
+	}
+
 	// Implementation for export jobs
 	q.UpdateJob(job.ID, JobStatusProcessing, 50, nil, nil)
 	
 	// Simulate export processing
-	time.Sleep(2 * time.Second)
+	select {
+	case <-time.After(2 * time.Second):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 	
 	result := map[string]interface{}{
 		"export_url": "/api/exports/example.pdf",
 		"format":     "pdf",
 	}
+	if payload.ModelURL != "" {
+		result["model_url"] = payload.ModelURL
+	}
 	
 	q.UpdateJob(job.ID, JobStatusCompleted, 100, result, nil)
 	return nil
 }
 
-// Helper methods to convert job data to request structs
+// Helper methods to convert job payloads to request structs
 func (q *Queue) jobToRenderRequest(job *Job) (*ai.RenderRequest, error) {
-	req := &ai.RenderRequest{
+	payload, err := jobPayload[*RenderPayload](job)
+	if err != nil {
+		return nil, err
+	}
+
+	renderType := payload.Type
+	if renderType == "" {
+		renderType = ai.RenderTypeQuick
+		if job.Type == JobTypeAIDetailed {
+			renderType = ai.RenderTypeDetailed
+		}
+	}
+
+	return &ai.RenderRequest{
 		ID:         job.ID,
 		UserID:     job.UserID,
 		ProjectID:  job.ProjectID,
-		Type:       ai.RenderType(job.Data["type"].(string)),
+		Type:       renderType,
+		Style:      ai.StyleType(payload.Style),
+		Prompt:     payload.Prompt,
+		InputImage: payload.InputImage,
+		Variants:   payload.Variants,
+		Seed:       payload.Seed,
 		Parameters: job.Data,
 		CreatedAt:  job.CreatedAt,
-	}
+	}, nil
+}
 
-	if style, ok := job.Data["style"].(string); ok {
-		req.Style = ai.StyleType(style)
+// jobStyleSelection loads the curated style referenced by the job's payload, if any
+func (q *Queue) jobStyleSelection(ctx context.Context, job *Job) (*ai.StyleSelection, error) {
+	payload, err := decodePayload(job)
+	if err != nil {
+		return nil, err
 	}
 
-	if prompt, ok := job.Data["prompt"].(string); ok {
-		req.Prompt = prompt
+	styled, ok := payload.(interface{ styleChoice() StyleChoice })
+	if !ok {
+		return nil, nil
 	}
-
-	if inputImage, ok := job.Data["input_image"].(string); ok {
-		req.InputImage = inputImage
+	choice := styled.styleChoice()
+	if choice.StyleReferenceID == "" {
+		return nil, nil
 	}
 
-	return req, nil
+	return q.aiRenderer.LoadStyleSelection(ctx, choice.StyleReferenceID, choice.AmbianceOptionID, choice.PaletteIndex)
+}
+
+// dataInt64 reads an integer job value stored either as a Go integer or as a JSON number
+func dataInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	case *int64:
+		if v == nil {
+			return 0, false
+		}
+		return *v, true
+	case float64:
+		return int64(v), true
+	default:
+		return 0, false
+	}
 }
 
 func (q *Queue) jobToModelingRequest(job *Job) (*modeling.ModelingRequest, error) {
+	payload, err := jobPayload[*ModelPayload](job)
+	if err != nil {
+		return nil, err
+	}
+
+	modelType := payload.Type
+	if modelType == "" {
+		modelType = modeling.ModelTypeRoom
+	}
+
 	req := &modeling.ModelingRequest{
-		ID:        job.ID,
-		UserID:    job.UserID,
-		ProjectID: job.ProjectID,
-		Type:      modeling.ModelType(job.Data["type"].(string)),
-		CreatedAt: job.CreatedAt,
+		ID:         job.ID,
+		UserID:     job.UserID,
+		ProjectID:  job.ProjectID,
+		Type:       modelType,
+		Room:       payload.Room,
+		Furniture:  payload.Furniture,
+		Lights:     payload.Lights,
+		Materials:  payload.Materials,
+		Parameters: payload.Parameters,
+		CreatedAt:  job.CreatedAt,
 	}
 
-	// Convert room data if present
-	if roomData, ok := job.Data["room"]; ok {
-		roomJSON, _ := json.Marshal(roomData)
-		var room modeling.Room
-		json.Unmarshal(roomJSON, &room)
-		req.Room = &room
+	// A pipeline passes the render the model is built from
+	if payload.ReferenceImage != "" {
+		if req.Parameters == nil {
+			req.Parameters = make(map[string]interface{})
+		}
+		req.Parameters["reference_image"] = payload.ReferenceImage
 	}
 
 	return req, nil
 }
 
 func (q *Queue) jobToInpaintingRequest(job *Job) (*ai.InpaintingRequest, error) {
-	req := &ai.InpaintingRequest{}
-	
-	if baseImage, ok := job.Data["base_image"].(string); ok {
-		req.BaseImage = baseImage
-	}
-	if maskImage, ok := job.Data["mask_image"].(string); ok {
-		req.MaskImage = maskImage
-	}
-	if prompt, ok := job.Data["prompt"].(string); ok {
-		req.Prompt = prompt
-	}
-	if strength, ok := job.Data["strength"].(float64); ok {
-		req.Strength = float32(strength)
-	}
-	
-	return req, nil
+	payload, err := jobPayload[*InpaintingPayload](job)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ai.InpaintingRequest{
+		UserID:         job.UserID,
+		ProjectID:      job.ProjectID,
+		BaseImage:      payload.BaseImage,
+		MaskImage:      payload.MaskImage,
+		MaskSpec:       payload.MaskSpec,
+		Prompt:         payload.Prompt,
+		FurnitureType:  payload.FurnitureType,
+		Style:          ai.StyleType(payload.Style),
+		NegativePrompt: payload.NegativePrompt,
+		Strength:       payload.Strength,
+		GuidanceScale:  payload.GuidanceScale,
+		Steps:          payload.Steps,
+	}, nil
 }
 
 func (q *Queue) jobToStyleTransferRequest(job *Job) (*ai.StyleTransferRequest, error) {
-	req := &ai.StyleTransferRequest{}
-	
-	if contentImage, ok := job.Data["content_image"].(string); ok {
-		req.ContentImage = contentImage
-	}
-	if style, ok := job.Data["style"].(string); ok {
-		req.Style = ai.StyleType(style)
+	payload, err := jobPayload[*StyleTransferPayload](job)
+	if err != nil {
+		return nil, err
 	}
-	if strength, ok := job.Data["strength"].(float64); ok {
-		req.Strength = float32(strength)
+
+	return &ai.StyleTransferRequest{
+		UserID:       job.UserID,
+		ProjectID:    job.ProjectID,
+		ContentImage: payload.ContentImage,
+		Style:        ai.StyleType(payload.Style),
+		Strength:     payload.Strength,
+	}, nil
+}
+
+func (q *Queue) jobToUpscaleRequest(job *Job) (*ai.UpscaleRequest, error) {
+	payload, err := jobPayload[*UpscalePayload](job)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ai.UpscaleRequest{
+		ID:            job.ID,
+		UserID:        job.UserID,
+		ProjectID:     job.ProjectID,
+		SourceJobID:   payload.SourceJobID,
+		SourceVariant: payload.SourceVariant,
+		SourceImage:   payload.SourceImage,
+		SourceHash:    payload.SourceHash,
+		Scale:         payload.Scale,
+	}, nil
+}
+
+func (q *Queue) jobToComposeRequest(job *Job) (*ai.ComposeRequest, error) {
+	payload, err := jobPayload[*ComposePayload](job)
+	if err != nil {
+		return nil, err
 	}
-	
-	return req, nil
+
+	req := payload.Composition
+	req.ID = job.ID
+	req.UserID = job.UserID
+	req.ProjectID = job.ProjectID
+	return &req, nil
 }
 
 // generateJobID creates a unique job ID
@@ -0,0 +1,158 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/compozit/vision/backend/internal/application/metering"
+)
+
+// recoverJobs requeues jobs orphaned by a previous run and hands every queued
+// job in the store to the workers
+func (q *Queue) recoverJobs(ctx context.Context) error {
+	recovered, err := q.store.RecoverExpired(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	for _, job := range recovered {
+		q.logger.Warn("Recovered orphaned job", "job_id", job.ID, "type", job.Type)
+	}
+
+	queued, err := q.store.List(ctx, JobFilter{Statuses: []JobStatus{JobStatusQueued}})
+	if err != nil {
+		return err
+	}
+
+	// Oldest first; List returns the newest first. Retries wait until they are due.
+	now := time.Now()
+	for i := len(queued) - 1; i >= 0; i-- {
+		if job := queued[i]; job.NextAttemptAt != nil && job.NextAttemptAt.After(now) {
+			q.delayed.add(job, *job.NextAttemptAt)
+			continue
+		}
+		q.dispatch(queued[i])
+	}
+
+	if len(queued) > 0 {
+		q.logger.Info("Resumed queued jobs", "jobs", len(queued), "recovered", len(recovered))
+	}
+
+	// Pipelines whose step finished just before the restart never started the next one
+	waiting, err := q.store.List(ctx, JobFilter{Statuses: []JobStatus{JobStatusWaiting}})
+	if err != nil {
+		return err
+	}
+	advanced := make(map[string]bool)
+	for _, job := range waiting {
+		if job.Pipeline != nil && !advanced[job.Pipeline.ID] {
+			advanced[job.Pipeline.ID] = true
+			q.advancePipeline(job.Pipeline.ID)
+		}
+	}
+	return nil
+}
+
+// recoverExpiredJobs periodically requeues jobs whose worker stopped renewing its
+// lease, e.g. because another instance sharing the store crashed
+func (q *Queue) recoverExpiredJobs(ctx context.Context) {
+	ticker := time.NewTicker(jobRecoveryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			recovered, err := q.store.RecoverExpired(ctx, time.Now())
+			if err != nil {
+				q.logger.Error("Failed to recover expired jobs", "error", err)
+				continue
+			}
+			for _, job := range recovered {
+				q.logger.Warn("Recovered job with expired lease", "job_id", job.ID, "type", job.Type)
+				q.dispatch(job)
+				q.notifier.NotifyJobUpdated(job)
+			}
+		}
+	}
+}
+
+// dispatch hands a stored queued job to the workers. A job the broker failed to
+// take stays queued in the store and is dispatched again when an instance starts.
+func (q *Queue) dispatch(job *Job) {
+	err := q.enqueue(job)
+	switch {
+	case errors.Is(err, ErrQueueDraining):
+		q.logger.Info("Leaving job queued while draining", "job_id", job.ID)
+	case err != nil:
+		q.logger.Error("Failed to publish job", "job_id", job.ID, "error", err)
+	}
+}
+
+// enqueue publishes a stored queued job to the broker, or hands it to the
+// scheduler of this process when there is none
+func (q *Queue) enqueue(job *Job) error {
+	if q.broker != nil {
+		return q.broker.Publish(context.Background(), job)
+	}
+	if !q.scheduler.push(job, q.userWeight(job.UserID)) {
+		// It stays queued in the store and runs at the next start
+		return ErrQueueDraining
+	}
+	return nil
+}
+
+// userWeight returns the fair-share weight of a user's plan tier
+func (q *Queue) userWeight(userID string) int {
+	plan := metering.PlanFree
+	if q.meter != nil {
+		balance, err := q.meter.GetBalance(context.Background(), userID)
+		if err != nil {
+			q.logger.Warn("Failed to load plan for scheduling", "user_id", userID, "error", err)
+		} else {
+			plan = balance.Plan
+		}
+	}
+	return q.scheduler.policy.weight(plan)
+}
+
+// requeueJob saves a failed job as queued for another attempt at nextAttempt
+func (q *Queue) requeueJob(jobID string, retryCount int, nextAttempt time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, err := q.store.Get(context.Background(), jobID)
+	if err != nil {
+		return err
+	}
+
+	// A job cancelled while it failed is not retried
+	if job.Status != JobStatusProcessing {
+		return fmt.Errorf("job is %s", job.Status)
+	}
+
+	job.Status = JobStatusQueued
+	job.Progress = 0
+	job.RetryCount = retryCount
+	job.NextAttemptAt = &nextAttempt
+	if err := q.store.Update(context.Background(), job); err != nil {
+		return err
+	}
+
+	q.notifier.NotifyJobUpdated(job)
+	return nil
+}
+
+// claimJob leases a queued job to a worker
+func (q *Queue) claimJob(ctx context.Context, jobID, workerID string) (*Job, error) {
+	return q.store.Claim(ctx, jobID, workerID, jobLeaseDuration)
+}
+
+// releaseJob drops a worker's lease once it stops working on the job
+func (q *Queue) releaseJob(jobID, workerID string) {
+	if err := q.store.Release(context.Background(), jobID, workerID); err != nil {
+		q.logger.Error("Failed to release job lease", "job_id", jobID, "worker_id", workerID, "error", err)
+	}
+}
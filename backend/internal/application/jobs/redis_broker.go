@@ -0,0 +1,279 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// redisConsumerGroup is the consumer group all worker processes share, so
+	// each job is delivered to one of them
+	redisConsumerGroup = "workers"
+
+	// redisStreamMaxLen roughly bounds each stream; acknowledged entries are
+	// only kept for inspection
+	redisStreamMaxLen = 100000
+)
+
+// RedisBroker is a Broker on Redis Streams. Each job type has a stream read by
+// one consumer group, with a consumer per worker process.
+type RedisBroker struct {
+	client redis.UniversalClient
+	prefix string
+
+	mu     sync.Mutex
+	groups map[string]bool // streams whose consumer group exists
+}
+
+// NewRedisBroker creates a Redis Streams broker. prefix namespaces its keys, so
+// several environments can share a Redis server.
+func NewRedisBroker(client redis.UniversalClient, prefix string) *RedisBroker {
+	return &RedisBroker{
+		client: client,
+		prefix: prefix,
+		groups: make(map[string]bool),
+	}
+}
+
+// stream is the key of a job type's stream
+func (b *RedisBroker) stream(jobType JobType) string {
+	return b.prefix + ":stream:" + string(jobType)
+}
+
+// workersKey is the key of the hash holding worker heartbeats
+func (b *RedisBroker) workersKey() string {
+	return b.prefix + ":workers"
+}
+
+// ensureGroup creates the consumer group of a stream, and the stream, unless
+// they exist. The group starts at the beginning so jobs published before any
+// worker started are delivered.
+func (b *RedisBroker) ensureGroup(ctx context.Context, stream string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.groups[stream] {
+		return nil
+	}
+	err := b.client.XGroupCreateMkStream(ctx, stream, redisConsumerGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create consumer group of %s: %w", stream, err)
+	}
+	b.groups[stream] = true
+	return nil
+}
+
+// forgetGroups makes the next read create the consumer groups again
+func (b *RedisBroker) forgetGroups() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.groups = make(map[string]bool)
+}
+
+func (b *RedisBroker) Publish(ctx context.Context, job *Job) error {
+	return b.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: b.stream(job.Type),
+		MaxLen: redisStreamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"job_id":  job.ID,
+			"user_id": job.UserID,
+		},
+	}).Err()
+}
+
+func (b *RedisBroker) Consume(ctx context.Context, consumer string, types []JobType, count int, block time.Duration) ([]Delivery, error) {
+	// XREADGROUP takes the stream keys followed by an ID per stream; ">" reads
+	// entries not yet delivered to the group
+	streams := make([]string, 0, 2*len(types))
+	for _, jobType := range types {
+		stream := b.stream(jobType)
+		if err := b.ensureGroup(ctx, stream); err != nil {
+			return nil, err
+		}
+		streams = append(streams, stream)
+	}
+	for range types {
+		streams = append(streams, ">")
+	}
+
+	result, err := b.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    redisConsumerGroup,
+		Consumer: consumer,
+		Streams:  streams,
+		Count:    int64(count),
+		Block:    block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		// The groups are gone when Redis lost its data; create them again
+		if strings.HasPrefix(err.Error(), "NOGROUP") {
+			b.forgetGroups()
+		}
+		return nil, err
+	}
+
+	var deliveries []Delivery
+	for _, stream := range result {
+		jobType := b.streamType(stream.Stream)
+		for _, message := range stream.Messages {
+			deliveries = append(deliveries, newRedisDelivery(jobType, message))
+		}
+	}
+	return deliveries, nil
+}
+
+// streamType returns the job type of a stream key
+func (b *RedisBroker) streamType(stream string) JobType {
+	return JobType(strings.TrimPrefix(stream, b.prefix+":stream:"))
+}
+
+// newRedisDelivery converts a stream entry into a delivery
+func newRedisDelivery(jobType JobType, message redis.XMessage) Delivery {
+	jobID, _ := message.Values["job_id"].(string)
+	return Delivery{ID: message.ID, JobID: jobID, JobType: jobType}
+}
+
+func (b *RedisBroker) Ack(ctx context.Context, delivery Delivery) error {
+	return b.client.XAck(ctx, b.stream(delivery.JobType), redisConsumerGroup, delivery.ID).Err()
+}
+
+func (b *RedisBroker) Reclaim(ctx context.Context, consumer string, types []JobType, minIdle time.Duration, count int) ([]Delivery, error) {
+	var deliveries []Delivery
+	for _, jobType := range types {
+		stream := b.stream(jobType)
+		if err := b.ensureGroup(ctx, stream); err != nil {
+			return nil, err
+		}
+
+		messages, _, err := b.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   stream,
+			Group:    redisConsumerGroup,
+			Consumer: consumer,
+			MinIdle:  minIdle,
+			Start:    "0-0",
+			Count:    int64(count - len(deliveries)),
+		}).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to reclaim deliveries of %s: %w", jobType, err)
+		}
+		for _, message := range messages {
+			deliveries = append(deliveries, newRedisDelivery(jobType, message))
+		}
+		if err := b.removeIdleConsumers(ctx, stream, consumer, minIdle); err != nil {
+			return nil, err
+		}
+		if len(deliveries) >= count {
+			break
+		}
+	}
+	return deliveries, nil
+}
+
+// removeIdleConsumers deletes the consumers of stopped worker processes once
+// nothing is pending with them. Each process consumes under a new name.
+func (b *RedisBroker) removeIdleConsumers(ctx context.Context, stream, self string, minIdle time.Duration) error {
+	consumers, err := b.client.XInfoConsumers(ctx, stream, redisConsumerGroup).Result()
+	if err != nil {
+		return fmt.Errorf("failed to list consumers of %s: %w", stream, err)
+	}
+	for _, consumer := range consumers {
+		if consumer.Name == self || consumer.Pending > 0 || consumer.Idle < minIdle {
+			continue
+		}
+		if err := b.client.XGroupDelConsumer(ctx, stream, redisConsumerGroup, consumer.Name).Err(); err != nil {
+			return fmt.Errorf("failed to remove consumer %s: %w", consumer.Name, err)
+		}
+	}
+	return nil
+}
+
+func (b *RedisBroker) Heartbeat(ctx context.Context, worker WorkerInfo) error {
+	encoded, err := json.Marshal(worker)
+	if err != nil {
+		return err
+	}
+	return b.client.HSet(ctx, b.workersKey(), worker.ID, encoded).Err()
+}
+
+func (b *RedisBroker) Workers(ctx context.Context) ([]WorkerInfo, error) {
+	entries, err := b.client.HGetAll(ctx, b.workersKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	workers := make([]WorkerInfo, 0, len(entries))
+	var expired []string
+	now := time.Now()
+	for id, entry := range entries {
+		var worker WorkerInfo
+		if err := json.Unmarshal([]byte(entry), &worker); err != nil || now.Sub(worker.LastSeen) > workerExpiry {
+			expired = append(expired, id)
+			continue
+		}
+		workers = append(workers, worker)
+	}
+
+	// Forget processes that stopped; their consumers remain in the group until
+	// their pending deliveries are reclaimed
+	if len(expired) > 0 {
+		if err := b.client.HDel(ctx, b.workersKey(), expired...).Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	sortWorkers(workers)
+	return workers, nil
+}
+
+func (b *RedisBroker) Stats(ctx context.Context, types []JobType) ([]StreamStats, error) {
+	stats := make([]StreamStats, 0, len(types))
+	for _, jobType := range types {
+		stream := b.stream(jobType)
+		if err := b.ensureGroup(ctx, stream); err != nil {
+			return nil, err
+		}
+
+		streamStats := StreamStats{JobType: jobType, Group: redisConsumerGroup, Lag: -1}
+		length, err := b.client.XLen(ctx, stream).Result()
+		if err != nil {
+			return nil, err
+		}
+		streamStats.Length = length
+
+		groups, err := b.client.XInfoGroups(ctx, stream).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range groups {
+			if group.Name == redisConsumerGroup {
+				streamStats.Pending, streamStats.Lag = group.Pending, group.Lag
+			}
+		}
+
+		consumers, err := b.client.XInfoConsumers(ctx, stream, redisConsumerGroup).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, consumer := range consumers {
+			streamStats.Consumers = append(streamStats.Consumers, ConsumerStats{
+				Name:        consumer.Name,
+				Pending:     consumer.Pending,
+				IdleSeconds: consumer.Idle.Seconds(),
+			})
+		}
+
+		stats = append(stats, streamStats)
+	}
+	return stats, nil
+}
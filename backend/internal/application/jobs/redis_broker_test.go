@@ -0,0 +1,204 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestBroker(t *testing.T) *RedisBroker {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedisBroker(client, "test")
+}
+
+func TestRedisBrokerDelivery(t *testing.T) {
+	ctx := context.Background()
+	broker := newTestBroker(t)
+	types := []JobType{JobTypeExport, JobTypeAIQuick}
+
+	// Jobs published before any consumer joined are delivered
+	for _, job := range []*Job{
+		{ID: "job_1", UserID: "user-1", Type: JobTypeExport},
+		{ID: "job_2", UserID: "user-1", Type: JobTypeAIQuick},
+		{ID: "job_3", UserID: "user-2", Type: JobTypeUpscale},
+	} {
+		if err := broker.Publish(ctx, job); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+	}
+
+	deliveries, err := broker.Consume(ctx, "worker-a", types, 10, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Consume failed: %v", err)
+	}
+	if len(deliveries) != 2 {
+		t.Fatalf("Expected the export and the render, got %+v", deliveries)
+	}
+	for _, delivery := range deliveries {
+		if delivery.JobType == JobTypeUpscale {
+			t.Errorf("Expected only the consumed types, got %+v", delivery)
+		}
+	}
+
+	// Each job is delivered to one consumer of the group
+	if more, _ := broker.Consume(ctx, "worker-b", types, 10, 10*time.Millisecond); len(more) != 0 {
+		t.Errorf("Expected nothing left for another consumer, got %+v", more)
+	}
+
+	if err := broker.Ack(ctx, deliveries[0]); err != nil {
+		t.Fatalf("Ack failed: %v", err)
+	}
+
+	// The unacknowledged delivery is taken over once it is idle long enough
+	if reclaimed, _ := broker.Reclaim(ctx, "worker-b", types, time.Hour, 10); len(reclaimed) != 0 {
+		t.Errorf("Expected no delivery idle for an hour, got %+v", reclaimed)
+	}
+	reclaimed, err := broker.Reclaim(ctx, "worker-b", types, 0, 10)
+	if err != nil {
+		t.Fatalf("Reclaim failed: %v", err)
+	}
+	if len(reclaimed) != 1 || reclaimed[0].JobID != deliveries[1].JobID {
+		t.Fatalf("Expected %s to be reclaimed, got %+v", deliveries[1].JobID, reclaimed)
+	}
+
+	stats, err := broker.Stats(ctx, []JobType{JobTypeAIQuick, JobTypeUpscale})
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	pending := make(map[string]int64)
+	for _, consumer := range stats[0].Consumers {
+		pending[consumer.Name] = consumer.Pending
+	}
+	if stats[0].Pending != 1 || pending["worker-b"] != 1 || pending["worker-a"] != 0 {
+		t.Errorf("Expected the render pending with worker-b, got %+v", stats[0])
+	}
+	if stats[1].Length != 1 || stats[1].Pending != 0 {
+		t.Errorf("Expected the upscale undelivered, got %+v", stats[1])
+	}
+}
+
+func TestRedisBrokerWorkers(t *testing.T) {
+	ctx := context.Background()
+	broker := newTestBroker(t)
+
+	now := time.Now()
+	broker.Heartbeat(ctx, WorkerInfo{ID: "gpu-1", Types: []JobType{JobTypeAIQuick}, LastSeen: now})
+	broker.Heartbeat(ctx, WorkerInfo{ID: "blender-1", Types: []JobType{JobType3DModel}, LastSeen: now})
+	broker.Heartbeat(ctx, WorkerInfo{ID: "gpu-0", LastSeen: now.Add(-2 * workerExpiry)})
+
+	workers, err := broker.Workers(ctx)
+	if err != nil {
+		t.Fatalf("Workers failed: %v", err)
+	}
+	if len(workers) != 2 || workers[0].ID != "blender-1" || workers[1].ID != "gpu-1" {
+		t.Errorf("Expected the live workers by ID, got %+v", workers)
+	}
+}
+
+func TestQueueRunsJobsOnBrokerWorkers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	broker := newTestBroker(t)
+	store := NewMemoryJobStore()
+
+	api := NewQueue(testLogger{}, nil, nil, 1)
+	api.SetStore(store)
+	api.SetBroker(broker, RoleEnqueue)
+	if err := api.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	worker := NewQueue(testLogger{}, nil, nil, 1)
+	worker.SetStore(store)
+	worker.SetBroker(broker, RoleWorker, JobTypeExport)
+	if err := worker.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	export := &Job{UserID: "user-1", Type: JobTypeExport}
+	if err := api.AddJob(export); err != nil {
+		t.Fatalf("AddJob failed: %v", err)
+	}
+	render := &Job{UserID: "user-1", Type: JobTypeAIQuick, Data: map[string]interface{}{"style": "modern"}}
+	if err := api.AddJob(render); err != nil {
+		t.Fatalf("AddJob failed: %v", err)
+	}
+
+	waitFor(t, func() bool {
+		stored, _ := api.GetJob(export.ID)
+		return stored.Status == JobStatusCompleted
+	})
+	if stored, _ := api.GetJob(render.ID); stored.Status != JobStatusQueued {
+		t.Errorf("Expected the render to wait for a worker consuming renders, got %s", stored.Status)
+	}
+	if api.SchedulerStats().Running[LaneBatch.String()] != 0 {
+		t.Error("Expected the enqueue-only queue to run nothing")
+	}
+
+	status, err := api.BrokerStatus(ctx)
+	if err != nil {
+		t.Fatalf("BrokerStatus failed: %v", err)
+	}
+	if status.Role != RoleEnqueue || len(status.Workers) != 1 || status.Workers[0].ID != worker.instanceID {
+		t.Errorf("Expected the worker's heartbeat, got %+v", status)
+	}
+	for _, stream := range status.Streams {
+		if stream.Pending != 0 {
+			t.Errorf("Expected every delivery acknowledged, %d pending for %s", stream.Pending, stream.JobType)
+		}
+	}
+}
+
+func TestQueueReclaimsDeliveriesOfStoppedWorker(t *testing.T) {
+	ctx := context.Background()
+	broker := newTestBroker(t)
+	store := NewMemoryJobStore()
+
+	api := NewQueue(testLogger{}, nil, nil, 1)
+	api.SetStore(store)
+	api.SetBroker(broker, RoleEnqueue)
+	job := &Job{UserID: "user-1", Type: JobTypeExport}
+	if err := api.AddJob(job); err != nil {
+		t.Fatalf("AddJob failed: %v", err)
+	}
+
+	// A worker read the job, then crashed before claiming it
+	if deliveries, _ := broker.Consume(ctx, "crashed", []JobType{JobTypeExport}, 1, 10*time.Millisecond); len(deliveries) != 1 {
+		t.Fatalf("Expected the crashed worker to hold the job, got %+v", deliveries)
+	}
+
+	worker := NewQueue(testLogger{}, nil, nil, 1)
+	worker.SetStore(store)
+	worker.SetBroker(broker, RoleWorker, JobTypeExport)
+	worker.reclaimPending(ctx, 0)
+
+	if _, ok := worker.QueuePosition(job.ID); !ok {
+		t.Fatal("Expected the reclaimed job to be scheduled")
+	}
+
+	// A second delivery of a job already scheduled is dropped
+	if err := broker.Publish(ctx, job); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	deliveries, _ := broker.Consume(ctx, worker.instanceID, []JobType{JobTypeExport}, 1, 10*time.Millisecond)
+	for _, delivery := range deliveries {
+		worker.acceptDelivery(ctx, delivery)
+	}
+	if worker.scheduler.len() != 1 {
+		t.Errorf("Expected the job scheduled once, got %d", worker.scheduler.len())
+	}
+
+	// Cancelling it acknowledges its delivery
+	if err := worker.CancelJob(job.ID); err != nil {
+		t.Fatalf("CancelJob failed: %v", err)
+	}
+	stats, _ := broker.Stats(ctx, []JobType{JobTypeExport})
+	if stats[0].Pending != 0 {
+		t.Errorf("Expected no pending deliveries, got %d", stats[0].Pending)
+	}
+}
@@ -0,0 +1,287 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/compozit/vision/backend/internal/infrastructure/storage"
+)
+
+const (
+	// retentionSweepInterval is how often finished jobs are checked against
+	// their retention policy
+	retentionSweepInterval = 10 * time.Minute
+
+	// retentionSweepBatch bounds the jobs archived per sweep; the rest wait
+	// for the next one
+	retentionSweepBatch = 500
+
+	// defaultHistoryLimit is how many finished jobs per user stay in the job store
+	defaultHistoryLimit = 200
+
+	day = 24 * time.Hour
+)
+
+// RetentionPolicy decides how long a finished job stays in the job store before
+// it is archived, or deleted when there is no archive
+type RetentionPolicy struct {
+	// TTL is counted from when the job finished; 0 keeps jobs until the
+	// history limit of their user moves them out
+	TTL time.Duration
+	// StatusTTL overrides TTL per final status, e.g. to keep failures longer
+	StatusTTL map[JobStatus]time.Duration
+}
+
+// ttl returns how long a job that finished with status is kept
+func (p RetentionPolicy) ttl(status JobStatus) time.Duration {
+	if ttl, ok := p.StatusTTL[status]; ok {
+		return ttl
+	}
+	return p.TTL
+}
+
+// defaultRetentionPolicy applies to job types without a policy of their own
+var defaultRetentionPolicy = RetentionPolicy{
+	TTL:       7 * day,
+	StatusTTL: map[JobStatus]time.Duration{JobStatusFailed: 30 * day, JobStatusCancelled: day},
+}
+
+// DefaultRetentionPolicies returns the retention policies per job type. Quick
+// previews are superseded within a day; 3D models and exports are kept for a
+// month. Failures stay 30 days for support.
+func DefaultRetentionPolicies() map[JobType]RetentionPolicy {
+	failures := func(ttl time.Duration) RetentionPolicy {
+		return RetentionPolicy{
+			TTL:       ttl,
+			StatusTTL: map[JobStatus]time.Duration{JobStatusFailed: 30 * day, JobStatusCancelled: day},
+		}
+	}
+
+	return map[JobType]RetentionPolicy{
+		JobTypeAIQuick: failures(day),
+		JobType3DModel: failures(30 * day),
+		JobTypeExport:  failures(30 * day),
+	}
+}
+
+// finalStatuses are the statuses of jobs that will not change again
+var finalStatuses = []JobStatus{JobStatusCompleted, JobStatusFailed, JobStatusCancelled}
+
+// retentionPolicy returns the retention policy of a job type
+func (q *Queue) retentionPolicy(jobType JobType) RetentionPolicy {
+	if policy, ok := q.retentionPolicies[jobType]; ok {
+		return policy
+	}
+	return defaultRetentionPolicy
+}
+
+// SetRetentionPolicy replaces the retention policy of a job type. It must be
+// called before Start.
+func (q *Queue) SetRetentionPolicy(jobType JobType, policy RetentionPolicy) {
+	q.retentionPolicies[jobType] = policy
+}
+
+// SetHistoryLimit sets how many finished jobs per user stay in the job store;
+// older ones are archived before their TTL. 0 removes the limit. It must be
+// called before Start.
+func (q *Queue) SetHistoryLimit(limit int) {
+	q.historyLimit = limit
+}
+
+// SetArchive keeps jobs moved out of the job store by retention in archive
+// instead of deleting them. When blobs is not nil, results are written there
+// and archived jobs link to them. It must be called before Start.
+func (q *Queue) SetArchive(archive JobArchive, blobs storage.BlobStore) {
+	q.archive = archive
+	q.resultBlobs = blobs
+}
+
+// expired reports whether a finished job outlived its retention policy
+func (q *Queue) expired(job *Job, now time.Time) bool {
+	ttl := q.retentionPolicy(job.Type).ttl(job.Status)
+	if ttl <= 0 {
+		return false
+	}
+
+	finished := job.CreatedAt
+	if job.CompletedAt != nil {
+		finished = *job.CompletedAt
+	}
+	return now.Sub(finished) >= ttl
+}
+
+// sweepRetention periodically moves finished jobs out of the job store
+func (q *Queue) sweepRetention(ctx context.Context) {
+	ticker := time.NewTicker(retentionSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			archived, err := q.sweepJobs(ctx, time.Now())
+			if err != nil {
+				q.logger.Error("Failed to sweep finished jobs", "error", err)
+				continue
+			}
+			if archived > 0 {
+				q.logger.Info("Moved finished jobs out of the job store", "jobs", archived)
+			}
+		}
+	}
+}
+
+// sweepJobs archives the finished jobs past their TTL or beyond the history
+// limit of their user, returning how many it moved. Steps of a pipeline stay
+// until the whole pipeline finished, as later steps read their results.
+func (q *Queue) sweepJobs(ctx context.Context, now time.Time) (int, error) {
+	finished, err := q.store.List(ctx, JobFilter{Statuses: finalStatuses})
+	if err != nil {
+		return 0, err
+	}
+
+	// Newest first, so each user's most recent jobs count against the limit
+	kept := make(map[string]int)
+	pipelineDone := make(map[string]bool)
+	archived := 0
+	for _, job := range finished {
+		if archived >= retentionSweepBatch || ctx.Err() != nil {
+			break
+		}
+
+		kept[job.UserID]++
+		overLimit := q.historyLimit > 0 && kept[job.UserID] > q.historyLimit
+		if !overLimit && !q.expired(job, now) {
+			continue
+		}
+
+		if job.Pipeline != nil {
+			done, checked := pipelineDone[job.Pipeline.ID]
+			if !checked {
+				done = q.pipelineFinished(ctx, job.Pipeline.ID)
+				pipelineDone[job.Pipeline.ID] = done
+			}
+			if !done {
+				continue
+			}
+		}
+
+		if err := q.archiveJob(ctx, job, now); err != nil {
+			q.logger.Error("Failed to archive job", "job_id", job.ID, "error", err)
+			continue
+		}
+		archived++
+	}
+	return archived, nil
+}
+
+// pipelineFinished reports whether every step of a pipeline is final
+func (q *Queue) pipelineFinished(ctx context.Context, pipelineID string) bool {
+	steps, err := q.store.List(ctx, JobFilter{PipelineID: pipelineID})
+	if err != nil {
+		q.logger.Error("Failed to load pipeline", "pipeline_id", pipelineID, "error", err)
+		return false
+	}
+	for _, step := range steps {
+		if !containsStatus(finalStatuses, step.Status) {
+			return false
+		}
+	}
+	return true
+}
+
+// archiveJob moves a finished job from the job store to the archive, writing
+// its result to blob storage first
+func (q *Queue) archiveJob(ctx context.Context, job *Job, now time.Time) error {
+	archived := copyJob(job)
+	archived.ArchivedAt = &now
+	archived.WorkerID, archived.LeaseExpiresAt = "", nil
+
+	if q.archive != nil && q.resultBlobs != nil && job.Result != nil {
+		url, err := q.archiveResult(ctx, job)
+		if err != nil {
+			return err
+		}
+		archived.Result, archived.ResultURL = nil, url
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// A dead-lettered job may have been requeued since it was listed
+	current, err := q.store.Get(ctx, job.ID)
+	if errors.Is(err, ErrJobNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !containsStatus(finalStatuses, current.Status) {
+		return nil
+	}
+
+	if q.archive != nil {
+		if err := q.archive.Put(ctx, archived); err != nil {
+			return fmt.Errorf("failed to archive job: %w", err)
+		}
+	}
+	return q.store.Delete(ctx, job.ID)
+}
+
+// archiveResult writes a job's result to blob storage, returning its URL. The
+// key is fixed per job, so archiving again after a failed delete reuses it.
+func (q *Queue) archiveResult(ctx context.Context, job *Job) (string, error) {
+	key := fmt.Sprintf("jobs/results/%s/%s.json", job.UserID, job.ID)
+
+	exists, err := q.resultBlobs.Exists(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to check archived result: %w", err)
+	}
+	if !exists {
+		encoded, err := json.Marshal(job.Result)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode result of job %s: %w", job.ID, err)
+		}
+		if err := q.resultBlobs.Put(ctx, key, bytes.NewReader(encoded), int64(len(encoded)), "application/json"); err != nil {
+			return "", fmt.Errorf("failed to archive result: %w", err)
+		}
+	}
+	return q.resultBlobs.URL(key), nil
+}
+
+// listWithArchive queries recent and archived jobs together. Both are read up
+// to the end of the requested page and merged, since retention archives jobs
+// of different types at different ages.
+func (q *Queue) listWithArchive(ctx context.Context, filter JobFilter) ([]*Job, error) {
+	window := filter
+	window.Offset = 0
+	if filter.Limit > 0 {
+		window.Limit = filter.Offset + filter.Limit
+	}
+
+	recent, err := q.store.List(ctx, window)
+	if err != nil {
+		return nil, err
+	}
+	archived, err := q.archive.List(ctx, window)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list archived jobs: %w", err)
+	}
+
+	// A job requeued from the dead letters is in both; the store has it current
+	seen := make(map[string]bool, len(recent))
+	for _, job := range recent {
+		seen[job.ID] = true
+	}
+	for _, job := range archived {
+		if !seen[job.ID] {
+			recent = append(recent, job)
+		}
+	}
+	return filter.page(recent), nil
+}
@@ -0,0 +1,176 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/compozit/vision/backend/internal/infrastructure/ai"
+	"github.com/compozit/vision/backend/internal/infrastructure/storage"
+)
+
+// newFinishedJob returns a job that finished with status at completedAt
+func newFinishedJob(id, userID string, jobType JobType, status JobStatus, completedAt time.Time) *Job {
+	job := newStoredJob(id, userID, jobType, completedAt.Add(-time.Minute))
+	job.Status = status
+	job.CompletedAt = &completedAt
+	return job
+}
+
+func TestJobArchive(t *testing.T) {
+	ctx := context.Background()
+	stores := testStores(t)
+	archives := map[string]JobArchive{
+		"memory": NewMemoryJobArchive(),
+		"bolt":   NewBoltJobArchive(stores["bolt"].(*BoltJobStore)),
+	}
+
+	now := time.Now()
+	for name, archive := range archives {
+		t.Run(name, func(t *testing.T) {
+			for i, id := range []string{"job_1", "job_2", "job_3"} {
+				job := newFinishedJob(id, "user-1", JobTypeAIQuick, JobStatusCompleted, now.Add(time.Duration(i)*time.Minute))
+				job.Result = &ai.RenderResult{ID: "render-" + id, ResultImageURL: "https://cdn.example/" + id + ".png"}
+				if id == "job_3" {
+					job.UserID = "user-2"
+				}
+				if err := archive.Put(ctx, job); err != nil {
+					t.Fatalf("Put failed: %v", err)
+				}
+			}
+
+			job, err := archive.Get(ctx, "job_1")
+			if err != nil {
+				t.Fatalf("Get failed: %v", err)
+			}
+			if result, ok := job.Result.(*ai.RenderResult); !ok || result.ID != "render-job_1" {
+				t.Errorf("Expected the typed result, got %#v", job.Result)
+			}
+			if _, err := archive.Get(ctx, "missing"); !errors.Is(err, ErrJobNotFound) {
+				t.Errorf("Expected ErrJobNotFound, got %v", err)
+			}
+
+			jobs, _ := archive.List(ctx, JobFilter{UserID: "user-1", Limit: 1, Offset: 1})
+			if got := jobIDs(jobs); len(got) != 1 || got[0] != "job_1" {
+				t.Errorf("Expected the second newest job of user-1, got %v", got)
+			}
+		})
+	}
+}
+
+func TestSweepJobsAppliesRetention(t *testing.T) {
+	ctx := context.Background()
+	blobs, err := storage.NewLocalStore(t.TempDir(), "/assets")
+	if err != nil {
+		t.Fatalf("NewLocalStore failed: %v", err)
+	}
+	archive := NewMemoryJobArchive()
+
+	q := NewQueue(testLogger{}, nil, nil, 1)
+	q.SetArchive(archive, blobs)
+
+	now := time.Now()
+	twoDaysAgo := now.Add(-2 * day)
+	preview := newFinishedJob("preview", "user-1", JobTypeAIQuick, JobStatusCompleted, twoDaysAgo)
+	preview.Result = &ai.RenderResult{ID: "render-1", ResultImageURL: "https://cdn.example/preview.png"}
+	waitingStep := newStoredJob("step_1", "user-1", JobTypeExport, twoDaysAgo)
+	waitingStep.Status = JobStatusWaiting
+	waitingStep.Pipeline = &PipelineLink{ID: "pipe_1", Step: "export", Index: 1}
+	finishedStep := newFinishedJob("step_0", "user-1", JobTypeAIQuick, JobStatusCompleted, twoDaysAgo)
+	finishedStep.Pipeline = &PipelineLink{ID: "pipe_1", Step: "render", Index: 0}
+
+	for _, job := range []*Job{
+		preview,
+		newFinishedJob("failed-preview", "user-1", JobTypeAIQuick, JobStatusFailed, twoDaysAgo),
+		newFinishedJob("detailed", "user-1", JobTypeAIDetailed, JobStatusCompleted, twoDaysAgo),
+		newFinishedJob("cancelled", "user-2", JobTypeAIDetailed, JobStatusCancelled, twoDaysAgo),
+		newStoredJob("queued", "user-2", JobTypeAIQuick, now.Add(-30*day)),
+		finishedStep,
+		waitingStep,
+	} {
+		if err := q.store.Create(ctx, job); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+
+	archived, err := q.sweepJobs(ctx, now)
+	if err != nil {
+		t.Fatalf("sweepJobs failed: %v", err)
+	}
+	if archived != 2 {
+		t.Errorf("Expected the preview and the cancelled job archived, got %d", archived)
+	}
+
+	// Failures, younger detailed renders, queued jobs and running pipelines stay
+	for _, id := range []string{"failed-preview", "detailed", "queued", "step_0", "step_1"} {
+		if _, err := q.store.Get(ctx, id); err != nil {
+			t.Errorf("Expected %s to stay in the store, got %v", id, err)
+		}
+	}
+
+	// The archived preview links to its result in blob storage
+	if _, err := q.store.Get(ctx, "preview"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected the preview evicted from the store, got %v", err)
+	}
+	stored, exists := q.GetJob("preview")
+	if !exists || stored.ArchivedAt == nil || stored.Result != nil {
+		t.Fatalf("Expected the archived preview without its result, got %+v", stored)
+	}
+	if stored.ResultURL != "/assets/jobs/results/user-1/preview.json" {
+		t.Errorf("Unexpected result URL %s", stored.ResultURL)
+	}
+	if ok, _ := blobs.Exists(ctx, "jobs/results/user-1/preview.json"); !ok {
+		t.Error("Expected the result written to blob storage")
+	}
+}
+
+func TestSweepJobsHistoryLimit(t *testing.T) {
+	ctx := context.Background()
+	q := NewQueue(testLogger{}, nil, nil, 1)
+	q.SetArchive(NewMemoryJobArchive(), nil)
+	q.SetHistoryLimit(2)
+
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		job := newFinishedJob(fmt.Sprintf("job_%d", i), "user-1", JobTypeAIDetailed, JobStatusCompleted, now.Add(time.Duration(i)*time.Minute))
+		if err := q.store.Create(ctx, job); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+	if err := q.store.Create(ctx, newFinishedJob("other", "user-2", JobTypeAIDetailed, JobStatusCompleted, now)); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	if archived, err := q.sweepJobs(ctx, now); err != nil || archived != 2 {
+		t.Fatalf("Expected the 2 oldest jobs of user-1 archived, got %d: %v", archived, err)
+	}
+
+	// Pages run across recent and archived jobs, newest first
+	var pages [][]string
+	for offset := 0; offset < 6; offset += 2 {
+		pages = append(pages, jobIDs(q.GetUserJobs("user-1", 2, offset)))
+	}
+	want := [][]string{{"job_3", "job_2"}, {"job_1", "job_0"}, nil}
+	if fmt.Sprint(pages) != fmt.Sprint(want) {
+		t.Errorf("Expected pages %v, got %v", want, pages)
+	}
+}
+
+func TestSweepJobsDeletesWithoutArchive(t *testing.T) {
+	ctx := context.Background()
+	q := NewQueue(testLogger{}, nil, nil, 1)
+
+	job := newFinishedJob("preview", "user-1", JobTypeAIQuick, JobStatusCompleted, time.Now().Add(-2*day))
+	if err := q.store.Create(ctx, job); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	if archived, _ := q.sweepJobs(ctx, time.Now()); archived != 1 {
+		t.Errorf("Expected the preview removed, got %d", archived)
+	}
+	if _, exists := q.GetJob("preview"); exists {
+		t.Error("Expected the expired preview deleted")
+	}
+}
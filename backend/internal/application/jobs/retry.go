@@ -0,0 +1,258 @@
+package jobs
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/compozit/vision/backend/internal/infrastructure/ai"
+)
+
+// RetryPolicy decides how often a failed job runs again and how long it waits
+// in between
+type RetryPolicy struct {
+	MaxRetries int
+	// BaseDelay is the wait before the first retry; it grows by Multiplier per
+	// retry up to MaxDelay
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+	Multiplier float64
+	// Jitter is the fraction of the delay that is randomised, from 0 to 1, so
+	// jobs failing together do not all retry at the same moment
+	Jitter float64
+}
+
+// defaultRetryPolicy applies to job types without a policy of their own
+var defaultRetryPolicy = RetryPolicy{
+	MaxRetries: 3,
+	BaseDelay:  2 * time.Second,
+	MaxDelay:   time.Minute,
+	Multiplier: 2,
+	Jitter:     0.5,
+}
+
+// DefaultRetryPolicies returns the retry policies per job type. Previews retry
+// quickly since a user is waiting; 3D models and exports back off longer.
+func DefaultRetryPolicies() map[JobType]RetryPolicy {
+	interactive := RetryPolicy{MaxRetries: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second, Multiplier: 2, Jitter: 0.5}
+	standard := RetryPolicy{MaxRetries: 3, BaseDelay: 2 * time.Second, MaxDelay: 30 * time.Second, Multiplier: 2, Jitter: 0.5}
+	batch := RetryPolicy{MaxRetries: 2, BaseDelay: 10 * time.Second, MaxDelay: 2 * time.Minute, Multiplier: 3, Jitter: 0.3}
+
+	return map[JobType]RetryPolicy{
+		JobTypeAIQuick:       interactive,
+		JobTypeInpainting:    interactive,
+		JobTypeStyleTransfer: interactive,
+		JobTypeCompose:       interactive,
+		JobTypeAIDetailed:    standard,
+		JobTypeUpscale:       standard,
+		JobType3DModel:       batch,
+		JobTypeExport:        batch,
+	}
+}
+
+// delay returns the wait before a retry, counted from 1. random is a number in
+// [0, 1) that picks the jittered share.
+func (p RetryPolicy) delay(retry int, random float64) time.Duration {
+	multiplier := max(p.Multiplier, 1)
+	delay := float64(p.BaseDelay) * math.Pow(multiplier, float64(max(retry-1, 0)))
+	if p.MaxDelay > 0 {
+		delay = math.Min(delay, float64(p.MaxDelay))
+	}
+
+	jitter := math.Min(math.Max(p.Jitter, 0), 1)
+	return time.Duration(delay * (1 - jitter*random))
+}
+
+// PermanentError marks a job failure that running the job again cannot fix,
+// such as a payload that does not convert to a request
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent marks err as a failure that is not retried
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// IsRetryable reports whether a failed job may succeed when it runs again.
+// Invalid payloads, panics, provider rejections and moderation failures are
+// permanent.
+func IsRetryable(err error) bool {
+	var permanent *PermanentError
+	var payload *PayloadError
+	var panicked *PanicError
+	if errors.As(err, &permanent) || errors.As(err, &payload) || errors.As(err, &panicked) {
+		return false
+	}
+	return !ai.IsPermanent(err)
+}
+
+// delayedJob is a job waiting in a delayQueue
+type delayedJob struct {
+	job   *Job
+	at    time.Time
+	index int
+}
+
+// delayHeap orders delayed jobs by due time
+type delayHeap []*delayedJob
+
+func (h delayHeap) Len() int           { return len(h) }
+func (h delayHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h delayHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+
+func (h *delayHeap) Push(x interface{}) {
+	item := x.(*delayedJob)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *delayHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return item
+}
+
+// delayQueue holds jobs until they are due, with a single timer for the
+// earliest one however many jobs wait. The jobs are also saved in the store
+// with their due time, so recovery puts them back after a restart.
+type delayQueue struct {
+	mu    sync.Mutex
+	items delayHeap
+	jobs  map[string]*delayedJob
+	// wake is signalled when the earliest due time may have changed
+	wake chan struct{}
+}
+
+func newDelayQueue() *delayQueue {
+	return &delayQueue{
+		jobs: make(map[string]*delayedJob),
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// add schedules a job to be due at the given time, replacing an earlier entry
+func (d *delayQueue) add(job *Job, at time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if item, exists := d.jobs[job.ID]; exists {
+		item.job, item.at = job, at
+		heap.Fix(&d.items, item.index)
+	} else {
+		item := &delayedJob{job: job, at: at}
+		heap.Push(&d.items, item)
+		d.jobs[job.ID] = item
+	}
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// remove drops a waiting job, reporting whether it was waiting
+func (d *delayQueue) remove(jobID string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	item, exists := d.jobs[jobID]
+	if !exists {
+		return false
+	}
+	heap.Remove(&d.items, item.index)
+	delete(d.jobs, jobID)
+	return true
+}
+
+// len returns the number of waiting jobs
+func (d *delayQueue) len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return len(d.items)
+}
+
+// popDue removes and returns the jobs due at now, and the time the next one is due
+func (d *delayQueue) popDue(now time.Time) ([]*Job, time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var due []*Job
+	for len(d.items) > 0 && !d.items[0].at.After(now) {
+		item := heap.Pop(&d.items).(*delayedJob)
+		delete(d.jobs, item.job.ID)
+		due = append(due, item.job)
+	}
+
+	var next time.Time
+	if len(d.items) > 0 {
+		next = d.items[0].at
+	}
+	return due, next
+}
+
+// run hands due jobs to dispatch until ctx is done
+func (d *delayQueue) run(ctx context.Context, dispatch func(*Job)) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		due, next := d.popDue(time.Now())
+		for _, job := range due {
+			dispatch(job)
+		}
+
+		wait := time.Hour
+		if !next.IsZero() {
+			wait = time.Until(next)
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// retryPolicy returns the retry policy of a job type
+func (q *Queue) retryPolicy(jobType JobType) RetryPolicy {
+	if policy, ok := q.retryPolicies[jobType]; ok {
+		return policy
+	}
+	return defaultRetryPolicy
+}
+
+// SetRetryPolicy replaces the retry policy of a job type. It must be called
+// before Start.
+func (q *Queue) SetRetryPolicy(jobType JobType, policy RetryPolicy) {
+	q.retryPolicies[jobType] = policy
+}
+
+// retryDelay returns the jittered wait before the given retry of a job
+func (q *Queue) retryDelay(job *Job, retry int) time.Duration {
+	return q.retryPolicy(job.Type).delay(retry, rand.Float64())
+}
@@ -0,0 +1,120 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/compozit/vision/backend/internal/infrastructure/ai"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 5, BaseDelay: time.Second, MaxDelay: 5 * time.Second, Multiplier: 2, Jitter: 0.5}
+
+	tests := []struct {
+		retry    int
+		random   float64
+		expected time.Duration
+	}{
+		{retry: 1, random: 0, expected: time.Second},
+		{retry: 2, random: 0, expected: 2 * time.Second},
+		{retry: 3, random: 0, expected: 4 * time.Second},
+		{retry: 4, random: 0, expected: 5 * time.Second}, // capped
+		{retry: 2, random: 0.5, expected: 1500 * time.Millisecond},
+		{retry: 4, random: 0.75, expected: 3125 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("retry %d random %.3f", tt.retry, tt.random), func(t *testing.T) {
+			if delay := policy.delay(tt.retry, tt.random); delay != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, delay)
+			}
+		})
+	}
+}
+
+func TestRetryDelayStaysWithinJitter(t *testing.T) {
+	q := NewQueue(testLogger{}, nil, nil, 1)
+	q.SetRetryPolicy(JobTypeExport, RetryPolicy{MaxRetries: 2, BaseDelay: time.Second, MaxDelay: time.Minute, Multiplier: 3, Jitter: 0.3})
+	job := &Job{Type: JobTypeExport}
+
+	for i := 0; i < 100; i++ {
+		delay := q.retryDelay(job, 2)
+		if delay <= 2100*time.Millisecond || delay > 3*time.Second {
+			t.Fatalf("Expected a delay between 2.1s and 3s, got %s", delay)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{name: "plain", err: errors.New("connection reset"), retryable: true},
+		{name: "permanent", err: Permanent(errors.New("invalid payload")), retryable: false},
+		{name: "wrapped permanent", err: fmt.Errorf("render failed: %w", Permanent(errors.New("bad style"))), retryable: false},
+		{name: "transient provider", err: &ai.ProviderError{Op: "create", StatusCode: 503, Transient: true}, retryable: true},
+		{name: "rejected by provider", err: &ai.ProviderError{Op: "create", StatusCode: 422}, retryable: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if retryable := IsRetryable(tt.err); retryable != tt.retryable {
+				t.Errorf("Expected retryable %v, got %v", tt.retryable, retryable)
+			}
+		})
+	}
+}
+
+func TestDelayQueueOrdering(t *testing.T) {
+	d := newDelayQueue()
+	now := time.Now()
+	d.add(&Job{ID: "late"}, now.Add(3*time.Second))
+	d.add(&Job{ID: "due"}, now.Add(-time.Second))
+	d.add(&Job{ID: "soon"}, now.Add(time.Second))
+	d.add(&Job{ID: "moved"}, now.Add(time.Hour))
+	d.add(&Job{ID: "moved"}, now.Add(2*time.Second))
+
+	if !d.remove("late") || d.remove("late") {
+		t.Error("Expected remove to report the job once")
+	}
+
+	due, next := d.popDue(now)
+	if len(due) != 1 || due[0].ID != "due" {
+		t.Fatalf("Expected only the due job, got %v", jobIDs(due))
+	}
+	if !next.Equal(now.Add(time.Second)) {
+		t.Errorf("Expected the next job due in a second, got %s", next.Sub(now))
+	}
+
+	due, next = d.popDue(now.Add(time.Minute))
+	if ids := jobIDs(due); len(ids) != 2 || ids[0] != "soon" || ids[1] != "moved" {
+		t.Errorf("Expected soon then moved, got %v", ids)
+	}
+	if !next.IsZero() || d.len() != 0 {
+		t.Errorf("Expected an empty queue, %d jobs left", d.len())
+	}
+}
+
+func TestDelayQueueDispatchesWhenDue(t *testing.T) {
+	q := NewQueue(testLogger{}, nil, nil, 1)
+	job := &Job{UserID: "user-1", Type: JobTypeExport}
+	if err := q.AddJob(job); err != nil {
+		t.Fatalf("AddJob failed: %v", err)
+	}
+	q.scheduler.remove(job.ID)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.delayed.run(ctx, q.dispatch)
+
+	q.delayed.add(job, time.Now().Add(50*time.Millisecond))
+	if q.scheduler.len() != 0 {
+		t.Fatal("Expected the job to wait until it is due")
+	}
+	waitFor(t, func() bool { return q.scheduler.len() == 1 })
+}
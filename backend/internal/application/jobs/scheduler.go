@@ -0,0 +1,496 @@
+package jobs
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/compozit/vision/backend/internal/application/metering"
+)
+
+// Lane is a priority class of jobs. Workers always take jobs from the most
+// urgent lane that has one ready.
+type Lane int
+
+const (
+	// LaneInteractive holds short jobs a user is waiting on, such as previews
+	LaneInteractive Lane = iota
+	// LaneStandard holds longer renders
+	LaneStandard
+	// LaneBatch holds long-running jobs such as 3D models and exports
+	LaneBatch
+
+	laneCount = 3
+)
+
+func (l Lane) String() string {
+	switch l {
+	case LaneInteractive:
+		return "interactive"
+	case LaneStandard:
+		return "standard"
+	default:
+		return "batch"
+	}
+}
+
+// maxQueuedJobs bounds the jobs waiting for a worker; new jobs are rejected beyond it
+const maxQueuedJobs = 100
+
+// SchedulingPolicy decides the order in which queued jobs run
+type SchedulingPolicy struct {
+	// Lanes assigns job types to priority classes; unlisted types are standard
+	Lanes map[JobType]Lane
+	// PlanWeights sets each plan tier's share of the workers within a lane
+	PlanWeights map[metering.Plan]int
+	// MaxUserConcurrency caps the jobs of one user running at the same time
+	MaxUserConcurrency int
+	// MaxBatchWorkers caps the workers running batch jobs, keeping the rest
+	// free for interactive and standard jobs
+	MaxBatchWorkers int
+	// MaxBackgroundWorkers caps the workers running standard and batch jobs
+	// together, keeping the rest free for interactive jobs; 0 removes the cap.
+	// A single worker cannot be reserved, so there it runs every lane and
+	// previews only go first among queued jobs.
+	MaxBackgroundWorkers int
+	// Estimates are the expected run times per job type until real ones are measured
+	Estimates map[JobType]time.Duration
+}
+
+// DefaultSchedulingPolicy returns the scheduling policy for a queue with the given
+// number of workers
+func DefaultSchedulingPolicy(workers int) SchedulingPolicy {
+	return SchedulingPolicy{
+		Lanes: map[JobType]Lane{
+			JobTypeAIQuick:       LaneInteractive,
+			JobTypeInpainting:    LaneInteractive,
+			JobTypeStyleTransfer: LaneInteractive,
+			JobTypeCompose:       LaneInteractive,
+			JobTypeAIDetailed:    LaneStandard,
+			JobTypeUpscale:       LaneStandard,
+			JobType3DModel:       LaneBatch,
+			JobTypeExport:        LaneBatch,
+		},
+		PlanWeights: map[metering.Plan]int{
+			metering.PlanFree:     1,
+			metering.PlanPro:      2,
+			metering.PlanBusiness: 4,
+		},
+		MaxUserConcurrency:   2,
+		MaxBatchWorkers:      max(workers-1, 1),
+		MaxBackgroundWorkers: max(workers-1, 1),
+		Estimates: map[JobType]time.Duration{
+			JobTypeAIQuick:       5 * time.Second,
+			JobTypeInpainting:    20 * time.Second,
+			JobTypeStyleTransfer: 20 * time.Second,
+			JobTypeCompose:       5 * time.Second,
+			JobTypeAIDetailed:    30 * time.Second,
+			JobTypeUpscale:       30 * time.Second,
+			JobType3DModel:       60 * time.Second,
+			JobTypeExport:        5 * time.Second,
+		},
+	}
+}
+
+func (p SchedulingPolicy) lane(jobType JobType) Lane {
+	if lane, ok := p.Lanes[jobType]; ok {
+		return lane
+	}
+	return LaneStandard
+}
+
+func (p SchedulingPolicy) weight(plan metering.Plan) int {
+	if weight := p.PlanWeights[plan]; weight > 0 {
+		return weight
+	}
+	return 1
+}
+
+// userQueue is one user's waiting jobs in a lane. pass is the user's virtual
+// time: it advances by 1/weight per dispatched job, and the user with the
+// lowest pass goes next, so users share workers in proportion to their weight.
+type userQueue struct {
+	jobs   []*Job
+	weight int
+	pass   float64
+}
+
+// schedulerLane is the waiting jobs of one priority class
+type schedulerLane struct {
+	users map[string]*userQueue
+	// vtime is the pass of the last dispatch; users joining start from it so
+	// they cannot claim the time they were idle
+	vtime float64
+}
+
+// runningJob is a job handed to a worker
+type runningJob struct {
+	lane      Lane
+	jobType   JobType
+	startedAt time.Time
+}
+
+// scheduler orders queued jobs by lane, then by weighted fair share across users
+type scheduler struct {
+	mu      sync.Mutex
+	policy  SchedulingPolicy
+	workers int
+	lanes   [laneCount]*schedulerLane
+	queued  map[string]Lane
+
+	running     map[string]*runningJob
+	userRunning map[string]int
+	laneRunning [laneCount]int
+
+	// durations holds a moving average of run times per job type
+	durations map[JobType]time.Duration
+
+	// changed is closed and replaced whenever a job may have become ready
+	changed chan struct{}
+	closed  bool
+}
+
+func newScheduler(policy SchedulingPolicy, workers int) *scheduler {
+	s := &scheduler{
+		policy:      policy,
+		workers:     max(workers, 1),
+		queued:      make(map[string]Lane),
+		running:     make(map[string]*runningJob),
+		userRunning: make(map[string]int),
+		durations:   make(map[JobType]time.Duration),
+		changed:     make(chan struct{}),
+	}
+	for i := range s.lanes {
+		s.lanes[i] = &schedulerLane{users: make(map[string]*userQueue)}
+	}
+	return s
+}
+
+// notify wakes workers waiting for a job; callers must hold the lock
+func (s *scheduler) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// push queues a job, reporting false when the scheduler is closed. weight is
+// the share of its user's plan tier.
+func (s *scheduler) push(job *Job, weight int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	if _, exists := s.queued[job.ID]; exists {
+		return true
+	}
+
+	laneID := s.policy.lane(job.Type)
+	lane := s.lanes[laneID]
+	user, exists := lane.users[job.UserID]
+	if !exists {
+		user = &userQueue{pass: lane.vtime}
+		lane.users[job.UserID] = user
+	}
+	user.weight = max(weight, 1)
+	user.jobs = append(user.jobs, job)
+
+	s.queued[job.ID] = laneID
+	s.notify()
+	return true
+}
+
+// remove takes a queued job out of its lane, reporting whether it was queued
+func (s *scheduler) remove(jobID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	laneID, exists := s.queued[jobID]
+	if !exists {
+		return false
+	}
+	delete(s.queued, jobID)
+
+	lane := s.lanes[laneID]
+	for userID, user := range lane.users {
+		for i, job := range user.jobs {
+			if job.ID != jobID {
+				continue
+			}
+			user.jobs = append(user.jobs[:i:i], user.jobs[i+1:]...)
+			if len(user.jobs) == 0 {
+				delete(lane.users, userID)
+			}
+			return true
+		}
+	}
+	return true
+}
+
+// len returns the number of queued jobs
+func (s *scheduler) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.queued)
+}
+
+// load returns the number of queued and running jobs
+func (s *scheduler) load() (queued, running int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.queued), len(s.running)
+}
+
+// isClosed reports whether the scheduler stopped handing out jobs
+func (s *scheduler) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closed
+}
+
+// next blocks until a job may run, returning nil once ctx is done, stop is
+// signalled or the scheduler is closed
+func (s *scheduler) next(ctx context.Context, stop <-chan bool) *Job {
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return nil
+		}
+		job := s.pick()
+		changed := s.changed
+		s.mu.Unlock()
+
+		if job != nil {
+			return job
+		}
+
+		select {
+		case <-changed:
+		case <-stop:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// pick removes and returns the next job allowed to run; callers must hold the lock
+func (s *scheduler) pick() *Job {
+	for laneID, lane := range s.lanes {
+		if Lane(laneID) == LaneBatch && s.laneRunning[laneID] >= s.policy.MaxBatchWorkers {
+			continue
+		}
+		if Lane(laneID) != LaneInteractive && s.policy.MaxBackgroundWorkers > 0 &&
+			s.laneRunning[LaneStandard]+s.laneRunning[LaneBatch] >= s.policy.MaxBackgroundWorkers {
+			continue
+		}
+
+		var userID string
+		var best *userQueue
+		for id, user := range lane.users {
+			if s.policy.MaxUserConcurrency > 0 && s.userRunning[id] >= s.policy.MaxUserConcurrency {
+				continue
+			}
+			if best == nil || user.pass < best.pass ||
+				(user.pass == best.pass && user.jobs[0].CreatedAt.Before(best.jobs[0].CreatedAt)) {
+				userID, best = id, user
+			}
+		}
+		if best == nil {
+			continue
+		}
+
+		job := best.jobs[0]
+		best.jobs = best.jobs[1:]
+		lane.vtime = best.pass
+		best.pass += 1 / float64(best.weight)
+		if len(best.jobs) == 0 {
+			delete(lane.users, userID)
+		}
+
+		delete(s.queued, job.ID)
+		s.running[job.ID] = &runningJob{lane: Lane(laneID), jobType: job.Type, startedAt: time.Now()}
+		s.userRunning[job.UserID]++
+		s.laneRunning[laneID]++
+		return job
+	}
+	return nil
+}
+
+// done records that a job picked by next stopped running
+func (s *scheduler) done(job *Job, elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	running, exists := s.running[job.ID]
+	if !exists {
+		return
+	}
+	delete(s.running, job.ID)
+	s.laneRunning[running.lane]--
+	if s.userRunning[job.UserID]--; s.userRunning[job.UserID] <= 0 {
+		delete(s.userRunning, job.UserID)
+	}
+
+	if elapsed > 0 {
+		if average, ok := s.durations[job.Type]; ok {
+			s.durations[job.Type] = (average*4 + elapsed) / 5
+		} else {
+			s.durations[job.Type] = elapsed
+		}
+	}
+	s.notify()
+}
+
+// close wakes all waiting workers and stops handing out jobs
+func (s *scheduler) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		s.notify()
+	}
+}
+
+// drain removes and returns every queued job, oldest first
+func (s *scheduler) drain() []*Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var jobs []*Job
+	for _, lane := range s.lanes {
+		for userID, user := range lane.users {
+			jobs = append(jobs, user.jobs...)
+			delete(lane.users, userID)
+		}
+	}
+	s.queued = make(map[string]Lane)
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+	return jobs
+}
+
+// estimate returns the expected run time of a job type; callers must hold the lock
+func (s *scheduler) estimate(jobType JobType) time.Duration {
+	if average, ok := s.durations[jobType]; ok {
+		return average
+	}
+	if estimate, ok := s.policy.Estimates[jobType]; ok {
+		return estimate
+	}
+	return 30 * time.Second
+}
+
+// QueuePosition describes where a queued job stands
+type QueuePosition struct {
+	Lane string `json:"lane"`
+	// Position is the number of jobs expected to start before this one
+	Position         int       `json:"queue_position"`
+	EstimatedStartAt time.Time `json:"estimated_start_at"`
+}
+
+// position estimates when a queued job will start by replaying the dispatch
+// order. Concurrency caps are ignored, so this is a best case.
+func (s *scheduler) position(jobID string, now time.Time) (*QueuePosition, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	laneID, exists := s.queued[jobID]
+	if !exists {
+		return nil, false
+	}
+
+	var ahead []*Job
+	for i := Lane(0); i < laneID; i++ {
+		for _, user := range s.lanes[i].users {
+			ahead = append(ahead, user.jobs...)
+		}
+	}
+	ahead = append(ahead, s.replayLane(laneID, jobID)...)
+
+	// The workers share the rest of the running jobs and the jobs ahead
+	var work time.Duration
+	for _, running := range s.running {
+		if remaining := s.estimate(running.jobType) - now.Sub(running.startedAt); remaining > 0 {
+			work += remaining
+		}
+	}
+	for _, job := range ahead {
+		work += s.estimate(job.Type)
+	}
+	wait := work / time.Duration(s.workers)
+
+	return &QueuePosition{
+		Lane:             laneID.String(),
+		Position:         len(ahead),
+		EstimatedStartAt: now.Add(wait),
+	}, true
+}
+
+// replayLane returns the jobs of a lane dispatched before jobID; callers must
+// hold the lock
+func (s *scheduler) replayLane(laneID Lane, jobID string) []*Job {
+	type replayUser struct {
+		jobs   []*Job
+		weight int
+		pass   float64
+	}
+
+	users := make([]*replayUser, 0, len(s.lanes[laneID].users))
+	for _, user := range s.lanes[laneID].users {
+		users = append(users, &replayUser{jobs: user.jobs, weight: user.weight, pass: user.pass})
+	}
+
+	var ahead []*Job
+	for {
+		var best *replayUser
+		for _, user := range users {
+			if len(user.jobs) == 0 {
+				continue
+			}
+			if best == nil || user.pass < best.pass ||
+				(user.pass == best.pass && user.jobs[0].CreatedAt.Before(best.jobs[0].CreatedAt)) {
+				best = user
+			}
+		}
+		if best == nil || best.jobs[0].ID == jobID {
+			return ahead
+		}
+
+		ahead = append(ahead, best.jobs[0])
+		best.jobs = best.jobs[1:]
+		best.pass += 1 / float64(best.weight)
+	}
+}
+
+// SchedulerStats summarises the queue for monitoring
+type SchedulerStats struct {
+	Queued  map[string]int `json:"queued"`
+	Running map[string]int `json:"running"`
+	Delayed int            `json:"delayed"` // jobs waiting for a retry
+	Workers int            `json:"workers"`
+}
+
+func (s *scheduler) stats() SchedulerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := SchedulerStats{
+		Queued:  make(map[string]int, laneCount),
+		Running: make(map[string]int, laneCount),
+		Workers: s.workers,
+	}
+	for i, lane := range s.lanes {
+		name := Lane(i).String()
+		for _, user := range lane.users {
+			stats.Queued[name] += len(user.jobs)
+		}
+		stats.Running[name] = s.laneRunning[i]
+	}
+	return stats
+}
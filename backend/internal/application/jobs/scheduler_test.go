@@ -0,0 +1,246 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newScheduledJob(id, userID string, jobType JobType, createdAt time.Time) *Job {
+	return &Job{ID: id, UserID: userID, Type: jobType, Status: JobStatusQueued, CreatedAt: createdAt}
+}
+
+// pickAll drains the scheduler, marking each job done before the next pick
+func pickAll(s *scheduler) []string {
+	var order []string
+	for {
+		s.mu.Lock()
+		job := s.pick()
+		s.mu.Unlock()
+		if job == nil {
+			return order
+		}
+		order = append(order, job.ID)
+		s.done(job, 0)
+	}
+}
+
+func TestSchedulerInteractiveBeforeBatch(t *testing.T) {
+	s := newScheduler(DefaultSchedulingPolicy(4), 4)
+	now := time.Now()
+
+	// One user floods the queue with 3D models before another asks for a preview
+	for i := 0; i < 20; i++ {
+		s.push(newScheduledJob(fmt.Sprintf("model_%d", i), "user-1", JobType3DModel, now.Add(time.Duration(i))), 1)
+	}
+	s.push(newScheduledJob("detailed", "user-2", JobTypeAIDetailed, now.Add(time.Minute)), 1)
+	s.push(newScheduledJob("preview", "user-2", JobTypeAIQuick, now.Add(2*time.Minute)), 1)
+
+	if order := pickAll(s); order[0] != "preview" || order[1] != "detailed" {
+		t.Errorf("Expected the preview then the detailed render first, got %v", order[:3])
+	}
+}
+
+func TestSchedulerConcurrencyCaps(t *testing.T) {
+	policy := DefaultSchedulingPolicy(4)
+	policy.MaxUserConcurrency = 2
+	s := newScheduler(policy, 4)
+	now := time.Now()
+
+	for i := 0; i < 5; i++ {
+		s.push(newScheduledJob(fmt.Sprintf("model_%d", i), fmt.Sprintf("user-%d", i), JobType3DModel, now), 1)
+	}
+	for i := 0; i < 3; i++ {
+		s.push(newScheduledJob(fmt.Sprintf("quick_%d", i), "user-9", JobTypeAIQuick, now), 1)
+	}
+
+	var running []*Job
+	s.mu.Lock()
+	for job := s.pick(); job != nil; job = s.pick() {
+		running = append(running, job)
+	}
+	s.mu.Unlock()
+
+	// Two previews for the capped user, and batch jobs leave one worker free
+	var quick, batch int
+	for _, job := range running {
+		if job.Type == JobTypeAIQuick {
+			quick++
+		} else {
+			batch++
+		}
+	}
+	if quick != 2 || batch != 3 {
+		t.Errorf("Expected 2 previews and 3 batch jobs running, got %d and %d", quick, batch)
+	}
+
+	// A finished preview lets the user's last one start ahead of the batch jobs
+	s.done(running[0], time.Second)
+	s.mu.Lock()
+	next := s.pick()
+	s.mu.Unlock()
+	if next == nil || next.ID != "quick_2" {
+		t.Errorf("Expected the last preview to start, got %+v", next)
+	}
+}
+
+func TestSchedulerReservesInteractiveWorker(t *testing.T) {
+	s := newScheduler(DefaultSchedulingPolicy(3), 3)
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		s.push(newScheduledJob(fmt.Sprintf("detailed_%d", i), fmt.Sprintf("user-%d", i), JobTypeAIDetailed, now), 1)
+		s.push(newScheduledJob(fmt.Sprintf("model_%d", i), fmt.Sprintf("user-%d", i), JobType3DModel, now), 1)
+	}
+
+	// Standard and batch jobs together leave one of the three workers free
+	s.mu.Lock()
+	var started int
+	for job := s.pick(); job != nil; job = s.pick() {
+		started++
+	}
+	s.mu.Unlock()
+
+	s.push(newScheduledJob("preview", "user-9", JobTypeAIQuick, now), 1)
+	s.mu.Lock()
+	next := s.pick()
+	s.mu.Unlock()
+
+	if started != 2 {
+		t.Errorf("Expected 2 background jobs running, got %d", started)
+	}
+	if next == nil || next.ID != "preview" {
+		t.Errorf("Expected the preview to take the reserved worker, got %+v", next)
+	}
+}
+
+func TestSchedulerSingleWorker(t *testing.T) {
+	s := newScheduler(DefaultSchedulingPolicy(1), 1)
+	now := time.Now()
+
+	// With nothing to reserve, background jobs still run on the only worker
+	s.push(newScheduledJob("detailed", "user-1", JobTypeAIDetailed, now), 1)
+	s.mu.Lock()
+	first := s.pick()
+	s.mu.Unlock()
+	if first == nil || first.ID != "detailed" {
+		t.Fatalf("Expected the detailed render to start, got %+v", first)
+	}
+
+	// One background job at a time; a preview queued meanwhile goes next
+	s.push(newScheduledJob("model", "user-1", JobType3DModel, now), 1)
+	s.push(newScheduledJob("export", "user-2", JobTypeExport, now), 1)
+	s.mu.Lock()
+	blocked := s.pick()
+	s.mu.Unlock()
+	if blocked != nil {
+		t.Errorf("Expected no second background job while one runs, got %s", blocked.ID)
+	}
+	s.push(newScheduledJob("preview", "user-3", JobTypeAIQuick, now.Add(time.Minute)), 1)
+
+	s.done(first, time.Second)
+	if order := pickAll(s); len(order) != 3 || order[0] != "preview" {
+		t.Errorf("Expected the preview first and every job to run, got %v", order)
+	}
+}
+
+func TestSchedulerWeightedFairShare(t *testing.T) {
+	s := newScheduler(DefaultSchedulingPolicy(4), 4)
+	now := time.Now()
+
+	// A business user (weight 4) and a free user (weight 1) with many jobs each
+	for i := 0; i < 10; i++ {
+		s.push(newScheduledJob(fmt.Sprintf("free_%d", i), "free-user", JobTypeAIQuick, now), 1)
+		s.push(newScheduledJob(fmt.Sprintf("business_%d", i), "business-user", JobTypeAIQuick, now), 4)
+	}
+
+	order := pickAll(s)
+	var business int
+	for _, id := range order[:10] {
+		if id[0] == 'b' {
+			business++
+		}
+	}
+	if business != 8 {
+		t.Errorf("Expected 8 of the first 10 jobs to be the business user's, got %d: %v", business, order[:10])
+	}
+
+	// The free user is not starved
+	var free bool
+	for _, id := range order[:5] {
+		free = free || id[0] == 'f'
+	}
+	if !free {
+		t.Errorf("Expected the free user to get a turn within the first 5 jobs: %v", order[:5])
+	}
+}
+
+func TestSchedulerPosition(t *testing.T) {
+	policy := DefaultSchedulingPolicy(2)
+	policy.Estimates[JobTypeAIQuick] = 10 * time.Second
+	policy.Estimates[JobType3DModel] = time.Minute
+	s := newScheduler(policy, 2)
+	now := time.Now()
+
+	s.push(newScheduledJob("model", "user-1", JobType3DModel, now), 1)
+	s.push(newScheduledJob("quick_1", "user-1", JobTypeAIQuick, now.Add(time.Second)), 1)
+	s.push(newScheduledJob("quick_2", "user-2", JobTypeAIQuick, now.Add(2*time.Second)), 1)
+
+	position, ok := s.position("quick_2", now)
+	if !ok || position.Position != 1 || position.Lane != "interactive" {
+		t.Fatalf("Unexpected position: %+v", position)
+	}
+	if wait := position.EstimatedStartAt.Sub(now); wait != 5*time.Second {
+		t.Errorf("Expected a 5s wait for one preview on two workers, got %s", wait)
+	}
+
+	position, _ = s.position("model", now)
+	if position.Position != 2 || position.EstimatedStartAt.Sub(now) != 10*time.Second {
+		t.Errorf("Expected the batch job behind both previews, got %+v", position)
+	}
+
+	if _, ok := s.position("missing", now); ok {
+		t.Error("Expected no position for an unknown job")
+	}
+}
+
+func TestSchedulerRemove(t *testing.T) {
+	s := newScheduler(DefaultSchedulingPolicy(2), 2)
+	now := time.Now()
+
+	s.push(newScheduledJob("quick_1", "user-1", JobTypeAIQuick, now), 1)
+	s.push(newScheduledJob("quick_2", "user-1", JobTypeAIQuick, now.Add(time.Second)), 1)
+	s.push(newScheduledJob("model", "user-2", JobType3DModel, now), 1)
+
+	if !s.remove("quick_1") || !s.remove("model") {
+		t.Fatal("Expected queued jobs to be removed")
+	}
+	if s.remove("model") {
+		t.Error("Expected a removed job not to be removed twice")
+	}
+	if order := pickAll(s); len(order) != 1 || order[0] != "quick_2" {
+		t.Errorf("Expected only the remaining job to run, got %v", order)
+	}
+}
+
+func TestSchedulerNextWakesOnPush(t *testing.T) {
+	s := newScheduler(DefaultSchedulingPolicy(1), 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	got := make(chan *Job, 1)
+	go func() { got <- s.next(ctx, nil) }()
+
+	time.Sleep(10 * time.Millisecond)
+	s.push(newScheduledJob("quick", "user-1", JobTypeAIQuick, time.Now()), 1)
+	if job := <-got; job == nil || job.ID != "quick" {
+		t.Fatalf("Expected the pushed job, got %+v", job)
+	}
+
+	go func() { got <- s.next(ctx, nil) }()
+	s.close()
+	if job := <-got; job != nil {
+		t.Errorf("Expected no job after close, got %+v", job)
+	}
+}
@@ -0,0 +1,101 @@
+package jobs
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// jsonSchemaDialect is the JSON Schema version of the generated payload schemas
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// PayloadSchema returns the JSON schema of a job type's payload, generated from
+// its payload struct. Fields tagged `jsonschema:"required"` are required; rules
+// spanning several fields are only checked by the payload's Validate.
+func PayloadSchema(jobType JobType) (map[string]interface{}, bool) {
+	spec, ok := payloadSpecs[jobType]
+	if !ok {
+		return nil, false
+	}
+
+	schema := typeSchema(reflect.TypeOf(spec.New()), map[reflect.Type]bool{})
+	schema["$schema"] = jsonSchemaDialect
+	schema["title"] = string(jobType)
+	schema["version"] = spec.Version
+	return schema, true
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// typeSchema describes a Go type as encoding/json marshals it. seen guards
+// against recursive types, which are left unconstrained.
+func typeSchema(t reflect.Type, seen map[reflect.Type]bool) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), seen)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), seen)}
+	case reflect.Struct:
+		if seen[t] {
+			return map[string]interface{}{"type": "object"}
+		}
+		seen[t] = true
+		defer delete(seen, t)
+
+		properties := make(map[string]interface{})
+		var required []string
+		addStructFields(t, properties, &required, seen)
+
+		schema := map[string]interface{}{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	default:
+		// interface{} holds any JSON value
+		return map[string]interface{}{}
+	}
+}
+
+// addStructFields adds the JSON fields of a struct to a schema, flattening
+// embedded structs as encoding/json does
+func addStructFields(t reflect.Type, properties map[string]interface{}, required *[]string, seen map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			addStructFields(field.Type, properties, required, seen)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = typeSchema(field.Type, seen)
+		if field.Tag.Get("jsonschema") == "required" {
+			*required = append(*required, name)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/compozit/vision/backend/internal/infrastructure/ai"
+	"github.com/compozit/vision/backend/internal/infrastructure/modeling"
+)
+
+var (
+	// ErrJobNotFound is returned when a store has no job with the requested ID
+	ErrJobNotFound = errors.New("job not found")
+
+	// ErrJobNotClaimable is returned when a job is no longer queued, e.g. because it
+	// was cancelled or another worker claimed it first
+	ErrJobNotClaimable = errors.New("job is not claimable")
+
+	// ErrLeaseLost is returned when a worker no longer holds the lease of its job
+	ErrLeaseLost = errors.New("job lease lost")
+)
+
+// JobFilter narrows job history queries. Results are ordered newest first.
+type JobFilter struct {
+	UserID     string
+	ProjectID  string
+	PipelineID string
+	Types      []JobType
+	Statuses   []JobStatus
+	From       time.Time
+	To         time.Time
+	Limit      int
+	Offset     int
+}
+
+// matches reports whether a job passes the filter, ignoring paging
+func (f JobFilter) matches(job *Job) bool {
+	if f.UserID != "" && job.UserID != f.UserID {
+		return false
+	}
+	if f.ProjectID != "" && job.ProjectID != f.ProjectID {
+		return false
+	}
+	if f.PipelineID != "" && (job.Pipeline == nil || job.Pipeline.ID != f.PipelineID) {
+		return false
+	}
+	if len(f.Types) > 0 && !containsType(f.Types, job.Type) {
+		return false
+	}
+	if len(f.Statuses) > 0 && !containsStatus(f.Statuses, job.Status) {
+		return false
+	}
+	if !f.From.IsZero() && job.CreatedAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !job.CreatedAt.Before(f.To) {
+		return false
+	}
+	return true
+}
+
+// page sorts matching jobs newest first and applies the filter's offset and limit
+func (f JobFilter) page(jobs []*Job) []*Job {
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+
+	if f.Offset > 0 {
+		if f.Offset >= len(jobs) {
+			return nil
+		}
+		jobs = jobs[f.Offset:]
+	}
+	if f.Limit > 0 && len(jobs) > f.Limit {
+		jobs = jobs[:f.Limit]
+	}
+	return jobs
+}
+
+func containsType(types []JobType, t JobType) bool {
+	for _, candidate := range types {
+		if candidate == t {
+			return true
+		}
+	}
+	return false
+}
+
+func containsStatus(statuses []JobStatus, s JobStatus) bool {
+	for _, candidate := range statuses {
+		if candidate == s {
+			return true
+		}
+	}
+	return false
+}
+
+// JobStore persists jobs so queued and running work survives restarts.
+//
+// A worker claims a queued job with a lease and keeps it alive with heartbeats;
+// jobs whose lease expires, because their worker or process died, are put back
+// in the queue by RecoverExpired. Jobs parked for a late result are not requeued:
+// the process reconciling their predictions holds them through Adopt instead.
+type JobStore interface {
+	Create(ctx context.Context, job *Job) error
+	Get(ctx context.Context, jobID string) (*Job, error)
+	// Update saves a job's state; its lease is left to Claim, Heartbeat and Release
+	Update(ctx context.Context, job *Job) error
+	Delete(ctx context.Context, jobID string) error
+	List(ctx context.Context, filter JobFilter) ([]*Job, error)
+
+	// Claim atomically marks a queued job as processing by workerID until the lease expires
+	Claim(ctx context.Context, jobID, workerID string, lease time.Duration) (*Job, error)
+	// Heartbeat extends the lease held by workerID
+	Heartbeat(ctx context.Context, jobID, workerID string, lease time.Duration) error
+	// Release drops the lease held by workerID without changing the job's status
+	Release(ctx context.Context, jobID, workerID string) error
+	// RecoverExpired requeues processing jobs whose lease expired before now
+	RecoverExpired(ctx context.Context, now time.Time) ([]*Job, error)
+	// Adopt leases a job parked for a late result to workerID, unless another
+	// worker holds a lease that has not expired
+	Adopt(ctx context.Context, jobID, workerID string, lease time.Duration) (*Job, error)
+}
+
+// MemoryJobStore is an in-memory JobStore for development and tests. Jobs do not
+// survive a restart.
+type MemoryJobStore struct {
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+// NewMemoryJobStore creates a new in-memory job store
+func NewMemoryJobStore() *MemoryJobStore {
+	return &MemoryJobStore{
+		jobs: make(map[string]*Job),
+	}
+}
+
+// copyJob returns a copy of a job so callers never share the stored value
+func copyJob(job *Job) *Job {
+	c := *job
+	return &c
+}
+
+func (s *MemoryJobStore) Create(ctx context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.jobs[job.ID]; exists {
+		return fmt.Errorf("job already exists: %s", job.ID)
+	}
+	s.jobs[job.ID] = copyJob(job)
+	return nil
+}
+
+func (s *MemoryJobStore) Get(ctx context.Context, jobID string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, exists := s.jobs[jobID]
+	if !exists {
+		return nil, ErrJobNotFound
+	}
+	return copyJob(job), nil
+}
+
+func (s *MemoryJobStore) Update(ctx context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, exists := s.jobs[job.ID]
+	if !exists {
+		return ErrJobNotFound
+	}
+
+	updated := copyJob(job)
+	updated.WorkerID, updated.LeaseExpiresAt = stored.WorkerID, stored.LeaseExpiresAt
+	s.jobs[job.ID] = updated
+	return nil
+}
+
+func (s *MemoryJobStore) Delete(ctx context.Context, jobID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.jobs, jobID)
+	return nil
+}
+
+func (s *MemoryJobStore) List(ctx context.Context, filter JobFilter) ([]*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var jobs []*Job
+	for _, job := range s.jobs {
+		if filter.matches(job) {
+			jobs = append(jobs, copyJob(job))
+		}
+	}
+	return filter.page(jobs), nil
+}
+
+func (s *MemoryJobStore) Claim(ctx context.Context, jobID, workerID string, lease time.Duration) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, exists := s.jobs[jobID]
+	if !exists {
+		return nil, ErrJobNotFound
+	}
+	if !claimJob(job, workerID, lease, time.Now()) {
+		return nil, ErrJobNotClaimable
+	}
+	return copyJob(job), nil
+}
+
+func (s *MemoryJobStore) Heartbeat(ctx context.Context, jobID, workerID string, lease time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, exists := s.jobs[jobID]
+	if !exists || !extendLease(job, workerID, lease, time.Now()) {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (s *MemoryJobStore) Release(ctx context.Context, jobID, workerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if job, exists := s.jobs[jobID]; exists && job.WorkerID == workerID {
+		job.WorkerID, job.LeaseExpiresAt = "", nil
+	}
+	return nil
+}
+
+func (s *MemoryJobStore) RecoverExpired(ctx context.Context, now time.Time) ([]*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var recovered []*Job
+	for _, job := range s.jobs {
+		if requeueExpired(job, now) {
+			recovered = append(recovered, copyJob(job))
+		}
+	}
+	return recovered, nil
+}
+
+func (s *MemoryJobStore) Adopt(ctx context.Context, jobID, workerID string, lease time.Duration) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, exists := s.jobs[jobID]
+	if !exists {
+		return nil, ErrJobNotFound
+	}
+	if !adoptJob(job, workerID, lease, time.Now()) {
+		return nil, ErrJobNotClaimable
+	}
+	return copyJob(job), nil
+}
+
+// claimJob leases a queued job to a worker, reporting whether it was claimable
+func claimJob(job *Job, workerID string, lease time.Duration, now time.Time) bool {
+	if job.Status != JobStatusQueued {
+		return false
+	}
+
+	expires := now.Add(lease)
+	job.Status = JobStatusProcessing
+	job.StartedAt = &now
+	job.NextAttemptAt = nil
+	job.WorkerID = workerID
+	job.LeaseExpiresAt = &expires
+	return true
+}
+
+// extendLease renews the lease of a worker's running job, reporting whether the
+// worker still held it
+func extendLease(job *Job, workerID string, lease time.Duration, now time.Time) bool {
+	if job.Status != JobStatusProcessing || job.WorkerID != workerID {
+		return false
+	}
+
+	expires := now.Add(lease)
+	job.LeaseExpiresAt = &expires
+	return true
+}
+
+// requeueExpired puts a processing job whose lease expired back in the queue.
+// Jobs parked for a late result are left to Adopt.
+func requeueExpired(job *Job, now time.Time) bool {
+	if job.Status != JobStatusProcessing || job.LateRender != nil || job.LeaseExpiresAt == nil || !job.LeaseExpiresAt.Before(now) {
+		return false
+	}
+
+	job.Status = JobStatusQueued
+	job.Progress = 0
+	job.StartedAt = nil
+	job.WorkerID = ""
+	job.LeaseExpiresAt = nil
+	return true
+}
+
+// adoptJob leases a job parked for a late result to a worker, reporting whether
+// its lease was free, expired or already the worker's
+func adoptJob(job *Job, workerID string, lease time.Duration, now time.Time) bool {
+	if job.Status != JobStatusProcessing || job.LateRender == nil {
+		return false
+	}
+	if job.WorkerID != "" && job.WorkerID != workerID && job.LeaseExpiresAt != nil && !job.LeaseExpiresAt.Before(now) {
+		return false
+	}
+
+	expires := now.Add(lease)
+	job.WorkerID = workerID
+	job.LeaseExpiresAt = &expires
+	return true
+}
+
+// jobRecord is the serialized form of a job in stores. The lease and late
+// render are kept alongside the job but never sent to clients.
+type jobRecord struct {
+	Job
+	Result         json.RawMessage `json:"result,omitempty"`
+	WorkerID       string          `json:"worker_id,omitempty"`
+	LeaseExpiresAt *time.Time      `json:"lease_expires_at,omitempty"`
+	LateRender     *LateRender     `json:"late_render,omitempty"`
+}
+
+// encodeJob serializes a job with its lease
+func encodeJob(job *Job) ([]byte, error) {
+	record := jobRecord{Job: *job, WorkerID: job.WorkerID, LeaseExpiresAt: job.LeaseExpiresAt, LateRender: job.LateRender}
+	if job.Result != nil {
+		result, err := json.Marshal(job.Result)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode result of job %s: %w", job.ID, err)
+		}
+		record.Result = result
+	}
+	return json.Marshal(record)
+}
+
+// decodeJob deserializes a job written by encodeJob
+func decodeJob(data []byte) (*Job, error) {
+	var record jobRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to decode job: %w", err)
+	}
+
+	job := record.Job
+	job.WorkerID, job.LeaseExpiresAt = record.WorkerID, record.LeaseExpiresAt
+	job.LateRender = record.LateRender
+
+	result, err := decodeJobResult(job.Type, record.Result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode result of job %s: %w", job.ID, err)
+	}
+	job.Result = result
+	return &job, nil
+}
+
+// decodeJobResult restores the typed result of a job type, so a job loaded from
+// a store looks the same to handlers as one that completed in this process
+func decodeJobResult(jobType JobType, data []byte) (interface{}, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+
+	var result interface{}
+	switch jobType {
+	case JobTypeAIQuick, JobTypeAIDetailed, JobTypeInpainting, JobTypeStyleTransfer, JobTypeUpscale, JobTypeCompose:
+		result = &ai.RenderResult{}
+	case JobType3DModel:
+		result = &modeling.ModelingResult{}
+	default:
+		var generic map[string]interface{}
+		if err := json.Unmarshal(data, &generic); err != nil {
+			return nil, err
+		}
+		return generic, nil
+	}
+
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
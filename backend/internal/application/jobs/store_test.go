@@ -0,0 +1,237 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/compozit/vision/backend/internal/infrastructure/ai"
+)
+
+// testStores returns the job stores that run without external services
+func testStores(t *testing.T) map[string]JobStore {
+	bolt, err := NewBoltJobStore(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatalf("NewBoltJobStore failed: %v", err)
+	}
+	t.Cleanup(func() { bolt.Close() })
+
+	return map[string]JobStore{
+		"memory": NewMemoryJobStore(),
+		"bolt":   bolt,
+	}
+}
+
+func newStoredJob(id, userID string, jobType JobType, createdAt time.Time) *Job {
+	return &Job{
+		ID:        id,
+		UserID:    userID,
+		Type:      jobType,
+		Status:    JobStatusQueued,
+		Data:      map[string]interface{}{"style": "modern", "variants": 2},
+		CreatedAt: createdAt,
+	}
+}
+
+func TestJobStoreClaimAndLease(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := store.Create(ctx, newStoredJob("job_1", "user-1", JobTypeAIQuick, time.Now())); err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+
+			job, err := store.Claim(ctx, "job_1", "worker-a", time.Minute)
+			if err != nil {
+				t.Fatalf("Claim failed: %v", err)
+			}
+			if job.Status != JobStatusProcessing || job.WorkerID != "worker-a" || job.StartedAt == nil {
+				t.Errorf("Unexpected claimed job: %+v", job)
+			}
+
+			// A job runs once
+			if _, err := store.Claim(ctx, "job_1", "worker-b", time.Minute); !errors.Is(err, ErrJobNotClaimable) {
+				t.Errorf("Expected a second claim to fail, got %v", err)
+			}
+			if err := store.Heartbeat(ctx, "job_1", "worker-b", time.Minute); !errors.Is(err, ErrLeaseLost) {
+				t.Errorf("Expected a heartbeat without the lease to fail, got %v", err)
+			}
+			if err := store.Heartbeat(ctx, "job_1", "worker-a", time.Minute); err != nil {
+				t.Errorf("Heartbeat failed: %v", err)
+			}
+
+			// Updates keep the lease
+			job.Progress = 40
+			if err := store.Update(ctx, job); err != nil {
+				t.Fatalf("Update failed: %v", err)
+			}
+			if job, _ = store.Get(ctx, "job_1"); job.Progress != 40 || job.WorkerID != "worker-a" {
+				t.Errorf("Expected the update to keep the lease, got %+v", job)
+			}
+
+			// Nothing has expired yet
+			if recovered, _ := store.RecoverExpired(ctx, time.Now()); len(recovered) != 0 {
+				t.Errorf("Expected no recovered jobs, got %d", len(recovered))
+			}
+
+			// The worker died: its lease runs out and the job is queued again
+			recovered, err := store.RecoverExpired(ctx, time.Now().Add(2*time.Minute))
+			if err != nil {
+				t.Fatalf("RecoverExpired failed: %v", err)
+			}
+			if len(recovered) != 1 || recovered[0].Status != JobStatusQueued || recovered[0].Progress != 0 {
+				t.Fatalf("Expected the job to be requeued, got %+v", recovered)
+			}
+			if err := store.Heartbeat(ctx, "job_1", "worker-a", time.Minute); !errors.Is(err, ErrLeaseLost) {
+				t.Errorf("Expected the dead worker's lease to be lost, got %v", err)
+			}
+
+			if _, err := store.Claim(ctx, "job_1", "worker-b", time.Minute); err != nil {
+				t.Errorf("Expected the recovered job to be claimable, got %v", err)
+			}
+			if err := store.Release(ctx, "job_1", "worker-b"); err != nil {
+				t.Fatalf("Release failed: %v", err)
+			}
+			if job, _ = store.Get(ctx, "job_1"); job.WorkerID != "" || job.LeaseExpiresAt != nil || job.Status != JobStatusProcessing {
+				t.Errorf("Expected a released job without a lease, got %+v", job)
+			}
+		})
+	}
+}
+
+func TestJobStoreAdoptParkedJob(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			store.Create(ctx, newStoredJob("job_1", "user-1", JobTypeAIQuick, time.Now()))
+			store.Claim(ctx, "job_1", "worker-a", time.Minute)
+
+			// Only jobs parked for a late result can be adopted
+			if _, err := store.Adopt(ctx, "job_1", "worker-b", time.Minute); !errors.Is(err, ErrJobNotClaimable) {
+				t.Errorf("Expected a running job not to be adoptable, got %v", err)
+			}
+
+			job, _ := store.Get(ctx, "job_1")
+			job.LateRender = &LateRender{Predictions: []LatePrediction{{ID: "p1", Seed: 7}}, Deadline: time.Now().Add(time.Hour)}
+			if err := store.Update(ctx, job); err != nil {
+				t.Fatalf("Update failed: %v", err)
+			}
+
+			// A parked job whose lease expired waits to be adopted, not rendered again
+			if recovered, _ := store.RecoverExpired(ctx, time.Now().Add(2*time.Minute)); len(recovered) != 0 {
+				t.Errorf("Expected the parked job not to be requeued, got %v", jobIDs(recovered))
+			}
+
+			if _, err := store.Adopt(ctx, "job_1", "worker-b", time.Minute); !errors.Is(err, ErrJobNotClaimable) {
+				t.Errorf("Expected a live lease to keep the job, got %v", err)
+			}
+			store.Release(ctx, "job_1", "worker-a")
+
+			adopted, err := store.Adopt(ctx, "job_1", "worker-b", -time.Second)
+			if err != nil {
+				t.Fatalf("Adopt failed: %v", err)
+			}
+			if adopted.WorkerID != "worker-b" || !adopted.LateRender.waitsFor("p1") || adopted.LateRender.Predictions[0].Seed != 7 {
+				t.Errorf("Unexpected adopted job: %+v", adopted)
+			}
+
+			// The lease of worker-b ran out, so worker-c may take over
+			if _, err := store.Adopt(ctx, "job_1", "worker-c", time.Minute); err != nil {
+				t.Errorf("Expected an expired lease to be adoptable, got %v", err)
+			}
+			if _, err := store.Adopt(ctx, "job_1", "worker-c", time.Minute); err != nil {
+				t.Errorf("Expected the holder to renew its lease, got %v", err)
+			}
+		})
+	}
+}
+
+func TestJobStoreHistory(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for i, id := range []string{"job_1", "job_2", "job_3", "job_4"} {
+				jobType := JobTypeAIQuick
+				if i == 3 {
+					jobType = JobType3DModel
+				}
+				store.Create(ctx, newStoredJob(id, "user-1", jobType, start.Add(time.Duration(i)*time.Minute)))
+			}
+			store.Create(ctx, newStoredJob("job_other", "user-2", JobTypeAIQuick, start))
+
+			completed, _ := store.Get(ctx, "job_2")
+			completed.Status = JobStatusCompleted
+			completed.Result = &ai.RenderResult{ID: "render_1", ResultImageURL: "https://example.com/render.png"}
+			store.Update(ctx, completed)
+
+			history, err := store.List(ctx, JobFilter{UserID: "user-1", Limit: 2, Offset: 1})
+			if err != nil {
+				t.Fatalf("List failed: %v", err)
+			}
+			if len(history) != 2 || history[0].ID != "job_3" || history[1].ID != "job_2" {
+				t.Errorf("Expected the second page of history newest first, got %v", jobIDs(history))
+			}
+
+			// Results keep their type through the store
+			if result, ok := history[1].Result.(*ai.RenderResult); !ok || result.ResultImageURL != "https://example.com/render.png" {
+				t.Errorf("Expected a typed render result, got %#v", history[1].Result)
+			}
+			if variants, ok := dataInt64(history[1].Data["variants"]); !ok || variants != 2 {
+				t.Errorf("Expected job data to be kept, got %v", history[1].Data)
+			}
+
+			filtered, _ := store.List(ctx, JobFilter{
+				UserID:   "user-1",
+				Types:    []JobType{JobTypeAIQuick},
+				Statuses: []JobStatus{JobStatusQueued},
+			})
+			if len(filtered) != 2 || filtered[0].ID != "job_3" || filtered[1].ID != "job_1" {
+				t.Errorf("Expected queued quick renders, got %v", jobIDs(filtered))
+			}
+
+			store.Delete(ctx, "job_1")
+			if _, err := store.Get(ctx, "job_1"); !errors.Is(err, ErrJobNotFound) {
+				t.Errorf("Expected a deleted job to be gone, got %v", err)
+			}
+		})
+	}
+}
+
+func TestBoltJobStoreSurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "jobs.db")
+
+	store, err := NewBoltJobStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Create(ctx, newStoredJob("job_1", "user-1", JobTypeAIDetailed, time.Now()))
+	store.Claim(ctx, "job_1", "worker-a", time.Millisecond)
+	store.Close()
+
+	store, err = NewBoltJobStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	recovered, err := store.RecoverExpired(ctx, time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatalf("RecoverExpired failed: %v", err)
+	}
+	if len(recovered) != 1 || recovered[0].ID != "job_1" || recovered[0].Status != JobStatusQueued {
+		t.Errorf("Expected the orphaned job to be recovered, got %+v", recovered)
+	}
+}
+
+func jobIDs(jobs []*Job) []string {
+	ids := make([]string, len(jobs))
+	for i, job := range jobs {
+		ids[i] = job.ID
+	}
+	return ids
+}
@@ -159,6 +159,21 @@ func (wsn *WebSocketNotifier) NotifyJobProgress(jobID, userID string, progress i
 	wsn.sendToUser(userID, msg)
 }
 
+// NotifyJobPreview sends an intermediate image of a running render
+func (wsn *WebSocketNotifier) NotifyJobPreview(jobID, userID string, progress int, previewURL string) {
+	msg := WebSocketMessage{
+		Type:   "job_preview",
+		JobID:  jobID,
+		UserID: userID,
+		Data: map[string]interface{}{
+			"progress":    progress,
+			"preview_url": previewURL,
+		},
+	}
+
+	wsn.sendToUser(userID, msg)
+}
+
 // NotifyJobCompleted notifies that a job has completed
 func (wsn *WebSocketNotifier) NotifyJobCompleted(job *Job) {
 	message := WebSocketMessage{
@@ -189,6 +204,20 @@ func (wsn *WebSocketNotifier) NotifyJobFailed(job *Job) {
 	wsn.sendToUser(job.UserID, message)
 }
 
+// NotifyJobCancelled notifies that a job has been cancelled
+func (wsn *WebSocketNotifier) NotifyJobCancelled(job *Job) {
+	message := WebSocketMessage{
+		Type:   "job_cancelled",
+		JobID:  job.ID,
+		UserID: job.UserID,
+		Data: map[string]interface{}{
+			"job": job,
+		},
+	}
+
+	wsn.sendToUser(job.UserID, message)
+}
+
 // sendToUser sends a message to all connections for a specific user
 func (wsn *WebSocketNotifier) sendToUser(userID string, message WebSocketMessage) {
 	wsn.mu.RLock()
@@ -2,6 +2,10 @@ package jobs
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/compozit/vision/backend/pkg/logger"
@@ -10,51 +14,49 @@ import (
 // Worker processes jobs from the queue
 type Worker struct {
 	id         int
-	jobChannel <-chan *Job
+	workerID   string // identifies the worker in job leases
 	queue      *Queue
 	logger     logger.Logger
 	quit       chan bool
+	stopOnce   sync.Once
+	done       chan struct{} // closed once Start returns
 }
 
 // NewWorker creates a new worker
-func NewWorker(id int, jobChannel <-chan *Job, queue *Queue, logger logger.Logger) *Worker {
+func NewWorker(id int, queue *Queue, logger logger.Logger) *Worker {
 	return &Worker{
 		id:         id,
-		jobChannel: jobChannel,
+		workerID:   fmt.Sprintf("%s/%d", queue.instanceID, id),
 		queue:      queue,
 		logger:     logger,
 		quit:       make(chan bool),
+		done:       make(chan struct{}),
 	}
 }
 
 // Start begins processing jobs
 func (w *Worker) Start(ctx context.Context) {
 	w.logger.Info("Worker started", "worker_id", w.id)
+	defer close(w.done)
 
 	for {
-		select {
-		case job := <-w.jobChannel:
-			if job == nil {
-				w.logger.Info("Job channel closed, stopping worker", "worker_id", w.id)
-				return
-			}
-			w.processJob(ctx, job)
-
-		case <-w.quit:
+		// The scheduler decides which job runs next
+		job := w.queue.scheduler.next(ctx, w.quit)
+		if job == nil {
 			w.logger.Info("Worker stopping", "worker_id", w.id)
 			return
-
-		case <-ctx.Done():
-			w.logger.Info("Context cancelled, stopping worker", "worker_id", w.id)
-			return
 		}
+		w.processJob(ctx, job)
 	}
 }
 
-// Stop gracefully stops the worker
+// Stop tells the worker to return once its current job finished. It does not
+// wait; done is closed when the worker returned.
 func (w *Worker) Stop() {
-	w.logger.Info("Stopping worker", "worker_id", w.id)
-	w.quit <- true
+	w.stopOnce.Do(func() {
+		w.logger.Info("Stopping worker", "worker_id", w.id)
+		close(w.quit)
+	})
 }
 
 // processJob processes a single job with retry logic
@@ -64,15 +66,74 @@ func (w *Worker) processJob(ctx context.Context, job *Job) {
 		"job_id", job.ID, 
 		"job_type", job.Type)
 
-	// Check if job was cancelled
-	if job.Status == JobStatusCancelled {
-		w.logger.Info("Job was cancelled, skipping", "job_id", job.ID)
+	// Free the job's scheduling slot once it stops running
+	started := time.Now()
+	var ran bool
+	defer func() {
+		var elapsed time.Duration
+		if ran {
+			elapsed = time.Since(started)
+		}
+		w.queue.scheduler.done(job, elapsed)
+		w.queue.settleDelivery(job.ID)
+	}()
+
+	// Claim the job; it may have been cancelled or taken by another instance
+	claimed, err := w.queue.claimJob(ctx, job.ID, w.workerID)
+	if err != nil {
+		if errors.Is(err, ErrJobNotClaimable) || errors.Is(err, ErrJobNotFound) {
+			w.logger.Info("Job is no longer queued, skipping", "job_id", job.ID)
+		} else {
+			w.logger.Error("Failed to claim job", "job_id", job.ID, "error", err)
+		}
+		return
+	}
+	job, ran = claimed, true
+
+	// Keep the lease alive while the job runs; CancelJob interrupts the job
+	// through its context
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer w.queue.untrackRunning(job.ID)
+	if !w.queue.trackRunning(job.ID, cancel) {
+		w.logger.Info("Job cancelled before it started", "worker_id", w.id, "job_id", job.ID)
+		w.queue.releaseJob(job.ID, w.workerID)
 		return
 	}
+	var leaseLost atomic.Bool
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		w.holdLease(jobCtx, cancel, job.ID, &leaseLost)
+	}()
+	defer func() {
+		cancel()
+		<-heartbeatDone
+		w.queue.releaseJob(job.ID, w.workerID)
+	}()
 
 	// Process the job
-	err := w.queue.ProcessJob(ctx, job)
-	
+	err = w.runJob(jobCtx, job)
+
+	if w.queue.isCancelled(job.ID) {
+		w.logger.Info("Job cancelled while running", "worker_id", w.id, "job_id", job.ID)
+		return
+	}
+
+	if leaseLost.Load() {
+		// The job was requeued and belongs to another worker now
+		w.logger.Warn("Abandoning job after losing its lease", "worker_id", w.id, "job_id", job.ID)
+		return
+	}
+
+	if err != nil && w.queue.interrupting.Load() {
+		// Stopped by a drain deadline rather than failed; it runs again elsewhere
+		w.logger.Warn("Requeueing job interrupted by shutdown", "worker_id", w.id, "job_id", job.ID)
+		if saveErr := w.queue.requeueInterrupted(job); saveErr != nil {
+			w.logger.Error("Failed to requeue interrupted job", "job_id", job.ID, "error", saveErr)
+		}
+		return
+	}
+
 	if err != nil {
 		w.logger.Error("Job processing failed", 
 			"worker_id", w.id,
@@ -80,11 +141,16 @@ func (w *Worker) processJob(ctx context.Context, job *Job) {
 			"error", err,
 			"retry_count", job.RetryCount)
 
-		// Handle retry logic
-		if job.RetryCount < job.MaxRetries {
+		// Retry failures that may be transient; a rejected request or an invalid
+		// payload fails for good, and a job out of retries is dead-lettered
+		switch {
+		case !IsRetryable(err):
+			w.failJob(job, err)
+		case job.RetryCount < job.MaxRetries:
 			w.retryJob(job, err)
-		} else {
+		default:
 			w.failJob(job, err)
+			w.queue.deadLetter(job, err)
 		}
 	} else {
 		w.logger.Info("Job completed successfully", 
@@ -93,35 +159,71 @@ func (w *Worker) processJob(ctx context.Context, job *Job) {
 	}
 }
 
+// runJob processes a job, recovering a panic as a PanicError so that one bad
+// job fails alone instead of taking down the worker
+func (w *Worker) runJob(ctx context.Context, job *Job) (err error) {
+	defer func() {
+		var panicked *PanicError
+		if errors.As(err, &panicked) {
+			w.logger.Error("Job panicked",
+				"worker_id", w.id,
+				"job_id", job.ID,
+				"panic", panicked.Value,
+				"stack", string(panicked.Stack))
+		}
+	}()
+	defer recoverJobPanic(&err)
+
+	return w.queue.ProcessJob(ctx, job)
+}
+
+// holdLease renews the lease of the worker's job until ctx is done. When the
+// lease is lost the job's context is cancelled, as it has been requeued.
+func (w *Worker) holdLease(ctx context.Context, cancel context.CancelFunc, jobID string, lost *atomic.Bool) {
+	ticker := time.NewTicker(jobHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := w.queue.store.Heartbeat(ctx, jobID, w.workerID, jobLeaseDuration)
+			if errors.Is(err, ErrLeaseLost) {
+				lost.Store(true)
+				cancel()
+				return
+			}
+			if err != nil {
+				// Try again on the next tick; the lease outlives several missed beats
+				w.logger.Error("Failed to renew job lease", "job_id", jobID, "error", err)
+			}
+		}
+	}
+}
+
 // retryJob schedules a job for retry after a delay
 func (w *Worker) retryJob(job *Job, err error) {
 	job.RetryCount++
 	
-	// Exponential backoff: 2^retry_count seconds
-	delay := time.Duration(1<<job.RetryCount) * time.Second
+	// Backoff with jitter, as configured for the job type
+	delay := w.queue.retryDelay(job, job.RetryCount)
+	nextAttempt := time.Now().Add(delay)
 	
 	w.logger.Info("Scheduling job retry", 
 		"job_id", job.ID,
 		"retry_count", job.RetryCount,
 		"delay", delay)
 
-	// Schedule retry after delay
-	go func() {
-		time.Sleep(delay)
-		
-		// Reset job status for retry
-		job.Status = JobStatusQueued
-		job.Progress = 0
-		
-		// Add back to queue
-		select {
-		case w.queue.jobChannel <- job:
-			w.logger.Info("Job requeued for retry", "job_id", job.ID)
-		default:
-			w.logger.Error("Failed to requeue job - queue full", "job_id", job.ID)
-			w.failJob(job, err)
-		}
-	}()
+	// Save the job as queued so a restart during the delay still retries it
+	if saveErr := w.queue.requeueJob(job.ID, job.RetryCount, nextAttempt); saveErr != nil {
+		w.logger.Error("Failed to save job for retry", "job_id", job.ID, "error", saveErr)
+		w.failJob(job, err)
+		return
+	}
+
+	// The delay queue dispatches the job when it is due; cancelling removes it
+	w.queue.delayed.add(job, nextAttempt)
 }
 
 // failJob marks a job as permanently failed
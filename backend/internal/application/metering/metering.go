@@ -0,0 +1,361 @@
+package metering
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/compozit/vision/backend/internal/infrastructure/ai"
+	"github.com/compozit/vision/backend/pkg/logger"
+)
+
+// Plan represents a subscription tier
+type Plan string
+
+const (
+	PlanFree     Plan = "free"
+	PlanPro      Plan = "pro"
+	PlanBusiness Plan = "business"
+)
+
+// ErrorCodeQuotaExceeded is the error code returned to clients when credits run out
+const ErrorCodeQuotaExceeded = "quota_exceeded"
+
+// QuotaError is returned when a user does not have enough credits for a job
+type QuotaError struct {
+	Code      string `json:"code"`
+	UserID    string `json:"user_id"`
+	Required  int64  `json:"required"`
+	Available int64  `json:"available"`
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s: job requires %d credits, %d available", e.Code, e.Required, e.Available)
+}
+
+// UsageRecord represents a single provider call
+type UsageRecord struct {
+	ID             string        `json:"id" db:"id"`
+	UserID         string        `json:"user_id" db:"user_id"`
+	ProjectID      string        `json:"project_id,omitempty" db:"project_id"`
+	PredictionID   string        `json:"prediction_id" db:"prediction_id"`
+	RenderType     string        `json:"render_type" db:"render_type"`
+	Model          string        `json:"model" db:"model"`
+	InferenceSteps int           `json:"inference_steps" db:"inference_steps"`
+	Duration       time.Duration `json:"duration" db:"duration_ns"`
+	EstimatedCost  float64       `json:"estimated_cost_usd" db:"estimated_cost_usd"`
+	Status         string        `json:"status" db:"status"`
+	CreatedAt      time.Time     `json:"created_at" db:"created_at"`
+}
+
+// Balance represents a user's credit balance for the current billing period
+type Balance struct {
+	UserID      string    `json:"user_id" db:"user_id"`
+	Plan        Plan      `json:"plan" db:"plan"`
+	Credits     int64     `json:"credits" db:"credits"`
+	Reserved    int64     `json:"reserved" db:"reserved"`
+	PeriodStart time.Time `json:"period_start" db:"period_start"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Available returns the credits that can still be reserved
+func (b *Balance) Available() int64 {
+	return b.Credits - b.Reserved
+}
+
+// UsageFilter narrows usage queries
+type UsageFilter struct {
+	UserID    string
+	ProjectID string
+	From      time.Time
+	To        time.Time
+}
+
+// UsageSummary aggregates usage for one render type and model
+type UsageSummary struct {
+	RenderType    string        `json:"render_type"`
+	Model         string        `json:"model"`
+	Calls         int           `json:"calls"`
+	FailedCalls   int           `json:"failed_calls"`
+	Duration      time.Duration `json:"duration"`
+	EstimatedCost float64       `json:"estimated_cost_usd"`
+}
+
+// UsageReport represents usage over a period for a user or a project
+type UsageReport struct {
+	UserID        string          `json:"user_id,omitempty"`
+	ProjectID     string          `json:"project_id,omitempty"`
+	From          time.Time       `json:"from"`
+	To            time.Time       `json:"to"`
+	TotalCalls    int             `json:"total_calls"`
+	TotalDuration time.Duration   `json:"total_duration"`
+	TotalCost     float64         `json:"total_cost_usd"`
+	Breakdown     []*UsageSummary `json:"breakdown"`
+	Balance       *Balance        `json:"balance,omitempty"`
+}
+
+// Pricing holds plan grants, job prices and provider cost estimates
+type Pricing struct {
+	MonthlyGrants    map[Plan]int64
+	JobCredits       map[string]int64 // credits per job (per variant for renders)
+	GPUCostPerSecond map[string]float64
+	DefaultGPUCost   float64 // USD per second when the model is not listed
+}
+
+// DefaultPricing returns the standard plan grants and job prices
+func DefaultPricing() Pricing {
+	return Pricing{
+		MonthlyGrants: map[Plan]int64{
+			PlanFree:     50,
+			PlanPro:      1000,
+			PlanBusiness: 5000,
+		},
+		JobCredits: map[string]int64{
+			"ai_quick":       1,
+			"ai_detailed":    5,
+			"inpainting":     3,
+			"style_transfer": 3,
+			"3d_model":       10,
+			"export":         0,
+			"upscale":        2,
+			"compose":        0,
+		},
+		GPUCostPerSecond: map[string]float64{
+			"stability-ai/sdxl-turbo:latest":          0.000725,
+			"stability-ai/stable-diffusion-xl:latest": 0.0014,
+			"nightmareai/real-esrgan:latest":          0.000225,
+		},
+		DefaultGPUCost: 0.0014,
+	}
+}
+
+// Meter records provider usage and enforces per-user credit quotas
+type Meter struct {
+	store   Store
+	pricing Pricing
+	logger  logger.Logger
+	now     func() time.Time
+}
+
+// NewMeter creates a new usage meter
+func NewMeter(store Store, pricing Pricing, logger logger.Logger) *Meter {
+	return &Meter{
+		store:   store,
+		pricing: pricing,
+		logger:  logger,
+		now:     time.Now,
+	}
+}
+
+// Ensure Meter implements the renderer's usage recorder
+var _ ai.UsageRecorder = (*Meter)(nil)
+
+// JobCredits returns the credit price of a job type
+func (m *Meter) JobCredits(jobType string, variants int) int64 {
+	if variants < 1 {
+		variants = 1
+	}
+
+	credits := m.pricing.JobCredits[jobType]
+	switch jobType {
+	case "ai_quick", "ai_detailed":
+		credits *= int64(variants)
+	}
+	return credits
+}
+
+// Reserve holds credits for a job before it is enqueued. It returns a QuotaError
+// when the user's available balance is too low.
+func (m *Meter) Reserve(ctx context.Context, userID string, credits int64) error {
+	if credits <= 0 {
+		return nil
+	}
+
+	balance, err := m.GetBalance(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	ok, err := m.store.Reserve(ctx, userID, credits)
+	if err != nil {
+		return fmt.Errorf("failed to reserve credits: %w", err)
+	}
+
+	if !ok {
+		m.logger.Info("User over quota", "user_id", userID, "required", credits, "available", balance.Available())
+		return &QuotaError{
+			Code:      ErrorCodeQuotaExceeded,
+			UserID:    userID,
+			Required:  credits,
+			Available: balance.Available(),
+		}
+	}
+
+	return nil
+}
+
+// Settle converts a reservation into a charge when the job succeeded, or releases it
+func (m *Meter) Settle(ctx context.Context, userID string, credits int64, succeeded bool) error {
+	if credits <= 0 {
+		return nil
+	}
+
+	if succeeded {
+		return m.store.Charge(ctx, userID, credits)
+	}
+	return m.store.Release(ctx, userID, credits)
+}
+
+// GetBalance returns the user's balance, applying the monthly grant when a new period started
+func (m *Meter) GetBalance(ctx context.Context, userID string) (*Balance, error) {
+	balance, err := m.store.GetBalance(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get balance: %w", err)
+	}
+
+	periodStart := monthStart(m.now())
+	if !balance.PeriodStart.Before(periodStart) {
+		return balance, nil
+	}
+
+	// Grants reset each month; unused credits do not roll over
+	grant := m.pricing.MonthlyGrants[balance.Plan]
+	applied, err := m.store.ApplyGrant(ctx, userID, grant, periodStart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply monthly grant: %w", err)
+	}
+	if applied {
+		m.logger.Info("Applied monthly credit grant", "user_id", userID, "plan", balance.Plan, "credits", grant)
+	}
+
+	// Read again, as a concurrent request may have applied the grant first
+	balance, err = m.store.GetBalance(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get balance: %w", err)
+	}
+	return balance, nil
+}
+
+// SetPlan changes a user's plan and grants the new plan's credits for the current period
+func (m *Meter) SetPlan(ctx context.Context, userID string, plan Plan) error {
+	grant, ok := m.pricing.MonthlyGrants[plan]
+	if !ok {
+		return fmt.Errorf("unknown plan: %s", plan)
+	}
+
+	if err := m.store.SetPlan(ctx, userID, plan, grant, monthStart(m.now())); err != nil {
+		return fmt.Errorf("failed to set plan: %w", err)
+	}
+	return nil
+}
+
+// RecordProviderCall stores a provider call with its estimated cost
+func (m *Meter) RecordProviderCall(ctx context.Context, call ai.ProviderCall) {
+	costPerSecond, ok := m.pricing.GPUCostPerSecond[call.Model]
+	if !ok {
+		costPerSecond = m.pricing.DefaultGPUCost
+	}
+
+	record := &UsageRecord{
+		ID:             "usage_" + uuid.NewString(),
+		UserID:         call.UserID,
+		ProjectID:      call.ProjectID,
+		PredictionID:   call.PredictionID,
+		RenderType:     string(call.RenderType),
+		Model:          call.Model,
+		InferenceSteps: call.InferenceSteps,
+		Duration:       call.Duration,
+		EstimatedCost:  call.Duration.Seconds() * costPerSecond,
+		Status:         call.Status,
+		CreatedAt:      m.now(),
+	}
+
+	if err := m.store.RecordUsage(ctx, record); err != nil {
+		m.logger.Error("Failed to record provider usage",
+			"prediction_id", call.PredictionID,
+			"user_id", call.UserID,
+			"error", err)
+	}
+}
+
+// SettleProviderCall records the final status and duration of a provider call
+// that was recorded as pending, so late predictions are not reported as failed
+func (m *Meter) SettleProviderCall(ctx context.Context, predictionID, status string, duration time.Duration) {
+	settled, err := m.store.SettleUsage(ctx, predictionID, status, duration)
+	if err != nil {
+		m.logger.Error("Failed to settle provider usage", "prediction_id", predictionID, "error", err)
+		return
+	}
+	if !settled {
+		m.logger.Warn("No pending provider usage to settle", "prediction_id", predictionID, "status", status)
+	}
+}
+
+// UserReport returns a user's usage over a period together with their balance
+func (m *Meter) UserReport(ctx context.Context, userID string, from, to time.Time) (*UsageReport, error) {
+	report, err := m.report(ctx, UsageFilter{UserID: userID, From: from, To: to})
+	if err != nil {
+		return nil, err
+	}
+
+	report.UserID = userID
+	report.Balance, err = m.GetBalance(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// ProjectReport returns a user's usage for one project over a period
+func (m *Meter) ProjectReport(ctx context.Context, userID, projectID string, from, to time.Time) (*UsageReport, error) {
+	report, err := m.report(ctx, UsageFilter{UserID: userID, ProjectID: projectID, From: from, To: to})
+	if err != nil {
+		return nil, err
+	}
+
+	report.ProjectID = projectID
+	return report, nil
+}
+
+// report aggregates usage records by render type and model
+func (m *Meter) report(ctx context.Context, filter UsageFilter) (*UsageReport, error) {
+	records, err := m.store.ListUsage(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list usage: %w", err)
+	}
+
+	report := &UsageReport{From: filter.From, To: filter.To}
+	summaries := make(map[string]*UsageSummary)
+
+	for _, record := range records {
+		key := record.RenderType + "|" + record.Model
+		summary, ok := summaries[key]
+		if !ok {
+			summary = &UsageSummary{RenderType: record.RenderType, Model: record.Model}
+			summaries[key] = summary
+			report.Breakdown = append(report.Breakdown, summary)
+		}
+
+		summary.Calls++
+		if record.Status != "succeeded" {
+			summary.FailedCalls++
+		}
+		summary.Duration += record.Duration
+		summary.EstimatedCost += record.EstimatedCost
+
+		report.TotalCalls++
+		report.TotalDuration += record.Duration
+		report.TotalCost += record.EstimatedCost
+	}
+
+	return report, nil
+}
+
+// monthStart returns the first instant of t's month in UTC
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
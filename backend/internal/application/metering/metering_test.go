@@ -0,0 +1,213 @@
+package metering
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/compozit/vision/backend/internal/infrastructure/ai"
+)
+
+type testLogger struct{}
+
+func (testLogger) Debug(msg string, kv ...interface{}) {}
+func (testLogger) Info(msg string, kv ...interface{})  {}
+func (testLogger) Warn(msg string, kv ...interface{})  {}
+func (testLogger) Error(msg string, kv ...interface{}) {}
+
+func newTestMeter(now time.Time) *Meter {
+	meter := NewMeter(NewMemoryStore(), DefaultPricing(), testLogger{})
+	meter.now = func() time.Time { return now }
+	return meter
+}
+
+func TestMonthlyGrant(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	meter := newTestMeter(now)
+
+	balance, err := meter.GetBalance(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("GetBalance failed: %v", err)
+	}
+	if balance.Plan != PlanFree || balance.Credits != 50 {
+		t.Errorf("Expected 50 free credits, got %d on %s", balance.Credits, balance.Plan)
+	}
+
+	if err := meter.SetPlan(ctx, "user-1", PlanPro); err != nil {
+		t.Fatalf("SetPlan failed: %v", err)
+	}
+	balance, _ = meter.GetBalance(ctx, "user-1")
+	if balance.Credits != 1000 {
+		t.Errorf("Expected 1000 pro credits, got %d", balance.Credits)
+	}
+
+	// Spent credits are restored at the start of the next month
+	if err := meter.Reserve(ctx, "user-1", 400); err != nil {
+		t.Fatalf("Reserve failed: %v", err)
+	}
+	meter.Settle(ctx, "user-1", 400, true)
+
+	meter.now = func() time.Time { return now.AddDate(0, 1, 0) }
+	balance, _ = meter.GetBalance(ctx, "user-1")
+	if balance.Credits != 1000 {
+		t.Errorf("Expected grant reset to 1000 credits, got %d", balance.Credits)
+	}
+}
+
+func TestMonthlyGrantAppliesOnce(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+
+	if err := store.SetPlan(ctx, "user-1", PlanPro, 1000, monthStart(now.AddDate(0, -1, 0))); err != nil {
+		t.Fatalf("SetPlan failed: %v", err)
+	}
+	store.Reserve(ctx, "user-1", 300)
+
+	// Reservations of jobs still running from the previous period carry over
+	periodStart := monthStart(now)
+	if applied, err := store.ApplyGrant(ctx, "user-1", 1000, periodStart); err != nil || !applied {
+		t.Fatalf("Expected the grant applied, got %v: %v", applied, err)
+	}
+	balance, _ := store.GetBalance(ctx, "user-1")
+	if balance.Credits != 1000 || balance.Reserved != 300 {
+		t.Errorf("Expected 1000 credits and 300 reserved, got %d and %d", balance.Credits, balance.Reserved)
+	}
+
+	// Releasing the old job's reservation leaves those of the new period alone
+	store.Reserve(ctx, "user-1", 400)
+	store.Release(ctx, "user-1", 300)
+	if balance, _ = store.GetBalance(ctx, "user-1"); balance.Reserved != 400 {
+		t.Errorf("Expected 400 reserved, got %d", balance.Reserved)
+	}
+
+	// A racing request for the same period leaves spent credits alone
+	store.Charge(ctx, "user-1", 400)
+	if applied, _ := store.ApplyGrant(ctx, "user-1", 1000, periodStart); applied {
+		t.Error("Expected the grant not to apply twice in a period")
+	}
+	balance, _ = store.GetBalance(ctx, "user-1")
+	if balance.Credits != 600 {
+		t.Errorf("Expected 600 credits left, got %d", balance.Credits)
+	}
+}
+
+func TestReserveOverQuota(t *testing.T) {
+	ctx := context.Background()
+	meter := newTestMeter(time.Now())
+
+	if err := meter.Reserve(ctx, "user-1", 45); err != nil {
+		t.Fatalf("Reserve failed: %v", err)
+	}
+
+	err := meter.Reserve(ctx, "user-1", 10)
+	var quotaErr *QuotaError
+	if !errors.As(err, &quotaErr) {
+		t.Fatalf("Expected QuotaError, got %v", err)
+	}
+	if quotaErr.Code != ErrorCodeQuotaExceeded || quotaErr.Required != 10 || quotaErr.Available != 5 {
+		t.Errorf("Unexpected quota error: %+v", quotaErr)
+	}
+}
+
+func TestSettle(t *testing.T) {
+	ctx := context.Background()
+	meter := newTestMeter(time.Now())
+
+	meter.Reserve(ctx, "user-1", 10)
+	meter.Reserve(ctx, "user-1", 5)
+
+	// A failed job returns its credits, a completed one is charged
+	meter.Settle(ctx, "user-1", 10, false)
+	meter.Settle(ctx, "user-1", 5, true)
+
+	balance, _ := meter.GetBalance(ctx, "user-1")
+	if balance.Credits != 45 || balance.Reserved != 0 {
+		t.Errorf("Expected 45 credits and nothing reserved, got %d/%d", balance.Credits, balance.Reserved)
+	}
+}
+
+func TestJobCredits(t *testing.T) {
+	meter := newTestMeter(time.Now())
+
+	if got := meter.JobCredits("ai_detailed", 4); got != 20 {
+		t.Errorf("Expected 20 credits for 4 detailed variants, got %d", got)
+	}
+	if got := meter.JobCredits("inpainting", 4); got != 3 {
+		t.Errorf("Expected variants to be ignored for inpainting, got %d", got)
+	}
+}
+
+func TestUserReport(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	meter := newTestMeter(now)
+
+	meter.RecordProviderCall(ctx, ai.ProviderCall{
+		UserID:     "user-1",
+		ProjectID:  "project-1",
+		RenderType: ai.RenderTypeDetailed,
+		Model:      "stability-ai/stable-diffusion-xl:latest",
+		Duration:   10 * time.Second,
+		Status:     "succeeded",
+	})
+	meter.RecordProviderCall(ctx, ai.ProviderCall{
+		UserID:     "user-1",
+		RenderType: ai.RenderTypeDetailed,
+		Model:      "stability-ai/stable-diffusion-xl:latest",
+		Duration:   5 * time.Second,
+		Status:     "failed",
+	})
+
+	report, err := meter.UserReport(ctx, "user-1", monthStart(now), monthStart(now).AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatalf("UserReport failed: %v", err)
+	}
+	if report.TotalCalls != 2 || len(report.Breakdown) != 1 || report.Breakdown[0].FailedCalls != 1 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	if report.TotalCost < 0.0209 || report.TotalCost > 0.0211 {
+		t.Errorf("Expected cost of 15 GPU seconds, got %f", report.TotalCost)
+	}
+
+	projectReport, _ := meter.ProjectReport(ctx, "user-1", "project-1", monthStart(now), monthStart(now).AddDate(0, 1, 0))
+	if projectReport.TotalCalls != 1 {
+		t.Errorf("Expected 1 project call, got %d", projectReport.TotalCalls)
+	}
+}
+
+func TestSettleProviderCall(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	meter := newTestMeter(now)
+
+	// A prediction that outlived the render call is recorded as pending
+	meter.RecordProviderCall(ctx, ai.ProviderCall{
+		UserID:       "user-1",
+		PredictionID: "p1",
+		RenderType:   ai.RenderTypeDetailed,
+		Model:        "stability-ai/stable-diffusion-xl:latest",
+		Duration:     5 * time.Second,
+		Status:       "pending",
+	})
+	meter.SettleProviderCall(ctx, "p1", "succeeded", 10*time.Second)
+
+	report, err := meter.UserReport(ctx, "user-1", monthStart(now), monthStart(now).AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatalf("UserReport failed: %v", err)
+	}
+	if report.TotalCalls != 1 || report.Breakdown[0].FailedCalls != 0 || report.TotalDuration != 10*time.Second {
+		t.Errorf("Expected one succeeded call of 10s, got %+v", report)
+	}
+	if report.TotalCost < 0.0139 || report.TotalCost > 0.0141 {
+		t.Errorf("Expected cost of 10 GPU seconds, got %f", report.TotalCost)
+	}
+
+	// A settled call is not settled again
+	meter.SettleProviderCall(ctx, "p1", "failed", time.Minute)
+	if report, _ = meter.UserReport(ctx, "user-1", monthStart(now), monthStart(now).AddDate(0, 1, 0)); report.Breakdown[0].FailedCalls != 0 {
+		t.Errorf("Expected the call to stay succeeded, got %+v", report.Breakdown[0])
+	}
+}
@@ -0,0 +1,191 @@
+package metering
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// PostgresStore persists usage and balances in the ai_usage_records and
+// ai_credit_balances tables
+type PostgresStore struct {
+	db *sqlx.DB
+}
+
+// NewPostgresStore creates a new Postgres-backed store
+func NewPostgresStore(db *sqlx.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) GetBalance(ctx context.Context, userID string) (*Balance, error) {
+	// Insert a zero free-plan balance on first use; the meter applies the grant
+	query := `
+		INSERT INTO ai_credit_balances (user_id, plan, credits, reserved, period_start, updated_at)
+		VALUES ($1, 'free', 0, 0, 'epoch', NOW())
+		ON CONFLICT (user_id) DO NOTHING`
+
+	if _, err := s.db.ExecContext(ctx, query, userID); err != nil {
+		return nil, fmt.Errorf("failed to initialise balance: %w", err)
+	}
+
+	balance := &Balance{}
+	query = `SELECT user_id, plan, credits, reserved, period_start, updated_at
+		FROM ai_credit_balances WHERE user_id = $1`
+
+	if err := s.db.GetContext(ctx, balance, query, userID); err != nil {
+		return nil, fmt.Errorf("failed to get balance: %w", err)
+	}
+
+	return balance, nil
+}
+
+func (s *PostgresStore) SetPlan(ctx context.Context, userID string, plan Plan, credits int64, periodStart time.Time) error {
+	query := `
+		INSERT INTO ai_credit_balances (user_id, plan, credits, reserved, period_start, updated_at)
+		VALUES ($1, $2, $3, 0, $4, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET
+			plan = EXCLUDED.plan,
+			credits = EXCLUDED.credits,
+			period_start = EXCLUDED.period_start,
+			updated_at = NOW()`
+
+	_, err := s.db.ExecContext(ctx, query, userID, plan, credits, periodStart)
+	return err
+}
+
+func (s *PostgresStore) ApplyGrant(ctx context.Context, userID string, credits int64, periodStart time.Time) (bool, error) {
+	// The period check makes the grant apply once when requests race at the
+	// start of a month; reservations of jobs still running are kept
+	query := `UPDATE ai_credit_balances
+		SET credits = $2, period_start = $3, updated_at = NOW()
+		WHERE user_id = $1 AND period_start < $3`
+
+	result, err := s.db.ExecContext(ctx, query, userID, credits, periodStart)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows == 1, nil
+}
+
+func (s *PostgresStore) Reserve(ctx context.Context, userID string, credits int64) (bool, error) {
+	// The WHERE clause makes the check-and-reserve atomic
+	query := `UPDATE ai_credit_balances
+		SET reserved = reserved + $2, updated_at = NOW()
+		WHERE user_id = $1 AND credits - reserved >= $2`
+
+	result, err := s.db.ExecContext(ctx, query, userID, credits)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows == 1, nil
+}
+
+func (s *PostgresStore) Release(ctx context.Context, userID string, credits int64) error {
+	query := `UPDATE ai_credit_balances
+		SET reserved = GREATEST(reserved - $2, 0), updated_at = NOW()
+		WHERE user_id = $1`
+
+	_, err := s.db.ExecContext(ctx, query, userID, credits)
+	return err
+}
+
+func (s *PostgresStore) Charge(ctx context.Context, userID string, credits int64) error {
+	query := `UPDATE ai_credit_balances
+		SET reserved = GREATEST(reserved - $2, 0), credits = credits - $2, updated_at = NOW()
+		WHERE user_id = $1`
+
+	_, err := s.db.ExecContext(ctx, query, userID, credits)
+	return err
+}
+
+func (s *PostgresStore) RecordUsage(ctx context.Context, record *UsageRecord) error {
+	query := `
+		INSERT INTO ai_usage_records (
+			id, user_id, project_id, prediction_id, render_type, model,
+			inference_steps, duration_ns, estimated_cost_usd, status, created_at
+		) VALUES (
+			:id, :user_id, NULLIF(:project_id, ''), :prediction_id, :render_type, :model,
+			:inference_steps, :duration_ns, :estimated_cost_usd, :status, :created_at
+		)`
+
+	_, err := s.db.NamedExecContext(ctx, query, record)
+	return err
+}
+
+func (s *PostgresStore) SettleUsage(ctx context.Context, predictionID, status string, duration time.Duration) (bool, error) {
+	// The pending record was priced at its model's rate, so the cost scales
+	// with the duration
+	query := `UPDATE ai_usage_records
+		SET status = $2,
+			estimated_cost_usd = CASE WHEN duration_ns > 0
+				THEN estimated_cost_usd * $3 / duration_ns
+				ELSE estimated_cost_usd END,
+			duration_ns = $3
+		WHERE prediction_id = $1 AND status = 'pending'`
+
+	result, err := s.db.ExecContext(ctx, query, predictionID, status, int64(duration))
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+func (s *PostgresStore) ListUsage(ctx context.Context, filter UsageFilter) ([]*UsageRecord, error) {
+	var conditions []string
+	var args []interface{}
+
+	addCondition := func(clause string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(clause, len(args)))
+	}
+
+	if filter.UserID != "" {
+		addCondition("user_id = $%d", filter.UserID)
+	}
+	if filter.ProjectID != "" {
+		addCondition("project_id = $%d", filter.ProjectID)
+	}
+	if !filter.From.IsZero() {
+		addCondition("created_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("created_at < $%d", filter.To)
+	}
+
+	query := `SELECT id, user_id, COALESCE(project_id, '') AS project_id, prediction_id,
+		render_type, model, inference_steps, duration_ns, estimated_cost_usd, status, created_at
+		FROM ai_usage_records`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY created_at"
+
+	var records []*UsageRecord
+	if err := s.db.SelectContext(ctx, &records, query, args...); err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	return records, nil
+}
@@ -0,0 +1,189 @@
+package metering
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store persists usage records and credit balances
+type Store interface {
+	// GetBalance returns the user's balance, creating a free-plan balance if none exists
+	GetBalance(ctx context.Context, userID string) (*Balance, error)
+	// SetPlan changes the user's plan and grants its credits for the period
+	// starting at periodStart
+	SetPlan(ctx context.Context, userID string, plan Plan, credits int64, periodStart time.Time) error
+	// ApplyGrant atomically replaces the credits unless a grant was already
+	// applied for periodStart. Reservations are kept, so jobs still running from
+	// the previous period release or charge their own credits. It reports
+	// whether it applied the grant.
+	ApplyGrant(ctx context.Context, userID string, credits int64, periodStart time.Time) (bool, error)
+
+	// Reserve atomically holds credits if enough are available
+	Reserve(ctx context.Context, userID string, credits int64) (bool, error)
+	Release(ctx context.Context, userID string, credits int64) error
+	Charge(ctx context.Context, userID string, credits int64) error
+
+	RecordUsage(ctx context.Context, record *UsageRecord) error
+
+	// SettleUsage sets the final status and duration of the pending record of
+	// a prediction, scaling its estimated cost with the duration. It reports
+	// whether a pending record was found.
+	SettleUsage(ctx context.Context, predictionID, status string, duration time.Duration) (bool, error)
+	ListUsage(ctx context.Context, filter UsageFilter) ([]*UsageRecord, error)
+}
+
+// MemoryStore is an in-memory Store for development and tests
+type MemoryStore struct {
+	mu       sync.Mutex
+	balances map[string]*Balance
+	usage    []*UsageRecord
+}
+
+// NewMemoryStore creates a new in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		balances: make(map[string]*Balance),
+	}
+}
+
+// balance returns the user's balance; callers must hold the lock
+func (s *MemoryStore) balance(userID string) *Balance {
+	b, ok := s.balances[userID]
+	if !ok {
+		b = &Balance{UserID: userID, Plan: PlanFree}
+		s.balances[userID] = b
+	}
+	return b
+}
+
+func (s *MemoryStore) GetBalance(ctx context.Context, userID string) (*Balance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := *s.balance(userID)
+	return &b, nil
+}
+
+func (s *MemoryStore) SetPlan(ctx context.Context, userID string, plan Plan, credits int64, periodStart time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.balance(userID)
+	b.Plan = plan
+	b.Credits = credits
+	b.PeriodStart = periodStart
+	b.UpdatedAt = time.Now()
+	return nil
+}
+
+func (s *MemoryStore) ApplyGrant(ctx context.Context, userID string, credits int64, periodStart time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.balance(userID)
+	if !b.PeriodStart.Before(periodStart) {
+		return false, nil
+	}
+
+	b.Credits = credits
+	b.PeriodStart = periodStart
+	b.UpdatedAt = time.Now()
+	return true, nil
+}
+
+func (s *MemoryStore) Reserve(ctx context.Context, userID string, credits int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.balance(userID)
+	if b.Available() < credits {
+		return false, nil
+	}
+
+	b.Reserved += credits
+	b.UpdatedAt = time.Now()
+	return true, nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, userID string, credits int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.balance(userID)
+	b.Reserved -= credits
+	if b.Reserved < 0 {
+		b.Reserved = 0
+	}
+	b.UpdatedAt = time.Now()
+	return nil
+}
+
+func (s *MemoryStore) Charge(ctx context.Context, userID string, credits int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.balance(userID)
+	b.Reserved -= credits
+	if b.Reserved < 0 {
+		b.Reserved = 0
+	}
+	b.Credits -= credits
+	b.UpdatedAt = time.Now()
+	return nil
+}
+
+func (s *MemoryStore) RecordUsage(ctx context.Context, record *UsageRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.usage = append(s.usage, record)
+	return nil
+}
+
+func (s *MemoryStore) SettleUsage(ctx context.Context, predictionID, status string, duration time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, record := range s.usage {
+		if record.PredictionID != predictionID || record.Status != "pending" {
+			continue
+		}
+		if record.Duration > 0 {
+			record.EstimatedCost *= float64(duration) / float64(record.Duration)
+		}
+		record.Duration = duration
+		record.Status = status
+		return true, nil
+	}
+	return false, nil
+}
+
+func (s *MemoryStore) ListUsage(ctx context.Context, filter UsageFilter) ([]*UsageRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var records []*UsageRecord
+	for _, record := range s.usage {
+		if filter.UserID != "" && record.UserID != filter.UserID {
+			continue
+		}
+		if filter.ProjectID != "" && record.ProjectID != filter.ProjectID {
+			continue
+		}
+		if !filter.From.IsZero() && record.CreatedAt.Before(filter.From) {
+			continue
+		}
+		if !filter.To.IsZero() && !record.CreatedAt.Before(filter.To) {
+			continue
+		}
+		records = append(records, record)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].CreatedAt.Before(records[j].CreatedAt)
+	})
+
+	return records, nil
+}
@@ -6,8 +6,9 @@ import (
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/compozit/compozit-vision-api/internal/domain/entities"
-	"github.com/compozit/compozit-vision-api/internal/domain/repositories"
+	"github.com/compozit/vision/backend/internal/domain/entities"
+	"github.com/compozit/vision/backend/internal/domain/repositories"
+	"github.com/compozit/vision/backend/internal/infrastructure/ai"
 )
 
 // AIGenerationService interface for AI design generation operations
@@ -26,15 +27,36 @@ type EnhancedGenerationServiceImpl struct {
 	aiGenerationSvc   AIGenerationService
 	spaceAnalysisSvc  *SpaceAnalysisServiceImpl
 	styleSvc          *StyleServiceImpl
+	qualityScorer     QualityScorer
+	qualityThreshold  float64
+	maxRegenerations  int
 }
 
-// NewEnhancedGenerationService creates a new enhanced generation service
+// QualityScorer computes quality metrics from the pixels of the original photo and a
+// generated design. ai.Renderer scores designs locally and deterministically.
+type QualityScorer interface {
+	ScoreDesign(ctx context.Context, originalImage, generatedImage string, palette *entities.StyleColorPalette) (*entities.QualityMetrics, error)
+}
+
+var _ QualityScorer = (*ai.Renderer)(nil)
+
+const (
+	// defaultQualityThreshold is the overall score below which a design is regenerated
+	defaultQualityThreshold = 0.6
+
+	// defaultMaxRegenerations bounds the extra generations spent on a low-scoring design
+	defaultMaxRegenerations = 2
+)
+
+// NewEnhancedGenerationService creates a new enhanced generation service. Designs are
+// scored from their pixels by qualityScorer, usually the ai.Renderer.
 func NewEnhancedGenerationService(
 	repo repositories.SpaceAnalysisRepository,
 	furnitureRepo repositories.FurnitureRepository,
 	aiGenerationSvc AIGenerationService,
 	spaceAnalysisSvc *SpaceAnalysisServiceImpl,
 	styleSvc *StyleServiceImpl,
+	qualityScorer QualityScorer,
 ) *EnhancedGenerationServiceImpl {
 	return &EnhancedGenerationServiceImpl{
 		repo:              repo,
@@ -42,9 +64,19 @@ func NewEnhancedGenerationService(
 		aiGenerationSvc:   aiGenerationSvc,
 		spaceAnalysisSvc:  spaceAnalysisSvc,
 		styleSvc:          styleSvc,
+		qualityScorer:     qualityScorer,
+		qualityThreshold:  defaultQualityThreshold,
+		maxRegenerations:  defaultMaxRegenerations,
 	}
 }
 
+// SetQualityThreshold sets the overall score below which designs are regenerated, up
+// to maxRegenerations times, keeping the best.
+func (s *EnhancedGenerationServiceImpl) SetQualityThreshold(threshold float64, maxRegenerations int) {
+	s.qualityThreshold = threshold
+	s.maxRegenerations = maxRegenerations
+}
+
 // GenerateEnhancedDesign orchestrates the enhanced design generation process
 func (s *EnhancedGenerationServiceImpl) GenerateEnhancedDesign(
 	ctx context.Context,
@@ -131,7 +163,7 @@ func (s *EnhancedGenerationServiceImpl) processEnhancedGeneration(
 		}
 	}()
 
-	// Step 1: Generate base design with AI
+	// Step 1: Generate the styled design
 	genRequest := EnhancedGenerationRequest{
 		SpaceAnalysis:    spaceAnalysis,
 		StyleReference:   styleRef,
@@ -140,24 +172,41 @@ func (s *EnhancedGenerationServiceImpl) processEnhancedGeneration(
 		FurnitureOptions: request.FurnitureOptions,
 	}
 
-	generationResult, err := s.aiGenerationSvc.GenerateDesign(ctx, genRequest)
+	selectedPalette := entities.StyleColorPalette{}
+	var palette *entities.StyleColorPalette
+	if request.ColorPaletteIndex < len(styleRef.ColorPalettes) {
+		selectedPalette = styleRef.ColorPalettes[request.ColorPaletteIndex]
+		palette = &selectedPalette
+	}
+
+	imageURL, err := s.generateStyledDesign(ctx, genRequest, styleRef, ambiance)
 	if err != nil {
 		result.Status = entities.GenerationStatusFailed
 		s.repo.UpdateGenerationResult(ctx, result)
 		return
 	}
 
-	result.GeneratedImageURL = generationResult.GeneratedImageURL
+	// Step 2: Score the design, regenerating low scores and keeping the best attempt
+	qualityMetrics, scored := s.scoreDesign(ctx, spaceAnalysis, imageURL, palette)
+	regenerations := 0
+	for scored && qualityMetrics.OverallScore < s.qualityThreshold && regenerations < s.maxRegenerations {
+		regenerations++
 
-	// Step 2: Apply style and ambiance
-	styledResult, err := s.aiGenerationSvc.ApplyStyle(ctx, result.GeneratedImageURL, styleRef, ambiance)
-	if err != nil {
-		result.Status = entities.GenerationStatusFailed
-		s.repo.UpdateGenerationResult(ctx, result)
-		return
+		candidateURL, err := s.generateStyledDesign(ctx, genRequest, styleRef, ambiance)
+		if err != nil {
+			break
+		}
+
+		candidate, candidateScored := s.scoreDesign(ctx, spaceAnalysis, candidateURL, palette)
+		if candidateScored && candidate.OverallScore > qualityMetrics.OverallScore {
+			imageURL, qualityMetrics = candidateURL, candidate
+		}
 	}
 
-	result.GeneratedImageURL = styledResult.StyledImageURL
+	result.GeneratedImageURL = imageURL
+	if scored {
+		result.QualityMetrics = *qualityMetrics
+	}
 
 	// Step 3: Generate furniture proposals
 	furnitureProposals, err := s.generateFurnitureProposals(ctx, spaceAnalysis, styleRef, request.FurnitureOptions)
@@ -184,41 +233,24 @@ func (s *EnhancedGenerationServiceImpl) processEnhancedGeneration(
 
 	result.EstimatedCost = *costEstimate
 
-	// Step 5: Calculate quality metrics
-	qualityMetrics, err := s.aiGenerationSvc.CalculateQualityMetrics(
-		ctx,
-		spaceAnalysis.ImageURL,
-		result.GeneratedImageURL,
-		spaceAnalysis,
-	)
-	if err != nil {
-		// Non-critical error - use default metrics
-		qualityMetrics = &entities.QualityMetrics{
-			StyleAccuracy:   0.8,
-			ColorHarmony:    0.8,
-			SpatialBalance:  0.8,
-			LightingQuality: 0.8,
-			OverallScore:    0.8,
-		}
+	// Step 5: Set style application details
+	notes := []string{"Style successfully applied", "Color harmony maintained"}
+	if !scored {
+		notes = append(notes, "Quality could not be scored")
 	}
-
-	result.QualityMetrics = *qualityMetrics
-
-	// Step 6: Set style application details
-	selectedPalette := entities.StyleColorPalette{}
-	if request.ColorPaletteIndex < len(styleRef.ColorPalettes) {
-		selectedPalette = styleRef.ColorPalettes[request.ColorPaletteIndex]
+	if regenerations > 0 {
+		notes = append(notes, fmt.Sprintf("Regenerated %d time(s) after scoring below %.2f", regenerations, s.qualityThreshold))
 	}
 
 	result.StyleApplied = entities.StyleApplication{
 		StyleReferenceID:  styleRef.ID,
 		AmbianceOptionID:  ambiance.ID,
 		ColorPaletteUsed:  selectedPalette,
-		ApplicationNotes:  []string{"Style successfully applied", "Color harmony maintained"},
-		ConfidenceScore:   qualityMetrics.StyleAccuracy,
+		ApplicationNotes:  notes,
+		ConfidenceScore:   result.QualityMetrics.StyleAccuracy,
 	}
 
-	// Step 7: Finalize result
+	// Step 6: Finalize result
 	result.Status = entities.GenerationStatusCompleted
 	result.ProcessingTime = int(time.Since(startTime).Milliseconds())
 
@@ -228,6 +260,53 @@ func (s *EnhancedGenerationServiceImpl) processEnhancedGeneration(
 	}
 }
 
+// generateStyledDesign generates a base design and applies the style and ambiance to it
+func (s *EnhancedGenerationServiceImpl) generateStyledDesign(
+	ctx context.Context,
+	genRequest EnhancedGenerationRequest,
+	styleRef *entities.StyleReference,
+	ambiance *entities.AmbianceOption,
+) (string, error) {
+	generationResult, err := s.aiGenerationSvc.GenerateDesign(ctx, genRequest)
+	if err != nil {
+		return "", err
+	}
+
+	styledResult, err := s.aiGenerationSvc.ApplyStyle(ctx, generationResult.GeneratedImageURL, styleRef, ambiance)
+	if err != nil {
+		return "", err
+	}
+
+	return styledResult.StyledImageURL, nil
+}
+
+// scoreDesign computes quality metrics locally, falling back to the AI service.
+// scored is false when neither could score the design; the result then carries no
+// quality metrics rather than made-up ones.
+func (s *EnhancedGenerationServiceImpl) scoreDesign(
+	ctx context.Context,
+	spaceAnalysis *entities.SpaceAnalysis,
+	imageURL string,
+	palette *entities.StyleColorPalette,
+) (*entities.QualityMetrics, bool) {
+	if s.qualityScorer != nil {
+		metrics, err := s.qualityScorer.ScoreDesign(ctx, spaceAnalysis.ImageURL, imageURL, palette)
+		if err == nil {
+			return metrics, true
+		}
+		fmt.Printf("Failed to score design locally: %v\n", err)
+	}
+
+	metrics, err := s.aiGenerationSvc.CalculateQualityMetrics(ctx, spaceAnalysis.ImageURL, imageURL, spaceAnalysis)
+	if err == nil {
+		return metrics, true
+	}
+
+	// Non-critical error - the design is kept unscored
+	fmt.Printf("Quality scoring degraded, design left unscored: %v\n", err)
+	return nil, false
+}
+
 // generateFurnitureProposals creates furniture placement proposals
 func (s *EnhancedGenerationServiceImpl) generateFurnitureProposals(
 	ctx context.Context,
@@ -249,10 +328,14 @@ func (s *EnhancedGenerationServiceImpl) generateFurnitureProposals(
 		filters := entities.FurnitureSearchFilters{
 			CategoryIDs: []uuid.UUID{category.ID},
 			StyleTags:   styleRef.CharacteristicTags,
-			RoomType:    &spaceAnalysis.RoomType,
-			BudgetRange: &options.BudgetRange,
+			RoomTypes:   []entities.RoomType{spaceAnalysis.RoomType},
+			MinPrice:    options.BudgetRange.Min,
+			MaxPrice:    options.BudgetRange.Max,
 			Limit:       5,
 		}
+		if options.BudgetRange.Currency != "" {
+			filters.Currency = &options.BudgetRange.Currency
+		}
 
 		searchResult, err := s.furnitureRepo.ListFurnitureItems(ctx, filters)
 		if err != nil {
@@ -282,7 +365,7 @@ func (s *EnhancedGenerationServiceImpl) generateFurnitureProposals(
 // calculateOptimalPlacement determines the best placement for furniture
 func (s *EnhancedGenerationServiceImpl) calculateOptimalPlacement(
 	spaceAnalysis *entities.SpaceAnalysis,
-	furniture *entities.FurnitureItem,
+	furniture *entities.FurnitureItemSummary,
 ) entities.FurniturePlacement {
 	// Simple placement algorithm - in production, this would be more sophisticated
 	
@@ -6,9 +6,8 @@ import (
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/compozit/compozit-vision-api/internal/domain/entities"
-	"github.com/compozit/compozit-vision-api/internal/domain/repositories"
-	"github.com/compozit/compozit-vision-api/internal/infrastructure/ai"
+	"github.com/compozit/vision/backend/internal/domain/entities"
+	"github.com/compozit/vision/backend/internal/domain/repositories"
 )
 
 // AIVisionService interface for AI computer vision operations
@@ -5,8 +5,8 @@ import (
 	"fmt"
 
 	"github.com/google/uuid"
-	"github.com/compozit/compozit-vision-api/internal/domain/entities"
-	"github.com/compozit/compozit-vision-api/internal/domain/repositories"
+	"github.com/compozit/vision/backend/internal/domain/entities"
+	"github.com/compozit/vision/backend/internal/domain/repositories"
 )
 
 // StyleServiceImpl implements style management business logic
@@ -305,6 +305,7 @@ type QualityMetrics struct {
 	StyleAccuracy      float64 `json:"style_accuracy"`      // 0-1
 	ColorHarmony       float64 `json:"color_harmony"`       // 0-1
 	SpatialBalance     float64 `json:"spatial_balance"`     // 0-1
+	StructurePreservation float64 `json:"structure_preservation"` // 0-1, edge similarity to the original photo
 	LightingQuality    float64 `json:"lighting_quality"`    // 0-1
 	OverallScore       float64 `json:"overall_score"`       // 0-1
 }
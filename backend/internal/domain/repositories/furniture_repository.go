@@ -5,7 +5,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
-	"compozit-vision/internal/domain/entities"
+	"github.com/compozit/vision/backend/internal/domain/entities"
 )
 
 // FurnitureRepository defines the interface for furniture data operations
@@ -4,7 +4,7 @@ import (
 	"context"
 
 	"github.com/google/uuid"
-	"github.com/compozit/compozit-vision-api/internal/domain/entities"
+	"github.com/compozit/vision/backend/internal/domain/entities"
 )
 
 // SpaceAnalysisRepository defines the interface for space analysis data operations
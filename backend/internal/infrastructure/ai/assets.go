@@ -0,0 +1,266 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/compozit/vision/backend/internal/infrastructure/storage"
+)
+
+const (
+	// maxOutputImageSize bounds provider output downloads
+	maxOutputImageSize = 50 << 20
+
+	// thumbnailSize is the longest side of generated thumbnails
+	thumbnailSize = 320
+
+	// storeOutputTimeout bounds copying a late prediction's output into storage
+	storeOutputTimeout = 2 * time.Minute
+)
+
+// StoredImage is a provider output copied into durable storage
+type StoredImage struct {
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+	Hash         string `json:"hash,omitempty"`
+}
+
+// EnableDurableStorage copies every render output into blobs. Provider URLs expire
+// within hours, so results and cache entries then reference only the stored copies.
+func (r *Renderer) EnableDurableStorage(blobs storage.BlobStore) {
+	r.blobs = blobs
+}
+
+// AssetHandler returns a handler serving stored images, or nil when the storage
+// backend serves its own URLs
+func (r *Renderer) AssetHandler() http.Handler {
+	if local, ok := r.blobs.(interface{ Handler() http.Handler }); ok {
+		return local.Handler()
+	}
+	return nil
+}
+
+// storeOutput downloads a provider output and stores it under its SHA-256 hash with a
+// thumbnail. Without durable storage the provider URL is returned unchanged.
+func (r *Renderer) storeOutput(ctx context.Context, sourceURL string) (*StoredImage, error) {
+	if r.blobs == nil {
+		return &StoredImage{URL: sourceURL}, nil
+	}
+	if sourceURL == "" {
+		return nil, fmt.Errorf("prediction returned no output")
+	}
+
+	data, err := r.downloadOutput(ctx, sourceURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.storeImage(ctx, data)
+}
+
+// storeImage stores image bytes under their SHA-256 hash with a thumbnail
+func (r *Renderer) storeImage(ctx context.Context, data []byte) (*StoredImage, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	contentType := http.DetectContentType(data)
+
+	key := fmt.Sprintf("renders/%s/%s%s", hash[:2], hash, imageExtension(contentType))
+	if err := r.putBlob(ctx, key, data, contentType); err != nil {
+		return nil, err
+	}
+
+	stored := &StoredImage{
+		URL:  r.blobs.URL(key),
+		Hash: hash,
+	}
+
+	// A missing thumbnail does not invalidate the render
+	thumbKey := fmt.Sprintf("thumbnails/%s/%s.jpg", hash[:2], hash)
+	if thumb, err := makeThumbnail(data); err != nil {
+		r.logger.Warn("Failed to generate thumbnail", "hash", hash, "content_type", contentType, "error", err)
+	} else if err := r.putBlob(ctx, thumbKey, thumb, "image/jpeg"); err != nil {
+		r.logger.Warn("Failed to store thumbnail", "hash", hash, "error", err)
+	} else {
+		stored.ThumbnailURL = r.blobs.URL(thumbKey)
+	}
+
+	return stored, nil
+}
+
+// storeVariant replaces a variant's provider URL with its stored copy
+func (r *Renderer) storeVariant(ctx context.Context, variant *RenderVariant) error {
+	stored, err := r.storeOutput(ctx, variant.ImageURL)
+	if err != nil {
+		return fmt.Errorf("failed to store render output: %w", err)
+	}
+
+	variant.ImageURL = stored.URL
+	variant.ThumbnailURL = stored.ThumbnailURL
+	variant.ImageHash = stored.Hash
+	return nil
+}
+
+// putBlob stores data under key unless it is already there; keys are content
+// addressed, so an existing blob has the same bytes
+func (r *Renderer) putBlob(ctx context.Context, key string, data []byte, contentType string) error {
+	exists, err := r.blobs.Exists(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to check stored image: %w", err)
+	}
+	if exists {
+		return nil
+	}
+
+	if err := r.blobs.Put(ctx, key, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+		return fmt.Errorf("failed to store image: %w", err)
+	}
+	return nil
+}
+
+// loadStoredImage reads back an image stored by storeImage. ok is false when the URL
+// is not served by the blob store.
+func (r *Renderer) loadStoredImage(ctx context.Context, url string) (data []byte, ok bool, err error) {
+	if r.blobs == nil {
+		return nil, false, nil
+	}
+	prefix := r.blobs.URL("")
+	if !strings.HasPrefix(url, prefix) {
+		return nil, false, nil
+	}
+
+	reader, err := r.blobs.Get(ctx, strings.TrimPrefix(url, prefix))
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to read stored image: %w", err)
+	}
+	defer reader.Close()
+
+	data, err = io.ReadAll(io.LimitReader(reader, maxOutputImageSize+1))
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to read stored image: %w", err)
+	}
+	if len(data) > maxOutputImageSize {
+		return nil, true, fmt.Errorf("stored image exceeds %d bytes", maxOutputImageSize)
+	}
+	return data, true, nil
+}
+
+// loadRenderImage reads a render's image bytes from blob storage, a data URI or an
+// allowed https host
+func (r *Renderer) loadRenderImage(ctx context.Context, sourceImage string) ([]byte, error) {
+	if data, ok, err := r.loadStoredImage(ctx, sourceImage); ok {
+		return data, err
+	}
+
+	if strings.HasPrefix(sourceImage, "data:") {
+		_, encoded, found := strings.Cut(sourceImage, ",")
+		if !found {
+			return nil, fmt.Errorf("malformed data URI")
+		}
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("malformed data URI: %w", err)
+		}
+		return data, nil
+	}
+
+	return r.fetchImage(ctx, sourceImage, maxOutputImageSize)
+}
+
+func (r *Renderer) downloadOutput(ctx context.Context, sourceURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download request: %w", err)
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download output: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download output: status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxOutputImageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download output: %w", err)
+	}
+	if len(data) > maxOutputImageSize {
+		return nil, fmt.Errorf("output exceeds %d bytes", maxOutputImageSize)
+	}
+
+	return data, nil
+}
+
+// makeThumbnail decodes an image and box-filters it down to thumbnailSize as JPEG
+func makeThumbnail(data []byte) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	scale := math.Min(1, float64(thumbnailSize)/math.Max(float64(w), float64(h)))
+	tw, th := int(math.Max(1, math.Round(float64(w)*scale))), int(math.Max(1, math.Round(float64(h)*scale)))
+
+	thumb := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for ty := 0; ty < th; ty++ {
+		y0 := bounds.Min.Y + ty*h/th
+		y1 := bounds.Min.Y + (ty+1)*h/th
+		for tx := 0; tx < tw; tx++ {
+			x0 := bounds.Min.X + tx*w/tw
+			x1 := bounds.Min.X + (tx+1)*w/tw
+
+			// Average the source pixels covered by this thumbnail pixel
+			var sr, sg, sb, n uint64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					r, g, b, _ := img.At(x, y).RGBA()
+					sr, sg, sb = sr+uint64(r), sg+uint64(g), sb+uint64(b)
+					n++
+				}
+			}
+
+			i := thumb.PixOffset(tx, ty)
+			thumb.Pix[i] = uint8(sr / n >> 8)
+			thumb.Pix[i+1] = uint8(sg / n >> 8)
+			thumb.Pix[i+2] = uint8(sb / n >> 8)
+			thumb.Pix[i+3] = 0xff
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// imageExtension returns the file extension for a detected image content type
+func imageExtension(contentType string) string {
+	switch contentType {
+	case "image/png":
+		return ".png"
+	case "image/jpeg":
+		return ".jpg"
+	case "image/webp":
+		return ".webp"
+	case "image/gif":
+		return ".gif"
+	default:
+		return ""
+	}
+}
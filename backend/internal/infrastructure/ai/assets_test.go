@@ -0,0 +1,87 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/compozit/vision/backend/internal/infrastructure/storage"
+)
+
+type testLogger struct{}
+
+func (testLogger) Debug(msg string, kv ...interface{}) {}
+func (testLogger) Info(msg string, kv ...interface{})  {}
+func (testLogger) Warn(msg string, kv ...interface{})  {}
+func (testLogger) Error(msg string, kv ...interface{}) {}
+
+func TestStoreOutput(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 1024, 768))
+	for y := 0; y < 768; y++ {
+		for x := 0; x < 1024; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(buf.Bytes())
+	}))
+	defer provider.Close()
+
+	blobs, err := storage.NewLocalStore(t.TempDir(), "https://api.example.com/assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renderer := NewRenderer("", nil, testLogger{})
+	renderer.EnableDurableStorage(blobs)
+
+	stored, err := renderer.storeOutput(context.Background(), provider.URL+"/output.png")
+	if err != nil {
+		t.Fatalf("storeOutput failed: %v", err)
+	}
+
+	if !strings.HasPrefix(stored.URL, "https://api.example.com/assets/renders/"+stored.Hash[:2]+"/"+stored.Hash) ||
+		!strings.HasSuffix(stored.URL, ".png") {
+		t.Errorf("Expected content-addressed URL, got %s", stored.URL)
+	}
+
+	thumbKey := strings.TrimPrefix(stored.ThumbnailURL, "https://api.example.com/assets/")
+	r, err := blobs.Get(context.Background(), thumbKey)
+	if err != nil {
+		t.Fatalf("Expected stored thumbnail: %v", err)
+	}
+	defer r.Close()
+
+	thumb, _, err := image.Decode(r)
+	if err != nil {
+		t.Fatalf("Failed to decode thumbnail: %v", err)
+	}
+	if b := thumb.Bounds(); b.Dx() != thumbnailSize || b.Dy() != 240 {
+		t.Errorf("Expected 320x240 thumbnail, got %dx%d", b.Dx(), b.Dy())
+	}
+
+	// Storing the same output again yields the same durable URL
+	again, err := renderer.storeOutput(context.Background(), provider.URL+"/other.png")
+	if err != nil || again.URL != stored.URL {
+		t.Errorf("Expected identical output to dedupe, got %v %v", again, err)
+	}
+}
+
+func TestCacheRejectsProviderURLs(t *testing.T) {
+	c := NewCache(nil)
+	req := &RenderRequest{ID: "r1", UserID: "u1"}
+
+	result := &RenderResult{ResultImageURL: "https://replicate.delivery/tmp/out.png"}
+	if err := c.SetRender(req, result); err != ErrUnstoredResult {
+		t.Errorf("Expected ErrUnstoredResult, got %v", err)
+	}
+}
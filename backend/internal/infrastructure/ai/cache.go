@@ -1,184 +1,420 @@
 package ai
 
 import (
+	"container/list"
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/compozit/vision/backend/internal/infrastructure/cache"
 )
 
-// Cache handles caching of AI rendering results
+// ErrUnstoredResult is returned when caching a result whose image is not in durable storage
+var ErrUnstoredResult = errors.New("result image is not in durable storage")
+
+// CachedFailureError is returned while a recent provider failure for the same request
+// is held in the negative cache
+type CachedFailureError struct {
+	Message   string
+	ExpiresAt time.Time
+}
+
+func (e *CachedFailureError) Error() string {
+	return fmt.Sprintf("provider failed recently for this request, retry after %s: %s",
+		e.ExpiresAt.Format(time.RFC3339), e.Message)
+}
+
+// CacheOptions configures the in-memory tier of the cache
+type CacheOptions struct {
+	MaxMemoryBytes int64         // LRU entries are evicted above this size
+	TTL            time.Duration // lifetime of cached results
+	NegativeTTL    time.Duration // lifetime of cached provider failures
+	SweepInterval  time.Duration // how often expired entries are removed
+}
+
+// DefaultCacheOptions returns the default cache limits
+func DefaultCacheOptions() CacheOptions {
+	return CacheOptions{
+		MaxMemoryBytes: 64 << 20,
+		TTL:            15 * time.Minute, // 15-minute cache for AI results
+		NegativeTTL:    30 * time.Second,
+		SweepInterval:  time.Minute,
+	}
+}
+
+// CacheStats reports cache effectiveness and memory use
+type CacheStats struct {
+	Hits           uint64  `json:"hits"`
+	Misses         uint64  `json:"misses"`
+	MemoryHits     uint64  `json:"memory_hits"`
+	RedisHits      uint64  `json:"redis_hits"`
+	NegativeHits   uint64  `json:"negative_hits"`
+	Evictions      uint64  `json:"evictions"`
+	Expirations    uint64  `json:"expirations"`
+	HitRate        float64 `json:"hit_rate"`
+	Entries        int     `json:"entries"`
+	MemoryBytes    int64   `json:"memory_bytes"`
+	MaxMemoryBytes int64   `json:"max_memory_bytes"`
+}
+
+// cacheEntry is one item in the in-memory LRU
+type cacheEntry struct {
+	key       string
+	userID    string
+	result    *RenderResult
+	failure   string // set for negative entries
+	size      int64
+	expiresAt time.Time
+}
+
+// Cache handles caching of AI rendering results in a bounded in-memory LRU backed by
+// Redis. Only results whose images were copied into durable storage are cached;
+// provider URLs expire long before cache entries do.
 type Cache struct {
 	redisCache cache.Cache
-	memCache   *sync.Map
-	ttl        time.Duration
+	opts       CacheOptions
+	now        func() time.Time
+
+	mu       sync.Mutex
+	lru      *list.List // front is most recently used
+	entries  map[string]*list.Element
+	userKeys map[string]map[string]struct{}
+	bytes    int64
+
+	hits, misses, memoryHits, redisHits, negativeHits, evictions, expirations atomic.Uint64
 }
 
-// NewCache creates a new AI cache
+// NewCache creates a new AI cache with the default options
 func NewCache(redisCache cache.Cache) *Cache {
+	return NewCacheWithOptions(redisCache, DefaultCacheOptions())
+}
+
+// NewCacheWithOptions creates a new AI cache. redisCache may be nil for a memory-only cache.
+func NewCacheWithOptions(redisCache cache.Cache, opts CacheOptions) *Cache {
 	return &Cache{
 		redisCache: redisCache,
-		memCache:   &sync.Map{},
-		ttl:        15 * time.Minute, // 15-minute cache for AI results
+		opts:       opts,
+		now:        time.Now,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+		userKeys:   make(map[string]map[string]struct{}),
 	}
 }
 
-// GetRender retrieves a cached render result
-func (c *Cache) GetRender(req *RenderRequest) (*RenderResult, bool) {
-	key := c.generateRenderKey(req)
-	
-	// Try memory cache first
-	if val, ok := c.memCache.Load(key); ok {
-		if result, ok := val.(*RenderResult); ok {
-			return result, true
-		}
-	}
+// Start removes expired entries in the background until ctx is cancelled
+func (c *Cache) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(c.opts.SweepInterval)
+		defer ticker.Stop()
 
-	// Try Redis cache
-	var result RenderResult
-	err := c.redisCache.Get(key, &result)
-	if err == nil {
-		// Store in memory cache for faster access
-		c.memCache.Store(key, &result)
-		return &result, true
-	}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.ClearExpiredCache()
+			}
+		}
+	}()
+}
 
-	return nil, false
+// GetRender retrieves a cached render result
+func (c *Cache) GetRender(req *RenderRequest) (*RenderResult, bool) {
+	return c.get(c.generateRenderKey(req), req.UserID)
 }
 
 // SetRender caches a render result
 func (c *Cache) SetRender(req *RenderRequest, result *RenderResult) error {
-	key := c.generateRenderKey(req)
-	
-	// Store in memory cache
-	c.memCache.Store(key, result)
-	
-	// Store in Redis cache
-	return c.redisCache.Set(key, result, c.ttl)
+	return c.set(c.generateRenderKey(req), req.UserID, result)
 }
 
-// GetInpainting retrieves cached inpainting result
-func (c *Cache) GetInpainting(req *InpaintingRequest) (*RenderResult, bool) {
-	key := c.generateInpaintingKey(req)
-	
-	if val, ok := c.memCache.Load(key); ok {
-		if result, ok := val.(*RenderResult); ok {
-			return result, true
-		}
-	}
+// GetRenderFailure returns a recent provider failure for the same render request
+func (c *Cache) GetRenderFailure(req *RenderRequest) error {
+	return c.getFailure(c.generateRenderKey(req))
+}
 
-	var result RenderResult
-	err := c.redisCache.Get(key, &result)
-	if err == nil {
-		c.memCache.Store(key, &result)
-		return &result, true
-	}
+// SetRenderFailure remembers a provider failure so identical requests fail fast for
+// the negative TTL. Failures are kept in memory only.
+func (c *Cache) SetRenderFailure(req *RenderRequest, err error) {
+	c.setFailure(c.generateRenderKey(req), req.UserID, err)
+}
 
-	return nil, false
+// GetInpainting retrieves cached inpainting result
+func (c *Cache) GetInpainting(req *InpaintingRequest) (*RenderResult, bool) {
+	return c.get(c.generateInpaintingKey(req), req.UserID)
 }
 
 // SetInpainting caches an inpainting result
 func (c *Cache) SetInpainting(req *InpaintingRequest, result *RenderResult) error {
-	key := c.generateInpaintingKey(req)
-	
-	c.memCache.Store(key, result)
-	
-	return c.redisCache.Set(key, result, c.ttl)
+	return c.set(c.generateInpaintingKey(req), req.UserID, result)
 }
 
 // GetStyleTransfer retrieves cached style transfer result
 func (c *Cache) GetStyleTransfer(req *StyleTransferRequest) (*RenderResult, bool) {
-	key := c.generateStyleTransferKey(req)
-	
-	if val, ok := c.memCache.Load(key); ok {
-		if result, ok := val.(*RenderResult); ok {
-			return result, true
-		}
-	}
-
-	var result RenderResult
-	err := c.redisCache.Get(key, &result)
-	if err == nil {
-		c.memCache.Store(key, &result)
-		return &result, true
-	}
-
-	return nil, false
+	return c.get(c.generateStyleTransferKey(req), req.UserID)
 }
 
 // SetStyleTransfer caches a style transfer result
 func (c *Cache) SetStyleTransfer(req *StyleTransferRequest, result *RenderResult) error {
-	key := c.generateStyleTransferKey(req)
-	
-	c.memCache.Store(key, result)
-	
-	return c.redisCache.Set(key, result, c.ttl)
+	return c.set(c.generateStyleTransferKey(req), req.UserID, result)
 }
 
 // InvalidateUserCache invalidates all cache entries for a user
 func (c *Cache) InvalidateUserCache(userID string) error {
-	// Clear from memory cache
-	c.memCache.Range(func(key, value interface{}) bool {
-		if keyStr, ok := key.(string); ok {
-			if contains(keyStr, userID) {
-				c.memCache.Delete(key)
-			}
+	c.mu.Lock()
+	for key := range c.userKeys[userID] {
+		if elem, ok := c.entries[key]; ok {
+			c.removeElement(elem)
 		}
-		return true
-	})
-	
-	// Clear from Redis using pattern
+	}
+	delete(c.userKeys, userID)
+	c.mu.Unlock()
+
+	if c.redisCache == nil {
+		return nil
+	}
+
+	// Every key embeds the user ID as its third segment
 	pattern := fmt.Sprintf("ai:*:%s:*", userID)
 	return c.redisCache.Delete(pattern)
 }
 
 // ClearExpiredCache removes expired entries from memory cache
 func (c *Cache) ClearExpiredCache() {
-	// This should be called periodically
-	c.memCache.Range(func(key, value interface{}) bool {
-		if result, ok := value.(*RenderResult); ok {
-			if result.CompletedAt != nil && time.Since(*result.CompletedAt) > c.ttl {
-				c.memCache.Delete(key)
-			}
+	now := c.now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for elem := c.lru.Back(); elem != nil; {
+		prev := elem.Prev()
+		if entry := elem.Value.(*cacheEntry); now.After(entry.expiresAt) {
+			c.removeElement(elem)
+			c.expirations.Add(1)
+		}
+		elem = prev
+	}
+}
+
+// Stats returns cache counters and memory use
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	entries, bytes := c.lru.Len(), c.bytes
+	c.mu.Unlock()
+
+	stats := CacheStats{
+		Hits:           c.hits.Load(),
+		Misses:         c.misses.Load(),
+		MemoryHits:     c.memoryHits.Load(),
+		RedisHits:      c.redisHits.Load(),
+		NegativeHits:   c.negativeHits.Load(),
+		Evictions:      c.evictions.Load(),
+		Expirations:    c.expirations.Load(),
+		Entries:        entries,
+		MemoryBytes:    bytes,
+		MaxMemoryBytes: c.opts.MaxMemoryBytes,
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
+
+// get looks a result up in memory, then in Redis, promoting Redis hits into memory
+func (c *Cache) get(key, userID string) (*RenderResult, bool) {
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		switch {
+		case c.now().After(entry.expiresAt):
+			c.removeElement(elem)
+			c.expirations.Add(1)
+		case entry.result != nil && entry.result.stored():
+			c.lru.MoveToFront(elem)
+			c.mu.Unlock()
+			c.hits.Add(1)
+			c.memoryHits.Add(1)
+			return entry.result, true
+		}
+	}
+	c.mu.Unlock()
+
+	if c.redisCache != nil {
+		var result RenderResult
+		if err := c.redisCache.Get(key, &result); err == nil && result.stored() {
+			c.store(key, userID, &result, "", c.opts.TTL)
+			c.hits.Add(1)
+			c.redisHits.Add(1)
+			return &result, true
 		}
-		return true
-	})
+	}
+
+	c.misses.Add(1)
+	return nil, false
+}
+
+// set stores a result in both tiers
+func (c *Cache) set(key, userID string, result *RenderResult) error {
+	if !result.stored() {
+		return ErrUnstoredResult
+	}
+
+	c.store(key, userID, result, "", c.opts.TTL)
+
+	if c.redisCache == nil {
+		return nil
+	}
+	return c.redisCache.Set(key, result, c.opts.TTL)
+}
+
+func (c *Cache) getFailure(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if entry.failure == "" {
+		return nil
+	}
+	if c.now().After(entry.expiresAt) {
+		c.removeElement(elem)
+		c.expirations.Add(1)
+		return nil
+	}
+
+	c.negativeHits.Add(1)
+	return &CachedFailureError{Message: entry.failure, ExpiresAt: entry.expiresAt}
+}
+
+func (c *Cache) setFailure(key, userID string, err error) {
+	if c.opts.NegativeTTL <= 0 {
+		return
+	}
+	c.store(key, userID, nil, err.Error(), c.opts.NegativeTTL)
+}
+
+// store inserts or replaces an in-memory entry and evicts least recently used
+// entries until the cache fits its memory cap
+func (c *Cache) store(key, userID string, result *RenderResult, failure string, ttl time.Duration) {
+	entry := &cacheEntry{
+		key:       key,
+		userID:    userID,
+		result:    result,
+		failure:   failure,
+		size:      entrySize(key, result, failure),
+		expiresAt: c.now().Add(ttl),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// An entry larger than the whole cache is not worth evicting everything for
+	if c.opts.MaxMemoryBytes > 0 && entry.size > c.opts.MaxMemoryBytes {
+		return
+	}
+
+	if elem, ok := c.entries[key]; ok {
+		c.removeElement(elem)
+	}
+
+	c.entries[key] = c.lru.PushFront(entry)
+	c.bytes += entry.size
+	if userID != "" {
+		if c.userKeys[userID] == nil {
+			c.userKeys[userID] = make(map[string]struct{})
+		}
+		c.userKeys[userID][key] = struct{}{}
+	}
+
+	for c.opts.MaxMemoryBytes > 0 && c.bytes > c.opts.MaxMemoryBytes {
+		c.removeElement(c.lru.Back())
+		c.evictions.Add(1)
+	}
+}
+
+// removeElement drops an entry from the LRU and the user index; callers must hold the lock
+func (c *Cache) removeElement(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size
+
+	if keys, ok := c.userKeys[entry.userID]; ok {
+		delete(keys, entry.key)
+		if len(keys) == 0 {
+			delete(c.userKeys, entry.userID)
+		}
+	}
+}
+
+// entrySize estimates the memory held by an entry from its JSON encoding
+func entrySize(key string, result *RenderResult, failure string) int64 {
+	size := int64(len(key) + len(failure) + 128) // entry and list overhead
+	if result != nil {
+		data, _ := json.Marshal(result)
+		size += int64(len(data))
+	}
+	return size
+}
+
+// stored reports whether a result's images are in durable storage
+func (r *RenderResult) stored() bool {
+	if r.ImageHash == "" {
+		return false
+	}
+	for _, variant := range r.Variants {
+		if variant.ImageHash == "" {
+			return false
+		}
+	}
+	return true
 }
 
 // generateRenderKey creates a unique cache key for render requests
 func (c *Cache) generateRenderKey(req *RenderRequest) string {
 	// Create a deterministic key based on request parameters
 	data := map[string]interface{}{
-		"type":       req.Type,
-		"style":      req.Style,
-		"prompt":     req.Prompt,
-		"parameters": req.Parameters,
-		"input_image": req.InputImage,
+		"type":         req.Type,
+		"style":        req.Style,
+		"custom_style": req.CustomStyle.cacheKey(),
+		"prompt":       req.Prompt,
+		"parameters":   req.Parameters,
+		"input_image":  req.InputImage,
+		"variants":     req.VariantCount(),
+		"seed":         req.Seed,
 	}
-	
+
 	jsonData, _ := json.Marshal(data)
 	hash := md5.Sum(jsonData)
-	
+
 	return fmt.Sprintf("ai:render:%s:%s", req.UserID, hex.EncodeToString(hash[:]))
 }
 
 // generateInpaintingKey creates a unique cache key for inpainting requests
 func (c *Cache) generateInpaintingKey(req *InpaintingRequest) string {
 	data := map[string]interface{}{
-		"base_image": req.BaseImage,
-		"mask_image": req.MaskImage,
-		"prompt":     req.Prompt,
-		"strength":   req.Strength,
+		"base_image":     req.BaseImage,
+		"mask_image":     req.MaskImage,
+		"prompt":         req.Prompt,
+		"furniture_type": req.FurnitureType,
+		"style":          req.Style,
+		"custom_style":   req.CustomStyle.cacheKey(),
+		"strength":       req.Strength,
 	}
-	
+
 	jsonData, _ := json.Marshal(data)
 	hash := md5.Sum(jsonData)
-	
-	return fmt.Sprintf("ai:inpaint:%s", hex.EncodeToString(hash[:]))
+
+	return fmt.Sprintf("ai:inpaint:%s:%s", req.UserID, hex.EncodeToString(hash[:]))
 }
 
 // generateStyleTransferKey creates a unique cache key for style transfer requests
@@ -186,16 +422,12 @@ func (c *Cache) generateStyleTransferKey(req *StyleTransferRequest) string {
 	data := map[string]interface{}{
 		"content_image": req.ContentImage,
 		"style":         req.Style,
+		"custom_style":  req.CustomStyle.cacheKey(),
 		"strength":      req.Strength,
 	}
-	
+
 	jsonData, _ := json.Marshal(data)
 	hash := md5.Sum(jsonData)
-	
-	return fmt.Sprintf("ai:style:%s", hex.EncodeToString(hash[:]))
-}
 
-// contains checks if a string contains a substring
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) && s[len(s)-len(substr):] == substr
-}
\ No newline at end of file
+	return fmt.Sprintf("ai:style:%s:%s", req.UserID, hex.EncodeToString(hash[:]))
+}
@@ -0,0 +1,126 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func storedResult(id string) *RenderResult {
+	return &RenderResult{ID: id, ResultImageURL: "https://api.example.com/assets/" + id, ImageHash: id}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	opts := DefaultCacheOptions()
+	opts.MaxMemoryBytes = 3 * entrySize("ai:render:u1:0123456789abcdef0123456789abcdef", storedResult("r0"), "")
+	c := NewCacheWithOptions(nil, opts)
+
+	reqs := make([]*RenderRequest, 4)
+	for i := range reqs {
+		reqs[i] = &RenderRequest{UserID: "u1", Prompt: fmt.Sprint(i)}
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := c.SetRender(reqs[i], storedResult(fmt.Sprintf("r%d", i))); err != nil {
+			t.Fatalf("SetRender failed: %v", err)
+		}
+	}
+
+	// Touch the oldest entry so the second one becomes least recently used
+	if _, ok := c.GetRender(reqs[0]); !ok {
+		t.Fatal("Expected cache hit")
+	}
+	c.SetRender(reqs[3], storedResult("r3"))
+
+	if _, ok := c.GetRender(reqs[1]); ok {
+		t.Error("Expected least recently used entry to be evicted")
+	}
+	if _, ok := c.GetRender(reqs[0]); !ok {
+		t.Error("Expected recently used entry to survive")
+	}
+
+	stats := c.Stats()
+	if stats.Evictions != 1 || stats.Entries != 3 || stats.MemoryBytes > opts.MaxMemoryBytes {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	if stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("Expected 2 hits and 1 miss, got %+v", stats)
+	}
+}
+
+func TestCacheInvalidateUserCache(t *testing.T) {
+	c := NewCacheWithOptions(nil, DefaultCacheOptions())
+
+	c.SetRender(&RenderRequest{UserID: "u1"}, storedResult("r1"))
+	c.SetInpainting(&InpaintingRequest{UserID: "u1"}, storedResult("i1"))
+	c.SetStyleTransfer(&StyleTransferRequest{UserID: "u21"}, storedResult("s1"))
+
+	c.InvalidateUserCache("u1")
+
+	if _, ok := c.GetRender(&RenderRequest{UserID: "u1"}); ok {
+		t.Error("Expected render entry to be invalidated")
+	}
+	if _, ok := c.GetInpainting(&InpaintingRequest{UserID: "u1"}); ok {
+		t.Error("Expected inpainting entry to be invalidated")
+	}
+	if _, ok := c.GetStyleTransfer(&StyleTransferRequest{UserID: "u21"}); !ok {
+		t.Error("Expected other user's entry to survive")
+	}
+}
+
+func TestCacheExpiryAndNegativeEntries(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := NewCacheWithOptions(nil, DefaultCacheOptions())
+	c.now = func() time.Time { return now }
+
+	req := &RenderRequest{UserID: "u1"}
+	c.SetRenderFailure(req, errors.New("NSFW content detected"))
+
+	var failure *CachedFailureError
+	if err := c.GetRenderFailure(req); !errors.As(err, &failure) {
+		t.Fatalf("Expected cached failure, got %v", err)
+	}
+	if _, ok := c.GetRender(req); ok {
+		t.Error("Negative entries must not be returned as results")
+	}
+
+	now = now.Add(time.Minute)
+	if err := c.GetRenderFailure(req); err != nil {
+		t.Errorf("Expected failure to expire, got %v", err)
+	}
+
+	c.SetRender(req, storedResult("r1"))
+	now = now.Add(time.Hour)
+	c.ClearExpiredCache()
+
+	if stats := c.Stats(); stats.Entries != 0 || stats.MemoryBytes != 0 || stats.Expirations != 2 {
+		t.Errorf("Expected expired entries to be swept, got %+v", stats)
+	}
+}
+
+func TestConfigNewRendererStartsCacheSweep(t *testing.T) {
+	opts := DefaultCacheOptions()
+	opts.SweepInterval = 10 * time.Millisecond
+	c := NewCacheWithOptions(nil, opts)
+	c.SetRender(&RenderRequest{UserID: "u1"}, storedResult("r1"))
+	expired := time.Now().Add(2 * opts.TTL)
+	c.now = func() time.Time { return expired }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := LoadConfig()
+	if _, err := config.NewRenderer(ctx, c, nil, testLogger{}); err != nil {
+		t.Fatalf("NewRenderer failed: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for c.Stats().Entries != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the renderer to sweep expired cache entries")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
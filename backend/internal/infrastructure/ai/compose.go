@@ -0,0 +1,508 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxComposeRenders bounds the number of renders in one composition
+	maxComposeRenders = 8
+
+	// composeJPEGQuality is the quality of JPEG compositions
+	composeJPEGQuality = 90
+)
+
+// ComposeLayout is how the original and its renders are arranged
+type ComposeLayout string
+
+const (
+	// ComposeLayoutSideBySide places the images next to each other, stacked
+	// vertically on portrait canvases
+	ComposeLayoutSideBySide ComposeLayout = "side_by_side"
+	// ComposeLayoutSlider splits one canvas between the original and a single
+	// render at the slider position
+	ComposeLayoutSlider ComposeLayout = "slider"
+	// ComposeLayoutGrid tiles the original and its renders in a square-ish grid
+	ComposeLayoutGrid ComposeLayout = "grid"
+)
+
+// composeAspects are the supported canvas aspect ratios, sized for social media
+var composeAspects = map[string]image.Point{
+	"1:1":    {1080, 1080},
+	"4:5":    {1080, 1350},
+	"9:16":   {1080, 1920},
+	"16:9":   {1920, 1080},
+	"1.91:1": {1200, 628},
+}
+
+// Composition output formats
+const (
+	ComposeFormatPNG  = "png"
+	ComposeFormatJPEG = "jpeg"
+)
+
+// ErrCompositionNeedsStorage is returned when a composition has nowhere to be stored
+var ErrCompositionNeedsStorage = errors.New("composition requires durable storage")
+
+var (
+	composeBackground = color.RGBA{24, 24, 24, 255}
+	composeCaptionBar = color.NRGBA{0, 0, 0, 150}
+	composeWatermark  = color.NRGBA{255, 255, 255, 150}
+)
+
+// ComposeSource is one render placed in a composition
+type ComposeSource struct {
+	ImageURL      string `json:"image_url"`
+	Caption       string `json:"caption,omitempty"`
+	SourceJobID   string `json:"source_job_id,omitempty"`
+	SourceVariant int    `json:"source_variant"`
+	ImageHash     string `json:"image_hash,omitempty"`
+}
+
+// ComposeRequest represents a request for a before/after presentation image
+type ComposeRequest struct {
+	ID              string          `json:"id,omitempty"`
+	UserID          string          `json:"user_id,omitempty"`
+	ProjectID       string          `json:"project_id,omitempty"`
+	OriginalImage   string          `json:"original_image"`
+	OriginalCaption string          `json:"original_caption,omitempty"`
+	Renders         []ComposeSource `json:"renders"`
+	Layout          ComposeLayout   `json:"layout"`
+	Aspect          string          `json:"aspect"`           // one of the composeAspects keys, default 1:1
+	Format          string          `json:"format,omitempty"` // png or jpeg, default png
+	Captions        bool            `json:"captions"`
+	StyleName       string          `json:"style_name,omitempty"`
+	CostTotal       *float64        `json:"cost_total,omitempty"`
+	Currency        string          `json:"currency,omitempty"`
+	Watermark       string          `json:"watermark,omitempty"`
+	SliderPosition  float64         `json:"slider_position,omitempty"` // fraction of the width showing the original, default 0.5
+}
+
+// Validate checks the images, layout and output options of the composition
+func (req *ComposeRequest) Validate() error {
+	if req.OriginalImage == "" {
+		return fmt.Errorf("original image is required")
+	}
+	if len(req.Renders) == 0 {
+		return fmt.Errorf("at least one render is required")
+	}
+	if len(req.Renders) > maxComposeRenders {
+		return fmt.Errorf("at most %d renders can be composed, got %d", maxComposeRenders, len(req.Renders))
+	}
+	for i, render := range req.Renders {
+		if render.ImageURL == "" {
+			return fmt.Errorf("render %d has no image", i)
+		}
+	}
+
+	switch req.Layout {
+	case ComposeLayoutSideBySide, ComposeLayoutGrid:
+	case ComposeLayoutSlider:
+		if len(req.Renders) != 1 {
+			return fmt.Errorf("slider layout takes exactly one render, got %d", len(req.Renders))
+		}
+	default:
+		return fmt.Errorf("unknown layout: %q", req.Layout)
+	}
+
+	if _, ok := composeAspects[req.aspect()]; !ok {
+		return fmt.Errorf("unsupported aspect ratio: %q", req.Aspect)
+	}
+	if format := req.format(); format != ComposeFormatPNG && format != ComposeFormatJPEG {
+		return fmt.Errorf("unsupported format: %q", req.Format)
+	}
+	if req.SliderPosition < 0 || req.SliderPosition >= 1 {
+		return fmt.Errorf("slider position must be between 0 and 1, got %v", req.SliderPosition)
+	}
+	return nil
+}
+
+func (req *ComposeRequest) aspect() string {
+	if req.Aspect == "" {
+		return "1:1"
+	}
+	return req.Aspect
+}
+
+func (req *ComposeRequest) format() string {
+	switch strings.ToLower(req.Format) {
+	case "", ComposeFormatPNG:
+		return ComposeFormatPNG
+	case ComposeFormatJPEG, "jpg":
+		return ComposeFormatJPEG
+	}
+	return req.Format
+}
+
+// CompositionInfo describes a stored composition; it is set as the "composition"
+// metadata of the render result
+type CompositionInfo struct {
+	Layout        ComposeLayout   `json:"layout"`
+	Aspect        string          `json:"aspect"`
+	Format        string          `json:"format"`
+	Width         int             `json:"width"`
+	Height        int             `json:"height"`
+	OriginalImage string          `json:"original_image"`
+	Renders       []ComposeSource `json:"renders"`
+}
+
+// composePanel is one image placed on the canvas with its caption
+type composePanel struct {
+	img     image.Image
+	caption string
+}
+
+// RenderComposition draws the original image and its renders into a single
+// presentation image and stores it like any other render. Captions, the style
+// name, the cost total and a watermark are drawn when set.
+func (r *Renderer) RenderComposition(ctx context.Context, req *ComposeRequest) (*RenderResult, error) {
+	startTime := time.Now()
+
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if r.blobs == nil {
+		return nil, ErrCompositionNeedsStorage
+	}
+
+	panels := make([]composePanel, 0, len(req.Renders)+1)
+	original, err := r.loadComposeImage(ctx, req.OriginalImage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load original image: %w", err)
+	}
+	panels = append(panels, composePanel{img: original, caption: req.OriginalCaption})
+	if panels[0].caption == "" {
+		panels[0].caption = "Before"
+	}
+	for i, render := range req.Renders {
+		img, err := r.loadComposeImage(ctx, render.ImageURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load render %d: %w", i, err)
+		}
+		caption := render.Caption
+		if caption == "" {
+			caption = "After"
+			if len(req.Renders) > 1 {
+				caption = fmt.Sprintf("After %d", i+1)
+			}
+		}
+		panels = append(panels, composePanel{img: img, caption: caption})
+	}
+	if !req.Captions {
+		for i := range panels {
+			panels[i].caption = ""
+		}
+	}
+
+	canvas := composeCanvas(req, panels)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	format := req.format()
+	if format == ComposeFormatJPEG {
+		err = jpeg.Encode(&buf, canvas, &jpeg.Options{Quality: composeJPEGQuality})
+	} else {
+		encoder := png.Encoder{CompressionLevel: png.BestSpeed}
+		err = encoder.Encode(&buf, canvas)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode composition: %w", err)
+	}
+
+	stored, err := r.storeImage(ctx, buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to store composition: %w", err)
+	}
+
+	bounds := canvas.Bounds()
+	return &RenderResult{
+		ID:             "compose_" + stored.Hash[:16],
+		RequestID:      req.ID,
+		Status:         "completed",
+		ResultImageURL: stored.URL,
+		ThumbnailURL:   stored.ThumbnailURL,
+		ImageHash:      stored.Hash,
+		Progress:       100,
+		ProcessingTime: time.Since(startTime).Seconds(),
+		CreatedAt:      startTime,
+		CompletedAt:    timePtr(time.Now()),
+		Metadata: map[string]interface{}{
+			"composition": CompositionInfo{
+				Layout:        req.Layout,
+				Aspect:        req.aspect(),
+				Format:        format,
+				Width:         bounds.Dx(),
+				Height:        bounds.Dy(),
+				OriginalImage: req.OriginalImage,
+				Renders:       req.Renders,
+			},
+		},
+	}, nil
+}
+
+// loadComposeImage loads and decodes one image of a composition
+func (r *Renderer) loadComposeImage(ctx context.Context, source string) (image.Image, error) {
+	data, err := r.loadRenderImage(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return img, nil
+}
+
+// composeCanvas lays the panels out on a canvas of the requested aspect ratio
+func composeCanvas(req *ComposeRequest, panels []composePanel) *image.RGBA {
+	size := composeAspects[req.aspect()]
+	canvas := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(composeBackground), image.Point{}, draw.Src)
+
+	scale := composeTextScale(size)
+	pad := 3 * scale
+
+	// The footer carries the style name and cost below the images
+	area := canvas.Bounds()
+	footer := composeFooter(req)
+	if footer[0] != "" || footer[1] != "" {
+		footerHeight := glyphHeight*scale + 4*pad
+		area.Max.Y -= footerHeight
+		drawFooter(canvas, image.Rect(0, area.Max.Y, size.X, size.Y), footer, scale, pad)
+	}
+
+	gap := max(4, size.X/200)
+	switch req.Layout {
+	case ComposeLayoutSlider:
+		drawSlider(canvas, area, panels[0], panels[1], req.sliderPosition(), scale, pad)
+	case ComposeLayoutGrid:
+		cols := int(math.Ceil(math.Sqrt(float64(len(panels)))))
+		rows := (len(panels) + cols - 1) / cols
+		for i, cell := range gridCells(area, cols, rows, gap) {
+			if i < len(panels) {
+				drawPanel(canvas, cell, panels[i], scale, pad)
+			}
+		}
+	default:
+		cols, rows := len(panels), 1
+		if size.Y > size.X {
+			cols, rows = 1, len(panels)
+		}
+		for i, cell := range gridCells(area, cols, rows, gap) {
+			drawPanel(canvas, cell, panels[i], scale, pad)
+		}
+	}
+
+	if req.Watermark != "" {
+		text, textScale := fitText(req.Watermark, scale, area.Dx()/2)
+		x := area.Max.X - pad - textWidth(text, textScale)
+		y := area.Max.Y - pad - glyphHeight*textScale
+		if req.Captions && req.Layout != ComposeLayoutSlider {
+			// Keep clear of the caption strip of the bottom-right panel
+			y -= glyphHeight*scale + 2*pad
+		}
+		drawText(canvas, x, y, text, textScale, composeWatermark)
+	}
+
+	return canvas
+}
+
+func (req *ComposeRequest) sliderPosition() float64 {
+	if req.SliderPosition == 0 {
+		return 0.5
+	}
+	return req.SliderPosition
+}
+
+// composeTextScale scales the bitmap font with the canvas
+func composeTextScale(size image.Point) int {
+	return max(2, min(size.X, size.Y)/300)
+}
+
+// composeFooter returns the left (style) and right (cost) footer texts
+func composeFooter(req *ComposeRequest) [2]string {
+	var footer [2]string
+	if req.StyleName != "" {
+		footer[0] = "Style: " + req.StyleName
+	}
+	if req.CostTotal != nil {
+		footer[1] = "Est. cost " + formatCost(*req.CostTotal, req.Currency)
+	}
+	return footer
+}
+
+// formatCost formats a whole amount with thousands separators, using a dollar sign
+// for USD and the currency code otherwise
+func formatCost(amount float64, currency string) string {
+	digits := strconv.FormatInt(int64(math.Round(math.Abs(amount))), 10)
+	var grouped strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(d)
+	}
+
+	sign := ""
+	if amount <= -0.5 {
+		sign = "-"
+	}
+	currency = strings.ToUpper(currency)
+	if currency == "" || currency == "USD" {
+		return sign + "$" + grouped.String()
+	}
+	return sign + currency + " " + grouped.String()
+}
+
+// gridCells splits area into cols x rows cells separated by gap
+func gridCells(area image.Rectangle, cols, rows, gap int) []image.Rectangle {
+	cellW := (area.Dx() - gap*(cols-1)) / cols
+	cellH := (area.Dy() - gap*(rows-1)) / rows
+
+	cells := make([]image.Rectangle, 0, cols*rows)
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			x := area.Min.X + col*(cellW+gap)
+			y := area.Min.Y + row*(cellH+gap)
+			cells = append(cells, image.Rect(x, y, x+cellW, y+cellH))
+		}
+	}
+	return cells
+}
+
+// drawPanel draws an image filling cell, cropped to its aspect ratio, with its caption
+func drawPanel(canvas *image.RGBA, cell image.Rectangle, panel composePanel, scale, pad int) {
+	if cell.Dx() <= 0 || cell.Dy() <= 0 {
+		return
+	}
+	fitted := coverFit(panel.img, cell.Dx(), cell.Dy())
+	draw.Draw(canvas, cell, fitted, image.Point{}, draw.Src)
+	drawCaption(canvas, cell, panel.caption, scale, pad, false)
+}
+
+// drawSlider splits area at position between the original and the render and
+// draws the slider handle on the divider
+func drawSlider(canvas *image.RGBA, area image.Rectangle, before, after composePanel, position float64, scale, pad int) {
+	beforeImg := coverFit(before.img, area.Dx(), area.Dy())
+	afterImg := coverFit(after.img, area.Dx(), area.Dy())
+
+	split := area.Min.X + int(math.Round(float64(area.Dx())*position))
+	draw.Draw(canvas, image.Rect(area.Min.X, area.Min.Y, split, area.Max.Y), beforeImg, image.Point{}, draw.Src)
+	draw.Draw(canvas, image.Rect(split, area.Min.Y, area.Max.X, area.Max.Y), afterImg, image.Point{split - area.Min.X, 0}, draw.Src)
+
+	white := image.NewUniform(color.RGBA{255, 255, 255, 255})
+	lineWidth := max(2, area.Dx()/300)
+	draw.Draw(canvas, image.Rect(split-lineWidth/2, area.Min.Y, split-lineWidth/2+lineWidth, area.Max.Y), white, image.Point{}, draw.Src)
+
+	// Circular handle with a left/right arrow in its centre
+	cy := area.Min.Y + area.Dy()/2
+	radius := max(8, min(area.Dx(), area.Dy())/25)
+	fillCircle(canvas, split, cy, radius, color.RGBA{255, 255, 255, 255})
+	fillCircle(canvas, split, cy, radius-lineWidth, composeBackground)
+	arrow := radius / 2
+	for i := 0; i <= arrow/2; i++ {
+		half := arrow/2 - i
+		draw.Draw(canvas, image.Rect(split-arrow+i, cy-half, split-arrow+i+1, cy+half+1), white, image.Point{}, draw.Src)
+		draw.Draw(canvas, image.Rect(split+arrow-i, cy-half, split+arrow-i+1, cy+half+1), white, image.Point{}, draw.Src)
+	}
+
+	drawCaption(canvas, image.Rect(area.Min.X, area.Min.Y, split, area.Max.Y), before.caption, scale, pad, false)
+	drawCaption(canvas, image.Rect(split, area.Min.Y, area.Max.X, area.Max.Y), after.caption, scale, pad, true)
+}
+
+// drawCaption draws text on a translucent strip along the bottom of rect,
+// left-aligned or right-aligned
+func drawCaption(canvas *image.RGBA, rect image.Rectangle, caption string, scale, pad int, alignRight bool) {
+	if caption == "" {
+		return
+	}
+	text, textScale := fitText(caption, scale, rect.Dx()-2*pad)
+	if text == "" {
+		return
+	}
+
+	stripHeight := glyphHeight*scale + 2*pad
+	strip := image.Rect(rect.Min.X, rect.Max.Y-stripHeight, rect.Max.X, rect.Max.Y)
+	draw.Draw(canvas, strip, image.NewUniform(composeCaptionBar), image.Point{}, draw.Over)
+
+	x := strip.Min.X + pad
+	if alignRight {
+		x = strip.Max.X - pad - textWidth(text, textScale)
+	}
+	y := strip.Min.Y + (stripHeight-glyphHeight*textScale)/2
+	drawText(canvas, x, y, text, textScale, color.White)
+}
+
+// drawFooter draws the left and right footer texts centred vertically in rect
+func drawFooter(canvas *image.RGBA, rect image.Rectangle, footer [2]string, scale, pad int) {
+	width := rect.Dx() - 2*pad
+	if footer[0] != "" && footer[1] != "" {
+		width = (width - 2*pad) / 2
+	}
+
+	if footer[0] != "" {
+		text, textScale := fitText(footer[0], scale, width)
+		y := rect.Min.Y + (rect.Dy()-glyphHeight*textScale)/2
+		drawText(canvas, rect.Min.X+pad, y, text, textScale, color.White)
+	}
+	if footer[1] != "" {
+		text, textScale := fitText(footer[1], scale, width)
+		y := rect.Min.Y + (rect.Dy()-glyphHeight*textScale)/2
+		drawText(canvas, rect.Max.X-pad-textWidth(text, textScale), y, text, textScale, color.White)
+	}
+}
+
+// fillCircle fills a circle of radius r centred at (cx, cy)
+func fillCircle(canvas *image.RGBA, cx, cy, r int, c color.RGBA) {
+	bounds := canvas.Bounds()
+	for y := cy - r; y <= cy+r; y++ {
+		for x := cx - r; x <= cx+r; x++ {
+			dx, dy := x-cx, y-cy
+			if dx*dx+dy*dy <= r*r && image.Pt(x, y).In(bounds) {
+				canvas.SetRGBA(x, y, c)
+			}
+		}
+	}
+}
+
+// coverFit scales img to fill w x h, cropping the centre of the longer axis
+func coverFit(img image.Image, w, h int) *image.RGBA {
+	bounds := img.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+
+	crop := bounds
+	if sw*h > sh*w {
+		cw := sh * w / h
+		crop.Min.X += (sw - cw) / 2
+		crop.Max.X = crop.Min.X + cw
+	} else {
+		ch := sw * h / w
+		crop.Min.Y += (sh - ch) / 2
+		crop.Max.Y = crop.Min.Y + ch
+	}
+
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		img = sub.SubImage(crop)
+	} else {
+		cropped := image.NewRGBA(image.Rect(0, 0, crop.Dx(), crop.Dy()))
+		draw.Draw(cropped, cropped.Bounds(), img, crop.Min, draw.Src)
+		img = cropped
+	}
+	return lanczosResize(img, w, h)
+}
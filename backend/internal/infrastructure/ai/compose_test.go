@@ -0,0 +1,214 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/compozit/vision/backend/internal/infrastructure/storage"
+)
+
+func solidImage(w, h int, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	return img
+}
+
+func TestComposeCanvasLayouts(t *testing.T) {
+	red := color.RGBA{220, 30, 30, 255}
+	blue := color.RGBA{30, 30, 220, 255}
+	green := color.RGBA{30, 200, 30, 255}
+	panels := []composePanel{{img: solidImage(80, 60, red)}, {img: solidImage(60, 80, blue)}}
+
+	near := func(got, want color.RGBA) bool {
+		d := func(a, b uint8) int {
+			if a > b {
+				return int(a - b)
+			}
+			return int(b - a)
+		}
+		return d(got.R, want.R) < 8 && d(got.G, want.G) < 8 && d(got.B, want.B) < 8
+	}
+
+	// Side by side on a landscape canvas: original left, render right
+	canvas := composeCanvas(&ComposeRequest{Layout: ComposeLayoutSideBySide, Aspect: "16:9"}, panels)
+	if b := canvas.Bounds(); b.Dx() != 1920 || b.Dy() != 1080 {
+		t.Fatalf("Expected a 1920x1080 canvas, got %v", b)
+	}
+	if got := canvas.RGBAAt(400, 540); !near(got, red) {
+		t.Errorf("Expected the original on the left, got %v", got)
+	}
+	if got := canvas.RGBAAt(1500, 540); !near(got, blue) {
+		t.Errorf("Expected the render on the right, got %v", got)
+	}
+
+	// Portrait canvases stack the images
+	canvas = composeCanvas(&ComposeRequest{Layout: ComposeLayoutSideBySide, Aspect: "9:16"}, panels)
+	if got := canvas.RGBAAt(540, 400); !near(got, red) {
+		t.Errorf("Expected the original on top, got %v", got)
+	}
+	if got := canvas.RGBAAt(540, 1500); !near(got, blue) {
+		t.Errorf("Expected the render below, got %v", got)
+	}
+
+	// The slider splits at the requested position
+	canvas = composeCanvas(&ComposeRequest{Layout: ComposeLayoutSlider, SliderPosition: 0.25}, panels)
+	if got := canvas.RGBAAt(200, 100); !near(got, red) {
+		t.Errorf("Expected the original left of the slider, got %v", got)
+	}
+	if got := canvas.RGBAAt(400, 100); !near(got, blue) {
+		t.Errorf("Expected the render right of the slider, got %v", got)
+	}
+	if got := canvas.RGBAAt(270, 100); got != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("Expected the divider at 25%%, got %v", got)
+	}
+
+	// Three images tile a 2x2 grid, leaving the last cell empty
+	grid := append(panels, composePanel{img: solidImage(50, 50, green)})
+	canvas = composeCanvas(&ComposeRequest{Layout: ComposeLayoutGrid, Aspect: "1:1"}, grid)
+	for _, c := range []struct {
+		x, y int
+		want color.RGBA
+	}{{270, 270, red}, {810, 270, blue}, {270, 810, green}, {810, 810, composeBackground}} {
+		if got := canvas.RGBAAt(c.x, c.y); !near(got, c.want) {
+			t.Errorf("Expected %v at (%d, %d), got %v", c.want, c.x, c.y, got)
+		}
+	}
+}
+
+func TestComposeCanvasText(t *testing.T) {
+	gray := color.RGBA{128, 128, 128, 255}
+	panels := []composePanel{{img: solidImage(40, 40, gray), caption: "Before"}, {img: solidImage(40, 40, gray), caption: "After"}}
+	cost := 12345.4
+
+	plain := composeCanvas(&ComposeRequest{Layout: ComposeLayoutSideBySide}, []composePanel{{img: panels[0].img}, {img: panels[1].img}})
+	captioned := composeCanvas(&ComposeRequest{
+		Layout:    ComposeLayoutSideBySide,
+		Captions:  true,
+		StyleName: "Japandi",
+		CostTotal: &cost,
+		Watermark: "compozit.app",
+	}, panels)
+
+	// The footer only carries text when a style name or cost is set
+	countWhite := func(img *image.RGBA, rect image.Rectangle) int {
+		n := 0
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				if c := img.RGBAAt(x, y); c.R > 240 && c.G > 240 && c.B > 240 {
+					n++
+				}
+			}
+		}
+		return n
+	}
+	footer := image.Rect(0, 1000, 1080, 1080)
+	if countWhite(plain, footer) != 0 {
+		t.Error("Expected no footer without a style name or cost")
+	}
+	if countWhite(captioned, footer) == 0 {
+		t.Error("Expected footer text")
+	}
+	if captioned.RGBAAt(5, 300) != plain.RGBAAt(5, 300) {
+		t.Error("Expected the top of the panels to be untouched")
+	}
+}
+
+func TestFormatCost(t *testing.T) {
+	for _, c := range []struct {
+		amount   float64
+		currency string
+		want     string
+	}{
+		{12345.4, "", "$12,345"},
+		{999, "usd", "$999"},
+		{1000, "EUR", "EUR 1,000"},
+		{1234567.5, "USD", "$1,234,568"},
+	} {
+		if got := formatCost(c.amount, c.currency); got != c.want {
+			t.Errorf("formatCost(%v, %q) = %q, want %q", c.amount, c.currency, got, c.want)
+		}
+	}
+}
+
+func TestFitText(t *testing.T) {
+	if text, scale := fitText("After", 4, 1000); text != "After" || scale != 4 {
+		t.Errorf("Expected text to fit at full scale, got %q at %d", text, scale)
+	}
+	if _, scale := fitText("After", 4, textWidth("After", 2)); scale != 2 {
+		t.Errorf("Expected text to shrink to scale 2, got %d", scale)
+	}
+	text, scale := fitText("A very long caption", 3, 60)
+	if scale != 1 || textWidth(text, 1) > 60 || text[len(text)-3:] != "..." {
+		t.Errorf("Expected truncated text within 60px, got %q at %d", text, scale)
+	}
+}
+
+func TestRenderComposition(t *testing.T) {
+	req := &ComposeRequest{
+		ID:            "job_3",
+		OriginalImage: testImageDataURI(t, testRoomImage()),
+		Renders:       []ComposeSource{{ImageURL: testImageDataURI(t, testRoomImage()), SourceJobID: "job_1"}},
+		Layout:        ComposeLayoutSlider,
+		Aspect:        "4:5",
+		Format:        "jpeg",
+		Captions:      true,
+	}
+
+	renderer := NewRenderer("", nil, testLogger{})
+	if _, err := renderer.RenderComposition(context.Background(), req); !errors.Is(err, ErrCompositionNeedsStorage) {
+		t.Fatalf("Expected ErrCompositionNeedsStorage, got %v", err)
+	}
+
+	blobs, err := storage.NewLocalStore(t.TempDir(), "https://api.example.com/assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	renderer.EnableDurableStorage(blobs)
+
+	result, err := renderer.RenderComposition(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if info, ok := result.Metadata["composition"].(CompositionInfo); !ok || info.Width != 1080 || info.Height != 1350 || info.Format != ComposeFormatJPEG {
+		t.Errorf("Unexpected composition metadata: %+v", result.Metadata)
+	}
+
+	data, err := renderer.loadRenderImage(context.Background(), result.ResultImageURL)
+	if err != nil {
+		t.Fatalf("Expected stored composition to be readable: %v", err)
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || format != "jpeg" || config.Width != 1080 || config.Height != 1350 {
+		t.Errorf("Expected a stored 1080x1350 JPEG, got %s %+v %v", format, config, err)
+	}
+}
+
+func TestComposeRequestValidate(t *testing.T) {
+	render := ComposeSource{ImageURL: "https://example.com/after.png"}
+	valid := ComposeRequest{OriginalImage: "https://example.com/before.png", Renders: []ComposeSource{render}, Layout: ComposeLayoutSideBySide}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for name, mutate := range map[string]func(*ComposeRequest){
+		"no original":    func(r *ComposeRequest) { r.OriginalImage = "" },
+		"no renders":     func(r *ComposeRequest) { r.Renders = nil },
+		"bad layout":     func(r *ComposeRequest) { r.Layout = "collage" },
+		"bad aspect":     func(r *ComposeRequest) { r.Aspect = "3:2" },
+		"bad format":     func(r *ComposeRequest) { r.Format = "gif" },
+		"slider of two":  func(r *ComposeRequest) { r.Layout = ComposeLayoutSlider; r.Renders = []ComposeSource{render, render} },
+		"slider too far": func(r *ComposeRequest) { r.Layout = ComposeLayoutSlider; r.SliderPosition = 1 },
+	} {
+		req := valid
+		mutate(&req)
+		if err := req.Validate(); err == nil {
+			t.Errorf("Expected %s to be rejected", name)
+		}
+	}
+}
@@ -1,10 +1,14 @@
 package ai
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/compozit/vision/backend/pkg/logger"
 )
 
 // Config holds configuration for the AI rendering system
@@ -13,15 +17,46 @@ type Config struct {
 	ReplicateToken string
 	ReplicateURL   string
 
+	// Webhook configuration; polling is used alone when WebhookURL is empty
+	WebhookURL    string
+	WebhookSecret string
+
 	// Model configurations
 	QuickModelVersion    string
 	DetailedModelVersion string
 	InpaintingModelVersion string
+	ControlNetModelVersion string
+	UpscaleModelVersion    string
+
+	// Upscaling: auto, provider or local (CPU Lanczos, for offline use)
+	UpscaleMode UpscaleMode
+
+	// Structure preservation: how strongly renders follow the input photo's edges and depth
+	ConditioningScale float64
+
+	// Hosts user-supplied image URLs may be fetched from over https; "*." matches subdomains
+	ImageHosts []string
+
+	// Prompt templates; the built-in templates are used when PromptTemplateDir is empty
+	PromptTemplateDir    string
+	PromptReloadInterval time.Duration
+
+	// Content moderation; blocklist terms and the rules file extend the built-in blocklist
+	ModerationBlocklist []string
+	ModerationRulesFile string
 
 	// Performance settings
 	MaxConcurrentJobs int
 	JobTimeout        time.Duration
 	CacheExpiration   time.Duration
+	CacheMaxMemory    int64         // bytes held by the in-memory cache tier
+	CacheNegativeTTL  time.Duration // how long provider failures are remembered
+
+	// Provider resilience
+	ProviderMaxRetries   int
+	ProviderRateLimit    float64       // prediction creations per second; 0 disables limiting
+	BreakerThreshold     int           // consecutive failures that open a model's circuit
+	BreakerCooldown      time.Duration // time before an open circuit is probed again
 
 	// Quality settings
 	DefaultWidth      int
@@ -43,9 +78,21 @@ func LoadConfig() *Config {
 		QuickModelVersion:      "stability-ai/sdxl-turbo:latest",
 		DetailedModelVersion:   "stability-ai/stable-diffusion-xl:latest",
 		InpaintingModelVersion: "stability-ai/stable-diffusion-inpainting:latest",
+		ControlNetModelVersion: "lucataco/sdxl-controlnet:latest",
+		UpscaleModelVersion:    defaultUpscaleModel,
+		UpscaleMode:            UpscaleModeAuto,
+		ConditioningScale:      0.7,
+		ImageHosts:             defaultImageHosts,
+		PromptReloadInterval:   time.Minute,
 		MaxConcurrentJobs:      5,
 		JobTimeout:             5 * time.Minute,
 		CacheExpiration:        15 * time.Minute,
+		CacheMaxMemory:         64 << 20, // 64MB
+		CacheNegativeTTL:       30 * time.Second,
+		ProviderMaxRetries:     3,
+		ProviderRateLimit:      10,
+		BreakerThreshold:       5,
+		BreakerCooldown:        30 * time.Second,
 		DefaultWidth:           1024,
 		DefaultHeight:          1024,
 		QuickInferenceSteps:    4,
@@ -64,6 +111,14 @@ func LoadConfig() *Config {
 		config.ReplicateURL = url
 	}
 
+	if webhookURL := os.Getenv("REPLICATE_WEBHOOK_URL"); webhookURL != "" {
+		config.WebhookURL = webhookURL
+	}
+
+	if secret := os.Getenv("REPLICATE_WEBHOOK_SECRET"); secret != "" {
+		config.WebhookSecret = secret
+	}
+
 	if model := os.Getenv("AI_QUICK_MODEL"); model != "" {
 		config.QuickModelVersion = model
 	}
@@ -72,6 +127,46 @@ func LoadConfig() *Config {
 		config.DetailedModelVersion = model
 	}
 
+	if model := os.Getenv("AI_CONTROLNET_MODEL"); model != "" {
+		config.ControlNetModelVersion = model
+	}
+
+	if model := os.Getenv("AI_UPSCALE_MODEL"); model != "" {
+		config.UpscaleModelVersion = model
+	}
+
+	if mode := os.Getenv("AI_UPSCALE_MODE"); mode != "" {
+		config.UpscaleMode = UpscaleMode(mode)
+	}
+
+	if scale := os.Getenv("AI_CONDITIONING_SCALE"); scale != "" {
+		if s, err := strconv.ParseFloat(scale, 64); err == nil && s > 0 {
+			config.ConditioningScale = s
+		}
+	}
+
+	if hosts := os.Getenv("AI_IMAGE_HOSTS"); hosts != "" {
+		config.ImageHosts = strings.Split(hosts, ",")
+	}
+
+	if dir := os.Getenv("AI_PROMPT_TEMPLATE_DIR"); dir != "" {
+		config.PromptTemplateDir = dir
+	}
+
+	if interval := os.Getenv("AI_PROMPT_RELOAD_INTERVAL"); interval != "" {
+		if i, err := time.ParseDuration(interval); err == nil && i > 0 {
+			config.PromptReloadInterval = i
+		}
+	}
+
+	if blocklist := os.Getenv("AI_MODERATION_BLOCKLIST"); blocklist != "" {
+		config.ModerationBlocklist = strings.Split(blocklist, ",")
+	}
+
+	if rules := os.Getenv("AI_MODERATION_RULES_FILE"); rules != "" {
+		config.ModerationRulesFile = rules
+	}
+
 	if jobs := os.Getenv("MAX_CONCURRENT_AI_JOBS"); jobs != "" {
 		if j, err := strconv.Atoi(jobs); err == nil && j > 0 {
 			config.MaxConcurrentJobs = j
@@ -90,6 +185,42 @@ func LoadConfig() *Config {
 		}
 	}
 
+	if size := os.Getenv("AI_CACHE_MAX_MEMORY"); size != "" {
+		if s, err := strconv.ParseInt(size, 10, 64); err == nil && s > 0 {
+			config.CacheMaxMemory = s
+		}
+	}
+
+	if ttl := os.Getenv("AI_CACHE_NEGATIVE_TTL"); ttl != "" {
+		if t, err := time.ParseDuration(ttl); err == nil && t >= 0 {
+			config.CacheNegativeTTL = t
+		}
+	}
+
+	if retries := os.Getenv("AI_PROVIDER_MAX_RETRIES"); retries != "" {
+		if r, err := strconv.Atoi(retries); err == nil && r >= 0 {
+			config.ProviderMaxRetries = r
+		}
+	}
+
+	if rate := os.Getenv("AI_PROVIDER_RATE_LIMIT"); rate != "" {
+		if r, err := strconv.ParseFloat(rate, 64); err == nil && r >= 0 {
+			config.ProviderRateLimit = r
+		}
+	}
+
+	if threshold := os.Getenv("AI_BREAKER_THRESHOLD"); threshold != "" {
+		if t, err := strconv.Atoi(threshold); err == nil && t > 0 {
+			config.BreakerThreshold = t
+		}
+	}
+
+	if cooldown := os.Getenv("AI_BREAKER_COOLDOWN"); cooldown != "" {
+		if c, err := time.ParseDuration(cooldown); err == nil && c > 0 {
+			config.BreakerCooldown = c
+		}
+	}
+
 	if width := os.Getenv("AI_DEFAULT_WIDTH"); width != "" {
 		if w, err := strconv.Atoi(width); err == nil && w > 0 {
 			config.DefaultWidth = w
@@ -131,12 +262,111 @@ func LoadConfig() *Config {
 	return config
 }
 
+// CacheOptions returns the cache limits from the configuration
+func (c *Config) CacheOptions() CacheOptions {
+	opts := DefaultCacheOptions()
+	opts.MaxMemoryBytes = c.CacheMaxMemory
+	opts.TTL = c.CacheExpiration
+	opts.NegativeTTL = c.CacheNegativeTTL
+	return opts
+}
+
+// ResilienceConfig returns the provider retry, breaker and rate limit settings.
+// Status reads are allowed five times the creation rate, matching Replicate's limits.
+func (c *Config) ResilienceConfig() ResilienceConfig {
+	config := DefaultResilienceConfig()
+	config.MaxRetries = c.ProviderMaxRetries
+	config.CreateRateLimit = c.ProviderRateLimit
+	config.ReadRateLimit = c.ProviderRateLimit * 5
+	config.BreakerThreshold = c.BreakerThreshold
+	config.BreakerCooldown = c.BreakerCooldown
+	return config
+}
+
+// ModerationConfig returns the built-in blocklist extended with the configured
+// terms and rules file
+func (c *Config) ModerationConfig() (ModerationConfig, error) {
+	config := DefaultModerationConfig()
+	if c.ModerationRulesFile != "" {
+		var err error
+		if config, err = LoadModerationConfig(c.ModerationRulesFile); err != nil {
+			return config, err
+		}
+	}
+	config.Blocklist = append(config.Blocklist, c.ModerationBlocklist...)
+	return config, nil
+}
+
+// NewRenderer creates a renderer with the configured provider resilience,
+// upscaling, image hosts, moderation, prompt templates and structure control.
+// Webhooks are enabled when WebhookURL is set; otherwise predictions are polled.
+// depth may be nil to condition renders on edges only. The cache sweep and
+// prompt template reloads run until ctx is cancelled.
+func (c *Config) NewRenderer(ctx context.Context, cache *Cache, depth DepthEstimator, logger logger.Logger) (*Renderer, error) {
+	if cache != nil {
+		cache.Start(ctx)
+	}
+
+	renderer := NewRenderer(c.ReplicateToken, cache, logger)
+	renderer.ConfigureResilience(c.ResilienceConfig())
+	renderer.ConfigureUpscaling(c.UpscaleModelVersion, c.UpscaleMode)
+	renderer.SetImageHosts(c.ImageHosts)
+
+	moderation, err := c.ModerationConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load moderation rules: %w", err)
+	}
+	moderator, err := NewModerator(moderation, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create moderator: %w", err)
+	}
+	renderer.SetModerator(moderator)
+
+	if c.PromptTemplateDir != "" {
+		catalog := NewPromptCatalog(NewDirectoryPromptSource(c.PromptTemplateDir))
+		if err := catalog.Reload(ctx); err != nil {
+			return nil, fmt.Errorf("failed to load prompt templates: %w", err)
+		}
+		renderer.SetPromptCatalog(catalog)
+		go catalog.WatchReload(ctx, c.PromptReloadInterval, logger)
+	}
+
+	if c.ControlNetModelVersion != "" {
+		renderer.EnableStructureControl(c.ControlNetModelVersion, c.ConditioningScale, c.MaxFileSize, depth)
+	}
+	if c.WebhookURL != "" {
+		renderer.EnableWebhooks(c.WebhookURL, c.WebhookSecret)
+	}
+
+	return renderer, nil
+}
+
 // Validate checks if the configuration is valid
 func (c *Config) Validate() error {
 	if c.ReplicateToken == "" {
 		return fmt.Errorf("REPLICATE_API_TOKEN is required")
 	}
 
+	if c.WebhookURL != "" && c.WebhookSecret == "" {
+		return fmt.Errorf("REPLICATE_WEBHOOK_SECRET is required when REPLICATE_WEBHOOK_URL is set")
+	}
+
+	switch c.UpscaleMode {
+	case UpscaleModeAuto, UpscaleModeProvider, UpscaleModeLocal:
+	default:
+		return fmt.Errorf("unknown AI_UPSCALE_MODE: %s", c.UpscaleMode)
+	}
+
+	if c.ModerationRulesFile != "" {
+		moderation, err := c.ModerationConfig()
+		if err == nil {
+			_, err = NewModerator(moderation, nil)
+		}
+		if err != nil {
+			return fmt.Errorf("AI_MODERATION_RULES_FILE: %w", err)
+		}
+	}
+
 	if c.MaxConcurrentJobs <= 0 {
 		return fmt.Errorf("MaxConcurrentJobs must be positive")
 	}
@@ -0,0 +1,399 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg" // register JPEG decoder for input photos
+	"image/png"
+	"io"
+	"math"
+	"strings"
+)
+
+const (
+	// defaultConditioningScale balances structure preservation against style freedom
+	defaultConditioningScale = 0.7
+
+	// maxControlDimension caps the control map size sent to the provider
+	maxControlDimension = 1024
+
+	// Canny hysteresis thresholds on the normalised gradient magnitude (0-1)
+	cannyLowThreshold  = 0.1
+	cannyHighThreshold = 0.25
+)
+
+// DepthEstimator produces a per-pixel distance map from a room photo.
+// Larger values are farther from the camera. vision.SimpleAnalyzer and
+// vision.Analyzer implement it.
+type DepthEstimator interface {
+	EstimateDepthMap(ctx context.Context, img image.Image) ([][]float64, error)
+}
+
+// ControlMaps holds the conditioning images derived from the user's room photo
+type ControlMaps struct {
+	Canny string `json:"canny"`           // PNG data URI of the edge map
+	Depth string `json:"depth,omitempty"` // PNG data URI of the depth map
+}
+
+// structureControl configures image-conditioned rendering
+type structureControl struct {
+	modelVersion      string
+	conditioningScale float64
+	depth             DepthEstimator
+	maxImageSize      int64
+}
+
+// EnableStructureControl makes quick and detailed renders conditioned on the input
+// photo through a ControlNet model. depth may be nil to condition on edges only.
+func (r *Renderer) EnableStructureControl(modelVersion string, conditioningScale float64, maxImageSize int64, depth DepthEstimator) {
+	if conditioningScale <= 0 {
+		conditioningScale = defaultConditioningScale
+	}
+
+	r.control = &structureControl{
+		modelVersion:      modelVersion,
+		conditioningScale: conditioningScale,
+		depth:             depth,
+		maxImageSize:      maxImageSize,
+	}
+}
+
+// applyStructureControl derives control maps from the request's input image and adds
+// them to the provider input. It returns the model to use and the metadata to record,
+// or ok=false when the render should stay text-only.
+func (r *Renderer) applyStructureControl(ctx context.Context, req *RenderRequest, input map[string]interface{}) (string, map[string]interface{}, bool, error) {
+	if r.control == nil || req.InputImage == "" {
+		return "", nil, false, nil
+	}
+
+	img, err := r.loadInputImage(ctx, req.InputImage)
+	if err != nil {
+		return "", nil, false, fmt.Errorf("failed to load input image: %w", err)
+	}
+
+	maps, err := r.buildControlMaps(ctx, img)
+	if err != nil {
+		return "", nil, false, fmt.Errorf("failed to build control maps: %w", err)
+	}
+
+	scale := r.control.conditioningScale
+	if v, ok := req.Parameters["conditioning_strength"].(float64); ok && v > 0 && v <= 2 {
+		scale = v
+	}
+
+	input["image"] = maps.Canny
+	input["controlnet_conditioning_scale"] = scale
+	if maps.Depth != "" {
+		input["depth_image"] = maps.Depth
+	}
+
+	metadata := map[string]interface{}{
+		"control_maps":          maps,
+		"conditioning_strength": scale,
+		"control_model":         r.control.modelVersion,
+	}
+
+	return r.control.modelVersion, metadata, true, nil
+}
+
+// buildControlMaps computes the Canny edge map and, when available, the depth map
+func (r *Renderer) buildControlMaps(ctx context.Context, img image.Image) (*ControlMaps, error) {
+	img = downscale(img, maxControlDimension)
+	gray := toGray(img)
+
+	canny, err := encodePNGDataURI(cannyEdges(gray))
+	if err != nil {
+		return nil, err
+	}
+
+	maps := &ControlMaps{Canny: canny}
+
+	if r.control.depth != nil {
+		depthMap, err := r.control.depth.EstimateDepthMap(ctx, img)
+		if err != nil {
+			// Edges alone still preserve the room layout
+			r.logger.Warn("Depth estimation failed, conditioning on edges only", "error", err)
+		} else if len(depthMap) > 0 {
+			depth, err := encodePNGDataURI(depthToImage(depthMap))
+			if err != nil {
+				return nil, err
+			}
+			maps.Depth = depth
+		}
+	}
+
+	return maps, nil
+}
+
+// loadInputImage decodes the user's photo from a data URI, the blob store or an
+// allowed https host
+func (r *Renderer) loadInputImage(ctx context.Context, source string) (image.Image, error) {
+	var reader io.Reader
+
+	limit := int64(maxOutputImageSize)
+	if r.control != nil && r.control.maxImageSize > 0 {
+		limit = r.control.maxImageSize
+	}
+
+	if strings.HasPrefix(source, "data:") {
+		_, encoded, found := strings.Cut(source, ",")
+		if !found {
+			return nil, fmt.Errorf("malformed data URI")
+		}
+		reader = io.LimitReader(base64.NewDecoder(base64.StdEncoding, strings.NewReader(encoded)), limit)
+	} else if data, ok, err := r.loadStoredImage(ctx, source); ok {
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		data, err := r.fetchImage(ctx, source, limit)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	img, _, err := image.Decode(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	return img, nil
+}
+
+// downscale shrinks an image so its longest side is at most maxDim (nearest neighbour)
+func downscale(img image.Image, maxDim int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= maxDim && h <= maxDim {
+		return img
+	}
+
+	scale := float64(maxDim) / math.Max(float64(w), float64(h))
+	nw, nh := int(float64(w)*scale), int(float64(h)*scale)
+	out := image.NewRGBA(image.Rect(0, 0, nw, nh))
+
+	for y := 0; y < nh; y++ {
+		sy := bounds.Min.Y + int(float64(y)/scale)
+		for x := 0; x < nw; x++ {
+			sx := bounds.Min.X + int(float64(x)/scale)
+			out.Set(x, y, img.At(sx, sy))
+		}
+	}
+
+	return out
+}
+
+// toGray converts an image to a luminance matrix in the 0-1 range
+func toGray(img image.Image) [][]float64 {
+	bounds := img.Bounds()
+	gray := make([][]float64, bounds.Dy())
+
+	for y := range gray {
+		gray[y] = make([]float64, bounds.Dx())
+		for x := range gray[y] {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			gray[y][x] = (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 65535
+		}
+	}
+
+	return gray
+}
+
+// cannyEdges runs a Canny edge detector: Gaussian blur, Sobel gradients,
+// non-maximum suppression and hysteresis thresholding
+func cannyEdges(gray [][]float64) *image.Gray {
+	h := len(gray)
+	if h == 0 {
+		return image.NewGray(image.Rect(0, 0, 0, 0))
+	}
+	w := len(gray[0])
+	out := image.NewGray(image.Rect(0, 0, w, h))
+	if w < 3 || h < 3 {
+		return out
+	}
+
+	blurred := gaussianBlur(gray)
+
+	magnitude := make([][]float64, h)
+	direction := make([][]float64, h)
+	maxMag := 0.0
+	for y := range magnitude {
+		magnitude[y] = make([]float64, w)
+		direction[y] = make([]float64, w)
+	}
+
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			gx := -blurred[y-1][x-1] - 2*blurred[y][x-1] - blurred[y+1][x-1] +
+				blurred[y-1][x+1] + 2*blurred[y][x+1] + blurred[y+1][x+1]
+			gy := -blurred[y-1][x-1] - 2*blurred[y-1][x] - blurred[y-1][x+1] +
+				blurred[y+1][x-1] + 2*blurred[y+1][x] + blurred[y+1][x+1]
+
+			magnitude[y][x] = math.Hypot(gx, gy)
+			direction[y][x] = math.Atan2(gy, gx)
+			if magnitude[y][x] > maxMag {
+				maxMag = magnitude[y][x]
+			}
+		}
+	}
+
+	if maxMag == 0 {
+		return out
+	}
+
+	// Non-maximum suppression along the gradient direction
+	const (
+		none = iota
+		weak
+		strong
+	)
+	class := make([][]uint8, h)
+	for y := range class {
+		class[y] = make([]uint8, w)
+	}
+
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			m := magnitude[y][x] / maxMag
+			if m < cannyLowThreshold {
+				continue
+			}
+
+			angle := direction[y][x] * 180 / math.Pi
+			if angle < 0 {
+				angle += 180
+			}
+
+			var n1, n2 float64
+			switch {
+			case angle < 22.5 || angle >= 157.5:
+				n1, n2 = magnitude[y][x-1], magnitude[y][x+1]
+			case angle < 67.5:
+				n1, n2 = magnitude[y-1][x+1], magnitude[y+1][x-1]
+			case angle < 112.5:
+				n1, n2 = magnitude[y-1][x], magnitude[y+1][x]
+			default:
+				n1, n2 = magnitude[y-1][x-1], magnitude[y+1][x+1]
+			}
+
+			if magnitude[y][x] < n1 || magnitude[y][x] < n2 {
+				continue
+			}
+
+			if m >= cannyHighThreshold {
+				class[y][x] = strong
+			} else {
+				class[y][x] = weak
+			}
+		}
+	}
+
+	// Hysteresis: keep weak edges connected to strong ones
+	stack := make([]image.Point, 0, w)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if class[y][x] == strong {
+				stack = append(stack, image.Point{X: x, Y: y})
+			}
+		}
+	}
+
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		out.SetGray(p.X, p.Y, color.Gray{Y: 255})
+
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				nx, ny := p.X+dx, p.Y+dy
+				if nx < 0 || ny < 0 || nx >= w || ny >= h {
+					continue
+				}
+				if class[ny][nx] == weak {
+					class[ny][nx] = strong
+					stack = append(stack, image.Point{X: nx, Y: ny})
+				}
+			}
+		}
+	}
+
+	return out
+}
+
+// gaussianBlur applies a 5x5 Gaussian kernel (sigma ~1.4)
+func gaussianBlur(gray [][]float64) [][]float64 {
+	kernel := [5][5]float64{
+		{2, 4, 5, 4, 2},
+		{4, 9, 12, 9, 4},
+		{5, 12, 15, 12, 5},
+		{4, 9, 12, 9, 4},
+		{2, 4, 5, 4, 2},
+	}
+
+	h, w := len(gray), len(gray[0])
+	out := make([][]float64, h)
+
+	for y := 0; y < h; y++ {
+		out[y] = make([]float64, w)
+		for x := 0; x < w; x++ {
+			sum, weight := 0.0, 0.0
+			for ky := -2; ky <= 2; ky++ {
+				for kx := -2; kx <= 2; kx++ {
+					sy, sx := y+ky, x+kx
+					if sy < 0 || sx < 0 || sy >= h || sx >= w {
+						continue
+					}
+					k := kernel[ky+2][kx+2]
+					sum += gray[sy][sx] * k
+					weight += k
+				}
+			}
+			out[y][x] = sum / weight
+		}
+	}
+
+	return out
+}
+
+// depthToImage renders a distance map in the ControlNet convention: near is bright
+func depthToImage(depthMap [][]float64) *image.Gray {
+	h, w := len(depthMap), len(depthMap[0])
+	out := image.NewGray(image.Rect(0, 0, w, h))
+
+	minD, maxD := math.Inf(1), math.Inf(-1)
+	for _, row := range depthMap {
+		for _, d := range row {
+			minD = math.Min(minD, d)
+			maxD = math.Max(maxD, d)
+		}
+	}
+
+	span := maxD - minD
+	for y, row := range depthMap {
+		for x, d := range row {
+			v := 1.0
+			if span > 0 {
+				v = 1 - (d-minD)/span
+			}
+			out.SetGray(x, y, color.Gray{Y: uint8(v * 255)})
+		}
+	}
+
+	return out
+}
+
+// encodePNGDataURI encodes an image as a PNG data URI accepted by the provider
+func encodePNGDataURI(img image.Image) (string, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", fmt.Errorf("failed to encode control map: %w", err)
+	}
+
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
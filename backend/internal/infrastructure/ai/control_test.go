@@ -0,0 +1,203 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// fakeDepthEstimator returns a fixed depth map, or err
+type fakeDepthEstimator struct {
+	err error
+}
+
+func (f fakeDepthEstimator) EstimateDepthMap(ctx context.Context, img image.Image) ([][]float64, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	bounds := img.Bounds()
+	depth := make([][]float64, bounds.Dy())
+	for y := range depth {
+		depth[y] = make([]float64, bounds.Dx())
+		for x := range depth[y] {
+			depth[y][x] = float64(y)
+		}
+	}
+	return depth, nil
+}
+
+func TestCannyEdges(t *testing.T) {
+	// A dark left half next to a bright right half
+	gray := make([][]float64, 20)
+	for y := range gray {
+		gray[y] = make([]float64, 20)
+		for x := 10; x < 20; x++ {
+			gray[y][x] = 1
+		}
+	}
+
+	edges := cannyEdges(gray)
+	var onEdge, elsewhere int
+	for y := 2; y < 18; y++ {
+		for x := 0; x < 20; x++ {
+			if edges.GrayAt(x, y).Y == 0 {
+				continue
+			}
+			if x >= 8 && x <= 11 {
+				onEdge++
+			} else {
+				elsewhere++
+			}
+		}
+	}
+	if onEdge < 16 || elsewhere != 0 {
+		t.Errorf("Expected a thin vertical edge at the boundary, got %d edge and %d stray pixels", onEdge, elsewhere)
+	}
+
+	// Flat and degenerate inputs have no edges
+	flat := [][]float64{{0.5, 0.5, 0.5}, {0.5, 0.5, 0.5}, {0.5, 0.5, 0.5}}
+	for _, input := range [][][]float64{flat, {{1, 0}}, nil} {
+		for _, v := range cannyEdges(input).Pix {
+			if v != 0 {
+				t.Errorf("Expected no edges in %v", input)
+				break
+			}
+		}
+	}
+}
+
+func TestApplyStructureControl(t *testing.T) {
+	ctx := context.Background()
+	renderer := NewRenderer("", nil, testLogger{})
+	req := &RenderRequest{InputImage: testImageDataURI(t, testRoomImage()), Parameters: map[string]interface{}{}}
+
+	// Without structure control renders stay text-only
+	if _, _, ok, err := renderer.applyStructureControl(ctx, req, map[string]interface{}{}); ok || err != nil {
+		t.Fatalf("Expected no conditioning when disabled, got %v: %v", ok, err)
+	}
+
+	renderer.EnableStructureControl("controlnet:v1", 0, 0, fakeDepthEstimator{})
+	input := map[string]interface{}{}
+	model, metadata, ok, err := renderer.applyStructureControl(ctx, req, input)
+	if err != nil || !ok {
+		t.Fatalf("applyStructureControl failed: %v", err)
+	}
+	if model != "controlnet:v1" || metadata["control_model"] != "controlnet:v1" {
+		t.Errorf("Expected the ControlNet model, got %s", model)
+	}
+	if input["controlnet_conditioning_scale"] != defaultConditioningScale {
+		t.Errorf("Expected the default conditioning scale, got %v", input["controlnet_conditioning_scale"])
+	}
+	edges := decodeMask(t, input["image"].(string))
+	if edges.Bounds() != testRoomImage().Bounds() {
+		t.Errorf("Expected an edge map of the photo's size, got %v", edges.Bounds())
+	}
+	if depth, _ := input["depth_image"].(string); !strings.HasPrefix(depth, "data:image/png;base64,") {
+		t.Errorf("Expected a depth map, got %q", depth)
+	}
+
+	// The request may override the strength; a failed depth estimate keeps the edges
+	renderer.EnableStructureControl("controlnet:v1", 0.7, 0, fakeDepthEstimator{err: errors.New("no model")})
+	req.Parameters["conditioning_strength"] = 1.2
+	input = map[string]interface{}{}
+	if _, _, ok, err := renderer.applyStructureControl(ctx, req, input); !ok || err != nil {
+		t.Fatalf("applyStructureControl failed: %v", err)
+	}
+	if input["controlnet_conditioning_scale"] != 1.2 || input["depth_image"] != nil || input["image"] == nil {
+		t.Errorf("Expected edges only at strength 1.2, got %v", input)
+	}
+
+	// Without a depth estimator renders are conditioned on edges only
+	renderer.EnableStructureControl("controlnet:v1", 0, 0, nil)
+	input = map[string]interface{}{}
+	if _, _, ok, err := renderer.applyStructureControl(ctx, req, input); !ok || err != nil {
+		t.Fatalf("applyStructureControl failed: %v", err)
+	}
+	if input["depth_image"] != nil || input["image"] == nil {
+		t.Errorf("Expected edges only without a depth estimator, got %v", input)
+	}
+
+	// Photos on hosts that are not allowed are never fetched
+	req.InputImage = "https://169.254.169.254/latest/meta-data/"
+	if _, _, _, err := renderer.applyStructureControl(ctx, req, map[string]interface{}{}); !errors.Is(err, ErrImageSourceNotAllowed) {
+		t.Errorf("Expected ErrImageSourceNotAllowed, got %v", err)
+	}
+}
+
+func TestAllowImageURL(t *testing.T) {
+	renderer := NewRenderer("", nil, testLogger{})
+	renderer.SetImageHosts([]string{"uploads.example.com", "*.cdn.example.com"})
+
+	tests := map[string]bool{
+		"https://uploads.example.com/room.jpg":       true,
+		"https://eu.cdn.example.com/room.jpg":        true,
+		"https://UPLOADS.example.com/room.jpg":       true,
+		"http://uploads.example.com/room.jpg":        false,
+		"https://cdn.example.com/room.jpg":           false,
+		"https://uploads.example.com.evil.test/a":    false,
+		"https://localhost/room.jpg":                 false,
+		"file:///etc/passwd":                         false,
+		"https://10.0.0.5/room.jpg":                  false,
+		"https://uploads.example.com@evil.test/room": false,
+	}
+	for raw, allowed := range tests {
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatalf("invalid test URL %s: %v", raw, err)
+		}
+		if err := renderer.allowImageURL(u); (err == nil) != allowed {
+			t.Errorf("%s: expected allowed=%v, got %v", raw, allowed, err)
+		}
+	}
+}
+
+func TestPublicAddr(t *testing.T) {
+	tests := map[string]bool{
+		"93.184.216.34":   true,
+		"2606:4700::1111": true,
+		"127.0.0.1":       false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"0.0.0.0":         false,
+		"::1":             false,
+		"fe80::1":         false,
+		"fd00::1":         false,
+		"::ffff:10.0.0.1": false,
+	}
+	for addr, public := range tests {
+		if got := publicAddr(netip.MustParseAddr(addr)); got != public {
+			t.Errorf("%s: expected public=%v, got %v", addr, public, got)
+		}
+	}
+}
+
+func TestFetchImageRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("image"))
+	}))
+	defer server.Close()
+
+	// Even an allowed host is not contacted on a loopback address
+	renderer := NewRenderer("", nil, testLogger{})
+	renderer.SetImageHosts([]string{"127.0.0.1"})
+	if _, err := renderer.fetchImage(context.Background(), server.URL, 1<<20); !errors.Is(err, ErrImageSourceNotAllowed) {
+		t.Fatalf("Expected ErrImageSourceNotAllowed, got %v", err)
+	}
+
+	// With the address check out of the way the download and its size limit apply
+	renderer.imageClient = server.Client()
+	if data, err := renderer.fetchImage(context.Background(), server.URL, 1<<20); err != nil || string(data) != "image" {
+		t.Errorf("Expected the image, got %q: %v", data, err)
+	}
+	if _, err := renderer.fetchImage(context.Background(), server.URL, 3); err == nil {
+		t.Error("Expected an oversized image to be rejected")
+	}
+}
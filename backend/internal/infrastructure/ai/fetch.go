@@ -0,0 +1,125 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrImageSourceNotAllowed is returned for image URLs outside the blob store and
+// the allowed hosts
+var ErrImageSourceNotAllowed = errors.New("image source not allowed")
+
+// defaultImageHosts are the hosts user-supplied image URLs may point to when no
+// others are configured: the provider's output CDN
+var defaultImageHosts = []string{"replicate.delivery", "*.replicate.delivery"}
+
+// newImageClient returns the client for user-supplied image URLs. It refuses to
+// connect to private, loopback and link-local addresses after DNS resolution, so
+// an allowed host cannot be pointed at internal services.
+func newImageClient(allowed func(*url.URL) error) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("%w: %s", ErrImageSourceNotAllowed, address)
+			}
+			if !publicAddr(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s is not a public address", ErrImageSourceNotAllowed, addrPort.Addr())
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: 10 * time.Second},
+		// Redirects must stay on allowed hosts too
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			return allowed(req.URL)
+		},
+	}
+}
+
+// publicAddr reports whether an address is routable on the public internet
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() && addr.IsGlobalUnicast() && !addr.IsPrivate() &&
+		!addr.IsLoopback() && !addr.IsLinkLocalUnicast()
+}
+
+// SetImageHosts replaces the hosts user-supplied image URLs may be fetched from.
+// A leading "*." matches any subdomain. Images in the blob store and data URIs
+// are always accepted. It must be called before rendering.
+func (r *Renderer) SetImageHosts(hosts []string) {
+	r.imageHosts = hosts
+}
+
+// allowImageURL checks a user-supplied image URL against the allowed hosts
+func (r *Renderer) allowImageURL(u *url.URL) error {
+	if u.Scheme != "https" {
+		return fmt.Errorf("%w: only https URLs are fetched", ErrImageSourceNotAllowed)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, pattern := range r.imageHosts {
+		pattern = strings.ToLower(pattern)
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return nil
+			}
+		} else if host == pattern {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: host %s", ErrImageSourceNotAllowed, host)
+}
+
+// fetchImage downloads a user-supplied image URL, refusing hosts that are not
+// allowed and responses larger than limit bytes
+func (r *Renderer) fetchImage(ctx context.Context, rawURL string, limit int64) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrImageSourceNotAllowed, err)
+	}
+	if err := r.allowImageURL(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create image request: %w", err)
+	}
+
+	resp, err := r.imageClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download image: status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download image: %w", err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("image exceeds %d bytes", limit)
+	}
+
+	return data, nil
+}
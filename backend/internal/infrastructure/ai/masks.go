@@ -0,0 +1,486 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/compozit/vision/backend/internal/domain/entities"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxMaskWorkingDimension caps the resolution masks are computed at; the result
+	// is scaled back up to the base image size
+	maxMaskWorkingDimension = 1024
+
+	// Defaults used when a MaskSpec leaves the controls unset
+	defaultMaskTolerance = 0.15
+	defaultMaskDilate    = 8
+	defaultMaskFeather   = 6
+
+	// maxTapRegionCoverage rejects taps that flood into most of the image, such as a
+	// tap on a bare wall
+	maxTapRegionCoverage = 0.6
+)
+
+// Mask sources
+const (
+	MaskSourceFurniture = "furniture"
+	MaskSourceRectangle = "rectangle"
+	MaskSourcePoint     = "point"
+)
+
+var (
+	// ErrMaskRegionTooLarge is returned when a tapped region covers most of the image
+	ErrMaskRegionTooLarge = errors.New("tapped region covers too much of the image, use a placement rectangle instead")
+
+	// ErrSpaceAnalysesNotConfigured is returned for furniture references without a SpaceAnalysisSource
+	ErrSpaceAnalysesNotConfigured = errors.New("space analyses are not configured")
+)
+
+// SpaceAnalysisSource loads analysed room photos with their detected furniture.
+// repositories.SpaceAnalysisRepository satisfies it.
+type SpaceAnalysisSource interface {
+	GetSpaceAnalysisByID(ctx context.Context, id uuid.UUID) (*entities.SpaceAnalysis, error)
+}
+
+// MaskSpec describes an inpainting mask to generate instead of uploading one. Exactly
+// one region is used: detected furniture (by analysis reference or boxes), a placement
+// rectangle, or a tapped point that is grown into the surrounding region of similar
+// colour, bounded by edges. Coordinates are normalised to 0-1.
+type MaskSpec struct {
+	SpaceAnalysisID  string                 `json:"space_analysis_id,omitempty"`
+	FurnitureIndexes []int                  `json:"furniture_indexes,omitempty"` // into SpaceAnalysis.ExistingFurniture
+	Boxes            []entities.BoundingBox `json:"boxes,omitempty"`
+	Rectangle        *entities.BoundingBox  `json:"rectangle,omitempty"`
+	Point            *entities.Point2D      `json:"point,omitempty"`
+
+	Tolerance float64 `json:"tolerance,omitempty"` // colour distance for region growing, 0-1
+	Dilate    *int    `json:"dilate,omitempty"`    // pixels the mask is grown by
+	Feather   *int    `json:"feather,omitempty"`   // pixels of soft edge
+}
+
+// Mask is a generated inpainting mask. White marks the area to repaint.
+type Mask struct {
+	DataURI   string                       `json:"mask_image"`
+	BaseImage string                       `json:"base_image"`
+	Source    string                       `json:"source"`
+	Coverage  float64                      `json:"coverage"` // fraction of the image repainted
+	Width     int                          `json:"width"`
+	Height    int                          `json:"height"`
+	Furniture []entities.DetectedFurniture `json:"furniture,omitempty"` // referenced items
+}
+
+// Validate checks that the spec selects exactly one kind of region with valid coordinates
+func (s *MaskSpec) Validate() error {
+	sources := 0
+	if s.SpaceAnalysisID != "" || len(s.Boxes) > 0 {
+		sources++
+	}
+	if s.Rectangle != nil {
+		sources++
+	}
+	if s.Point != nil {
+		sources++
+	}
+	if sources != 1 {
+		return fmt.Errorf("mask needs exactly one of furniture, rectangle or point")
+	}
+
+	if s.SpaceAnalysisID != "" && len(s.FurnitureIndexes) == 0 {
+		return fmt.Errorf("furniture_indexes are required with space_analysis_id")
+	}
+	if len(s.FurnitureIndexes) > 0 && s.SpaceAnalysisID == "" {
+		return fmt.Errorf("space_analysis_id is required with furniture_indexes")
+	}
+
+	for _, box := range s.Boxes {
+		if err := validateMaskBox(box); err != nil {
+			return err
+		}
+	}
+	if s.Rectangle != nil {
+		if err := validateMaskBox(*s.Rectangle); err != nil {
+			return err
+		}
+	}
+	if s.Point != nil && (s.Point.X < 0 || s.Point.X > 1 || s.Point.Y < 0 || s.Point.Y > 1) {
+		return fmt.Errorf("point must be normalised to 0-1")
+	}
+
+	if s.Tolerance < 0 || s.Tolerance > 1 {
+		return fmt.Errorf("tolerance must be between 0 and 1")
+	}
+	if (s.Dilate != nil && *s.Dilate < 0) || (s.Feather != nil && *s.Feather < 0) {
+		return fmt.Errorf("dilate and feather must not be negative")
+	}
+
+	return nil
+}
+
+func validateMaskBox(box entities.BoundingBox) error {
+	if box.Width <= 0 || box.Height <= 0 || box.X < 0 || box.Y < 0 || box.X+box.Width > 1.0001 || box.Y+box.Height > 1.0001 {
+		return fmt.Errorf("boxes must be normalised to 0-1 with a positive size")
+	}
+	return nil
+}
+
+// SetSpaceAnalysisSource lets masks reference furniture detected by space analysis
+func (r *Renderer) SetSpaceAnalysisSource(source SpaceAnalysisSource) {
+	r.analyses = source
+}
+
+// GenerateMask builds an inpainting mask for baseImage, a URL or data URI. For
+// furniture references baseImage may be empty; the analysed photo is used.
+func (r *Renderer) GenerateMask(ctx context.Context, baseImage string, spec *MaskSpec) (*Mask, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+
+	mask := &Mask{BaseImage: baseImage}
+	boxes := spec.Boxes
+
+	if spec.SpaceAnalysisID != "" {
+		analysis, err := r.loadSpaceAnalysis(ctx, spec.SpaceAnalysisID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, index := range spec.FurnitureIndexes {
+			if index < 0 || index >= len(analysis.ExistingFurniture) {
+				return nil, fmt.Errorf("space analysis has no furniture item %d", index)
+			}
+			item := analysis.ExistingFurniture[index]
+			mask.Furniture = append(mask.Furniture, item)
+			boxes = append(boxes, item.BoundingBox)
+		}
+
+		if mask.BaseImage == "" {
+			mask.BaseImage = analysis.ImageURL
+		}
+	}
+
+	if mask.BaseImage == "" {
+		return nil, fmt.Errorf("base image is required")
+	}
+
+	img, err := r.loadInputImage(ctx, mask.BaseImage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load base image: %w", err)
+	}
+
+	bounds := img.Bounds()
+	work := downscale(img, maxMaskWorkingDimension)
+	scale := float64(work.Bounds().Dx()) / float64(bounds.Dx())
+
+	var region *image.Gray
+	switch {
+	case len(boxes) > 0:
+		mask.Source = MaskSourceFurniture
+		region = rasterizeBoxes(work.Bounds().Dx(), work.Bounds().Dy(), boxes)
+	case spec.Rectangle != nil:
+		mask.Source = MaskSourceRectangle
+		region = rasterizeBoxes(work.Bounds().Dx(), work.Bounds().Dy(), []entities.BoundingBox{*spec.Rectangle})
+	default:
+		mask.Source = MaskSourcePoint
+		tolerance := spec.Tolerance
+		if tolerance == 0 {
+			tolerance = defaultMaskTolerance
+		}
+		region = growRegion(work, *spec.Point, tolerance)
+		if maskCoverage(region) > maxTapRegionCoverage {
+			return nil, ErrMaskRegionTooLarge
+		}
+	}
+
+	dilate, feather := defaultMaskDilate, defaultMaskFeather
+	if spec.Dilate != nil {
+		dilate = *spec.Dilate
+	}
+	if spec.Feather != nil {
+		feather = *spec.Feather
+	}
+
+	// Controls are given in base image pixels
+	region = dilateMask(region, int(math.Round(float64(dilate)*scale)))
+	region = featherMask(region, int(math.Round(float64(feather)*scale)))
+
+	mask.Coverage = maskCoverage(region)
+	mask.Width, mask.Height = bounds.Dx(), bounds.Dy()
+
+	if mask.DataURI, err = encodePNGDataURI(resizeGray(region, bounds.Dx(), bounds.Dy())); err != nil {
+		return nil, err
+	}
+
+	return mask, nil
+}
+
+// prepareInpaintingMask generates the request's mask from its MaskSpec when no mask
+// image was uploaded, filling in the base image and furniture type from a furniture
+// reference. It returns metadata describing the generated mask.
+func (r *Renderer) prepareInpaintingMask(ctx context.Context, req *InpaintingRequest) (map[string]interface{}, error) {
+	if req.MaskImage != "" || req.MaskSpec == nil {
+		return nil, nil
+	}
+
+	mask, err := r.GenerateMask(ctx, req.BaseImage, req.MaskSpec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate inpainting mask: %w", err)
+	}
+
+	req.BaseImage = mask.BaseImage
+	req.MaskImage = mask.DataURI
+	if req.FurnitureType == "" && len(mask.Furniture) == 1 {
+		req.FurnitureType = mask.Furniture[0].Category
+	}
+
+	return map[string]interface{}{
+		"source":   mask.Source,
+		"coverage": mask.Coverage,
+	}, nil
+}
+
+// loadSpaceAnalysis loads a space analysis by ID
+func (r *Renderer) loadSpaceAnalysis(ctx context.Context, id string) (*entities.SpaceAnalysis, error) {
+	if r.analyses == nil {
+		return nil, ErrSpaceAnalysesNotConfigured
+	}
+
+	analysisID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid space analysis ID: %w", err)
+	}
+
+	analysis, err := r.analyses.GetSpaceAnalysisByID(ctx, analysisID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load space analysis: %w", err)
+	}
+
+	return analysis, nil
+}
+
+// rasterizeBoxes fills normalised boxes into a w x h mask
+func rasterizeBoxes(w, h int, boxes []entities.BoundingBox) *image.Gray {
+	mask := image.NewGray(image.Rect(0, 0, w, h))
+
+	for _, box := range boxes {
+		// The epsilon keeps float error in normalised sums such as 0.2+0.4 from
+		// adding a stray row or column
+		x0 := clampInt(int(math.Floor(box.X*float64(w)+1e-9)), 0, w)
+		y0 := clampInt(int(math.Floor(box.Y*float64(h)+1e-9)), 0, h)
+		x1 := clampInt(int(math.Ceil((box.X+box.Width)*float64(w)-1e-9)), 0, w)
+		y1 := clampInt(int(math.Ceil((box.Y+box.Height)*float64(h)-1e-9)), 0, h)
+
+		for y := y0; y < y1; y++ {
+			row := mask.Pix[y*mask.Stride : y*mask.Stride+w]
+			for x := x0; x < x1; x++ {
+				row[x] = 255
+			}
+		}
+	}
+
+	return mask
+}
+
+// growRegion flood-fills from a normalised seed point through pixels whose colour is
+// within tolerance of the seed colour. Canny edges are included but not crossed, so
+// the region stops at object outlines even where colours are similar.
+func growRegion(img image.Image, seed entities.Point2D, tolerance float64) *image.Gray {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	mask := image.NewGray(image.Rect(0, 0, w, h))
+	if w == 0 || h == 0 {
+		return mask
+	}
+
+	colors := make([][3]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			colors[y*w+x] = [3]float64{float64(r) / 65535, float64(g) / 65535, float64(b) / 65535}
+		}
+	}
+	edges := cannyEdges(toGray(img))
+
+	sx := clampInt(int(seed.X*float64(w)), 0, w-1)
+	sy := clampInt(int(seed.Y*float64(h)), 0, h-1)
+
+	// Compare against the average around the seed so a noisy tapped pixel does not skew the fill
+	var target [3]float64
+	samples := 0.0
+	for y := sy - 1; y <= sy+1; y++ {
+		for x := sx - 1; x <= sx+1; x++ {
+			if x < 0 || y < 0 || x >= w || y >= h {
+				continue
+			}
+			for c := 0; c < 3; c++ {
+				target[c] += colors[y*w+x][c]
+			}
+			samples++
+		}
+	}
+	for c := range target {
+		target[c] /= samples
+	}
+
+	// Distances are normalised so 1 spans black to white
+	limit := tolerance * math.Sqrt(3)
+	queue := []int{sy*w + sx}
+	mask.Pix[sy*mask.Stride+sx] = 255
+
+	for len(queue) > 0 {
+		p := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		x, y := p%w, p/w
+
+		if p != sy*w+sx && edges.Pix[y*edges.Stride+x] != 0 {
+			continue
+		}
+
+		for _, n := range [4][2]int{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+			nx, ny := n[0], n[1]
+			if nx < 0 || ny < 0 || nx >= w || ny >= h || mask.Pix[ny*mask.Stride+nx] != 0 {
+				continue
+			}
+
+			c := colors[ny*w+nx]
+			dr, dg, db := c[0]-target[0], c[1]-target[1], c[2]-target[2]
+			if math.Sqrt(dr*dr+dg*dg+db*db) > limit {
+				continue
+			}
+
+			mask.Pix[ny*mask.Stride+nx] = 255
+			queue = append(queue, ny*w+nx)
+		}
+	}
+
+	return mask
+}
+
+// dilateMask grows the mask by radius pixels with a square structuring element,
+// applied as separable horizontal and vertical maximum filters
+func dilateMask(mask *image.Gray, radius int) *image.Gray {
+	if radius <= 0 {
+		return mask
+	}
+	return separableFilter(mask, radius, func(values []uint8, i, radius int) uint8 {
+		peak := uint8(0)
+		for j := i - radius; j <= i+radius; j++ {
+			if j >= 0 && j < len(values) && values[j] > peak {
+				peak = values[j]
+			}
+		}
+		return peak
+	})
+}
+
+// featherMask softens the mask edge over about radius pixels with two box blur
+// passes, which approximate a Gaussian
+func featherMask(mask *image.Gray, radius int) *image.Gray {
+	if radius <= 0 {
+		return mask
+	}
+
+	half := (radius + 1) / 2
+	blur := func(values []uint8, i, radius int) uint8 {
+		sum, n := 0, 0
+		for j := i - radius; j <= i+radius; j++ {
+			if j >= 0 && j < len(values) {
+				sum += int(values[j])
+				n++
+			}
+		}
+		return uint8((sum + n/2) / n)
+	}
+
+	return separableFilter(separableFilter(mask, half, blur), half, blur)
+}
+
+// separableFilter applies a 1D filter along rows and then along columns
+func separableFilter(mask *image.Gray, radius int, filter func(values []uint8, i, radius int) uint8) *image.Gray {
+	w, h := mask.Rect.Dx(), mask.Rect.Dy()
+	horizontal := image.NewGray(image.Rect(0, 0, w, h))
+	out := image.NewGray(image.Rect(0, 0, w, h))
+
+	row := make([]uint8, w)
+	for y := 0; y < h; y++ {
+		copy(row, mask.Pix[y*mask.Stride:y*mask.Stride+w])
+		for x := 0; x < w; x++ {
+			horizontal.Pix[y*horizontal.Stride+x] = filter(row, x, radius)
+		}
+	}
+
+	column := make([]uint8, h)
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			column[y] = horizontal.Pix[y*horizontal.Stride+x]
+		}
+		for y := 0; y < h; y++ {
+			out.Pix[y*out.Stride+x] = filter(column, y, radius)
+		}
+	}
+
+	return out
+}
+
+// resizeGray scales a mask to w x h with bilinear interpolation, keeping feathered edges smooth
+func resizeGray(src *image.Gray, w, h int) *image.Gray {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	if sw == w && sh == h {
+		return src
+	}
+
+	out := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		fy := math.Max(0, (float64(y)+0.5)*float64(sh)/float64(h)-0.5)
+		y0 := clampInt(int(fy), 0, sh-1)
+		y1 := clampInt(y0+1, 0, sh-1)
+		ty := fy - float64(y0)
+
+		for x := 0; x < w; x++ {
+			fx := math.Max(0, (float64(x)+0.5)*float64(sw)/float64(w)-0.5)
+			x0 := clampInt(int(fx), 0, sw-1)
+			x1 := clampInt(x0+1, 0, sw-1)
+			tx := fx - float64(x0)
+
+			top := float64(src.GrayAt(x0, y0).Y)*(1-tx) + float64(src.GrayAt(x1, y0).Y)*tx
+			bottom := float64(src.GrayAt(x0, y1).Y)*(1-tx) + float64(src.GrayAt(x1, y1).Y)*tx
+			out.SetGray(x, y, color.Gray{Y: uint8(math.Round(top*(1-ty) + bottom*ty))})
+		}
+	}
+
+	return out
+}
+
+// maskCoverage returns the fraction of mask pixels that are mostly white
+func maskCoverage(mask *image.Gray) float64 {
+	w, h := mask.Rect.Dx(), mask.Rect.Dy()
+	if w == 0 || h == 0 {
+		return 0
+	}
+
+	covered := 0
+	for y := 0; y < h; y++ {
+		for _, v := range mask.Pix[y*mask.Stride : y*mask.Stride+w] {
+			if v >= 128 {
+				covered++
+			}
+		}
+	}
+
+	return float64(covered) / float64(w*h)
+}
+
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
@@ -0,0 +1,208 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/compozit/vision/backend/internal/domain/entities"
+	"github.com/google/uuid"
+)
+
+type fakeSpaceAnalyses map[uuid.UUID]*entities.SpaceAnalysis
+
+func (f fakeSpaceAnalyses) GetSpaceAnalysisByID(ctx context.Context, id uuid.UUID) (*entities.SpaceAnalysis, error) {
+	if analysis, ok := f[id]; ok {
+		return analysis, nil
+	}
+	return nil, errors.New("space analysis not found")
+}
+
+// testRoomImage is a white 100x80 image with a red 40x20 "sofa" at (20, 40)
+func testRoomImage() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 80))
+	for y := 0; y < 80; y++ {
+		for x := 0; x < 100; x++ {
+			c := color.RGBA{240, 240, 240, 255}
+			if x >= 20 && x < 60 && y >= 40 && y < 60 {
+				c = color.RGBA{200, 30, 30, 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func testImageDataURI(t *testing.T, img image.Image) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func decodeMask(t *testing.T, dataURI string) *image.Gray {
+	t.Helper()
+	_, encoded, _ := strings.Cut(dataURI, ",")
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gray, ok := img.(*image.Gray)
+	if !ok {
+		t.Fatalf("Expected a grayscale mask, got %T", img)
+	}
+	return gray
+}
+
+func intPtr(v int) *int { return &v }
+
+func TestRasterizeBoxes(t *testing.T) {
+	mask := rasterizeBoxes(100, 80, []entities.BoundingBox{{X: 0.2, Y: 0.5, Width: 0.4, Height: 0.25}})
+
+	if got := maskCoverage(mask); math.Abs(got-0.1) > 0.001 {
+		t.Errorf("Expected 10%% coverage, got %.3f", got)
+	}
+	if mask.GrayAt(20, 40).Y != 255 || mask.GrayAt(19, 40).Y != 0 || mask.GrayAt(60, 40).Y != 0 {
+		t.Error("Expected box edges to be rasterized exactly")
+	}
+}
+
+func TestGrowRegionStopsAtObjectBoundary(t *testing.T) {
+	mask := growRegion(testRoomImage(), entities.Point2D{X: 0.4, Y: 0.6}, defaultMaskTolerance)
+
+	// The fill covers the sofa (800 pixels) and its outline, not the background
+	coverage := maskCoverage(mask)
+	if coverage < 0.09 || coverage > 0.13 {
+		t.Errorf("Expected the tapped object to be selected, got coverage %.3f", coverage)
+	}
+	if mask.GrayAt(40, 50).Y != 255 {
+		t.Error("Expected the tapped object to be inside the mask")
+	}
+	if mask.GrayAt(5, 5).Y != 0 {
+		t.Error("Expected the background to stay outside the mask")
+	}
+}
+
+func TestDilateAndFeatherMask(t *testing.T) {
+	mask := rasterizeBoxes(100, 80, []entities.BoundingBox{{X: 0.2, Y: 0.5, Width: 0.4, Height: 0.25}})
+
+	dilated := dilateMask(mask, 3)
+	if dilated.GrayAt(17, 37).Y != 255 || dilated.GrayAt(16, 40).Y != 0 {
+		t.Error("Expected dilation to grow the mask by exactly the radius")
+	}
+
+	feathered := featherMask(dilated, 4)
+	edge := feathered.GrayAt(17, 50).Y
+	if edge == 0 || edge == 255 {
+		t.Errorf("Expected a soft value at the mask edge, got %d", edge)
+	}
+	if feathered.GrayAt(40, 50).Y != 255 {
+		t.Error("Expected the mask interior to stay fully masked")
+	}
+}
+
+func TestMaskSpecValidate(t *testing.T) {
+	valid := []MaskSpec{
+		{Rectangle: &entities.BoundingBox{X: 0.1, Y: 0.1, Width: 0.5, Height: 0.5}},
+		{Point: &entities.Point2D{X: 0.5, Y: 0.5}, Tolerance: 0.2},
+		{SpaceAnalysisID: uuid.NewString(), FurnitureIndexes: []int{0}},
+	}
+	for _, spec := range valid {
+		if err := spec.Validate(); err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", spec, err)
+		}
+	}
+
+	invalid := []MaskSpec{
+		{},
+		{Rectangle: &entities.BoundingBox{Width: 1, Height: 1}, Point: &entities.Point2D{}},
+		{Rectangle: &entities.BoundingBox{X: 0.8, Width: 0.5, Height: 0.5}},
+		{Point: &entities.Point2D{X: 2}},
+		{SpaceAnalysisID: uuid.NewString()},
+		{Point: &entities.Point2D{}, Dilate: intPtr(-1)},
+	}
+	for _, spec := range invalid {
+		if err := spec.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", spec)
+		}
+	}
+}
+
+func TestGenerateMaskFromFurnitureReference(t *testing.T) {
+	analysisID := uuid.New()
+	imageURI := testImageDataURI(t, testRoomImage())
+
+	renderer := NewRenderer("", nil, testLogger{})
+	renderer.SetSpaceAnalysisSource(fakeSpaceAnalyses{
+		analysisID: {
+			ID:       analysisID,
+			ImageURL: imageURI,
+			ExistingFurniture: []entities.DetectedFurniture{
+				{Category: "sofa", BoundingBox: entities.BoundingBox{X: 0.2, Y: 0.5, Width: 0.4, Height: 0.25}},
+			},
+		},
+	})
+
+	req := &InpaintingRequest{
+		MaskSpec: &MaskSpec{
+			SpaceAnalysisID:  analysisID.String(),
+			FurnitureIndexes: []int{0},
+			Dilate:           intPtr(0),
+			Feather:          intPtr(0),
+		},
+	}
+
+	metadata, err := renderer.prepareInpaintingMask(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if req.BaseImage != imageURI {
+		t.Error("Expected the analysed photo to be used as the base image")
+	}
+	if req.FurnitureType != "sofa" {
+		t.Errorf("Expected furniture type from the detected item, got %q", req.FurnitureType)
+	}
+	if metadata["source"] != MaskSourceFurniture {
+		t.Errorf("Expected furniture mask source, got %v", metadata["source"])
+	}
+
+	mask := decodeMask(t, req.MaskImage)
+	if mask.Bounds().Dx() != 100 || mask.Bounds().Dy() != 80 {
+		t.Errorf("Expected mask to match the base image size, got %v", mask.Bounds())
+	}
+	if mask.GrayAt(30, 45).Y != 255 || mask.GrayAt(5, 5).Y != 0 {
+		t.Error("Expected the mask to cover the referenced furniture only")
+	}
+
+	// An uploaded mask is used as is
+	uploaded := &InpaintingRequest{MaskImage: "data:image/png;base64,AAAA", MaskSpec: req.MaskSpec}
+	if metadata, err := renderer.prepareInpaintingMask(context.Background(), uploaded); err != nil || metadata != nil {
+		t.Errorf("Expected uploaded mask to be kept, got %v %v", metadata, err)
+	}
+}
+
+func TestGenerateMaskRejectsOversizedTap(t *testing.T) {
+	renderer := NewRenderer("", nil, testLogger{})
+
+	// Tapping the plain background floods most of the image
+	_, err := renderer.GenerateMask(context.Background(), testImageDataURI(t, testRoomImage()), &MaskSpec{
+		Point: &entities.Point2D{X: 0.05, Y: 0.05},
+	})
+	if !errors.Is(err, ErrMaskRegionTooLarge) {
+		t.Fatalf("Expected ErrMaskRegionTooLarge, got %v", err)
+	}
+}
@@ -8,9 +8,11 @@ import (
 type RenderType string
 
 const (
-	RenderTypeQuick    RenderType = "quick"
-	RenderTypeDetailed RenderType = "detailed"
-	RenderTypeStyle    RenderType = "style"
+	RenderTypeQuick      RenderType = "quick"
+	RenderTypeDetailed   RenderType = "detailed"
+	RenderTypeStyle      RenderType = "style"
+	RenderTypeInpainting RenderType = "inpainting"
+	RenderTypeUpscale    RenderType = "upscale"
 )
 
 // StyleType represents different design styles
@@ -37,6 +39,10 @@ type RenderRequest struct {
 	Style       StyleType              `json:"style,omitempty"`
 	Prompt      string                 `json:"prompt"`
 	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+	Variants    int                    `json:"variants,omitempty"` // 1-8, defaults to 1
+	Seed        *int64                 `json:"seed,omitempty"`     // random when nil
+	CustomStyle *StyleSelection        `json:"custom_style,omitempty"` // curated style, overrides Style
+	OnProgress  ProgressFunc           `json:"-"`                      // receives progress while the render runs
 	CreatedAt   time.Time              `json:"created_at"`
 }
 
@@ -46,6 +52,11 @@ type RenderResult struct {
 	RequestID      string                 `json:"request_id"`
 	Status         string                 `json:"status"`
 	ResultImageURL string                 `json:"result_image_url,omitempty"`
+	ThumbnailURL   string                 `json:"thumbnail_url,omitempty"`
+	ImageHash      string                 `json:"image_hash,omitempty"` // set once the image is in durable storage
+	Seed           int64                  `json:"seed"`
+	Variants       []RenderVariant        `json:"variants,omitempty"`
+	Derived        []DerivedAsset         `json:"derived,omitempty"` // upscales and other assets made from this render
 	Progress       int                    `json:"progress"`
 	Error          string                 `json:"error,omitempty"`
 	Metadata       map[string]interface{} `json:"metadata,omitempty"`
@@ -54,11 +65,28 @@ type RenderResult struct {
 	CompletedAt    *time.Time             `json:"completed_at,omitempty"`
 }
 
+// RenderVariant represents one seeded image produced by a render request
+type RenderVariant struct {
+	Index        int                    `json:"index"`
+	Seed         int64                  `json:"seed"`
+	PredictionID string                 `json:"prediction_id"`
+	ImageURL     string                 `json:"image_url"`
+	ThumbnailURL string                 `json:"thumbnail_url,omitempty"`
+	ImageHash    string                 `json:"image_hash,omitempty"`
+	Parameters   map[string]interface{} `json:"parameters,omitempty"`
+}
+
 // InpaintingRequest represents a request for AI inpainting
 type InpaintingRequest struct {
+	UserID         string    `json:"user_id,omitempty"`
+	ProjectID      string    `json:"project_id,omitempty"`
 	BaseImage      string    `json:"base_image"`
 	MaskImage      string    `json:"mask_image"`
+	MaskSpec       *MaskSpec `json:"mask_spec,omitempty"` // generates MaskImage when no mask is uploaded
 	Prompt         string    `json:"prompt"`
+	FurnitureType  string    `json:"furniture_type,omitempty"` // builds the prompt from the inpainting template
+	Style          StyleType `json:"style,omitempty"`
+	CustomStyle    *StyleSelection `json:"custom_style,omitempty"` // curated style, overrides Style
 	NegativePrompt string    `json:"negative_prompt,omitempty"`
 	Strength       float32   `json:"strength"`
 	GuidanceScale  float32   `json:"guidance_scale"`
@@ -67,9 +95,12 @@ type InpaintingRequest struct {
 
 // StyleTransferRequest represents a style transfer request
 type StyleTransferRequest struct {
+	UserID       string    `json:"user_id,omitempty"`
+	ProjectID    string    `json:"project_id,omitempty"`
 	ContentImage string    `json:"content_image"`
 	StyleImage   string    `json:"style_image,omitempty"`
 	Style        StyleType `json:"style"`
+	CustomStyle  *StyleSelection `json:"custom_style,omitempty"` // curated style, overrides Style
 	Strength     float32   `json:"strength"`
 }
 
@@ -82,4 +113,5 @@ type PromptComponents struct {
 	ColorScheme     []string `json:"color_scheme"`
 	Lighting        string   `json:"lighting"`
 	Additional      []string `json:"additional"`
+	CustomStyle     *StyleSelection `json:"custom_style,omitempty"`
 }
\ No newline at end of file
@@ -0,0 +1,440 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/compozit/vision/backend/pkg/logger"
+)
+
+const (
+	// defaultMaxModeratedText bounds user-supplied text sent to the provider, in runes
+	defaultMaxModeratedText = 1000
+
+	// maxPromptValueLength bounds a single value interpolated into a prompt template
+	maxPromptValueLength = 200
+
+	// moderationExcerptLength is how much of a rejected text is logged for review
+	moderationExcerptLength = 120
+)
+
+// ModerationReason is the code recorded when moderation rejects an input
+type ModerationReason string
+
+const (
+	ModerationBlockedTerm  ModerationReason = "blocked_term"
+	ModerationPatternMatch ModerationReason = "pattern_match"
+	ModerationTextTooLong  ModerationReason = "text_too_long"
+	ModerationImageFlagged ModerationReason = "image_flagged"
+)
+
+// defaultBlocklist holds terms the provider's terms of use rule out for interior renders
+var defaultBlocklist = []string{
+	"nude", "nudity", "naked", "nsfw", "porn", "pornographic", "erotic", "topless",
+	"genitals", "sexual", "gore", "gory", "decapitated", "dismembered", "mutilated",
+	"corpse", "swastika", "child abuse",
+}
+
+// ModerationError is returned when user input is rejected before a provider call.
+// Rejections are permanent: retrying the same input cannot succeed.
+type ModerationError struct {
+	Field  string           `json:"field"`
+	Reason ModerationReason `json:"reason"`
+	Rule   string           `json:"-"` // matched term or rule name, logged for review only
+}
+
+func (e *ModerationError) Error() string {
+	return fmt.Sprintf("%s rejected by content moderation: %s", e.Field, e.Reason)
+}
+
+// ModerationRule rejects text matching a regular expression
+type ModerationRule struct {
+	Name    string           `json:"name"`
+	Pattern string           `json:"pattern"`
+	Reason  ModerationReason `json:"reason,omitempty"` // defaults to pattern_match
+
+	re *regexp.Regexp
+}
+
+// ModerationConfig configures the text checks of a Moderator
+type ModerationConfig struct {
+	Blocklist     []string         `json:"blocklist"` // whole words or phrases, case-insensitive
+	Rules         []ModerationRule `json:"rules"`
+	MaxTextLength int              `json:"max_text_length,omitempty"`
+}
+
+// DefaultModerationConfig returns the built-in blocklist
+func DefaultModerationConfig() ModerationConfig {
+	return ModerationConfig{
+		Blocklist:     append([]string(nil), defaultBlocklist...),
+		MaxTextLength: defaultMaxModeratedText,
+	}
+}
+
+// LoadModerationConfig reads blocklist terms and rules from a JSON file and adds
+// them to the defaults
+func LoadModerationConfig(path string) (ModerationConfig, error) {
+	config := DefaultModerationConfig()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to read moderation rules: %w", err)
+	}
+
+	var file ModerationConfig
+	if err := json.Unmarshal(data, &file); err != nil {
+		return config, fmt.Errorf("invalid moderation rules %s: %w", path, err)
+	}
+
+	config.Blocklist = append(config.Blocklist, file.Blocklist...)
+	config.Rules = append(config.Rules, file.Rules...)
+	if file.MaxTextLength > 0 {
+		config.MaxTextLength = file.MaxTextLength
+	}
+	return config, nil
+}
+
+// ImageVerdict is an ImageClassifier's assessment of an input image
+type ImageVerdict struct {
+	Flagged  bool    `json:"flagged"`
+	Category string  `json:"category,omitempty"`
+	Score    float64 `json:"score,omitempty"`
+}
+
+// ImageClassifier checks uploaded images before they are sent to the provider
+type ImageClassifier interface {
+	ClassifyImage(ctx context.Context, data []byte) (*ImageVerdict, error)
+}
+
+// NoopImageClassifier allows every image
+type NoopImageClassifier struct{}
+
+// ClassifyImage implements ImageClassifier
+func (NoopImageClassifier) ClassifyImage(ctx context.Context, data []byte) (*ImageVerdict, error) {
+	return &ImageVerdict{}, nil
+}
+
+// Moderator checks user-supplied text against a blocklist and rules, and images
+// with an ImageClassifier
+type Moderator struct {
+	blocklist     *regexp.Regexp
+	rules         []ModerationRule
+	maxTextLength int
+	classifier    ImageClassifier
+}
+
+// NewModerator compiles the configured blocklist and rules. A nil classifier
+// allows every image.
+func NewModerator(config ModerationConfig, classifier ImageClassifier) (*Moderator, error) {
+	m := &Moderator{
+		maxTextLength: config.MaxTextLength,
+		classifier:    classifier,
+	}
+	if m.maxTextLength <= 0 {
+		m.maxTextLength = defaultMaxModeratedText
+	}
+	if m.classifier == nil {
+		m.classifier = NoopImageClassifier{}
+	}
+
+	terms := make([]string, 0, len(config.Blocklist))
+	for _, term := range config.Blocklist {
+		if term = strings.TrimSpace(term); term != "" {
+			// Phrases match across any run of whitespace
+			terms = append(terms, strings.Join(strings.Fields(regexp.QuoteMeta(strings.ToLower(term))), `\s+`))
+		}
+	}
+	if len(terms) > 0 {
+		m.blocklist = regexp.MustCompile(`(?i)\b(` + strings.Join(terms, "|") + `)\b`)
+	}
+
+	for _, rule := range config.Rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid moderation rule %q: %w", rule.Name, err)
+		}
+		rule.re = re
+		if rule.Reason == "" {
+			rule.Reason = ModerationPatternMatch
+		}
+		m.rules = append(m.rules, rule)
+	}
+
+	return m, nil
+}
+
+// CheckText returns a *ModerationError when text is too long, contains a
+// blocklisted term or matches a rule
+func (m *Moderator) CheckText(field, text string) error {
+	if text == "" {
+		return nil
+	}
+	if utf8.RuneCountInString(text) > m.maxTextLength {
+		return &ModerationError{Field: field, Reason: ModerationTextTooLong}
+	}
+
+	if m.blocklist != nil {
+		if match := m.blocklist.FindString(text); match != "" {
+			return &ModerationError{Field: field, Reason: ModerationBlockedTerm, Rule: strings.ToLower(match)}
+		}
+	}
+	for _, rule := range m.rules {
+		if rule.re.MatchString(text) {
+			return &ModerationError{Field: field, Reason: rule.Reason, Rule: rule.Name}
+		}
+	}
+	return nil
+}
+
+// CheckImage returns a *ModerationError when the classifier flags the image
+func (m *Moderator) CheckImage(ctx context.Context, field string, data []byte) error {
+	verdict, err := m.classifier.ClassifyImage(ctx, data)
+	if err != nil {
+		return fmt.Errorf("failed to classify %s: %w", field, err)
+	}
+	if verdict != nil && verdict.Flagged {
+		return &ModerationError{Field: field, Reason: ModerationImageFlagged, Rule: verdict.Category}
+	}
+	return nil
+}
+
+// classifiesImages reports whether images need to be loaded for CheckImage
+func (m *Moderator) classifiesImages() bool {
+	_, noop := m.classifier.(NoopImageClassifier)
+	return !noop
+}
+
+// SetModerator replaces the moderation applied to user input before provider calls
+func (r *Renderer) SetModerator(moderator *Moderator) {
+	r.moderator = moderator
+}
+
+// ModerateText checks user-supplied text fields without rendering, so requests
+// can be rejected before credits are reserved
+func (r *Renderer) ModerateText(userID string, texts map[string]string) error {
+	return r.moderateInputs(context.Background(), userID, texts, nil)
+}
+
+// moderateInputs checks text fields, then images, in field name order. Rejections
+// are logged for review.
+func (r *Renderer) moderateInputs(ctx context.Context, userID string, texts, images map[string]string) error {
+	if r.moderator == nil {
+		return nil
+	}
+
+	for _, field := range sortedKeys(texts) {
+		if err := r.moderator.CheckText(field, texts[field]); err != nil {
+			r.logModerationRejection(userID, err, texts[field])
+			return err
+		}
+	}
+
+	if !r.moderator.classifiesImages() {
+		return nil
+	}
+	for _, field := range sortedKeys(images) {
+		if images[field] == "" {
+			continue
+		}
+		data, err := r.loadRenderImage(ctx, images[field])
+		if err != nil {
+			return fmt.Errorf("failed to load %s for moderation: %w", field, err)
+		}
+		if err := r.moderator.CheckImage(ctx, field, data); err != nil {
+			r.logModerationRejection(userID, err, "")
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Renderer) logModerationRejection(userID string, err error, text string) {
+	modErr, ok := err.(*ModerationError)
+	if !ok {
+		return
+	}
+
+	excerpt := text
+	if utf8.RuneCountInString(excerpt) > moderationExcerptLength {
+		excerpt = string([]rune(excerpt)[:moderationExcerptLength]) + "..."
+	}
+	r.logger.Warn("Content moderation rejected input",
+		"user_id", userID,
+		"field", modErr.Field,
+		"reason", modErr.Reason,
+		"rule", modErr.Rule,
+		"excerpt", excerpt)
+}
+
+// moderateRender checks a room render's text and input photo, and strips prompt
+// injection from the parameters interpolated into prompt templates
+func (r *Renderer) moderateRender(ctx context.Context, req *RenderRequest) error {
+	texts := map[string]string{
+		"prompt": req.Prompt,
+		"style":  string(req.Style),
+	}
+	for _, key := range promptParameterKeys {
+		texts[key] = parameterText(req.Parameters[key])
+	}
+	if err := r.moderateInputs(ctx, req.UserID, texts, map[string]string{"input_image": req.InputImage}); err != nil {
+		return err
+	}
+
+	req.Style = StyleType(sanitizePromptValue(string(req.Style)))
+	req.Parameters = sanitizePromptParameters(r.logger, req.Parameters)
+	return nil
+}
+
+// moderateInpainting checks an inpainting request; the prompt is only sanitized
+// when it is interpolated into the inpainting template as context
+func (r *Renderer) moderateInpainting(ctx context.Context, req *InpaintingRequest) error {
+	texts := map[string]string{
+		"prompt":          req.Prompt,
+		"negative_prompt": req.NegativePrompt,
+		"furniture_type":  req.FurnitureType,
+		"style":           string(req.Style),
+	}
+	if err := r.moderateInputs(ctx, req.UserID, texts, map[string]string{"base_image": req.BaseImage}); err != nil {
+		return err
+	}
+
+	req.Style = StyleType(sanitizePromptValue(string(req.Style)))
+	if req.FurnitureType != "" {
+		req.FurnitureType = sanitizePromptValue(req.FurnitureType)
+		req.Prompt = sanitizePromptValue(req.Prompt)
+	}
+	return nil
+}
+
+// moderateStyleTransfer checks a style transfer's images and style
+func (r *Renderer) moderateStyleTransfer(ctx context.Context, req *StyleTransferRequest) error {
+	texts := map[string]string{"style": string(req.Style)}
+	images := map[string]string{
+		"content_image": req.ContentImage,
+		"style_image":   req.StyleImage,
+	}
+	if err := r.moderateInputs(ctx, req.UserID, texts, images); err != nil {
+		return err
+	}
+
+	req.Style = StyleType(sanitizePromptValue(string(req.Style)))
+	return nil
+}
+
+// promptParameterKeys are the render parameters interpolated into prompt templates
+var promptParameterKeys = []string{
+	"room_type", "desired_style", "lighting", "current_elements", "furniture_items", "color_scheme", "additional",
+}
+
+var (
+	// promptInjectionPatterns match instructions and model syntax smuggled into
+	// template values: "ignore the previous instructions", role and negative prompt
+	// markers, LoRA and embedding triggers, attention weights and chunk breaks
+	promptInjectionPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)\b(ignore|disregard|forget|override)\b[^.,;:]{0,40}\b(previous|above|prior|earlier|preceding|all|system)\b[^.,;:]{0,40}\b(instructions?|prompts?|rules?|text)\b`),
+		regexp.MustCompile(`(?i)\b(negative[\s_-]*prompt|system|assistant|user)\s*:`),
+		regexp.MustCompile(`<[^>]*>`),
+		regexp.MustCompile(`:\s*-?\d+(\.\d+)?`),
+		regexp.MustCompile(`\bBREAK\b`),
+	}
+
+	// promptSyntaxChars group or weight tokens in diffusion prompts
+	promptSyntaxChars = "()[]{}<>|\\"
+)
+
+// sanitizePromptValue strips prompt injection from a value interpolated into a
+// prompt template and folds it to a single bounded line
+func sanitizePromptValue(value string) string {
+	for _, pattern := range promptInjectionPatterns {
+		value = pattern.ReplaceAllString(value, " ")
+	}
+	value = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(promptSyntaxChars, r) {
+			return ' '
+		}
+		return r
+	}, value)
+
+	value = strings.Join(strings.Fields(value), " ")
+	if utf8.RuneCountInString(value) > maxPromptValueLength {
+		value = strings.TrimSpace(string([]rune(value)[:maxPromptValueLength]))
+	}
+	return value
+}
+
+// sanitizePromptParameters returns a copy of params with the prompt parameters
+// sanitized. Lists decoded from JSON are converted to []string.
+func sanitizePromptParameters(log logger.Logger, params map[string]interface{}) map[string]interface{} {
+	if params == nil {
+		return nil
+	}
+
+	sanitized := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		sanitized[k] = v
+	}
+
+	for _, key := range promptParameterKeys {
+		switch v := params[key].(type) {
+		case string:
+			if clean := sanitizePromptValue(v); clean != v {
+				log.Info("Stripped prompt syntax from render parameter", "parameter", key)
+				sanitized[key] = clean
+			}
+		case []string, []interface{}:
+			values := parameterList(v)
+			for i, value := range values {
+				if clean := sanitizePromptValue(value); clean != value {
+					log.Info("Stripped prompt syntax from render parameter", "parameter", key)
+					values[i] = clean
+				}
+			}
+			sanitized[key] = values
+		}
+	}
+	return sanitized
+}
+
+// parameterText joins a string or list render parameter for moderation
+func parameterText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []string, []interface{}:
+		return strings.Join(parameterList(v), ", ")
+	}
+	return ""
+}
+
+// parameterList copies the strings of a list render parameter
+func parameterList(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return append([]string(nil), v...)
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,104 @@
+package ai
+
+import (
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// Render progress stages
+const (
+	ProgressStageStarting   = "starting"
+	ProgressStageProcessing = "processing"
+	ProgressStageStoring    = "storing"
+)
+
+// RenderProgress is a progress update of a running render. Fraction covers all
+// variants of the render; Step and TotalSteps are those of the variant reported.
+type RenderProgress struct {
+	Stage      string  `json:"stage"`
+	Fraction   float64 `json:"fraction"`
+	Variant    int     `json:"variant"`
+	Step       int     `json:"step,omitempty"`
+	TotalSteps int     `json:"total_steps,omitempty"`
+	PreviewURL string  `json:"preview_url,omitempty"` // intermediate output, when the model provides one
+}
+
+// ProgressFunc receives progress updates of a render. It may be called
+// concurrently from the variants of a render.
+type ProgressFunc func(RenderProgress)
+
+// stepProgressPattern matches the step counter of tqdm progress bars in prediction
+// logs, e.g. " 46%|████▌     | 23/50 [00:05<00:06,  4.21it/s]"
+var stepProgressPattern = regexp.MustCompile(`(\d+)/(\d+)\s*\[`)
+
+// parseStepProgress returns the latest sampling step reported in prediction logs
+func parseStepProgress(logs string) (step, total int, ok bool) {
+	matches := stepProgressPattern.FindAllStringSubmatch(logs, -1)
+	for i := len(matches) - 1; i >= 0; i-- {
+		step, _ = strconv.Atoi(matches[i][1])
+		total, _ = strconv.Atoi(matches[i][2])
+		if total > 0 && step <= total {
+			return step, total, true
+		}
+	}
+	return 0, 0, false
+}
+
+// variantProgress combines the progress of a render's variants into one fraction.
+// Each variant's fraction only moves forward, so a second sampling pass such as
+// the SDXL refiner does not make the render appear to go backwards.
+type variantProgress struct {
+	mu        sync.Mutex
+	fractions []float64
+	report    ProgressFunc
+}
+
+func newVariantProgress(variants int, report ProgressFunc) *variantProgress {
+	if report == nil {
+		return nil
+	}
+	return &variantProgress{fractions: make([]float64, variants), report: report}
+}
+
+// update records a variant's progress and reports the render's overall progress
+func (p *variantProgress) update(variant int, fraction float64, progress RenderProgress) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	if fraction > p.fractions[variant] {
+		p.fractions[variant] = fraction
+	}
+	var total float64
+	for _, f := range p.fractions {
+		total += f
+	}
+	progress.Variant = variant
+	progress.Fraction = total / float64(len(p.fractions))
+	p.mu.Unlock()
+
+	p.report(progress)
+}
+
+// observe returns the observer passed to waitForPrediction for a variant
+func (p *variantProgress) observe(variant int) func(*replicatePrediction) {
+	if p == nil {
+		return nil
+	}
+	return func(prediction *replicatePrediction) {
+		progress := RenderProgress{Stage: ProgressStageStarting}
+		var fraction float64
+		if prediction.Status == "processing" {
+			progress.Stage = ProgressStageProcessing
+			if step, total, ok := parseStepProgress(prediction.Logs); ok {
+				progress.Step, progress.TotalSteps = step, total
+				// The last step is done once the output is stored
+				fraction = 0.95 * float64(step) / float64(total)
+			}
+			progress.PreviewURL = predictionOutputURL(prediction)
+		}
+		p.update(variant, fraction, progress)
+	}
+}
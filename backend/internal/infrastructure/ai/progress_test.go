@@ -0,0 +1,138 @@
+package ai
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseStepProgress(t *testing.T) {
+	logs := "Using seed: 42\n" +
+		"  0%|          | 0/50 [00:00<?, ?it/s]\n" +
+		" 46%|████▌     | 23/50 [00:05<00:06,  4.21it/s]\r" +
+		" 48%|████▊     | 24/50 [00:05<00:06,  4.20it/s]"
+
+	if step, total, ok := parseStepProgress(logs); !ok || step != 24 || total != 50 {
+		t.Errorf("Expected step 24/50, got %d/%d %v", step, total, ok)
+	}
+	if _, _, ok := parseStepProgress("Loading weights 1/3"); ok {
+		t.Error("Expected counters outside progress bars to be ignored")
+	}
+}
+
+func TestVariantProgress(t *testing.T) {
+	var updates []RenderProgress
+	progress := newVariantProgress(2, func(update RenderProgress) {
+		updates = append(updates, update)
+	})
+
+	observe := progress.observe(1)
+	observe(&replicatePrediction{ID: "p1", Status: "starting"})
+	observe(&replicatePrediction{ID: "p1", Status: "processing", Logs: " 50%|█████     | 10/20 ["})
+	observe(&replicatePrediction{ID: "p1", Status: "processing", Logs: "  5%|▌         | 1/20 [", Output: []interface{}{"https://example.com/preview.png"}})
+
+	if len(updates) != 3 {
+		t.Fatalf("Expected 3 updates, got %d", len(updates))
+	}
+	if u := updates[1]; u.Stage != ProgressStageProcessing || u.Step != 10 || u.TotalSteps != 20 || u.Variant != 1 {
+		t.Errorf("Unexpected step update: %+v", u)
+	}
+	// The second variant is half done; the first has not started
+	if u := updates[1]; u.Fraction < 0.23 || u.Fraction > 0.24 {
+		t.Errorf("Expected overall progress of ~0.24, got %f", u.Fraction)
+	}
+	// A refiner pass restarting the step counter does not move progress back
+	if u := updates[2]; u.Fraction != updates[1].Fraction || u.PreviewURL != "https://example.com/preview.png" {
+		t.Errorf("Unexpected refiner update: %+v", u)
+	}
+
+	if newVariantProgress(2, nil) != nil {
+		t.Error("Expected no progress tracking without a callback")
+	}
+	// A nil tracker ignores updates
+	var none *variantProgress
+	none.update(0, 1, RenderProgress{})
+	if none.observe(0) != nil {
+		t.Error("Expected no observer without a callback")
+	}
+}
+
+func TestWaitForPredictionForwardsWebhookProgress(t *testing.T) {
+	renderer := NewRenderer("", nil, testLogger{})
+	// With webhooks enabled the first poll is seconds away
+	renderer.webhookURL = "https://api.example.com/webhooks/replicate"
+
+	observed := make(chan *replicatePrediction, 1)
+	done := make(chan error, 1)
+	go func() {
+		_, err := renderer.waitForPrediction(context.Background(), "p1", 5*time.Second, &pendingPrediction{
+			progress: func(p *replicatePrediction) { observed <- p },
+		})
+		done <- err
+	}()
+
+	// Wait for the render call to register
+	for i := 0; ; i++ {
+		renderer.tracker.mu.Lock()
+		_, registered := renderer.tracker.observers["p1"]
+		renderer.tracker.mu.Unlock()
+		if registered {
+			break
+		}
+		if i > 100 {
+			t.Fatal("Render call did not register")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	renderer.tracker.progress(&replicatePrediction{ID: "p1", Status: "processing", Logs: "3/4 ["})
+	if p := <-observed; p.Logs != "3/4 [" {
+		t.Errorf("Unexpected observed prediction: %+v", p)
+	}
+
+	renderer.completePrediction(&replicatePrediction{ID: "p1", Status: "succeeded", Output: "https://example.com/out.png"})
+	if err := <-done; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	renderer.tracker.mu.Lock()
+	defer renderer.tracker.mu.Unlock()
+	if len(renderer.tracker.observers) != 0 {
+		t.Error("Expected the observer to be removed on completion")
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestWaitForPredictionCancelsAbandonedPrediction(t *testing.T) {
+	renderer := NewRenderer("", nil, testLogger{})
+	renderer.webhookURL = "https://api.example.com/webhooks/replicate"
+
+	cancelled := make(chan string, 1)
+	renderer.httpClient = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		cancelled <- req.Method + " " + req.URL.Path
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("{}")), Header: http.Header{}}, nil
+	})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := renderer.waitForPrediction(ctx, "p1", 5*time.Second, &pendingPrediction{}); err != context.Canceled {
+		t.Fatalf("Expected the cancellation error, got %v", err)
+	}
+
+	select {
+	case call := <-cancelled:
+		if call != "POST /v1/predictions/p1/cancel" {
+			t.Errorf("Unexpected provider call: %s", call)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the prediction to be cancelled at the provider")
+	}
+}
@@ -0,0 +1,101 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// promptManifestFile lists the templates in a prompt directory
+const promptManifestFile = "manifest.json"
+
+// DirectoryPromptSource loads templates from a directory containing a manifest.json
+// and one text/template file per version:
+//
+//	{"templates": [
+//	  {"name": "room", "version": "2024-06-01", "variant": "a", "weight": 50, "file": "room_a.tmpl"},
+//	  {"name": "room", "version": "2024-06-01", "variant": "b", "weight": 50, "file": "room_b.tmpl"}
+//	]}
+type DirectoryPromptSource struct {
+	dir string
+}
+
+type promptManifest struct {
+	Templates []struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+		Variant string `json:"variant"`
+		Weight  *int   `json:"weight"` // defaults to 1
+		File    string `json:"file"`
+	} `json:"templates"`
+}
+
+// NewDirectoryPromptSource creates a source reading templates from dir
+func NewDirectoryPromptSource(dir string) *DirectoryPromptSource {
+	return &DirectoryPromptSource{dir: dir}
+}
+
+// LoadPromptTemplates reads the manifest and every template file it lists
+func (s *DirectoryPromptSource) LoadPromptTemplates(ctx context.Context) ([]*PromptTemplate, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, promptManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prompt manifest: %w", err)
+	}
+
+	var manifest promptManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse prompt manifest: %w", err)
+	}
+
+	templates := make([]*PromptTemplate, 0, len(manifest.Templates))
+	for _, entry := range manifest.Templates {
+		body, err := os.ReadFile(filepath.Join(s.dir, filepath.Clean("/"+entry.File)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read prompt template %s: %w", entry.File, err)
+		}
+
+		weight := 1
+		if entry.Weight != nil {
+			weight = *entry.Weight
+		}
+
+		templates = append(templates, &PromptTemplate{
+			Name:    entry.Name,
+			Version: entry.Version,
+			Variant: entry.Variant,
+			Weight:  weight,
+			Body:    string(body),
+		})
+	}
+
+	return templates, nil
+}
+
+// PostgresPromptSource loads templates from the prompt_templates table
+type PostgresPromptSource struct {
+	db *sqlx.DB
+}
+
+// NewPostgresPromptSource creates a source reading templates from the database
+func NewPostgresPromptSource(db *sqlx.DB) *PostgresPromptSource {
+	return &PostgresPromptSource{db: db}
+}
+
+// LoadPromptTemplates returns every enabled template version
+func (s *PostgresPromptSource) LoadPromptTemplates(ctx context.Context) ([]*PromptTemplate, error) {
+	query := `SELECT name, version, variant, weight, body, created_at
+		FROM prompt_templates
+		WHERE weight > 0
+		ORDER BY name, version, variant`
+
+	var templates []*PromptTemplate
+	if err := s.db.SelectContext(ctx, &templates, query); err != nil {
+		return nil, fmt.Errorf("failed to query prompt templates: %w", err)
+	}
+
+	return templates, nil
+}
@@ -5,86 +5,122 @@ import (
 	"strings"
 )
 
-// PromptBuilder builds optimized prompts for AI rendering
+// PromptBuilder builds optimized prompts for AI rendering from the prompt catalog
 type PromptBuilder struct {
-	stylePrompts map[StyleType]string
+	catalog *PromptCatalog
 }
 
-// NewPromptBuilder creates a new prompt builder
+// NewPromptBuilder creates a new prompt builder using the built-in templates
 func NewPromptBuilder() *PromptBuilder {
+	return NewPromptBuilderWithCatalog(NewPromptCatalog())
+}
+
+// NewPromptBuilderWithCatalog creates a prompt builder backed by catalog
+func NewPromptBuilderWithCatalog(catalog *PromptCatalog) *PromptBuilder {
 	return &PromptBuilder{
-		stylePrompts: initializeStylePrompts(),
+		catalog: catalog,
 	}
 }
 
 // BuildRoomPrompt creates a detailed prompt for room rendering
 func (pb *PromptBuilder) BuildRoomPrompt(components PromptComponents) string {
-	var parts []string
-
-	// Base description
-	parts = append(parts, fmt.Sprintf("A photorealistic interior design visualization of a %s", components.RoomType))
+	prompt, _ := pb.RoomPrompt(components, "")
+	return prompt
+}
 
-	// Style description
-	if styleDesc, ok := pb.stylePrompts[StyleType(components.DesiredStyle)]; ok {
-		parts = append(parts, styleDesc)
+// RoomPrompt creates a room rendering prompt and returns the template versions used.
+// key selects the A/B arm, typically the user ID.
+func (pb *PromptBuilder) RoomPrompt(components PromptComponents, key string) (string, []PromptVersion) {
+	var versions []PromptVersion
+
+	data := PromptData{
+		RoomType:       components.RoomType,
+		Style:          StyleType(components.DesiredStyle),
+		FurnitureItems: components.FurnitureItems,
+		ColorScheme:    components.ColorScheme,
+		Lighting:       components.Lighting,
+		Additional:     components.Additional,
 	}
+	data.StyleDescription = pb.styleDescription(data.Style, components.CustomStyle, key, &versions)
 
-	// Furniture and elements
-	if len(components.FurnitureItems) > 0 {
-		parts = append(parts, fmt.Sprintf("featuring %s", strings.Join(components.FurnitureItems, ", ")))
-	}
+	return pb.render(PromptTemplateRoom, key, data, &versions), versions
+}
 
-	// Color scheme
-	if len(components.ColorScheme) > 0 {
-		parts = append(parts, fmt.Sprintf("with a %s color palette", strings.Join(components.ColorScheme, " and ")))
-	}
+// BuildInpaintingPrompt creates a prompt for furniture placement via inpainting
+func (pb *PromptBuilder) BuildInpaintingPrompt(furnitureType string, style StyleType, context string) string {
+	prompt, _ := pb.InpaintingPrompt(furnitureType, style, nil, context, "")
+	return prompt
+}
 
-	// Lighting
-	if components.Lighting != "" {
-		parts = append(parts, fmt.Sprintf("illuminated by %s", components.Lighting))
-	}
+// InpaintingPrompt creates an inpainting prompt and returns the template versions used.
+// A non-nil selection describes the style instead of the built-in style template.
+func (pb *PromptBuilder) InpaintingPrompt(furnitureType string, style StyleType, selection *StyleSelection, context, key string) (string, []PromptVersion) {
+	var versions []PromptVersion
 
-	// Additional details
-	if len(components.Additional) > 0 {
-		parts = append(parts, strings.Join(components.Additional, ". "))
+	data := PromptData{
+		Style:         style,
+		FurnitureType: furnitureType,
+		Context:       context,
 	}
+	data.StyleDescription = pb.styleDescription(style, selection, key, &versions)
 
-	// Quality modifiers
-	parts = append(parts, "8k resolution, highly detailed, professional architectural photography, interior design magazine quality")
-
-	return strings.Join(parts, ", ")
-}
-
-// BuildInpaintingPrompt creates a prompt for furniture placement via inpainting
-func (pb *PromptBuilder) BuildInpaintingPrompt(furnitureType string, style StyleType, context string) string {
-	styleDesc := pb.stylePrompts[style]
-	
-	return fmt.Sprintf(
-		"A %s in %s, seamlessly integrated into the existing room, maintaining consistent lighting and perspective, %s",
-		furnitureType,
-		styleDesc,
-		context,
-	)
+	return pb.render(PromptTemplateInpainting, key, data, &versions), versions
 }
 
 // BuildNegativePrompt creates negative prompts to avoid common issues
 func (pb *PromptBuilder) BuildNegativePrompt() string {
-	return "blurry, distorted, unrealistic proportions, bad perspective, watermark, text, " +
-		"low quality, amateur, CGI, artificial lighting, oversaturated, underexposed, " +
-		"cluttered, messy, incomplete furniture, floating objects"
+	prompt, _ := pb.NegativePrompt("")
+	return prompt
+}
+
+// NegativePrompt creates a negative prompt and returns the template versions used
+func (pb *PromptBuilder) NegativePrompt(key string) (string, []PromptVersion) {
+	var versions []PromptVersion
+	return pb.render(PromptTemplateNegative, key, PromptData{}, &versions), versions
 }
 
 // BuildStyleTransferPrompt creates prompts for style transfer
 func (pb *PromptBuilder) BuildStyleTransferPrompt(currentRoom string, targetStyle StyleType) string {
-	styleDesc := pb.stylePrompts[targetStyle]
-	
-	return fmt.Sprintf(
-		"Transform this %s into %s, maintaining the room layout and structure but updating " +
-		"furniture, materials, colors, and decorative elements to match the new style. " +
-		"Keep architectural features intact. Professional interior design quality.",
-		currentRoom,
-		styleDesc,
-	)
+	prompt, _ := pb.StyleTransferPrompt(currentRoom, targetStyle, nil, "")
+	return prompt
+}
+
+// StyleTransferPrompt creates a style transfer prompt and returns the template versions used.
+// A non-nil selection describes the style instead of the built-in style template.
+func (pb *PromptBuilder) StyleTransferPrompt(currentRoom string, targetStyle StyleType, selection *StyleSelection, key string) (string, []PromptVersion) {
+	var versions []PromptVersion
+
+	data := PromptData{
+		Style:       targetStyle,
+		CurrentRoom: currentRoom,
+	}
+	data.StyleDescription = pb.styleDescription(targetStyle, selection, key, &versions)
+
+	return pb.render(PromptTemplateStyleTransfer, key, data, &versions), versions
+}
+
+// styleDescription describes a curated style selection from its tags, materials and
+// colours, or renders the built-in style's description template. It returns "" for
+// unknown styles.
+func (pb *PromptBuilder) styleDescription(style StyleType, selection *StyleSelection, key string, versions *[]PromptVersion) string {
+	if selection != nil && selection.Reference != nil {
+		return pb.render(PromptTemplateStyleReference, key, selection.promptData(), versions)
+	}
+	if style == "" {
+		return ""
+	}
+	return pb.render(promptTemplateStylePrefix+string(style), key, PromptData{Style: style}, versions)
+}
+
+// render executes a catalog template and appends its version to versions. Built-in
+// templates always exist, so an error only means an unknown style template.
+func (pb *PromptBuilder) render(name, key string, data PromptData, versions *[]PromptVersion) string {
+	text, version, err := pb.catalog.Render(name, key, data)
+	if err != nil {
+		return ""
+	}
+	*versions = append(*versions, version)
+	return text
 }
 
 // initializeStylePrompts creates style-specific prompt descriptions
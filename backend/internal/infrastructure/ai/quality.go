@@ -0,0 +1,489 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/compozit/vision/backend/internal/domain/entities"
+)
+
+const (
+	// qualityWorkingDimension is the longest side images are scored at
+	qualityWorkingDimension = 256
+
+	// paletteSampleDimension is the longest side sampled for dominant colours
+	paletteSampleDimension = 64
+
+	// dominantColorCount is the number of colour clusters extracted from an output
+	dominantColorCount = 6
+
+	// harmonyDeltaE is the CIEDE2000 distance at which two colours no longer match
+	harmonyDeltaE = 40.0
+
+	// structureEdgeBlur softens edge maps so edges shifted by a pixel or two still match
+	structureEdgeBlur = 3
+
+	// ssimWindow is the side of the windows SSIM is averaged over
+	ssimWindow = 8
+)
+
+// Weights of each metric in QualityMetrics.OverallScore
+const (
+	qualityWeightHarmony   = 0.30
+	qualityWeightStructure = 0.35
+	qualityWeightLighting  = 0.20
+	qualityWeightBalance   = 0.15
+)
+
+// ScoreDesign loads the original photo and a generated design and scores the design
+// locally. See ScoreImages.
+func (r *Renderer) ScoreDesign(ctx context.Context, originalImage, generatedImage string, palette *entities.StyleColorPalette) (*entities.QualityMetrics, error) {
+	original, err := r.loadInputImage(ctx, originalImage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load original image: %w", err)
+	}
+	generated, err := r.loadInputImage(ctx, generatedImage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load generated image: %w", err)
+	}
+
+	metrics := ScoreImages(original, generated, palette)
+	return &metrics, nil
+}
+
+// ScoreImages computes deterministic quality metrics for a generated design:
+//   - ColorHarmony: CIEDE2000 match between the output's dominant colours and the
+//     chosen palette, or the original photo's colours when there is no palette
+//   - StructurePreservation: SSIM between the edge maps of the original and output
+//   - LightingQuality: exposure, contrast, clipping and spread of the luminance histogram
+//   - SpatialBalance: how close the output's visual weight is to the image centre
+//
+// The palette match is the only local signal of style, so StyleAccuracy equals
+// ColorHarmony.
+func ScoreImages(original, generated image.Image, palette *entities.StyleColorPalette) entities.QualityMetrics {
+	// Score both images at the original's aspect ratio and a fixed working size
+	bounds := original.Bounds()
+	scale := math.Min(1, float64(qualityWorkingDimension)/math.Max(float64(bounds.Dx()), float64(bounds.Dy())))
+	w := int(math.Max(1, math.Round(float64(bounds.Dx())*scale)))
+	h := int(math.Max(1, math.Round(float64(bounds.Dy())*scale)))
+	originalSmall := lanczosResize(original, w, h)
+	generatedSmall := lanczosResize(generated, w, h)
+
+	var targets []weightedLab
+	if palette != nil {
+		targets = paletteColors(palette)
+	}
+	if len(targets) == 0 {
+		targets = dominantColors(originalSmall)
+	}
+
+	metrics := entities.QualityMetrics{
+		ColorHarmony:          colorHarmony(dominantColors(generatedSmall), targets),
+		StructurePreservation: structurePreservation(originalSmall, generatedSmall),
+		LightingQuality:       lightingQuality(generatedSmall),
+		SpatialBalance:        spatialBalance(generatedSmall),
+	}
+	metrics.StyleAccuracy = metrics.ColorHarmony
+	metrics.OverallScore = qualityWeightHarmony*metrics.ColorHarmony +
+		qualityWeightStructure*metrics.StructurePreservation +
+		qualityWeightLighting*metrics.LightingQuality +
+		qualityWeightBalance*metrics.SpatialBalance
+
+	return metrics
+}
+
+// lab is a colour in CIE L*a*b* (D65)
+type lab struct {
+	L, A, B float64
+}
+
+// weightedLab is a colour with its share of an image or palette
+type weightedLab struct {
+	color  lab
+	weight float64
+}
+
+// colorHarmony scores how well two colour sets match. Each output colour is scored
+// by its closest target, and each target by its closest output colour, so an output
+// that ignores part of the palette is penalised as well as one adding foreign colours.
+func colorHarmony(output, targets []weightedLab) float64 {
+	if len(output) == 0 || len(targets) == 0 {
+		return 0
+	}
+
+	match := func(from, to []weightedLab) float64 {
+		var score, total float64
+		for _, c := range from {
+			closest := math.Inf(1)
+			for _, t := range to {
+				closest = math.Min(closest, ciede2000(c.color, t.color))
+			}
+			score += c.weight * math.Max(0, 1-closest/harmonyDeltaE)
+			total += c.weight
+		}
+		if total == 0 {
+			return 0
+		}
+		return score / total
+	}
+
+	return 0.7*match(output, targets) + 0.3*match(targets, output)
+}
+
+// paletteColors converts a style palette to Lab, weighted by prominence
+func paletteColors(palette *entities.StyleColorPalette) []weightedLab {
+	var colors []weightedLab
+	for _, group := range [][]entities.ColorInfo{palette.PrimaryColors, palette.AccentColors, palette.NeutralColors} {
+		for _, info := range group {
+			r, g, b := info.RGB.R, info.RGB.G, info.RGB.B
+			if parsed, ok := parseHexColor(info.Hex); ok {
+				r, g, b = parsed[0], parsed[1], parsed[2]
+			}
+
+			weight := info.Prominence
+			if weight <= 0 {
+				weight = 0.1
+			}
+			colors = append(colors, weightedLab{color: rgbToLab(r, g, b), weight: weight})
+		}
+	}
+	return colors
+}
+
+// parseHexColor parses #RRGGBB
+func parseHexColor(hex string) ([3]uint8, bool) {
+	hex = strings.TrimPrefix(hex, "#")
+	if len(hex) != 6 {
+		return [3]uint8{}, false
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return [3]uint8{}, false
+	}
+	return [3]uint8{uint8(v >> 16), uint8(v >> 8), uint8(v)}, true
+}
+
+// dominantColors clusters an image's pixels in Lab with k-means. Centres start at
+// the pixels farthest from those already chosen, so results are deterministic.
+func dominantColors(img *image.RGBA) []weightedLab {
+	bounds := img.Bounds()
+	scale := math.Min(1, float64(paletteSampleDimension)/math.Max(float64(bounds.Dx()), float64(bounds.Dy())))
+	sample := img
+	if scale < 1 {
+		sample = lanczosResize(img, int(math.Max(1, float64(bounds.Dx())*scale)), int(math.Max(1, float64(bounds.Dy())*scale)))
+	}
+
+	pixels := make([]lab, 0, sample.Rect.Dx()*sample.Rect.Dy())
+	var mean lab
+	for i := 0; i+3 < len(sample.Pix); i += 4 {
+		c := rgbToLab(sample.Pix[i], sample.Pix[i+1], sample.Pix[i+2])
+		pixels = append(pixels, c)
+		mean.L, mean.A, mean.B = mean.L+c.L, mean.A+c.A, mean.B+c.B
+	}
+	if len(pixels) == 0 {
+		return nil
+	}
+	n := float64(len(pixels))
+	mean = lab{mean.L / n, mean.A / n, mean.B / n}
+
+	// Farthest-point initialisation from the mean colour
+	centers := make([]lab, 0, dominantColorCount)
+	distance := make([]float64, len(pixels))
+	for i, p := range pixels {
+		distance[i] = labDistance2(p, mean)
+	}
+	for len(centers) < dominantColorCount {
+		farthest := 0
+		for i := range pixels {
+			if distance[i] > distance[farthest] {
+				farthest = i
+			}
+		}
+		if len(centers) > 0 && distance[farthest] == 0 {
+			break
+		}
+		centers = append(centers, pixels[farthest])
+		for i, p := range pixels {
+			distance[i] = math.Min(distance[i], labDistance2(p, pixels[farthest]))
+		}
+	}
+
+	counts := make([]int, len(centers))
+	for iteration := 0; iteration < 10; iteration++ {
+		sums := make([]lab, len(centers))
+		for i := range counts {
+			counts[i] = 0
+		}
+		for _, p := range pixels {
+			best := 0
+			for k := 1; k < len(centers); k++ {
+				if labDistance2(p, centers[k]) < labDistance2(p, centers[best]) {
+					best = k
+				}
+			}
+			counts[best]++
+			sums[best].L += p.L
+			sums[best].A += p.A
+			sums[best].B += p.B
+		}
+		for k := range centers {
+			if counts[k] > 0 {
+				c := float64(counts[k])
+				centers[k] = lab{sums[k].L / c, sums[k].A / c, sums[k].B / c}
+			}
+		}
+	}
+
+	colors := make([]weightedLab, 0, len(centers))
+	for k, center := range centers {
+		if counts[k] > 0 {
+			colors = append(colors, weightedLab{color: center, weight: float64(counts[k]) / n})
+		}
+	}
+	return colors
+}
+
+func labDistance2(a, b lab) float64 {
+	dl, da, db := a.L-b.L, a.A-b.A, a.B-b.B
+	return dl*dl + da*da + db*db
+}
+
+// rgbToLab converts an sRGB colour to CIE L*a*b* under the D65 white point
+func rgbToLab(r, g, b uint8) lab {
+	linear := func(v uint8) float64 {
+		c := float64(v) / 255
+		if c <= 0.04045 {
+			return c / 12.92
+		}
+		return math.Pow((c+0.055)/1.055, 2.4)
+	}
+	lr, lg, lb := linear(r), linear(g), linear(b)
+
+	x := (0.4124564*lr + 0.3575761*lg + 0.1804375*lb) / 0.95047
+	y := 0.2126729*lr + 0.7151522*lg + 0.0721750*lb
+	z := (0.0193339*lr + 0.1191920*lg + 0.9503041*lb) / 1.08883
+
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27*t + 16) / 116
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+
+	return lab{L: 116*fy - 16, A: 500 * (fx - fy), B: 200 * (fy - fz)}
+}
+
+// ciede2000 returns the CIEDE2000 colour difference between two Lab colours
+func ciede2000(c1, c2 lab) float64 {
+	const pow25to7 = 6103515625.0 // 25^7
+
+	cab := (math.Hypot(c1.A, c1.B) + math.Hypot(c2.A, c2.B)) / 2
+	cab7 := math.Pow(cab, 7)
+	g := 0.5 * (1 - math.Sqrt(cab7/(cab7+pow25to7)))
+
+	a1, a2 := (1+g)*c1.A, (1+g)*c2.A
+	chroma1, chroma2 := math.Hypot(a1, c1.B), math.Hypot(a2, c2.B)
+
+	hue := func(a, b float64) float64 {
+		if a == 0 && b == 0 {
+			return 0
+		}
+		h := math.Atan2(b, a) * 180 / math.Pi
+		if h < 0 {
+			h += 360
+		}
+		return h
+	}
+	h1, h2 := hue(a1, c1.B), hue(a2, c2.B)
+
+	dL := c2.L - c1.L
+	dC := chroma2 - chroma1
+
+	var dh float64
+	if chroma1*chroma2 != 0 {
+		dh = h2 - h1
+		if dh > 180 {
+			dh -= 360
+		} else if dh < -180 {
+			dh += 360
+		}
+	}
+	dH := 2 * math.Sqrt(chroma1*chroma2) * math.Sin(dh*math.Pi/360)
+
+	meanL := (c1.L + c2.L) / 2
+	meanC := (chroma1 + chroma2) / 2
+
+	meanH := h1 + h2
+	if chroma1*chroma2 != 0 {
+		switch {
+		case math.Abs(h1-h2) <= 180:
+			meanH /= 2
+		case h1+h2 < 360:
+			meanH = (meanH + 360) / 2
+		default:
+			meanH = (meanH - 360) / 2
+		}
+	}
+
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	t := 1 - 0.17*math.Cos(rad(meanH-30)) + 0.24*math.Cos(rad(2*meanH)) +
+		0.32*math.Cos(rad(3*meanH+6)) - 0.20*math.Cos(rad(4*meanH-63))
+
+	dTheta := 30 * math.Exp(-math.Pow((meanH-275)/25, 2))
+	meanC7 := math.Pow(meanC, 7)
+	rc := 2 * math.Sqrt(meanC7/(meanC7+pow25to7))
+	sl := 1 + 0.015*math.Pow(meanL-50, 2)/math.Sqrt(20+math.Pow(meanL-50, 2))
+	sc := 1 + 0.045*meanC
+	sh := 1 + 0.015*meanC*t
+	rt := -math.Sin(rad(2*dTheta)) * rc
+
+	lTerm, cTerm, hTerm := dL/sl, dC/sc, dH/sh
+	return math.Sqrt(lTerm*lTerm + cTerm*cTerm + hTerm*hTerm + rt*cTerm*hTerm)
+}
+
+// structurePreservation compares the softened Canny edge maps of two same-sized
+// images with SSIM, mapped to 0-1
+func structurePreservation(original, generated *image.RGBA) float64 {
+	a := featherMask(cannyEdges(toGray(original)), structureEdgeBlur)
+	b := featherMask(cannyEdges(toGray(generated)), structureEdgeBlur)
+
+	// Two images without any edges have identical structure
+	if edgeSum(a) == 0 && edgeSum(b) == 0 {
+		return 1
+	}
+
+	return math.Max(0, ssim(a, b))
+}
+
+func edgeSum(img *image.Gray) int {
+	sum := 0
+	for _, v := range img.Pix {
+		sum += int(v)
+	}
+	return sum
+}
+
+// ssim computes the mean structural similarity of two same-sized grayscale images
+// over non-overlapping windows
+func ssim(a, b *image.Gray) float64 {
+	const (
+		c1 = (0.01 * 255) * (0.01 * 255)
+		c2 = (0.03 * 255) * (0.03 * 255)
+	)
+
+	w, h := a.Rect.Dx(), a.Rect.Dy()
+	var total float64
+	windows := 0
+	for y0 := 0; y0 < h; y0 += ssimWindow {
+		for x0 := 0; x0 < w; x0 += ssimWindow {
+			y1, x1 := min(y0+ssimWindow, h), min(x0+ssimWindow, w)
+			n := float64((y1 - y0) * (x1 - x0))
+
+			var sumA, sumB, sumAA, sumBB, sumAB float64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					va := float64(a.Pix[y*a.Stride+x])
+					vb := float64(b.Pix[y*b.Stride+x])
+					sumA += va
+					sumB += vb
+					sumAA += va * va
+					sumBB += vb * vb
+					sumAB += va * vb
+				}
+			}
+
+			meanA, meanB := sumA/n, sumB/n
+			varA := sumAA/n - meanA*meanA
+			varB := sumBB/n - meanB*meanB
+			cov := sumAB/n - meanA*meanB
+
+			total += ((2*meanA*meanB + c1) * (2*cov + c2)) /
+				((meanA*meanA + meanB*meanB + c1) * (varA + varB + c2))
+			windows++
+		}
+	}
+
+	if windows == 0 {
+		return 0
+	}
+	return total / float64(windows)
+}
+
+// lightingQuality scores the luminance histogram: mid-tone exposure, contrast
+// between the 5th and 95th percentiles, little clipping and a well spread histogram
+func lightingQuality(img *image.RGBA) float64 {
+	var histogram [256]int
+	total := 0
+	for i := 0; i+3 < len(img.Pix); i += 4 {
+		y := 0.2126*float64(img.Pix[i]) + 0.7152*float64(img.Pix[i+1]) + 0.0722*float64(img.Pix[i+2])
+		histogram[clampInt(int(math.Round(y)), 0, 255)]++
+		total++
+	}
+	if total == 0 {
+		return 0
+	}
+
+	var mean, entropy float64
+	for v, count := range histogram {
+		if count == 0 {
+			continue
+		}
+		p := float64(count) / float64(total)
+		mean += p * float64(v) / 255
+		entropy -= p * math.Log2(p)
+	}
+
+	percentile := func(q float64) float64 {
+		target := int(math.Ceil(q * float64(total)))
+		seen := 0
+		for v, count := range histogram {
+			seen += count
+			if seen >= target {
+				return float64(v) / 255
+			}
+		}
+		return 1
+	}
+
+	var clipped int
+	for v := 0; v < 5; v++ {
+		clipped += histogram[v] + histogram[255-v]
+	}
+	clipping := float64(clipped) / float64(total)
+
+	exposure := math.Max(0, 1-math.Abs(mean-0.5)/0.5)
+	contrast := math.Min(1, (percentile(0.95)-percentile(0.05))/0.6)
+	spread := entropy / 8
+
+	score := 0.4*exposure + 0.3*contrast + 0.3*spread - math.Min(0.5, clipping*2)
+	return math.Max(0, math.Min(1, score))
+}
+
+// spatialBalance scores how close the centroid of visual weight, taken as distance
+// from mid-gray luminance, is to the image centre
+func spatialBalance(img *image.RGBA) float64 {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	var sumX, sumY, total float64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*img.Stride + x*4
+			luma := (0.2126*float64(img.Pix[i]) + 0.7152*float64(img.Pix[i+1]) + 0.0722*float64(img.Pix[i+2])) / 255
+			weight := math.Abs(luma - 0.5)
+			sumX += weight * (float64(x) + 0.5) / float64(w)
+			sumY += weight * (float64(y) + 0.5) / float64(h)
+			total += weight
+		}
+	}
+	if total == 0 {
+		return 1
+	}
+
+	// The centroid can be at most ~0.707 from the centre in normalised coordinates
+	offset := math.Hypot(sumX/total-0.5, sumY/total-0.5)
+	return math.Max(0, 1-offset/math.Sqrt2*2)
+}
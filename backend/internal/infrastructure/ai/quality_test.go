@@ -0,0 +1,108 @@
+package ai
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/compozit/vision/backend/internal/domain/entities"
+)
+
+func TestCIEDE2000(t *testing.T) {
+	// Reference pairs from Sharma, Wu and Dalal (2005)
+	cases := []struct {
+		a, b lab
+		want float64
+	}{
+		{lab{50, 2.6772, -79.7751}, lab{50, 0, -82.7485}, 2.0425},
+		{lab{50, -1.3802, -84.2814}, lab{50, 0, -82.7485}, 1.0000},
+		{lab{50, 2.5, 0}, lab{73, 25, -18}, 27.1492},
+		{lab{50, 2.5, 0}, lab{50, 3.2592, 0.3350}, 1.0000},
+		{lab{60.2574, -34.0099, 36.2677}, lab{60.4626, -34.1751, 39.4387}, 1.2644},
+		{lab{22.7233, 20.0904, -46.6940}, lab{23.0331, 14.9730, -42.5619}, 2.0373},
+		{lab{90.9257, -0.5406, -0.9208}, lab{88.6381, -0.8985, -0.7239}, 1.5381},
+	}
+
+	for _, c := range cases {
+		if got := ciede2000(c.a, c.b); math.Abs(got-c.want) > 1e-4 {
+			t.Errorf("ciede2000(%v, %v) = %.4f, want %.4f", c.a, c.b, got, c.want)
+		}
+		if got := ciede2000(c.b, c.a); math.Abs(got-c.want) > 1e-4 {
+			t.Errorf("Expected ciede2000 to be symmetric for %v, %v", c.a, c.b)
+		}
+	}
+}
+
+// testSceneImage draws a room-like scene: a wall and floor split, with a sofa block
+func testSceneImage(wall, floor, sofa color.RGBA, light float64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 160, 120))
+	shade := func(c color.RGBA) color.RGBA {
+		return color.RGBA{uint8(float64(c.R) * light), uint8(float64(c.G) * light), uint8(float64(c.B) * light), 255}
+	}
+	for y := 0; y < 120; y++ {
+		for x := 0; x < 160; x++ {
+			c := wall
+			if y >= 70 {
+				c = floor
+			}
+			if x >= 40 && x < 120 && y >= 55 && y < 90 {
+				c = sofa
+			}
+			img.SetRGBA(x, y, shade(c))
+		}
+	}
+	return img
+}
+
+func TestScoreImages(t *testing.T) {
+	wall := color.RGBA{235, 228, 215, 255}
+	floor := color.RGBA{150, 110, 70, 255}
+	sofa := color.RGBA{40, 70, 120, 255}
+
+	original := testSceneImage(wall, floor, sofa, 1)
+	palette := &entities.StyleColorPalette{
+		PrimaryColors: []entities.ColorInfo{{Hex: "#EBE4D7", Prominence: 0.5}},
+		AccentColors:  []entities.ColorInfo{{Hex: "#284678", Prominence: 0.2}},
+		NeutralColors: []entities.ColorInfo{{RGB: entities.RGBColor{R: 150, G: 110, B: 70}, Prominence: 0.3}},
+	}
+
+	onPalette := ScoreImages(original, testSceneImage(wall, floor, sofa, 1), palette)
+	offPalette := ScoreImages(original, testSceneImage(color.RGBA{200, 40, 160, 255}, color.RGBA{20, 200, 40, 255}, color.RGBA{250, 220, 0, 255}, 1), palette)
+	dark := ScoreImages(original, testSceneImage(wall, floor, sofa, 0.15), palette)
+
+	if onPalette.ColorHarmony < 0.9 {
+		t.Errorf("Expected on-palette design to score high harmony, got %.3f", onPalette.ColorHarmony)
+	}
+	if offPalette.ColorHarmony >= onPalette.ColorHarmony-0.3 {
+		t.Errorf("Expected off-palette design to score lower harmony, got %.3f vs %.3f", offPalette.ColorHarmony, onPalette.ColorHarmony)
+	}
+	if onPalette.StructurePreservation < 0.99 {
+		t.Errorf("Expected identical structure to score ~1, got %.3f", onPalette.StructurePreservation)
+	}
+
+	// Recolouring keeps the layout, a different layout does not
+	moved := image.NewRGBA(original.Bounds())
+	for y := 0; y < 120; y++ {
+		for x := 0; x < 160; x++ {
+			moved.SetRGBA(x, y, original.RGBAAt((x+60)%160, (y+40)%120))
+		}
+	}
+	restructured := ScoreImages(original, moved, palette)
+	if restructured.StructurePreservation >= offPalette.StructurePreservation {
+		t.Errorf("Expected a moved layout to score lower structure than a recolour, got %.3f vs %.3f",
+			restructured.StructurePreservation, offPalette.StructurePreservation)
+	}
+
+	if dark.LightingQuality >= onPalette.LightingQuality {
+		t.Errorf("Expected an underexposed design to score lower lighting, got %.3f vs %.3f", dark.LightingQuality, onPalette.LightingQuality)
+	}
+	if onPalette.OverallScore <= offPalette.OverallScore || onPalette.OverallScore <= dark.OverallScore {
+		t.Errorf("Expected the faithful design to score best overall: %+v", onPalette)
+	}
+
+	// Scores are deterministic
+	if again := ScoreImages(original, testSceneImage(wall, floor, sofa, 1), palette); again != onPalette {
+		t.Errorf("Expected identical scores, got %+v and %+v", again, onPalette)
+	}
+}
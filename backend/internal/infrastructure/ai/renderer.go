@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"time"
 
+	"github.com/compozit/vision/backend/internal/infrastructure/storage"
 	"github.com/compozit/vision/backend/pkg/logger"
 )
 
@@ -19,11 +21,28 @@ type Renderer struct {
 	promptBuilder  *PromptBuilder
 	cache          *Cache
 	logger         logger.Logger
+	tracker        *predictionTracker
+	control        *structureControl
+	webhookURL     string
+	webhookSecret  string
+	onLateResult   LateResultHandler
+	usage          UsageRecorder
+	blobs          storage.BlobStore
+	resilience     *resilience
+	styles         StyleResolver
+	analyses       SpaceAnalysisSource
+	upscale        upscaleSettings
+	moderator      *Moderator
+	imageHosts     []string
+	imageClient    *http.Client
 }
 
 // NewRenderer creates a new AI renderer
 func NewRenderer(replicateToken string, cache *Cache, logger logger.Logger) *Renderer {
-	return &Renderer{
+	// The built-in blocklist has no patterns to fail compiling
+	moderator, _ := NewModerator(DefaultModerationConfig(), nil)
+
+	r := &Renderer{
 		replicateToken: replicateToken,
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
@@ -31,59 +50,86 @@ func NewRenderer(replicateToken string, cache *Cache, logger logger.Logger) *Ren
 		promptBuilder: NewPromptBuilder(),
 		cache:         cache,
 		logger:        logger,
+		tracker:       newPredictionTracker(),
+		resilience:    newResilience(DefaultResilienceConfig()),
+		moderator:     moderator,
+		imageHosts:    defaultImageHosts,
 	}
+	r.imageClient = newImageClient(r.allowImageURL)
+	return r
 }
 
 // RenderQuick performs fast AI rendering (2-5 seconds)
 func (r *Renderer) RenderQuick(ctx context.Context, req *RenderRequest) (*RenderResult, error) {
 	startTime := time.Now()
+
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if err := r.moderateRender(ctx, req); err != nil {
+		return nil, err
+	}
+	req.CustomStyle = r.resolveStyle(ctx, req.Style, req.CustomStyle)
 	
 	// Check cache first
 	if cached, found := r.cache.GetRender(req); found {
 		r.logger.Info("Returning cached render result", "request_id", req.ID)
 		return cached, nil
 	}
+	if err := r.cache.GetRenderFailure(req); err != nil {
+		return nil, err
+	}
 
-	// Build optimized prompt
-	prompt := r.promptBuilder.BuildRoomPrompt(PromptComponents{
-		RoomType:     req.Parameters["room_type"].(string),
+	// Build optimized prompt; room_type is optional
+	roomType, _ := req.Parameters["room_type"].(string)
+	prompt, promptVersions := r.promptBuilder.RoomPrompt(PromptComponents{
+		RoomType:     roomType,
 		DesiredStyle: string(req.Style),
+		CustomStyle:  req.CustomStyle,
 		// Add other components from parameters
-	})
+	}, req.UserID)
+	negativePrompt, negativeVersions := r.promptBuilder.NegativePrompt(req.UserID)
 
 	// Use SDXL Turbo for quick results
 	modelVersion := "stability-ai/sdxl-turbo:latest"
-	
-	prediction, err := r.createPrediction(ctx, modelVersion, map[string]interface{}{
+	input := map[string]interface{}{
 		"prompt":         prompt,
-		"negative_prompt": r.promptBuilder.BuildNegativePrompt(),
+		"negative_prompt": negativePrompt,
 		"width":          1024,
 		"height":         1024,
 		"num_inference_steps": 4, // Turbo mode
 		"guidance_scale": 0.0,    // Required for turbo
-	})
-	
-	if err != nil {
-		return nil, fmt.Errorf("failed to create prediction: %w", err)
 	}
 
-	// Poll for results
-	result, err := r.waitForPrediction(ctx, prediction.ID, 10*time.Second)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get prediction result: %w", err)
+	metadata := map[string]interface{}{
+		"prompt_templates": append(promptVersions, negativeVersions...),
+	}
+	if req.CustomStyle != nil {
+		metadata["style_reference"] = req.CustomStyle.metadata()
 	}
 
-	renderResult := &RenderResult{
-		ID:             result.ID,
-		RequestID:      req.ID,
-		Status:         "completed",
-		ResultImageURL: result.Output.(string),
-		Progress:       100,
-		ProcessingTime: time.Since(startTime).Seconds(),
-		CreatedAt:      startTime,
-		CompletedAt:    timePtr(time.Now()),
+	// Condition on the user's photo so the room keeps its structure
+	if controlModel, controlMetadata, ok, err := r.applyStructureControl(ctx, req, input); err != nil {
+		return nil, err
+	} else if ok {
+		modelVersion = controlModel
+		for k, v := range controlMetadata {
+			metadata[k] = v
+		}
+		// ControlNet models are not distilled for turbo sampling
+		input["num_inference_steps"] = 20
+		input["guidance_scale"] = 5.0
 	}
 
+	// Fan variants out in parallel and wait for webhook or polling results
+	variants, err := r.renderVariants(ctx, req, modelVersion, input, 10*time.Second, startTime, metadata)
+	if err != nil {
+		r.cacheRenderFailure(ctx, req, err)
+		return nil, err
+	}
+
+	renderResult := newVariantsResult(req, variants, startTime, metadata)
+
 	// Cache the result
 	r.cache.SetRender(req, renderResult)
 
@@ -94,17 +140,30 @@ func (r *Renderer) RenderQuick(ctx context.Context, req *RenderRequest) (*Render
 func (r *Renderer) RenderDetailed(ctx context.Context, req *RenderRequest) (*RenderResult, error) {
 	startTime := time.Now()
 
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if err := r.moderateRender(ctx, req); err != nil {
+		return nil, err
+	}
+	req.CustomStyle = r.resolveStyle(ctx, req.Style, req.CustomStyle)
+
+	if err := r.cache.GetRenderFailure(req); err != nil {
+		return nil, err
+	}
+
 	// Build detailed prompt with all parameters
 	components := r.extractPromptComponents(req.Parameters)
-	prompt := r.promptBuilder.BuildRoomPrompt(components)
+	components.CustomStyle = req.CustomStyle
+	prompt, promptVersions := r.promptBuilder.RoomPrompt(components, req.UserID)
 	prompt = r.promptBuilder.OptimizePromptForModel(prompt, "stable-diffusion-xl")
+	negativePrompt, negativeVersions := r.promptBuilder.NegativePrompt(req.UserID)
 
 	// Use full SDXL for quality
 	modelVersion := "stability-ai/stable-diffusion-xl:latest"
-	
-	prediction, err := r.createPrediction(ctx, modelVersion, map[string]interface{}{
+	input := map[string]interface{}{
 		"prompt":         prompt,
-		"negative_prompt": r.promptBuilder.BuildNegativePrompt(),
+		"negative_prompt": negativePrompt,
 		"width":          1024,
 		"height":         1024,
 		"num_inference_steps": 50,
@@ -112,130 +171,254 @@ func (r *Renderer) RenderDetailed(ctx context.Context, req *RenderRequest) (*Ren
 		"scheduler":      "K_EULER",
 		"refine":         "expert_ensemble_refiner",
 		"high_noise_frac": 0.8,
-	})
-	
-	if err != nil {
-		return nil, fmt.Errorf("failed to create detailed prediction: %w", err)
 	}
 
-	// Longer timeout for detailed rendering
-	result, err := r.waitForPrediction(ctx, prediction.ID, 60*time.Second)
+	metadata := map[string]interface{}{
+		"quality":          "high",
+		"resolution":       "1024x1024",
+		"prompt_templates": append(promptVersions, negativeVersions...),
+	}
+	if req.CustomStyle != nil {
+		metadata["style_reference"] = req.CustomStyle.metadata()
+	}
+
+	// Condition on the user's photo so the room keeps its structure
+	if controlModel, controlMetadata, ok, err := r.applyStructureControl(ctx, req, input); err != nil {
+		return nil, err
+	} else if ok {
+		modelVersion = controlModel
+		for k, v := range controlMetadata {
+			metadata[k] = v
+		}
+	}
+	metadata["model"] = modelVersion
+
+	// Longer timeout for detailed rendering; slower predictions are reconciled later
+	variants, err := r.renderVariants(ctx, req, modelVersion, input, 60*time.Second, startTime, metadata)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get detailed prediction result: %w", err)
+		r.cacheRenderFailure(ctx, req, err)
+		return nil, fmt.Errorf("detailed rendering failed: %w", err)
 	}
 
-	return &RenderResult{
-		ID:             result.ID,
-		RequestID:      req.ID,
-		Status:         "completed",
-		ResultImageURL: result.Output.(string),
-		Progress:       100,
-		ProcessingTime: time.Since(startTime).Seconds(),
-		CreatedAt:      startTime,
-		CompletedAt:    timePtr(time.Now()),
-		Metadata: map[string]interface{}{
-			"model":         modelVersion,
-			"quality":       "high",
-			"resolution":    "1024x1024",
-		},
-	}, nil
+	return newVariantsResult(req, variants, startTime, metadata), nil
 }
 
 // RenderInpainting performs AI inpainting for furniture placement
 func (r *Renderer) RenderInpainting(ctx context.Context, req *InpaintingRequest) (*RenderResult, error) {
 	startTime := time.Now()
+	if err := r.moderateInpainting(ctx, req); err != nil {
+		return nil, err
+	}
+	req.CustomStyle = r.resolveStyle(ctx, req.Style, req.CustomStyle)
+
+	maskMetadata, err := r.prepareInpaintingMask(ctx, req)
+	if err != nil {
+		return nil, err
+	}
 
 	modelVersion := "stability-ai/stable-diffusion-inpainting:latest"
+
+	// Build the prompt from the inpainting template when the item is known; a
+	// free-form prompt is then added as context
+	prompt := req.Prompt
+	var promptVersions []PromptVersion
+	if req.FurnitureType != "" {
+		prompt, promptVersions = r.promptBuilder.InpaintingPrompt(req.FurnitureType, req.Style, req.CustomStyle, req.Prompt, req.UserID)
+	}
+
+	negativePrompt := req.NegativePrompt
+	if negativePrompt == "" {
+		var negativeVersions []PromptVersion
+		negativePrompt, negativeVersions = r.promptBuilder.NegativePrompt(req.UserID)
+		promptVersions = append(promptVersions, negativeVersions...)
+	}
+
+	metadata := map[string]interface{}{
+		"prompt_templates": promptVersions,
+	}
+	if maskMetadata != nil {
+		metadata["generated_mask"] = maskMetadata
+	}
+	if req.CustomStyle != nil {
+		metadata["style_reference"] = req.CustomStyle.metadata()
+	}
 	
-	prediction, err := r.createPrediction(ctx, modelVersion, map[string]interface{}{
+	input := map[string]interface{}{
 		"image":          req.BaseImage,
 		"mask":           req.MaskImage,
-		"prompt":         req.Prompt,
-		"negative_prompt": req.NegativePrompt,
+		"prompt":         prompt,
+		"negative_prompt": negativePrompt,
 		"strength":       req.Strength,
 		"guidance_scale": req.GuidanceScale,
 		"num_inference_steps": req.Steps,
-	})
-	
+	}
+
+	prediction, err := r.createPrediction(ctx, modelVersion, input)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create inpainting prediction: %w", err)
 	}
 
-	result, err := r.waitForPrediction(ctx, prediction.ID, 30*time.Second)
+	result, err := r.waitForPrediction(ctx, prediction.ID, 30*time.Second, &pendingPrediction{
+		startedAt: startTime,
+		metadata:  metadata,
+	})
+	r.recordProviderCall(ctx, ProviderCall{
+		UserID:       req.UserID,
+		ProjectID:    req.ProjectID,
+		PredictionID: prediction.ID,
+		RenderType:   RenderTypeInpainting,
+		Model:        modelVersion,
+	}, input, startTime, err)
+	r.recordPredictionOutcome(modelVersion, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get inpainting result: %w", err)
 	}
 
+	stored, err := r.storeOutput(ctx, predictionOutputURL(result))
+	if err != nil {
+		return nil, fmt.Errorf("failed to store inpainting result: %w", err)
+	}
+
 	return &RenderResult{
 		ID:             result.ID,
 		RequestID:      "", // Set by caller
 		Status:         "completed",
-		ResultImageURL: result.Output.(string),
+		ResultImageURL: stored.URL,
+		ThumbnailURL:   stored.ThumbnailURL,
+		ImageHash:      stored.Hash,
 		Progress:       100,
 		ProcessingTime: time.Since(startTime).Seconds(),
 		CreatedAt:      startTime,
 		CompletedAt:    timePtr(time.Now()),
+		Metadata:       metadata,
 	}, nil
 }
 
 // RenderStyleTransfer performs style transfer on existing room
 func (r *Renderer) RenderStyleTransfer(ctx context.Context, req *StyleTransferRequest) (*RenderResult, error) {
 	startTime := time.Now()
+	if err := r.moderateStyleTransfer(ctx, req); err != nil {
+		return nil, err
+	}
+	req.CustomStyle = r.resolveStyle(ctx, req.Style, req.CustomStyle)
 
 	// Build style transfer prompt
-	prompt := r.promptBuilder.BuildStyleTransferPrompt("room", req.Style)
+	prompt, promptVersions := r.promptBuilder.StyleTransferPrompt("room", req.Style, req.CustomStyle, req.UserID)
+	negativePrompt, negativeVersions := r.promptBuilder.NegativePrompt(req.UserID)
 
 	modelVersion := "stability-ai/stable-diffusion-img2img:latest"
 	
-	prediction, err := r.createPrediction(ctx, modelVersion, map[string]interface{}{
+	input := map[string]interface{}{
 		"image":          req.ContentImage,
 		"prompt":         prompt,
-		"negative_prompt": r.promptBuilder.BuildNegativePrompt(),
+		"negative_prompt": negativePrompt,
 		"strength":       req.Strength,
 		"guidance_scale": 7.5,
 		"num_inference_steps": 30,
-	})
-	
+	}
+
+	prediction, err := r.createPrediction(ctx, modelVersion, input)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create style transfer prediction: %w", err)
 	}
 
-	result, err := r.waitForPrediction(ctx, prediction.ID, 30*time.Second)
+	metadata := map[string]interface{}{
+		"style":            req.Style,
+		"strength":         req.Strength,
+		"prompt_templates": append(promptVersions, negativeVersions...),
+	}
+	if req.CustomStyle != nil {
+		metadata["style_reference"] = req.CustomStyle.metadata()
+	}
+
+	result, err := r.waitForPrediction(ctx, prediction.ID, 30*time.Second, &pendingPrediction{
+		startedAt: startTime,
+		metadata:  metadata,
+	})
+	r.recordProviderCall(ctx, ProviderCall{
+		UserID:       req.UserID,
+		ProjectID:    req.ProjectID,
+		PredictionID: prediction.ID,
+		RenderType:   RenderTypeStyle,
+		Model:        modelVersion,
+	}, input, startTime, err)
+	r.recordPredictionOutcome(modelVersion, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get style transfer result: %w", err)
 	}
 
+	stored, err := r.storeOutput(ctx, predictionOutputURL(result))
+	if err != nil {
+		return nil, fmt.Errorf("failed to store style transfer result: %w", err)
+	}
+
 	return &RenderResult{
 		ID:             result.ID,
 		RequestID:      "", // Set by caller
 		Status:         "completed",
-		ResultImageURL: result.Output.(string),
+		ResultImageURL: stored.URL,
+		ThumbnailURL:   stored.ThumbnailURL,
+		ImageHash:      stored.Hash,
 		Progress:       100,
 		ProcessingTime: time.Since(startTime).Seconds(),
 		CreatedAt:      startTime,
 		CompletedAt:    timePtr(time.Now()),
-		Metadata: map[string]interface{}{
-			"style": req.Style,
-			"strength": req.Strength,
-		},
+		Metadata:       metadata,
 	}, nil
 }
 
+// cacheRenderFailure records a provider failure in the negative cache. Predictions
+// still running and cancelled requests are not failures of the request itself.
+func (r *Renderer) cacheRenderFailure(ctx context.Context, req *RenderRequest, err error) {
+	var pending *PredictionPendingError
+	if errors.As(err, &pending) || ctx.Err() != nil {
+		return
+	}
+	r.cache.SetRenderFailure(req, err)
+}
+
+// CacheStats returns the render cache's hit, eviction and memory statistics
+func (r *Renderer) CacheStats() CacheStats {
+	return r.cache.Stats()
+}
+
 // Replicate API structures
 type replicatePrediction struct {
 	ID      string                 `json:"id"`
 	Status  string                 `json:"status"`
 	Output  interface{}            `json:"output"`
 	Error   interface{}            `json:"error"`
+	Logs    string                 `json:"logs,omitempty"`
 }
 
-// createPrediction creates a new prediction on Replicate
+// createPrediction creates a new prediction on Replicate, through the model's
+// circuit breaker and the creation rate limiter
 func (r *Renderer) createPrediction(ctx context.Context, modelVersion string, input map[string]interface{}) (*replicatePrediction, error) {
+	var prediction *replicatePrediction
+	err := r.callProvider(ctx, modelVersion, r.resilience.createLimiter, func() error {
+		var err error
+		prediction, err = r.doCreatePrediction(ctx, modelVersion, input)
+		return err
+	})
+	return prediction, err
+}
+
+// doCreatePrediction makes a single prediction creation request
+func (r *Renderer) doCreatePrediction(ctx context.Context, modelVersion string, input map[string]interface{}) (*replicatePrediction, error) {
 	url := fmt.Sprintf("https://api.replicate.com/v1/models/%s/predictions", modelVersion)
 	
-	body, err := json.Marshal(map[string]interface{}{
+	payload := map[string]interface{}{
 		"input": input,
-	})
+	}
+
+	// Ask Replicate to call us back on completion instead of relying on polling alone;
+	// log and output events carry step progress and intermediate previews
+	if r.webhookURL != "" {
+		payload["webhook"] = r.webhookURL
+		payload["webhook_events_filter"] = []string{"logs", "output", "completed"}
+	}
+
+	body, err := json.Marshal(payload)
 	if err != nil {
 		return nil, err
 	}
@@ -250,13 +433,13 @@ func (r *Renderer) createPrediction(ctx context.Context, modelVersion string, in
 
 	resp, err := r.httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, newTransportError(ctx, "create", modelVersion, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusCreated {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to create prediction: %s", body)
+		return nil, newHTTPError("create", modelVersion, resp, body)
 	}
 
 	var prediction replicatePrediction
@@ -267,38 +450,89 @@ func (r *Renderer) createPrediction(ctx context.Context, modelVersion string, in
 	return &prediction, nil
 }
 
-// waitForPrediction polls for prediction completion
-func (r *Renderer) waitForPrediction(ctx context.Context, predictionID string, timeout time.Duration) (*replicatePrediction, error) {
-	deadline := time.Now().Add(timeout)
-	ticker := time.NewTicker(500 * time.Millisecond)
-	defer ticker.Stop()
+// waitForPrediction waits for prediction completion, delivered either by webhook or
+// by polling with exponential backoff. If the prediction is still running at the
+// timeout it is handed to late reconciliation and a PredictionPendingError is returned.
+// In-progress statuses are passed to pending.progress while the call waits.
+func (r *Renderer) waitForPrediction(ctx context.Context, predictionID string, timeout time.Duration, pending *pendingPrediction) (*replicatePrediction, error) {
+	completed := r.tracker.register(predictionID, pending.progress)
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	// Webhooks carry the result, so polling only needs to catch missed deliveries
+	interval := 500 * time.Millisecond
+	maxInterval := 5 * time.Second
+	if r.webhookURL != "" {
+		interval = 2 * time.Second
+		maxInterval = 15 * time.Second
+	}
+	poll := time.NewTimer(interval)
+	defer poll.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
+			// Nobody will use the result, so stop paying for it
+			r.tracker.unregister(predictionID)
+			go r.cancelPrediction(predictionID)
 			return nil, ctx.Err()
-		case <-ticker.C:
-			if time.Now().After(deadline) {
-				return nil, fmt.Errorf("prediction timeout")
-			}
 
+		case <-deadline.C:
+			r.tracker.orphan(predictionID, pending)
+			r.logger.Info("Prediction still running after wait timeout, reconciling later",
+				"prediction_id", predictionID,
+				"timeout", timeout)
+			return nil, &PredictionPendingError{PredictionID: predictionID, Index: pending.index, Seed: pending.seed}
+
+		case prediction := <-completed:
+			return checkPrediction(prediction)
+
+		case <-poll.C:
 			prediction, err := r.getPrediction(ctx, predictionID)
 			if err != nil {
+				r.tracker.unregister(predictionID)
 				return nil, err
 			}
 
-			switch prediction.Status {
-			case "succeeded":
-				return prediction, nil
-			case "failed", "canceled":
-				return nil, fmt.Errorf("prediction failed: %v", prediction.Error)
+			if isTerminalStatus(prediction.Status) {
+				r.tracker.unregister(predictionID)
+				return checkPrediction(prediction)
 			}
+			if pending.progress != nil {
+				pending.progress(prediction)
+			}
+
+			interval *= 2
+			if interval > maxInterval {
+				interval = maxInterval
+			}
+			poll.Reset(interval)
 		}
 	}
 }
 
-// getPrediction fetches prediction status
+// checkPrediction converts a terminal prediction into a result or an error
+func checkPrediction(prediction *replicatePrediction) (*replicatePrediction, error) {
+	if prediction.Status != "succeeded" {
+		return nil, newPredictionError(prediction)
+	}
+	return prediction, nil
+}
+
+// getPrediction fetches prediction status, retrying transient failures
 func (r *Renderer) getPrediction(ctx context.Context, predictionID string) (*replicatePrediction, error) {
+	var prediction *replicatePrediction
+	err := r.callProvider(ctx, "", r.resilience.readLimiter, func() error {
+		var err error
+		prediction, err = r.doGetPrediction(ctx, predictionID)
+		return err
+	})
+	return prediction, err
+}
+
+// doGetPrediction makes a single prediction status request
+func (r *Renderer) doGetPrediction(ctx context.Context, predictionID string) (*replicatePrediction, error) {
 	url := fmt.Sprintf("https://api.replicate.com/v1/predictions/%s", predictionID)
 	
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
@@ -310,10 +544,15 @@ func (r *Renderer) getPrediction(ctx context.Context, predictionID string) (*rep
 
 	resp, err := r.httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, newTransportError(ctx, "get", "", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, newHTTPError("get", "", resp, body)
+	}
+
 	var prediction replicatePrediction
 	if err := json.NewDecoder(resp.Body).Decode(&prediction); err != nil {
 		return nil, err
@@ -322,6 +561,55 @@ func (r *Renderer) getPrediction(ctx context.Context, predictionID string) (*rep
 	return &prediction, nil
 }
 
+// CancelPrediction stops a prediction awaiting late reconciliation, e.g. because
+// its job was cancelled
+func (r *Renderer) CancelPrediction(predictionID string) {
+	if pending := r.tracker.forget(predictionID); pending != nil {
+		r.settleProviderCall(predictionID, pending, "canceled")
+	}
+	go r.cancelPrediction(predictionID)
+}
+
+// cancelPrediction asks the provider to stop a prediction. It runs detached from
+// the render call, whose context is usually the one that was cancelled.
+func (r *Renderer) cancelPrediction(predictionID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), cancelPredictionTimeout)
+	defer cancel()
+
+	err := r.callProvider(ctx, "", r.resilience.readLimiter, func() error {
+		return r.doCancelPrediction(ctx, predictionID)
+	})
+	if err != nil {
+		r.logger.Warn("Failed to cancel prediction", "prediction_id", predictionID, "error", err)
+		return
+	}
+	r.logger.Info("Cancelled prediction", "prediction_id", predictionID)
+}
+
+// doCancelPrediction makes a single prediction cancel request
+func (r *Renderer) doCancelPrediction(ctx context.Context, predictionID string) error {
+	url := fmt.Sprintf("https://api.replicate.com/v1/predictions/%s/cancel", predictionID)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", r.replicateToken))
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return newTransportError(ctx, "cancel", "", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return newHTTPError("cancel", "", resp, body)
+	}
+	return nil
+}
+
 // extractPromptComponents extracts structured components from parameters
 func (r *Renderer) extractPromptComponents(params map[string]interface{}) PromptComponents {
 	components := PromptComponents{}
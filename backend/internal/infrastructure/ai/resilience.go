@@ -0,0 +1,537 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProviderError is a failed provider call, classified as transient or permanent
+type ProviderError struct {
+	Op         string // create, get or prediction
+	Model      string
+	StatusCode int // 0 when no HTTP response was received
+	Message    string
+	Transient  bool
+	RetryAfter time.Duration // requested by a 429 or 503 response
+	Err        error
+}
+
+func (e *ProviderError) Error() string {
+	kind := "permanent"
+	if e.Transient {
+		kind = "transient"
+	}
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("provider %s failed (%s, status %d): %s", e.Op, kind, e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("provider %s failed (%s): %s", e.Op, kind, e.Message)
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// CircuitOpenError is returned without calling the provider while a model's breaker is open
+type CircuitOpenError struct {
+	Model   string
+	RetryAt time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit open for model %s until %s", e.Model, e.RetryAt.Format(time.RFC3339))
+}
+
+// IsPermanent reports whether err is a failure that retrying cannot fix, such as
+// input rejected by moderation or the provider's content filter. Joined errors, as returned when
+// every variant of a render fails, are permanent only if all of them are.
+func IsPermanent(err error) bool {
+	switch e := err.(type) {
+	case nil:
+		return false
+	case *ProviderError:
+		return !e.Transient
+	case *ModerationError:
+		return true
+	case interface{ Unwrap() []error }:
+		errs := e.Unwrap()
+		for _, err := range errs {
+			if !IsPermanent(err) {
+				return false
+			}
+		}
+		return len(errs) > 0
+	case interface{ Unwrap() error }:
+		return IsPermanent(e.Unwrap())
+	default:
+		return false
+	}
+}
+
+// ResilienceConfig configures retries, circuit breaking and rate limiting of provider calls
+type ResilienceConfig struct {
+	MaxRetries       int           // retries after the first attempt
+	RetryBaseDelay   time.Duration // doubled per attempt, with full jitter
+	RetryMaxDelay    time.Duration
+	MaxRetryAfter    time.Duration // longer Retry-After values fail the call instead
+	BreakerThreshold int           // consecutive transient failures that open a breaker
+	BreakerCooldown  time.Duration // time before an open breaker lets a probe through
+	CreateRateLimit  float64       // prediction creations per second
+	ReadRateLimit    float64       // status reads per second
+}
+
+// DefaultResilienceConfig returns limits that stay under Replicate's published rate
+// limits of 600 creations and 3000 other requests per minute
+func DefaultResilienceConfig() ResilienceConfig {
+	return ResilienceConfig{
+		MaxRetries:       3,
+		RetryBaseDelay:   500 * time.Millisecond,
+		RetryMaxDelay:    10 * time.Second,
+		MaxRetryAfter:    time.Minute,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+		CreateRateLimit:  10,
+		ReadRateLimit:    50,
+	}
+}
+
+// resilience holds the retry policy, breakers and rate limiters of a renderer
+type resilience struct {
+	config        ResilienceConfig
+	breakers      *breakerSet
+	createLimiter *tokenBucket
+	readLimiter   *tokenBucket
+}
+
+func newResilience(config ResilienceConfig) *resilience {
+	return &resilience{
+		config:        config,
+		breakers:      newBreakerSet(config.BreakerThreshold, config.BreakerCooldown),
+		createLimiter: newTokenBucket(config.CreateRateLimit, int(config.CreateRateLimit)),
+		readLimiter:   newTokenBucket(config.ReadRateLimit, int(config.ReadRateLimit)),
+	}
+}
+
+// ConfigureResilience replaces the renderer's retry, breaker and rate limit settings
+func (r *Renderer) ConfigureResilience(config ResilienceConfig) {
+	r.resilience = newResilience(config)
+}
+
+// ProviderStatus reports the state of each model's circuit breaker
+type ProviderStatus struct {
+	Breakers        []BreakerStatus `json:"breakers"`
+	CreateRateLimit float64         `json:"create_rate_limit_per_second"`
+	ReadRateLimit   float64         `json:"read_rate_limit_per_second"`
+}
+
+// ProviderStatus returns breaker states and rate limits for system status reporting
+func (r *Renderer) ProviderStatus() ProviderStatus {
+	return ProviderStatus{
+		Breakers:        r.resilience.breakers.statuses(),
+		CreateRateLimit: r.resilience.config.CreateRateLimit,
+		ReadRateLimit:   r.resilience.config.ReadRateLimit,
+	}
+}
+
+// callProvider runs a provider call through the model's breaker and the rate limiter,
+// retrying retryable failures with jittered exponential backoff. model may be empty
+// for calls not tied to a model, which bypass the breaker.
+func (r *Renderer) callProvider(ctx context.Context, model string, limiter *tokenBucket, call func() error) error {
+	res := r.resilience
+
+	var breaker *circuitBreaker
+	if model != "" {
+		breaker = res.breakers.get(model)
+	}
+
+	for attempt := 0; ; attempt++ {
+		if breaker != nil {
+			if err := breaker.allow(); err != nil {
+				return err
+			}
+		}
+
+		if err := limiter.wait(ctx); err != nil {
+			if breaker != nil {
+				breaker.cancelProbe()
+			}
+			return err
+		}
+
+		err := call()
+
+		var providerErr *ProviderError
+		isProviderErr := errors.As(err, &providerErr)
+		if breaker != nil {
+			switch {
+			case err == nil:
+				breaker.record(true, "")
+			case isProviderErr && providerErr.Transient && providerErr.StatusCode != http.StatusTooManyRequests:
+				breaker.record(false, providerErr.Message)
+			default:
+				// Rejected inputs, account rate limits and cancellations say nothing
+				// about the model's health
+				breaker.cancelProbe()
+			}
+		}
+
+		if err == nil || !isProviderErr || !retryable(providerErr) || attempt >= res.config.MaxRetries {
+			return err
+		}
+
+		delay := backoffDelay(attempt, res.config.RetryBaseDelay, res.config.RetryMaxDelay)
+		if providerErr.RetryAfter > 0 {
+			if providerErr.RetryAfter > res.config.MaxRetryAfter {
+				return err
+			}
+			delay = providerErr.RetryAfter
+		}
+
+		r.logger.Warn("Retrying provider call",
+			"model", model,
+			"attempt", attempt+1,
+			"delay", delay,
+			"error", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryable reports whether a failed call can safely be repeated. A prediction
+// creation is only retried when the provider answered with an error status or the
+// connection was never made; otherwise the prediction may exist and a retry would
+// start, and bill, a duplicate.
+func retryable(err *ProviderError) bool {
+	if !err.Transient {
+		return false
+	}
+	if err.Op != "create" || err.StatusCode != 0 {
+		return true
+	}
+
+	var opErr *net.OpError
+	return errors.As(err.Err, &opErr) && opErr.Op == "dial"
+}
+
+// backoffDelay returns a full-jitter delay for the given attempt
+func backoffDelay(attempt int, base, max time.Duration) time.Duration {
+	ceiling := base << attempt
+	if ceiling <= 0 || ceiling > max {
+		ceiling = max
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)) + 1)
+}
+
+// newHTTPError classifies a non-success HTTP response
+func newHTTPError(op, model string, resp *http.Response, body []byte) *ProviderError {
+	err := &ProviderError{
+		Op:         op,
+		Model:      model,
+		StatusCode: resp.StatusCode,
+		Message:    strings.TrimSpace(string(body)),
+	}
+
+	switch resp.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooEarly, http.StatusTooManyRequests,
+		http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		err.Transient = true
+		err.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+
+	return err
+}
+
+// newTransportError classifies an error returned by the HTTP client
+func newTransportError(ctx context.Context, op, model string, err error) error {
+	// Cancellation is the caller's decision, not a provider failure
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return &ProviderError{
+		Op:        op,
+		Model:     model,
+		Message:   err.Error(),
+		Transient: true,
+		Err:       err,
+	}
+}
+
+// transientPredictionErrors are failure messages caused by the provider's
+// infrastructure rather than by the request
+var transientPredictionErrors = []string{
+	"out of memory",
+	"timed out",
+	"timeout",
+	"temporarily unavailable",
+	"internal error",
+	"failed to boot",
+	"connection reset",
+}
+
+// newPredictionError classifies a prediction that finished with status failed or canceled
+func newPredictionError(prediction *replicatePrediction) *ProviderError {
+	message := fmt.Sprint(prediction.Error)
+	if prediction.Error == nil {
+		message = "prediction " + prediction.Status
+	}
+
+	err := &ProviderError{
+		Op:      "prediction",
+		Message: message,
+	}
+
+	lower := strings.ToLower(message)
+	for _, pattern := range transientPredictionErrors {
+		if strings.Contains(lower, pattern) {
+			err.Transient = true
+			break
+		}
+	}
+
+	return err
+}
+
+// recordPredictionOutcome feeds a finished prediction into the model's breaker, so a
+// model whose predictions keep failing on the provider's side is opened too
+func (r *Renderer) recordPredictionOutcome(model string, err error) {
+	var providerErr *ProviderError
+	switch {
+	case err == nil:
+		r.resilience.breakers.get(model).record(true, "")
+	case errors.As(err, &providerErr) && providerErr.Op == "prediction" && providerErr.Transient:
+		r.resilience.breakers.get(model).record(false, providerErr.Message)
+	}
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// Breaker states
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// BreakerStatus is the observable state of one model's circuit breaker
+type BreakerStatus struct {
+	Model               string     `json:"model"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+}
+
+// circuitBreaker stops calls to a failing model. After the cooldown a single probe
+// is let through; its outcome closes the breaker or opens it again.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	model     string
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	state     string
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	lastError string
+}
+
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		retryAt := b.openedAt.Add(b.cooldown)
+		if b.now().Before(retryAt) {
+			return &CircuitOpenError{Model: b.model, RetryAt: retryAt}
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return nil
+	case BreakerHalfOpen:
+		if b.probing {
+			return &CircuitOpenError{Model: b.model, RetryAt: b.now().Add(b.cooldown)}
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+func (b *circuitBreaker) record(success bool, message string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if success {
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	b.lastError = message
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// cancelProbe releases a half-open probe whose call said nothing about the model
+func (b *circuitBreaker) cancelProbe() {
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+func (b *circuitBreaker) status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{
+		Model:               b.model,
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		LastError:           b.lastError,
+	}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
+
+// breakerSet holds one circuit breaker per model
+type breakerSet struct {
+	mu        sync.Mutex
+	breakers  map[string]*circuitBreaker
+	threshold int
+	cooldown  time.Duration
+}
+
+func newBreakerSet(threshold int, cooldown time.Duration) *breakerSet {
+	return &breakerSet{
+		breakers:  make(map[string]*circuitBreaker),
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+func (s *breakerSet) get(model string) *circuitBreaker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.breakers[model]
+	if !ok {
+		b = &circuitBreaker{
+			model:     model,
+			threshold: s.threshold,
+			cooldown:  s.cooldown,
+			now:       time.Now,
+			state:     BreakerClosed,
+		}
+		s.breakers[model] = b
+	}
+	return b
+}
+
+func (s *breakerSet) statuses() []BreakerStatus {
+	s.mu.Lock()
+	breakers := make([]*circuitBreaker, 0, len(s.breakers))
+	for _, b := range s.breakers {
+		breakers = append(breakers, b)
+	}
+	s.mu.Unlock()
+
+	statuses := make([]BreakerStatus, 0, len(breakers))
+	for _, b := range breakers {
+		statuses = append(statuses, b.status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Model < statuses[j].Model })
+	return statuses
+}
+
+// tokenBucket is a client-side rate limiter refilled continuously at rate tokens per second
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// wait blocks until a token is available or ctx is done. A zero rate disables limiting.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	if b.rate <= 0 {
+		return nil
+	}
+
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
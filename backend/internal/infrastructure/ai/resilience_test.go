@@ -0,0 +1,297 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func testResilienceRenderer(config ResilienceConfig) *Renderer {
+	renderer := NewRenderer("", nil, testLogger{})
+	renderer.ConfigureResilience(config)
+	return renderer
+}
+
+func fastResilienceConfig() ResilienceConfig {
+	config := DefaultResilienceConfig()
+	config.RetryBaseDelay = time.Millisecond
+	config.RetryMaxDelay = 5 * time.Millisecond
+	config.CreateRateLimit = 0
+	config.ReadRateLimit = 0
+	return config
+}
+
+func TestNewHTTPErrorClassification(t *testing.T) {
+	tests := []struct {
+		status    int
+		transient bool
+	}{
+		{http.StatusBadRequest, false},
+		{http.StatusUnauthorized, false},
+		{http.StatusPaymentRequired, false},
+		{http.StatusNotFound, false},
+		{http.StatusUnprocessableEntity, false},
+		{http.StatusTooManyRequests, true},
+		{http.StatusInternalServerError, true},
+		{http.StatusBadGateway, true},
+		{http.StatusServiceUnavailable, true},
+	}
+
+	for _, tt := range tests {
+		resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+		err := newHTTPError("create", "model", resp, []byte("body"))
+		if err.Transient != tt.transient {
+			t.Errorf("status %d: expected transient=%v, got %v", tt.status, tt.transient, err.Transient)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if got := parseRetryAfter("7", now); got != 7*time.Second {
+		t.Errorf("expected 7s, got %s", got)
+	}
+	date := now.Add(30 * time.Second).Format(http.TimeFormat)
+	if got := parseRetryAfter(date, now); got != 30*time.Second {
+		t.Errorf("expected 30s, got %s", got)
+	}
+	if got := parseRetryAfter("soon", now); got != 0 {
+		t.Errorf("expected 0 for an invalid value, got %s", got)
+	}
+}
+
+func TestNewPredictionErrorClassification(t *testing.T) {
+	oom := newPredictionError(&replicatePrediction{Status: "failed", Error: "CUDA out of memory"})
+	if !oom.Transient {
+		t.Error("expected out of memory failure to be transient")
+	}
+
+	nsfw := newPredictionError(&replicatePrediction{Status: "failed", Error: "NSFW content detected"})
+	if nsfw.Transient {
+		t.Error("expected NSFW failure to be permanent")
+	}
+}
+
+func TestIsPermanent(t *testing.T) {
+	permanent := &ProviderError{Op: "create", StatusCode: 422}
+	transient := &ProviderError{Op: "create", StatusCode: 503, Transient: true}
+
+	if !IsPermanent(fmt.Errorf("render failed: %w", permanent)) {
+		t.Error("expected wrapped permanent error to be permanent")
+	}
+	if IsPermanent(transient) {
+		t.Error("expected transient error not to be permanent")
+	}
+	if IsPermanent(errors.New("unknown")) {
+		t.Error("expected unclassified error not to be permanent")
+	}
+	if IsPermanent(errors.Join(permanent, transient)) {
+		t.Error("expected mixed joined errors not to be permanent")
+	}
+	if !IsPermanent(errors.Join(permanent, permanent)) {
+		t.Error("expected all-permanent joined errors to be permanent")
+	}
+}
+
+func TestCallProviderRetriesTransientFailures(t *testing.T) {
+	renderer := testResilienceRenderer(fastResilienceConfig())
+
+	calls := 0
+	err := renderer.callProvider(context.Background(), "", renderer.resilience.readLimiter, func() error {
+		calls++
+		if calls < 3 {
+			return &ProviderError{Op: "get", StatusCode: 502, Transient: true}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected success after retries, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls, got %d", calls)
+	}
+}
+
+func TestCallProviderDoesNotRetryPermanentFailures(t *testing.T) {
+	renderer := testResilienceRenderer(fastResilienceConfig())
+
+	calls := 0
+	err := renderer.callProvider(context.Background(), "model", renderer.resilience.createLimiter, func() error {
+		calls++
+		return &ProviderError{Op: "create", StatusCode: 422}
+	})
+	if !IsPermanent(err) {
+		t.Fatalf("expected permanent error, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 call, got %d", calls)
+	}
+}
+
+func TestCallProviderDoesNotRetryAmbiguousCreate(t *testing.T) {
+	renderer := testResilienceRenderer(fastResilienceConfig())
+
+	// A timeout after the request was sent may have created the prediction
+	calls := 0
+	renderer.callProvider(context.Background(), "model", renderer.resilience.createLimiter, func() error {
+		calls++
+		return &ProviderError{Op: "create", Transient: true, Err: errors.New("read timeout")}
+	})
+	if calls != 1 {
+		t.Errorf("expected ambiguous create not to be retried, got %d calls", calls)
+	}
+
+	// A refused connection never reached the provider
+	calls = 0
+	renderer.callProvider(context.Background(), "model2", renderer.resilience.createLimiter, func() error {
+		calls++
+		return &ProviderError{Op: "create", Transient: true, Err: &net.OpError{Op: "dial", Err: errors.New("refused")}}
+	})
+	if calls != 4 {
+		t.Errorf("expected dial failures to be retried, got %d calls", calls)
+	}
+}
+
+func TestCallProviderHonoursRetryAfter(t *testing.T) {
+	config := fastResilienceConfig()
+	config.MaxRetries = 1
+	renderer := testResilienceRenderer(config)
+
+	started := time.Now()
+	calls := 0
+	renderer.callProvider(context.Background(), "", renderer.resilience.readLimiter, func() error {
+		calls++
+		if calls == 1 {
+			return &ProviderError{Op: "get", StatusCode: 429, Transient: true, RetryAfter: 50 * time.Millisecond}
+		}
+		return nil
+	})
+	if elapsed := time.Since(started); elapsed < 50*time.Millisecond {
+		t.Errorf("expected retry to wait for Retry-After, waited %s", elapsed)
+	}
+
+	config.MaxRetryAfter = 10 * time.Millisecond
+	renderer = testResilienceRenderer(config)
+	calls = 0
+	renderer.callProvider(context.Background(), "", renderer.resilience.readLimiter, func() error {
+		calls++
+		return &ProviderError{Op: "get", StatusCode: 429, Transient: true, RetryAfter: time.Hour}
+	})
+	if calls != 1 {
+		t.Errorf("expected no retry past the maximum Retry-After, got %d calls", calls)
+	}
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	breakers := newBreakerSet(2, time.Minute)
+	breaker := breakers.get("model")
+	breaker.now = func() time.Time { return now }
+
+	breaker.record(false, "boom")
+	if breaker.status().State != BreakerClosed {
+		t.Fatal("expected breaker to stay closed below the threshold")
+	}
+	breaker.record(false, "boom")
+	if breaker.status().State != BreakerOpen {
+		t.Fatal("expected breaker to open at the threshold")
+	}
+
+	var openErr *CircuitOpenError
+	if err := breaker.allow(); !errors.As(err, &openErr) {
+		t.Fatalf("expected CircuitOpenError while open, got %v", err)
+	}
+
+	// After the cooldown a single probe is allowed through
+	now = now.Add(time.Minute)
+	if err := breaker.allow(); err != nil {
+		t.Fatalf("expected probe to be allowed, got %v", err)
+	}
+	if breaker.status().State != BreakerHalfOpen {
+		t.Fatal("expected breaker to be half-open during the probe")
+	}
+	if err := breaker.allow(); err == nil {
+		t.Fatal("expected concurrent calls to be rejected during the probe")
+	}
+
+	// A failed probe reopens the circuit
+	breaker.record(false, "still down")
+	if breaker.status().State != BreakerOpen {
+		t.Fatal("expected failed probe to reopen the breaker")
+	}
+
+	now = now.Add(time.Minute)
+	breaker.allow()
+	breaker.record(true, "")
+	status := breaker.status()
+	if status.State != BreakerClosed || status.ConsecutiveFailures != 0 {
+		t.Errorf("expected successful probe to close the breaker, got %+v", status)
+	}
+}
+
+func TestCallProviderOpensBreaker(t *testing.T) {
+	config := fastResilienceConfig()
+	config.MaxRetries = 0
+	config.BreakerThreshold = 2
+	renderer := testResilienceRenderer(config)
+
+	fail := func() error {
+		return &ProviderError{Op: "create", StatusCode: 503, Transient: true, Message: "unavailable"}
+	}
+	renderer.callProvider(context.Background(), "model", renderer.resilience.createLimiter, fail)
+	renderer.callProvider(context.Background(), "model", renderer.resilience.createLimiter, fail)
+
+	called := false
+	err := renderer.callProvider(context.Background(), "model", renderer.resilience.createLimiter, func() error {
+		called = true
+		return nil
+	})
+	var openErr *CircuitOpenError
+	if !errors.As(err, &openErr) || called {
+		t.Fatalf("expected open circuit to short-circuit the call, got %v", err)
+	}
+
+	statuses := renderer.ProviderStatus().Breakers
+	if len(statuses) != 1 || statuses[0].State != BreakerOpen || statuses[0].LastError != "unavailable" {
+		t.Errorf("unexpected breaker status: %+v", statuses)
+	}
+
+	// Permanent failures do not count against the model
+	renderer.callProvider(context.Background(), "other", renderer.resilience.createLimiter, func() error {
+		return &ProviderError{Op: "create", StatusCode: 422}
+	})
+	renderer.callProvider(context.Background(), "other", renderer.resilience.createLimiter, func() error {
+		return &ProviderError{Op: "create", StatusCode: 422}
+	})
+	if state := renderer.resilience.breakers.get("other").status().State; state != BreakerClosed {
+		t.Errorf("expected permanent failures to leave the breaker closed, got %s", state)
+	}
+}
+
+func TestTokenBucketLimitsRate(t *testing.T) {
+	bucket := newTokenBucket(100, 1)
+
+	started := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := bucket.wait(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// One token in the burst, then two more at 10ms each
+	if elapsed := time.Since(started); elapsed < 15*time.Millisecond {
+		t.Errorf("expected rate limiting to delay calls, took %s", elapsed)
+	}
+
+	slow := newTokenBucket(0.001, 1)
+	slow.wait(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := slow.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected wait to respect the context, got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package ai
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/compozit/vision/backend/internal/domain/entities"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrSpaceAnalysisNotFound is returned for unknown space analyses
+var ErrSpaceAnalysisNotFound = errors.New("space analysis not found")
+
+// PostgresSpaceAnalysisSource loads analysed room photos from the space_analyses table
+type PostgresSpaceAnalysisSource struct {
+	db *sqlx.DB
+}
+
+// NewPostgresSpaceAnalysisSource creates a source reading space analyses from the database
+func NewPostgresSpaceAnalysisSource(db *sqlx.DB) *PostgresSpaceAnalysisSource {
+	return &PostgresSpaceAnalysisSource{db: db}
+}
+
+// spaceAnalysisRow is a space_analyses row before its JSON columns are decoded
+type spaceAnalysisRow struct {
+	ID                 uuid.UUID               `db:"id"`
+	UserID             uuid.UUID               `db:"user_id"`
+	ProjectID          *uuid.UUID              `db:"project_id"`
+	ImageURL           string                  `db:"image_url"`
+	ProcessedImageURL  *string                 `db:"processed_image_url"`
+	RoomType           entities.RoomType       `db:"room_type"`
+	RoomTypeConfidence float64                 `db:"room_type_confidence"`
+	Dimensions         []byte                  `db:"dimensions"`
+	ExistingFurniture  []byte                  `db:"existing_furniture"`
+	SpatialFeatures    []byte                  `db:"spatial_features"`
+	StyleAnalysis      []byte                  `db:"style_analysis"`
+	LightingAnalysis   []byte                  `db:"lighting_analysis"`
+	ColorPalette       []byte                  `db:"color_palette"`
+	Recommendations    []byte                  `db:"recommendations"`
+	AnalysisMetadata   []byte                  `db:"analysis_metadata"`
+	Status             entities.AnalysisStatus `db:"status"`
+	CreatedAt          time.Time               `db:"created_at"`
+	UpdatedAt          time.Time               `db:"updated_at"`
+}
+
+// GetSpaceAnalysisByID returns a space analysis with its detected furniture
+func (s *PostgresSpaceAnalysisSource) GetSpaceAnalysisByID(ctx context.Context, id uuid.UUID) (*entities.SpaceAnalysis, error) {
+	query := `SELECT id, user_id, project_id, image_url, processed_image_url, room_type,
+			room_type_confidence, dimensions, existing_furniture, spatial_features, style_analysis,
+			lighting_analysis, color_palette, recommendations, analysis_metadata, status,
+			created_at, updated_at
+		FROM space_analyses
+		WHERE id = $1`
+
+	var row spaceAnalysisRow
+	if err := s.db.GetContext(ctx, &row, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrSpaceAnalysisNotFound, id)
+		}
+		return nil, fmt.Errorf("failed to query space analysis: %w", err)
+	}
+
+	analysis := &entities.SpaceAnalysis{
+		ID:                 row.ID,
+		UserID:             row.UserID,
+		ProjectID:          row.ProjectID,
+		ImageURL:           row.ImageURL,
+		ProcessedImageURL:  row.ProcessedImageURL,
+		RoomType:           row.RoomType,
+		RoomTypeConfidence: row.RoomTypeConfidence,
+		Status:             row.Status,
+		CreatedAt:          row.CreatedAt,
+		UpdatedAt:          row.UpdatedAt,
+	}
+
+	columns := []struct {
+		data []byte
+		dest interface{}
+	}{
+		{row.Dimensions, &analysis.Dimensions},
+		{row.ExistingFurniture, &analysis.ExistingFurniture},
+		{row.SpatialFeatures, &analysis.SpatialFeatures},
+		{row.StyleAnalysis, &analysis.StyleAnalysis},
+		{row.LightingAnalysis, &analysis.LightingAnalysis},
+		{row.ColorPalette, &analysis.ColorPalette},
+		{row.Recommendations, &analysis.Recommendations},
+		{row.AnalysisMetadata, &analysis.AnalysisMetadata},
+	}
+	for _, column := range columns {
+		if len(column.data) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(column.data, column.dest); err != nil {
+			return nil, fmt.Errorf("failed to decode space analysis %s: %w", row.ID, err)
+		}
+	}
+
+	return analysis, nil
+}
+
+var _ SpaceAnalysisSource = (*PostgresSpaceAnalysisSource)(nil)
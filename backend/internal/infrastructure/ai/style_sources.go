@@ -0,0 +1,136 @@
+package ai
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/compozit/vision/backend/internal/domain/entities"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrStyleReferenceNotFound is returned for unknown or inactive style references
+	ErrStyleReferenceNotFound = errors.New("style reference not found")
+
+	// ErrAmbianceOptionNotFound is returned for unknown ambiance options
+	ErrAmbianceOptionNotFound = errors.New("ambiance option not found")
+)
+
+// PostgresStyleResolver loads curated styles from the style_references and
+// ambiance_options tables. Inactive styles are not resolved, so renders using
+// their slug fall back to the built-in templates.
+type PostgresStyleResolver struct {
+	db *sqlx.DB
+}
+
+// NewPostgresStyleResolver creates a resolver reading the style catalogue from the database
+func NewPostgresStyleResolver(db *sqlx.DB) *PostgresStyleResolver {
+	return &PostgresStyleResolver{db: db}
+}
+
+const styleReferenceColumns = `id, name, slug, description, category, characteristic_tags,
+	color_palettes, furniture_styles, ambiance_options, room_examples, is_active, created_at, updated_at`
+
+// styleReferenceRow is a style_references row before its JSON columns are decoded
+type styleReferenceRow struct {
+	ID                 uuid.UUID      `db:"id"`
+	Name               string         `db:"name"`
+	Slug               string         `db:"slug"`
+	Description        string         `db:"description"`
+	Category           string         `db:"category"`
+	CharacteristicTags pq.StringArray `db:"characteristic_tags"`
+	ColorPalettes      []byte         `db:"color_palettes"`
+	FurnitureStyles    []byte         `db:"furniture_styles"`
+	AmbianceOptions    []byte         `db:"ambiance_options"`
+	RoomExamples       []byte         `db:"room_examples"`
+	IsActive           bool           `db:"is_active"`
+	CreatedAt          time.Time      `db:"created_at"`
+	UpdatedAt          time.Time      `db:"updated_at"`
+}
+
+// GetStyleReferenceByID returns an active style reference
+func (s *PostgresStyleResolver) GetStyleReferenceByID(ctx context.Context, id uuid.UUID) (*entities.StyleReference, error) {
+	return s.getStyleReference(ctx, `SELECT `+styleReferenceColumns+`
+		FROM style_references
+		WHERE id = $1 AND is_active`, id)
+}
+
+// GetStyleReferenceBySlug returns the active style reference with slug
+func (s *PostgresStyleResolver) GetStyleReferenceBySlug(ctx context.Context, slug string) (*entities.StyleReference, error) {
+	return s.getStyleReference(ctx, `SELECT `+styleReferenceColumns+`
+		FROM style_references
+		WHERE slug = $1 AND is_active`, slug)
+}
+
+func (s *PostgresStyleResolver) getStyleReference(ctx context.Context, query string, arg interface{}) (*entities.StyleReference, error) {
+	var row styleReferenceRow
+	if err := s.db.GetContext(ctx, &row, query, arg); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %v", ErrStyleReferenceNotFound, arg)
+		}
+		return nil, fmt.Errorf("failed to query style reference: %w", err)
+	}
+
+	style := &entities.StyleReference{
+		ID:                 row.ID,
+		Name:               row.Name,
+		Slug:               row.Slug,
+		Description:        row.Description,
+		Category:           row.Category,
+		CharacteristicTags: row.CharacteristicTags,
+		IsActive:           row.IsActive,
+		CreatedAt:          row.CreatedAt,
+		UpdatedAt:          row.UpdatedAt,
+	}
+
+	columns := []struct {
+		data []byte
+		dest interface{}
+	}{
+		{row.ColorPalettes, &style.ColorPalettes},
+		{row.FurnitureStyles, &style.FurnitureStyles},
+		{row.AmbianceOptions, &style.AmbianceOptions},
+		{row.RoomExamples, &style.RoomExamples},
+	}
+	for _, column := range columns {
+		if len(column.data) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(column.data, column.dest); err != nil {
+			return nil, fmt.Errorf("failed to decode style reference %s: %w", row.Slug, err)
+		}
+	}
+
+	return style, nil
+}
+
+// GetAmbianceOptionByID returns an ambiance option
+func (s *PostgresStyleResolver) GetAmbianceOptionByID(ctx context.Context, id uuid.UUID) (*entities.AmbianceOption, error) {
+	query := `SELECT id, name, description, mood_tags, lighting_preset, color_adjustment,
+			texture_emphasis, preview_image_url
+		FROM ambiance_options
+		WHERE id = $1`
+
+	var row struct {
+		entities.AmbianceOption
+		MoodTags pq.StringArray `db:"mood_tags"`
+	}
+	if err := s.db.GetContext(ctx, &row, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrAmbianceOptionNotFound, id)
+		}
+		return nil, fmt.Errorf("failed to query ambiance option: %w", err)
+	}
+
+	ambiance := row.AmbianceOption
+	ambiance.MoodTags = row.MoodTags
+	return &ambiance, nil
+}
+
+var _ StyleResolver = (*PostgresStyleResolver)(nil)
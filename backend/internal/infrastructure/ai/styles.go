@@ -0,0 +1,179 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/compozit/vision/backend/internal/domain/entities"
+	"github.com/google/uuid"
+)
+
+// ErrStylesNotConfigured is returned when a style reference is requested without a StyleResolver
+var ErrStylesNotConfigured = errors.New("style references are not configured")
+
+// StyleResolver loads curated styles from the style catalogue.
+// repositories.SpaceAnalysisRepository satisfies it.
+type StyleResolver interface {
+	GetStyleReferenceByID(ctx context.Context, id uuid.UUID) (*entities.StyleReference, error)
+	GetStyleReferenceBySlug(ctx context.Context, slug string) (*entities.StyleReference, error)
+	GetAmbianceOptionByID(ctx context.Context, id uuid.UUID) (*entities.AmbianceOption, error)
+}
+
+// StyleSelection is a curated style with an optional ambiance and one of its colour
+// palettes. When set on a request it takes precedence over the StyleType.
+type StyleSelection struct {
+	Reference    *entities.StyleReference `json:"reference"`
+	Ambiance     *entities.AmbianceOption `json:"ambiance,omitempty"`
+	PaletteIndex int                      `json:"palette_index,omitempty"`
+}
+
+// LegacyStyleSlug returns the slug of the seeded StyleReference for a built-in style
+func LegacyStyleSlug(style StyleType) string {
+	return string(style)
+}
+
+// Palette returns the selected colour palette, or nil when the style has none at that index
+func (s *StyleSelection) Palette() *entities.StyleColorPalette {
+	if s == nil || s.Reference == nil || s.PaletteIndex < 0 || s.PaletteIndex >= len(s.Reference.ColorPalettes) {
+		return nil
+	}
+	return &s.Reference.ColorPalettes[s.PaletteIndex]
+}
+
+// promptData returns the data for the style reference prompt template
+func (s *StyleSelection) promptData() PromptData {
+	data := PromptData{
+		StyleName: s.Reference.Name,
+		StyleTags: s.Reference.CharacteristicTags,
+	}
+
+	seen := make(map[string]bool)
+	for _, guide := range s.Reference.FurnitureStyles {
+		for _, material := range guide.Materials {
+			material = humanizeStyleValue(material)
+			if material != "" && !seen[material] {
+				seen[material] = true
+				data.Materials = append(data.Materials, material)
+			}
+		}
+	}
+
+	if palette := s.Palette(); palette != nil {
+		for _, colors := range [][]entities.ColorInfo{palette.PrimaryColors, palette.AccentColors, palette.NeutralColors} {
+			for _, color := range colors {
+				name := strings.ToLower(color.Name)
+				if name == "" {
+					name = color.Hex
+				}
+				data.ColorScheme = append(data.ColorScheme, name)
+			}
+		}
+	}
+
+	if s.Ambiance != nil {
+		data.Mood = s.Ambiance.MoodTags
+		data.Lighting = humanizeStyleValue(s.Ambiance.LightingPreset)
+		data.ColorAdjustment = humanizeStyleValue(s.Ambiance.ColorAdjustment)
+		data.TextureEmphasis = humanizeStyleValue(s.Ambiance.TextureEmphasis)
+	}
+
+	return data
+}
+
+// metadata describes the selection for RenderResult.Metadata
+func (s *StyleSelection) metadata() map[string]interface{} {
+	metadata := map[string]interface{}{
+		"id":            s.Reference.ID,
+		"slug":          s.Reference.Slug,
+		"name":          s.Reference.Name,
+		"palette_index": s.PaletteIndex,
+	}
+	if palette := s.Palette(); palette != nil {
+		metadata["palette_name"] = palette.Name
+	}
+	if s.Ambiance != nil {
+		metadata["ambiance_option_id"] = s.Ambiance.ID
+		metadata["ambiance_name"] = s.Ambiance.Name
+	}
+	return metadata
+}
+
+// cacheKey identifies the selection in render cache keys. The update time is
+// included so edits by curators are not masked by cached renders.
+func (s *StyleSelection) cacheKey() string {
+	if s == nil || s.Reference == nil {
+		return ""
+	}
+	key := fmt.Sprintf("%s@%d/%d", s.Reference.ID, s.Reference.UpdatedAt.Unix(), s.PaletteIndex)
+	if s.Ambiance != nil {
+		key += "/" + s.Ambiance.ID.String()
+	}
+	return key
+}
+
+// humanizeStyleValue turns catalogue identifiers such as "warm_yellow" into prompt text
+func humanizeStyleValue(value string) string {
+	return strings.ToLower(strings.NewReplacer("_", " ", "-", " ").Replace(value))
+}
+
+// SetStyleResolver lets renders use curated styles from the style catalogue. Requests
+// with only a StyleType then use the seeded StyleReference of the same slug.
+func (r *Renderer) SetStyleResolver(resolver StyleResolver) {
+	r.styles = resolver
+}
+
+// LoadStyleSelection loads a style reference and optional ambiance option by ID
+func (r *Renderer) LoadStyleSelection(ctx context.Context, styleReferenceID, ambianceOptionID string, paletteIndex int) (*StyleSelection, error) {
+	if r.styles == nil {
+		return nil, ErrStylesNotConfigured
+	}
+
+	styleID, err := uuid.Parse(styleReferenceID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid style reference ID: %w", err)
+	}
+
+	reference, err := r.styles.GetStyleReferenceByID(ctx, styleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load style reference: %w", err)
+	}
+
+	selection := &StyleSelection{Reference: reference, PaletteIndex: paletteIndex}
+	if paletteIndex != 0 && selection.Palette() == nil {
+		return nil, fmt.Errorf("style %s has no color palette %d", reference.Slug, paletteIndex)
+	}
+
+	if ambianceOptionID != "" {
+		ambianceID, err := uuid.Parse(ambianceOptionID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ambiance option ID: %w", err)
+		}
+		if selection.Ambiance, err = r.styles.GetAmbianceOptionByID(ctx, ambianceID); err != nil {
+			return nil, fmt.Errorf("failed to load ambiance option: %w", err)
+		}
+	}
+
+	return selection, nil
+}
+
+// resolveStyle returns the style selection to render with: the request's own
+// selection, or the seeded StyleReference for its StyleType. nil means the
+// built-in style templates are used.
+func (r *Renderer) resolveStyle(ctx context.Context, style StyleType, selection *StyleSelection) *StyleSelection {
+	if selection != nil && selection.Reference != nil {
+		return selection
+	}
+	if style == "" || r.styles == nil {
+		return nil
+	}
+
+	reference, err := r.styles.GetStyleReferenceBySlug(ctx, LegacyStyleSlug(style))
+	if err != nil || reference == nil {
+		r.logger.Debug("No style reference for style, using built-in templates", "style", style, "error", err)
+		return nil
+	}
+
+	return &StyleSelection{Reference: reference}
+}
@@ -0,0 +1,193 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/compozit/vision/backend/internal/domain/entities"
+	"github.com/google/uuid"
+)
+
+type fakeStyleResolver struct {
+	styles    map[uuid.UUID]*entities.StyleReference
+	ambiances map[uuid.UUID]*entities.AmbianceOption
+}
+
+func (f *fakeStyleResolver) GetStyleReferenceByID(ctx context.Context, id uuid.UUID) (*entities.StyleReference, error) {
+	if style, ok := f.styles[id]; ok {
+		return style, nil
+	}
+	return nil, errors.New("style reference not found")
+}
+
+func (f *fakeStyleResolver) GetStyleReferenceBySlug(ctx context.Context, slug string) (*entities.StyleReference, error) {
+	for _, style := range f.styles {
+		if style.Slug == slug {
+			return style, nil
+		}
+	}
+	return nil, errors.New("style reference not found")
+}
+
+func (f *fakeStyleResolver) GetAmbianceOptionByID(ctx context.Context, id uuid.UUID) (*entities.AmbianceOption, error) {
+	if ambiance, ok := f.ambiances[id]; ok {
+		return ambiance, nil
+	}
+	return nil, errors.New("ambiance option not found")
+}
+
+func testStyleReference() *entities.StyleReference {
+	return &entities.StyleReference{
+		ID:                 uuid.New(),
+		Name:               "Coastal Calm",
+		Slug:               "coastal-calm",
+		CharacteristicTags: []string{"airy", "relaxed"},
+		ColorPalettes: []entities.StyleColorPalette{
+			{
+				Name:          "Sand",
+				PrimaryColors: []entities.ColorInfo{{Hex: "#F4E1C1", Name: "Sand"}},
+			},
+			{
+				Name:          "Sea",
+				PrimaryColors: []entities.ColorInfo{{Hex: "#2E86AB", Name: "Ocean Blue"}},
+				AccentColors:  []entities.ColorInfo{{Hex: "#FFFFFF"}},
+			},
+		},
+		FurnitureStyles: []entities.FurnitureStyleGuide{
+			{Materials: []string{"rattan", "light-wood"}},
+			{Materials: []string{"linen", "rattan"}},
+		},
+		UpdatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func testAmbianceOption() *entities.AmbianceOption {
+	return &entities.AmbianceOption{
+		ID:              uuid.New(),
+		Name:            "Warm & Cozy",
+		MoodTags:        []string{"cozy", "intimate"},
+		LightingPreset:  "warm_yellow",
+		ColorAdjustment: "warm_tones",
+		TextureEmphasis: "textured",
+	}
+}
+
+func TestStyleReferencePrompt(t *testing.T) {
+	selection := &StyleSelection{
+		Reference:    testStyleReference(),
+		Ambiance:     testAmbianceOption(),
+		PaletteIndex: 1,
+	}
+
+	pb := NewPromptBuilder()
+	prompt, versions := pb.StyleTransferPrompt("room", "", selection, "u1")
+
+	for _, want := range []string{
+		"coastal calm style",
+		"airy, relaxed",
+		"rattan, light wood, linen materials",
+		"ocean blue, #FFFFFF color palette",
+		"cozy, intimate atmosphere",
+		"warm yellow lighting",
+		"warm tones color grading",
+		"textured textures",
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("Expected prompt to contain %q, got %q", want, prompt)
+		}
+	}
+	if strings.Contains(prompt, "sand") {
+		t.Errorf("Expected only the selected palette, got %q", prompt)
+	}
+
+	found := false
+	for _, version := range versions {
+		if version.Template == PromptTemplateStyleReference {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected style reference template version to be recorded, got %+v", versions)
+	}
+}
+
+func TestResolveStyleMapsLegacyStyle(t *testing.T) {
+	seeded := testStyleReference()
+	seeded.Slug = LegacyStyleSlug(StyleScandinavian)
+
+	renderer := NewRenderer("", nil, testLogger{})
+
+	// Without a resolver the built-in templates are used
+	if selection := renderer.resolveStyle(context.Background(), StyleScandinavian, nil); selection != nil {
+		t.Fatalf("Expected no selection without a resolver, got %+v", selection)
+	}
+
+	renderer.SetStyleResolver(&fakeStyleResolver{styles: map[uuid.UUID]*entities.StyleReference{seeded.ID: seeded}})
+
+	selection := renderer.resolveStyle(context.Background(), StyleScandinavian, nil)
+	if selection == nil || selection.Reference != seeded {
+		t.Fatalf("Expected the seeded reference for the legacy style, got %+v", selection)
+	}
+
+	if selection := renderer.resolveStyle(context.Background(), StyleRustic, nil); selection != nil {
+		t.Errorf("Expected unseeded style to fall back to built-in templates, got %+v", selection)
+	}
+
+	custom := &StyleSelection{Reference: testStyleReference()}
+	if selection := renderer.resolveStyle(context.Background(), StyleScandinavian, custom); selection != custom {
+		t.Errorf("Expected an explicit selection to take precedence over the style type")
+	}
+}
+
+func TestLoadStyleSelection(t *testing.T) {
+	style := testStyleReference()
+	ambiance := testAmbianceOption()
+
+	renderer := NewRenderer("", nil, testLogger{})
+	if _, err := renderer.LoadStyleSelection(context.Background(), style.ID.String(), "", 0); !errors.Is(err, ErrStylesNotConfigured) {
+		t.Fatalf("Expected ErrStylesNotConfigured, got %v", err)
+	}
+
+	renderer.SetStyleResolver(&fakeStyleResolver{
+		styles:    map[uuid.UUID]*entities.StyleReference{style.ID: style},
+		ambiances: map[uuid.UUID]*entities.AmbianceOption{ambiance.ID: ambiance},
+	})
+
+	selection, err := renderer.LoadStyleSelection(context.Background(), style.ID.String(), ambiance.ID.String(), 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if selection.Reference != style || selection.Ambiance != ambiance || selection.Palette().Name != "Sea" {
+		t.Errorf("Unexpected selection: %+v", selection)
+	}
+
+	if _, err := renderer.LoadStyleSelection(context.Background(), style.ID.String(), "", 5); err == nil {
+		t.Error("Expected an error for a missing palette")
+	}
+	if _, err := renderer.LoadStyleSelection(context.Background(), "not-a-uuid", "", 0); err == nil {
+		t.Error("Expected an error for an invalid style ID")
+	}
+}
+
+func TestStyleSelectionCacheKey(t *testing.T) {
+	style := testStyleReference()
+
+	first := (&StyleSelection{Reference: style}).cacheKey()
+	second := (&StyleSelection{Reference: style, PaletteIndex: 1}).cacheKey()
+	if first == second {
+		t.Error("Expected palette index to change the cache key")
+	}
+
+	style.UpdatedAt = style.UpdatedAt.Add(time.Hour)
+	if edited := (&StyleSelection{Reference: style}).cacheKey(); edited == first {
+		t.Error("Expected edits to the style to change the cache key")
+	}
+
+	var none *StyleSelection
+	if none.cacheKey() != "" {
+		t.Error("Expected empty cache key without a selection")
+	}
+}
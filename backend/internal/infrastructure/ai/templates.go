@@ -0,0 +1,364 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/compozit/vision/backend/pkg/logger"
+)
+
+// Prompt template names
+const (
+	PromptTemplateRoom          = "room"
+	PromptTemplateInpainting    = "inpainting"
+	PromptTemplateStyleTransfer = "style_transfer"
+	PromptTemplateNegative      = "negative"
+
+	// PromptTemplateStyleReference describes a curated StyleReference and ambiance
+	PromptTemplateStyleReference = "style_reference"
+
+	// Style descriptions are templates named "style.<style>", e.g. "style.modern"
+	promptTemplateStylePrefix = "style."
+
+	// BuiltinPromptVersion is the version of the templates compiled into the binary
+	BuiltinPromptVersion = "builtin"
+)
+
+// PromptTemplate is one version of a named prompt template. Several active versions
+// of the same name form an A/B test, selected in proportion to their weights.
+type PromptTemplate struct {
+	Name      string    `json:"name" db:"name"`
+	Version   string    `json:"version" db:"version"`
+	Variant   string    `json:"variant,omitempty" db:"variant"` // A/B arm label
+	Weight    int       `json:"weight" db:"weight"`             // 0 disables the version
+	Body      string    `json:"body" db:"body"`
+	CreatedAt time.Time `json:"created_at,omitempty" db:"created_at"`
+
+	tmpl *template.Template
+}
+
+// PromptVersion identifies the template version used to build a prompt
+type PromptVersion struct {
+	Template string `json:"template"`
+	Version  string `json:"version"`
+	Variant  string `json:"variant,omitempty"`
+}
+
+// PromptData is the data available to prompt templates
+type PromptData struct {
+	RoomType         string
+	Style            StyleType
+	StyleDescription string
+	FurnitureItems   []string
+	ColorScheme      []string
+	Lighting         string
+	Additional       []string
+	FurnitureType    string
+	Context          string
+	CurrentRoom      string
+
+	// Style reference fields, set for the style_reference template
+	StyleName       string
+	StyleTags       []string
+	Materials       []string
+	Mood            []string
+	ColorAdjustment string
+	TextureEmphasis string
+}
+
+// PromptSource loads prompt templates from an external store
+type PromptSource interface {
+	LoadPromptTemplates(ctx context.Context) ([]*PromptTemplate, error)
+}
+
+var promptFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+}
+
+// samplePromptData exercises every field so broken templates are rejected at load time
+var samplePromptData = PromptData{
+	RoomType:         "living room",
+	Style:            StyleModern,
+	StyleDescription: "modern style",
+	FurnitureItems:   []string{"sofa", "coffee table"},
+	ColorScheme:      []string{"white", "oak"},
+	Lighting:         "natural light",
+	Additional:       []string{"large windows"},
+	FurnitureType:    "armchair",
+	Context:          "matching the natural lighting",
+	CurrentRoom:      "room",
+	StyleName:        "Modern Minimalist",
+	StyleTags:        []string{"clean", "minimal"},
+	Materials:        []string{"leather", "oak"},
+	Mood:             []string{"calm", "serene"},
+	ColorAdjustment:  "cool tones",
+	TextureEmphasis:  "minimal",
+}
+
+// PromptCatalog holds the active prompt templates. Templates from sources replace the
+// built-in templates of the same name; names a source does not define keep the built-in.
+type PromptCatalog struct {
+	mu        sync.RWMutex
+	templates map[string][]*PromptTemplate
+	builtin   map[string]*PromptTemplate
+	sources   []PromptSource
+}
+
+// NewPromptCatalog creates a catalog with the built-in templates. Call Reload to load
+// templates from the sources.
+func NewPromptCatalog(sources ...PromptSource) *PromptCatalog {
+	c := &PromptCatalog{
+		builtin: make(map[string]*PromptTemplate),
+		sources: sources,
+	}
+
+	for _, t := range builtinPromptTemplates() {
+		if err := t.parse(); err != nil {
+			panic(fmt.Sprintf("invalid built-in prompt template %s: %v", t.Name, err))
+		}
+		c.builtin[t.Name] = t
+	}
+
+	c.templates = c.withBuiltins(nil)
+	return c
+}
+
+// Reload loads templates from every source. The active set is only replaced when all
+// templates load and parse, so a bad edit never takes prompts offline.
+func (c *PromptCatalog) Reload(ctx context.Context) error {
+	var loaded []*PromptTemplate
+	for _, source := range c.sources {
+		templates, err := source.LoadPromptTemplates(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to load prompt templates: %w", err)
+		}
+		loaded = append(loaded, templates...)
+	}
+
+	active := make(map[string][]*PromptTemplate)
+	for _, t := range loaded {
+		if t.Name == "" || t.Version == "" {
+			return fmt.Errorf("prompt template missing name or version")
+		}
+		if err := t.parse(); err != nil {
+			return fmt.Errorf("invalid prompt template %s@%s: %w", t.Name, t.Version, err)
+		}
+		if t.Weight > 0 {
+			active[t.Name] = append(active[t.Name], t)
+		}
+	}
+
+	for _, versions := range active {
+		sort.Slice(versions, func(i, j int) bool {
+			return versions[i].Version+versions[i].Variant < versions[j].Version+versions[j].Variant
+		})
+	}
+
+	c.mu.Lock()
+	c.templates = c.withBuiltins(active)
+	c.mu.Unlock()
+
+	return nil
+}
+
+// WatchReload reloads the catalog on an interval until ctx is cancelled
+func (c *PromptCatalog) WatchReload(ctx context.Context, interval time.Duration, logger logger.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Reload(ctx); err != nil {
+				logger.Error("Failed to reload prompt templates", "error", err)
+			}
+		}
+	}
+}
+
+// Templates returns the active templates, including built-ins that are not overridden
+func (c *PromptCatalog) Templates() []*PromptTemplate {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var templates []*PromptTemplate
+	for _, versions := range c.templates {
+		templates = append(templates, versions...)
+	}
+
+	sort.Slice(templates, func(i, j int) bool {
+		if templates[i].Name != templates[j].Name {
+			return templates[i].Name < templates[j].Name
+		}
+		return templates[i].Version+templates[i].Variant < templates[j].Version+templates[j].Variant
+	})
+	return templates
+}
+
+// Select picks the active version of a template. The same key always selects the same
+// A/B arm, so a user sees consistent prompts; an empty key selects at random.
+func (c *PromptCatalog) Select(name, key string) (*PromptTemplate, bool) {
+	c.mu.RLock()
+	versions := c.templates[name]
+	c.mu.RUnlock()
+
+	switch len(versions) {
+	case 0:
+		return nil, false
+	case 1:
+		return versions[0], true
+	}
+
+	total := 0
+	for _, t := range versions {
+		total += t.Weight
+	}
+
+	var pick int
+	if key == "" {
+		pick = rand.Intn(total)
+	} else {
+		h := fnv.New32a()
+		h.Write([]byte(name + ":" + key))
+		pick = int(h.Sum32() % uint32(total))
+	}
+
+	for _, t := range versions {
+		if pick < t.Weight {
+			return t, true
+		}
+		pick -= t.Weight
+	}
+	return versions[len(versions)-1], true
+}
+
+// Render executes the selected version of a template. If a loaded template fails to
+// execute, the built-in template is used instead.
+func (c *PromptCatalog) Render(name, key string, data PromptData) (string, PromptVersion, error) {
+	t, ok := c.Select(name, key)
+	if !ok {
+		return "", PromptVersion{}, fmt.Errorf("prompt template not found: %s", name)
+	}
+
+	text, err := t.execute(data)
+	if err != nil {
+		builtin, ok := c.builtin[name]
+		if !ok || builtin == t {
+			return "", PromptVersion{}, err
+		}
+		t = builtin
+		if text, err = t.execute(data); err != nil {
+			return "", PromptVersion{}, err
+		}
+	}
+
+	return text, t.version(), nil
+}
+
+// SetPromptCatalog makes the renderer build its prompts from catalog
+func (r *Renderer) SetPromptCatalog(catalog *PromptCatalog) {
+	r.promptBuilder = NewPromptBuilderWithCatalog(catalog)
+}
+
+// withBuiltins fills names missing from active with the built-in templates
+func (c *PromptCatalog) withBuiltins(active map[string][]*PromptTemplate) map[string][]*PromptTemplate {
+	templates := make(map[string][]*PromptTemplate, len(c.builtin)+len(active))
+	for name, t := range c.builtin {
+		templates[name] = []*PromptTemplate{t}
+	}
+	for name, versions := range active {
+		templates[name] = versions
+	}
+	return templates
+}
+
+// parse compiles the template body and checks it against sample data
+func (t *PromptTemplate) parse() error {
+	tmpl, err := template.New(t.Name).Funcs(promptFuncs).Parse(t.Body)
+	if err != nil {
+		return err
+	}
+	t.tmpl = tmpl
+
+	_, err = t.execute(samplePromptData)
+	return err
+}
+
+func (t *PromptTemplate) execute(data PromptData) (string, error) {
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+func (t *PromptTemplate) version() PromptVersion {
+	return PromptVersion{Template: t.Name, Version: t.Version, Variant: t.Variant}
+}
+
+// builtinPromptTemplates returns the default templates used when no source overrides them
+func builtinPromptTemplates() []*PromptTemplate {
+	templates := []*PromptTemplate{
+		{
+			Name: PromptTemplateRoom,
+			Body: `A photorealistic interior design visualization of a {{.RoomType}}` +
+				`{{with .StyleDescription}}, {{.}}{{end}}` +
+				`{{with .FurnitureItems}}, featuring {{join . ", "}}{{end}}` +
+				`{{with .ColorScheme}}, with a {{join . " and "}} color palette{{end}}` +
+				`{{with .Lighting}}, illuminated by {{.}}{{end}}` +
+				`{{with .Additional}}, {{join . ". "}}{{end}}` +
+				`, 8k resolution, highly detailed, professional architectural photography, interior design magazine quality`,
+		},
+		{
+			Name: PromptTemplateInpainting,
+			Body: `A {{.FurnitureType}} in {{.StyleDescription}}, seamlessly integrated into the existing room, ` +
+				`maintaining consistent lighting and perspective{{with .Context}}, {{.}}{{end}}`,
+		},
+		{
+			Name: PromptTemplateStyleTransfer,
+			Body: `Transform this {{.CurrentRoom}} into {{.StyleDescription}}, maintaining the room layout and structure but updating ` +
+				`furniture, materials, colors, and decorative elements to match the new style. ` +
+				`Keep architectural features intact. Professional interior design quality.`,
+		},
+		{
+			Name: PromptTemplateStyleReference,
+			Body: `{{lower .StyleName}} style` +
+				`{{with .StyleTags}}, {{join . ", "}}{{end}}` +
+				`{{with .Materials}}, {{join . ", "}} materials{{end}}` +
+				`{{with .ColorScheme}}, {{join . ", "}} color palette{{end}}` +
+				`{{with .Mood}}, {{join . ", "}} atmosphere{{end}}` +
+				`{{with .Lighting}}, {{.}} lighting{{end}}` +
+				`{{with .ColorAdjustment}}, {{.}} color grading{{end}}` +
+				`{{with .TextureEmphasis}}, {{.}} textures{{end}}`,
+		},
+		{
+			Name: PromptTemplateNegative,
+			Body: "blurry, distorted, unrealistic proportions, bad perspective, watermark, text, " +
+				"low quality, amateur, CGI, artificial lighting, oversaturated, underexposed, " +
+				"cluttered, messy, incomplete furniture, floating objects",
+		},
+	}
+
+	for style, desc := range initializeStylePrompts() {
+		templates = append(templates, &PromptTemplate{
+			Name: promptTemplateStylePrefix + string(style),
+			Body: desc,
+		})
+	}
+
+	for _, t := range templates {
+		t.Version = BuiltinPromptVersion
+		t.Weight = 1
+	}
+	return templates
+}
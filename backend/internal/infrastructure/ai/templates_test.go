@@ -0,0 +1,123 @@
+package ai
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuiltinRoomPrompt(t *testing.T) {
+	pb := NewPromptBuilder()
+
+	prompt, versions := pb.RoomPrompt(PromptComponents{
+		RoomType:       "bedroom",
+		DesiredStyle:   string(StyleRustic),
+		FurnitureItems: []string{"bed", "nightstand"},
+		ColorScheme:    []string{"brown", "cream"},
+		Lighting:       "warm lamps",
+	}, "user-1")
+
+	expected := "A photorealistic interior design visualization of a bedroom, " +
+		initializeStylePrompts()[StyleRustic] +
+		", featuring bed, nightstand, with a brown and cream color palette, illuminated by warm lamps, " +
+		"8k resolution, highly detailed, professional architectural photography, interior design magazine quality"
+	if prompt != expected {
+		t.Errorf("Unexpected room prompt:\n%s\nexpected:\n%s", prompt, expected)
+	}
+
+	if len(versions) != 2 || versions[0].Template != "style.rustic" || versions[1].Template != PromptTemplateRoom {
+		t.Fatalf("Unexpected template versions: %+v", versions)
+	}
+	if versions[1].Version != BuiltinPromptVersion {
+		t.Errorf("Expected built-in version, got %s", versions[1].Version)
+	}
+}
+
+func TestDirectoryPromptSourceABSelection(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"manifest.json": `{"templates": [
+			{"name": "negative", "version": "2", "variant": "a", "weight": 1, "file": "negative_a.tmpl"},
+			{"name": "negative", "version": "2", "variant": "b", "weight": 1, "file": "negative_b.tmpl"},
+			{"name": "negative", "version": "1", "weight": 0, "file": "negative_a.tmpl"}
+		]}`,
+		"negative_a.tmpl": "blurry\n",
+		"negative_b.tmpl": "blurry, {{lower \"CGI\"}}",
+	}
+	for name, body := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	catalog := NewPromptCatalog(NewDirectoryPromptSource(dir))
+	if err := catalog.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	pb := NewPromptBuilderWithCatalog(catalog)
+	arms := make(map[string]string)
+	for _, user := range []string{"u1", "u2", "u3", "u4", "u5", "u6", "u7", "u8"} {
+		prompt, versions := pb.NegativePrompt(user)
+		if len(versions) != 1 || versions[0].Version != "2" {
+			t.Fatalf("Expected version 2, got %+v", versions)
+		}
+		arms[versions[0].Variant] = prompt
+
+		// The same key must always select the same arm
+		again, _ := pb.NegativePrompt(user)
+		if again != prompt {
+			t.Errorf("Selection for %s is not stable", user)
+		}
+	}
+
+	if arms["a"] != "blurry" || arms["b"] != "blurry, cgi" {
+		t.Errorf("Expected both arms to be selected, got %+v", arms)
+	}
+
+	// Templates not in the manifest keep the built-in version
+	if _, versions := pb.StyleTransferPrompt("room", StyleModern, nil, "u1"); versions[1].Version != BuiltinPromptVersion {
+		t.Errorf("Expected built-in style transfer template, got %+v", versions)
+	}
+}
+
+func TestPromptCatalogRejectsInvalidTemplate(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "manifest.json"), []byte(`{"templates": [{"name": "room", "version": "2", "file": "room.tmpl"}]}`), 0o644)
+	os.WriteFile(filepath.Join(dir, "room.tmpl"), []byte("{{.Unknown}}"), 0o644)
+
+	catalog := NewPromptCatalog(NewDirectoryPromptSource(dir))
+	if err := catalog.Reload(context.Background()); err == nil {
+		t.Fatal("Expected invalid template to be rejected")
+	}
+
+	if t0, _ := catalog.Select(PromptTemplateRoom, "u1"); t0.Version != BuiltinPromptVersion {
+		t.Errorf("Expected built-in template to stay active, got %s", t0.Version)
+	}
+}
+
+func TestConfigNewRendererLoadsPromptTemplates(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "manifest.json"), []byte(`{"templates": [{"name": "negative", "version": "2", "weight": 1, "file": "negative.tmpl"}]}`), 0o644)
+	os.WriteFile(filepath.Join(dir, "negative.tmpl"), []byte("blurry"), 0o644)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := LoadConfig()
+	config.PromptTemplateDir = dir
+	renderer, err := config.NewRenderer(ctx, nil, nil, testLogger{})
+	if err != nil {
+		t.Fatalf("NewRenderer failed: %v", err)
+	}
+	if prompt, versions := renderer.promptBuilder.NegativePrompt("u1"); prompt != "blurry" || versions[0].Version != "2" {
+		t.Errorf("Expected the configured template, got %q %+v", prompt, versions)
+	}
+
+	// A directory without a manifest is a configuration error
+	config.PromptTemplateDir = t.TempDir()
+	if _, err := config.NewRenderer(ctx, nil, nil, testLogger{}); err == nil {
+		t.Error("Expected missing prompt templates to fail")
+	}
+}
@@ -0,0 +1,415 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultUpscaleModel is the super-resolution model used through the provider
+	defaultUpscaleModel = "nightmareai/real-esrgan:latest"
+
+	// lanczosLobes is the kernel radius of the CPU fallback (Lanczos-3)
+	lanczosLobes = 3
+
+	// maxUpscaledPixels bounds the CPU fallback's output, 4x of a 2048x2048 render
+	maxUpscaledPixels = 8192 * 8192
+
+	// upscaleTimeout is how long an upscale waits before reconciling the prediction later
+	upscaleTimeout = 60 * time.Second
+)
+
+// UpscaleMode selects how renders are upscaled
+type UpscaleMode string
+
+const (
+	// UpscaleModeAuto uses the provider and falls back to local upscaling when it
+	// fails or no provider token is configured
+	UpscaleModeAuto     UpscaleMode = "auto"
+	UpscaleModeProvider UpscaleMode = "provider"
+	UpscaleModeLocal    UpscaleMode = "local"
+)
+
+// Upscaling methods recorded in asset provenance
+const (
+	UpscaleMethodProvider = "provider"
+	UpscaleMethodLanczos  = "lanczos"
+)
+
+// DerivedAssetUpscale is the DerivedAsset kind of upscaled renders
+const DerivedAssetUpscale = "upscale"
+
+// ErrLocalUpscaleNeedsStorage is returned when the CPU fallback has nowhere to put its output
+var ErrLocalUpscaleNeedsStorage = errors.New("local upscaling requires durable storage")
+
+// UpscaleRequest represents a request to upscale a stored render
+type UpscaleRequest struct {
+	ID            string `json:"id,omitempty"`
+	UserID        string `json:"user_id,omitempty"`
+	ProjectID     string `json:"project_id,omitempty"`
+	SourceJobID   string `json:"source_job_id,omitempty"`
+	SourceVariant int    `json:"source_variant,omitempty"`
+	SourceImage   string `json:"source_image"`
+	SourceHash    string `json:"source_hash,omitempty"`
+	Scale         int    `json:"scale"` // 2 or 4
+}
+
+// Validate checks the source image and scale factor
+func (req *UpscaleRequest) Validate() error {
+	if req.SourceImage == "" {
+		return fmt.Errorf("source image is required")
+	}
+	if req.Scale != 2 && req.Scale != 4 {
+		return fmt.Errorf("scale must be 2 or 4, got %d", req.Scale)
+	}
+	return nil
+}
+
+// AssetProvenance records how a derived asset was produced from its source render
+type AssetProvenance struct {
+	Operation      string    `json:"operation"`
+	SourceJobID    string    `json:"source_job_id,omitempty"`
+	SourceVariant  int       `json:"source_variant"`
+	SourceImageURL string    `json:"source_image_url"`
+	SourceHash     string    `json:"source_hash,omitempty"`
+	SourceWidth    int       `json:"source_width"`
+	SourceHeight   int       `json:"source_height"`
+	Scale          int       `json:"scale"`
+	Method         string    `json:"method"`
+	Model          string    `json:"model,omitempty"`
+	FallbackReason string    `json:"fallback_reason,omitempty"` // provider error that triggered local upscaling
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// DerivedAsset is an image produced from a stored render, such as a print-ready upscale
+type DerivedAsset struct {
+	Kind         string          `json:"kind"`
+	JobID        string          `json:"job_id"`
+	ImageURL     string          `json:"image_url"`
+	ThumbnailURL string          `json:"thumbnail_url,omitempty"`
+	ImageHash    string          `json:"image_hash,omitempty"`
+	Width        int             `json:"width"`
+	Height       int             `json:"height"`
+	Provenance   AssetProvenance `json:"provenance"`
+}
+
+// NewDerivedAsset describes a completed upscale result as an asset of its source
+// render. ok is false when the result carries no upscale provenance.
+func NewDerivedAsset(jobID string, result *RenderResult) (DerivedAsset, bool) {
+	provenance, ok := result.Metadata["provenance"].(AssetProvenance)
+	if !ok || result.ResultImageURL == "" {
+		return DerivedAsset{}, false
+	}
+
+	return DerivedAsset{
+		Kind:         DerivedAssetUpscale,
+		JobID:        jobID,
+		ImageURL:     result.ResultImageURL,
+		ThumbnailURL: result.ThumbnailURL,
+		ImageHash:    result.ImageHash,
+		Width:        provenance.SourceWidth * provenance.Scale,
+		Height:       provenance.SourceHeight * provenance.Scale,
+		Provenance:   provenance,
+	}, true
+}
+
+// upscaleSettings configures RenderUpscale; the zero value upscales through the
+// default model with local fallback
+type upscaleSettings struct {
+	modelVersion string
+	mode         UpscaleMode
+}
+
+// ConfigureUpscaling sets the super-resolution model and how the CPU fallback is used
+func (r *Renderer) ConfigureUpscaling(modelVersion string, mode UpscaleMode) {
+	r.upscale = upscaleSettings{modelVersion: modelVersion, mode: mode}
+}
+
+// RenderUpscale upscales a stored render 2x or 4x. The provider's super-resolution
+// model is used when available; otherwise, or when it fails in auto mode, the image
+// is resampled locally with a Lanczos filter. The result's metadata carries the
+// AssetProvenance linking it to the source render.
+func (r *Renderer) RenderUpscale(ctx context.Context, req *UpscaleRequest) (*RenderResult, error) {
+	startTime := time.Now()
+
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	source, err := r.loadRenderImage(ctx, req.SourceImage)
+	if err != nil {
+		return nil, err
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(source))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode source image: %w", err)
+	}
+
+	modelVersion := r.upscale.modelVersion
+	if modelVersion == "" {
+		modelVersion = defaultUpscaleModel
+	}
+	mode := r.upscale.mode
+	if mode == "" {
+		mode = UpscaleModeAuto
+	}
+
+	provenance := AssetProvenance{
+		Operation:      DerivedAssetUpscale,
+		SourceJobID:    req.SourceJobID,
+		SourceVariant:  req.SourceVariant,
+		SourceImageURL: req.SourceImage,
+		SourceHash:     req.SourceHash,
+		SourceWidth:    config.Width,
+		SourceHeight:   config.Height,
+		Scale:          req.Scale,
+		CreatedAt:      startTime,
+	}
+
+	var result *RenderResult
+	if mode == UpscaleModeProvider || (mode == UpscaleModeAuto && r.replicateToken != "") {
+		provenance.Method = UpscaleMethodProvider
+		provenance.Model = modelVersion
+
+		result, err = r.upscaleWithProvider(ctx, req, modelVersion, source, provenance, startTime)
+		if err != nil {
+			var pending *PredictionPendingError
+			if mode == UpscaleModeProvider || errors.As(err, &pending) || ctx.Err() != nil {
+				return nil, err
+			}
+
+			r.logger.Warn("Provider upscaling failed, falling back to local upscaling",
+				"source_hash", req.SourceHash,
+				"error", err)
+			provenance.FallbackReason = err.Error()
+		}
+	}
+
+	if result == nil {
+		provenance.Method = UpscaleMethodLanczos
+		provenance.Model = ""
+
+		result, err = r.upscaleLocally(ctx, source, provenance, startTime)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result.RequestID = req.ID
+	return result, nil
+}
+
+// upscaleWithProvider runs the super-resolution model on the source render
+func (r *Renderer) upscaleWithProvider(ctx context.Context, req *UpscaleRequest, modelVersion string, source []byte, provenance AssetProvenance, startTime time.Time) (*RenderResult, error) {
+	// Stored renders on the local backend are not reachable by the provider
+	imageRef := req.SourceImage
+	if !strings.HasPrefix(imageRef, "https://") && !strings.HasPrefix(imageRef, "http://") {
+		imageRef = fmt.Sprintf("data:%s;base64,%s", http.DetectContentType(source), base64.StdEncoding.EncodeToString(source))
+	}
+
+	input := map[string]interface{}{
+		"image":        imageRef,
+		"scale":        req.Scale,
+		"face_enhance": false,
+	}
+	metadata := map[string]interface{}{
+		"provenance": provenance,
+	}
+
+	prediction, err := r.createPrediction(ctx, modelVersion, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upscale prediction: %w", err)
+	}
+
+	result, err := r.waitForPrediction(ctx, prediction.ID, upscaleTimeout, &pendingPrediction{
+		requestID: req.ID,
+		startedAt: startTime,
+		metadata:  metadata,
+	})
+	r.recordProviderCall(ctx, ProviderCall{
+		UserID:       req.UserID,
+		ProjectID:    req.ProjectID,
+		PredictionID: prediction.ID,
+		RenderType:   RenderTypeUpscale,
+		Model:        modelVersion,
+	}, input, startTime, err)
+	r.recordPredictionOutcome(modelVersion, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get upscale result: %w", err)
+	}
+
+	stored, err := r.storeOutput(ctx, predictionOutputURL(result))
+	if err != nil {
+		return nil, fmt.Errorf("failed to store upscale result: %w", err)
+	}
+
+	return &RenderResult{
+		ID:             result.ID,
+		Status:         "completed",
+		ResultImageURL: stored.URL,
+		ThumbnailURL:   stored.ThumbnailURL,
+		ImageHash:      stored.Hash,
+		Progress:       100,
+		ProcessingTime: time.Since(startTime).Seconds(),
+		CreatedAt:      startTime,
+		CompletedAt:    timePtr(time.Now()),
+		Metadata:       metadata,
+	}, nil
+}
+
+// upscaleLocally resamples the source render with a Lanczos filter on the CPU
+func (r *Renderer) upscaleLocally(ctx context.Context, source []byte, provenance AssetProvenance, startTime time.Time) (*RenderResult, error) {
+	if r.blobs == nil {
+		return nil, ErrLocalUpscaleNeedsStorage
+	}
+
+	w, h := provenance.SourceWidth*provenance.Scale, provenance.SourceHeight*provenance.Scale
+	if w*h > maxUpscaledPixels {
+		return nil, fmt.Errorf("upscaled image of %dx%d exceeds the local upscaling limit", w, h)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(source))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode source image: %w", err)
+	}
+
+	upscaled := lanczosResize(img, w, h)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestSpeed}
+	if err := encoder.Encode(&buf, upscaled); err != nil {
+		return nil, fmt.Errorf("failed to encode upscaled image: %w", err)
+	}
+
+	stored, err := r.storeImage(ctx, buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to store upscale result: %w", err)
+	}
+
+	return &RenderResult{
+		ID:             "local_" + stored.Hash[:16],
+		Status:         "completed",
+		ResultImageURL: stored.URL,
+		ThumbnailURL:   stored.ThumbnailURL,
+		ImageHash:      stored.Hash,
+		Progress:       100,
+		ProcessingTime: time.Since(startTime).Seconds(),
+		CreatedAt:      startTime,
+		CompletedAt:    timePtr(time.Now()),
+		Metadata: map[string]interface{}{
+			"provenance": provenance,
+		},
+	}, nil
+}
+
+// lanczosResize resamples an image to w x h with a separable Lanczos-3 filter
+func lanczosResize(img image.Image, w, h int) *image.RGBA {
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+
+	// Horizontal pass into a float buffer, then vertical pass into the output
+	xWeights := lanczosWeights(sw, w)
+	horizontal := make([]float32, w*sh*4)
+	for y := 0; y < sh; y++ {
+		row := src.Pix[y*src.Stride:]
+		for x, weights := range xWeights {
+			var acc [4]float32
+			for _, tap := range weights {
+				p := row[tap.index*4:]
+				for c := 0; c < 4; c++ {
+					acc[c] += float32(p[c]) * tap.weight
+				}
+			}
+			copy(horizontal[(y*w+x)*4:], acc[:])
+		}
+	}
+
+	yWeights := lanczosWeights(sh, h)
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y, weights := range yWeights {
+		row := out.Pix[y*out.Stride:]
+		for x := 0; x < w; x++ {
+			var acc [4]float32
+			for _, tap := range weights {
+				p := horizontal[(tap.index*w+x)*4:]
+				for c := 0; c < 4; c++ {
+					acc[c] += p[c] * tap.weight
+				}
+			}
+			for c := 0; c < 4; c++ {
+				row[x*4+c] = uint8(math.Round(math.Max(0, math.Min(255, float64(acc[c])))))
+			}
+		}
+	}
+
+	return out
+}
+
+// lanczosTap is one source sample contributing to an output pixel
+type lanczosTap struct {
+	index  int
+	weight float32
+}
+
+// lanczosWeights computes the normalised filter taps of each output pixel along one
+// axis. When downsampling the kernel is widened to cover every source pixel.
+func lanczosWeights(srcSize, dstSize int) [][]lanczosTap {
+	scale := float64(dstSize) / float64(srcSize)
+	support := float64(lanczosLobes)
+	stretch := 1.0
+	if scale < 1 {
+		stretch = 1 / scale
+		support *= stretch
+	}
+
+	weights := make([][]lanczosTap, dstSize)
+	for i := range weights {
+		center := (float64(i)+0.5)/scale - 0.5
+		lo := int(math.Floor(center - support + 1))
+		hi := int(math.Floor(center + support))
+
+		taps := make([]lanczosTap, 0, hi-lo+1)
+		var sum float64
+		for j := lo; j <= hi; j++ {
+			weight := lanczos((center - float64(j)) / stretch)
+			if weight == 0 {
+				continue
+			}
+			taps = append(taps, lanczosTap{index: clampInt(j, 0, srcSize-1), weight: float32(weight)})
+			sum += weight
+		}
+		for k := range taps {
+			taps[k].weight = float32(float64(taps[k].weight) / sum)
+		}
+		weights[i] = taps
+	}
+
+	return weights
+}
+
+// lanczos evaluates the Lanczos kernel sinc(x) * sinc(x / lobes)
+func lanczos(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	if x <= -lanczosLobes || x >= lanczosLobes {
+		return 0
+	}
+	px := math.Pi * x
+	return lanczosLobes * math.Sin(px) * math.Sin(px/lanczosLobes) / (px * px)
+}
@@ -0,0 +1,118 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/compozit/vision/backend/internal/infrastructure/storage"
+)
+
+func TestLanczosWeightsAreNormalised(t *testing.T) {
+	for _, sizes := range [][2]int{{64, 128}, {64, 256}, {256, 64}} {
+		for i, taps := range lanczosWeights(sizes[0], sizes[1]) {
+			var sum float64
+			for _, tap := range taps {
+				if tap.index < 0 || tap.index >= sizes[0] {
+					t.Fatalf("Tap %d of pixel %d is outside the source", tap.index, i)
+				}
+				sum += float64(tap.weight)
+			}
+			if math.Abs(sum-1) > 1e-5 {
+				t.Fatalf("Expected weights of pixel %d to sum to 1 for %v, got %f", i, sizes, sum)
+			}
+		}
+	}
+}
+
+func TestLanczosResize(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 32; x++ {
+			c := color.RGBA{90, 140, 200, 255}
+			if x >= 16 {
+				c = color.RGBA{20, 20, 20, 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	out := lanczosResize(img, 128, 64)
+	if b := out.Bounds(); b.Dx() != 128 || b.Dy() != 64 {
+		t.Fatalf("Expected 128x64 output, got %v", b)
+	}
+
+	// Flat areas keep their colour exactly; the edge stays sharp
+	if got := out.RGBAAt(10, 30); got != (color.RGBA{90, 140, 200, 255}) {
+		t.Errorf("Expected flat colour to be preserved, got %v", got)
+	}
+	if got := out.RGBAAt(120, 30); got != (color.RGBA{20, 20, 20, 255}) {
+		t.Errorf("Expected flat colour to be preserved, got %v", got)
+	}
+	if left, right := out.RGBAAt(62, 30).B, out.RGBAAt(66, 30).B; left < 150 || right > 60 {
+		t.Errorf("Expected a sharp edge, got %d/%d", left, right)
+	}
+}
+
+func TestRenderUpscaleFallsBackToLanczos(t *testing.T) {
+	blobs, err := storage.NewLocalStore(t.TempDir(), "https://api.example.com/assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a provider token auto mode upscales locally
+	renderer := NewRenderer("", nil, testLogger{})
+
+	req := &UpscaleRequest{
+		ID:          "job_2",
+		SourceJobID: "job_1",
+		SourceImage: testImageDataURI(t, testRoomImage()),
+		SourceHash:  "abc",
+		Scale:       2,
+	}
+	if _, err := renderer.RenderUpscale(context.Background(), req); !errors.Is(err, ErrLocalUpscaleNeedsStorage) {
+		t.Fatalf("Expected ErrLocalUpscaleNeedsStorage, got %v", err)
+	}
+
+	renderer.EnableDurableStorage(blobs)
+	result, err := renderer.RenderUpscale(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	asset, ok := NewDerivedAsset("job_2", result)
+	if !ok {
+		t.Fatalf("Expected upscale provenance in the result, got %+v", result.Metadata)
+	}
+	if asset.Width != 200 || asset.Height != 160 {
+		t.Errorf("Expected a 200x160 asset, got %dx%d", asset.Width, asset.Height)
+	}
+	if p := asset.Provenance; p.Method != UpscaleMethodLanczos || p.SourceJobID != "job_1" || p.SourceHash != "abc" || p.Scale != 2 {
+		t.Errorf("Unexpected provenance: %+v", p)
+	}
+
+	// The stored upscale can itself be read back as a source
+	data, err := renderer.loadRenderImage(context.Background(), result.ResultImageURL)
+	if err != nil {
+		t.Fatalf("Expected stored upscale to be readable: %v", err)
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width != 200 || config.Height != 160 {
+		t.Errorf("Expected a stored 200x160 image, got %+v %v", config, err)
+	}
+}
+
+func TestUpscaleRequestValidate(t *testing.T) {
+	for _, scale := range []int{0, 1, 3, 8} {
+		if err := (&UpscaleRequest{SourceImage: "https://example.com/a.png", Scale: scale}).Validate(); err == nil {
+			t.Errorf("Expected scale %d to be rejected", scale)
+		}
+	}
+	if err := (&UpscaleRequest{Scale: 2}).Validate(); err == nil {
+		t.Error("Expected a missing source image to be rejected")
+	}
+}
@@ -0,0 +1,73 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ProviderCall describes one prediction run on the provider, for usage metering
+type ProviderCall struct {
+	UserID         string
+	ProjectID      string
+	PredictionID   string
+	RenderType     RenderType
+	Model          string
+	InferenceSteps int
+	Duration       time.Duration
+	Status         string // succeeded, failed or pending
+}
+
+// UsageRecorder receives every provider call made by the renderer
+type UsageRecorder interface {
+	RecordProviderCall(ctx context.Context, call ProviderCall)
+
+	// SettleProviderCall updates a call recorded as pending once its
+	// prediction finished after the render call gave up waiting
+	SettleProviderCall(ctx context.Context, predictionID, status string, duration time.Duration)
+}
+
+// SetUsageRecorder registers the recorder notified after each provider call
+func (r *Renderer) SetUsageRecorder(recorder UsageRecorder) {
+	r.usage = recorder
+}
+
+// recordProviderCall reports a finished (or parked) prediction to the usage recorder
+func (r *Renderer) recordProviderCall(ctx context.Context, call ProviderCall, input map[string]interface{}, started time.Time, err error) {
+	if r.usage == nil {
+		return
+	}
+
+	call.Duration = time.Since(started)
+	if steps, ok := input["num_inference_steps"].(int); ok {
+		call.InferenceSteps = steps
+	}
+
+	var pending *PredictionPendingError
+	switch {
+	case err == nil:
+		call.Status = "succeeded"
+	case errors.As(err, &pending):
+		call.Status = "pending"
+	default:
+		call.Status = "failed"
+	}
+
+	// Recording must not be cancelled along with the render
+	r.usage.RecordProviderCall(context.WithoutCancel(ctx), call)
+}
+
+// settleProviderCall reports the final status of a parked prediction. Its duration
+// runs from the start of the render call that created it.
+func (r *Renderer) settleProviderCall(predictionID string, pending *pendingPrediction, providerStatus string) {
+	if r.usage == nil {
+		return
+	}
+
+	status := "failed"
+	if providerStatus == "succeeded" {
+		status = "succeeded"
+	}
+
+	r.usage.SettleProviderCall(context.Background(), predictionID, status, time.Since(pending.startedAt))
+}
@@ -0,0 +1,223 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxRenderVariants is the largest number of variants a single render may request
+	MaxRenderVariants = 8
+
+	// maxSeed keeps seeds within the range accepted by the provider's samplers
+	maxSeed = 1<<32 - 1
+)
+
+// ErrInvalidVariantCount is returned when a request asks for too many variants
+var ErrInvalidVariantCount = fmt.Errorf("variant count must be between 1 and %d", MaxRenderVariants)
+
+// PendingVariantsError is returned when variant predictions are still running
+// after the render wait timeout. Result holds the variants that completed in
+// time, or is nil when none did. Each pending prediction is delivered to the
+// LateResultHandler on its own once it finishes.
+type PendingVariantsError struct {
+	Pending []*PredictionPendingError
+	Result  *RenderResult
+}
+
+func (e *PendingVariantsError) Error() string {
+	return fmt.Sprintf("%d variant predictions still running after wait timeout", len(e.Pending))
+}
+
+// Unwrap returns the PredictionPendingError of each pending prediction
+func (e *PendingVariantsError) Unwrap() []error {
+	errs := make([]error, len(e.Pending))
+	for i, pending := range e.Pending {
+		errs[i] = pending
+	}
+	return errs
+}
+
+// VariantCount returns the number of variants requested, defaulting to one
+func (req *RenderRequest) VariantCount() int {
+	if req.Variants <= 0 {
+		return 1
+	}
+	return req.Variants
+}
+
+// Validate checks the variant and seed settings of a render request
+func (req *RenderRequest) Validate() error {
+	if req.Variants < 0 || req.Variants > MaxRenderVariants {
+		return ErrInvalidVariantCount
+	}
+	if req.Seed != nil && (*req.Seed < 0 || *req.Seed > maxSeed) {
+		return fmt.Errorf("seed must be between 0 and %d", int64(maxSeed))
+	}
+	return nil
+}
+
+// variantSeeds returns one seed per variant. With an explicit seed the variants use
+// consecutive seeds so the whole set can be reproduced.
+func variantSeeds(req *RenderRequest) []int64 {
+	count := req.VariantCount()
+
+	base := rand.Int63n(maxSeed - MaxRenderVariants)
+	if req.Seed != nil {
+		base = *req.Seed
+	}
+
+	seeds := make([]int64, count)
+	for i := range seeds {
+		seeds[i] = (base + int64(i)) % (maxSeed + 1)
+	}
+	return seeds
+}
+
+// renderVariants fans a render out to the provider, one prediction per seed, and waits
+// for all of them in parallel. Variants that fail are dropped; an error is returned only
+// when no variant succeeds. When predictions outlive the timeout a PendingVariantsError
+// lists all of them, with the variants that completed, so none is left unaccounted for.
+func (r *Renderer) renderVariants(
+	ctx context.Context,
+	req *RenderRequest,
+	modelVersion string,
+	input map[string]interface{},
+	timeout time.Duration,
+	startTime time.Time,
+	metadata map[string]interface{},
+) ([]RenderVariant, error) {
+	seeds := variantSeeds(req)
+	variants := make([]RenderVariant, len(seeds))
+	errs := make([]error, len(seeds))
+	progress := newVariantProgress(len(seeds), req.OnProgress)
+
+	var wg sync.WaitGroup
+	for i, seed := range seeds {
+		wg.Add(1)
+		go func(i int, seed int64) {
+			defer wg.Done()
+
+			variantInput := make(map[string]interface{}, len(input)+1)
+			for k, v := range input {
+				variantInput[k] = v
+			}
+			variantInput["seed"] = seed
+
+			prediction, err := r.createPrediction(ctx, modelVersion, variantInput)
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to create prediction: %w", err)
+				return
+			}
+			progress.update(i, 0, RenderProgress{Stage: ProgressStageStarting})
+
+			predictionStart := time.Now()
+			result, err := r.waitForPrediction(ctx, prediction.ID, timeout, &pendingPrediction{
+				requestID: req.ID,
+				startedAt: startTime,
+				metadata:  metadata,
+				index:     i,
+				seed:      seed,
+				input:     variantParameters(variantInput),
+				progress:  progress.observe(i),
+			})
+			r.recordProviderCall(ctx, ProviderCall{
+				UserID:       req.UserID,
+				ProjectID:    req.ProjectID,
+				PredictionID: prediction.ID,
+				RenderType:   req.Type,
+				Model:        modelVersion,
+			}, variantInput, predictionStart, err)
+			r.recordPredictionOutcome(modelVersion, err)
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to get prediction result: %w", err)
+				return
+			}
+
+			progress.update(i, 0.95, RenderProgress{Stage: ProgressStageStoring})
+
+			variant := RenderVariant{
+				Index:        i,
+				Seed:         seed,
+				PredictionID: result.ID,
+				ImageURL:     predictionOutputURL(result),
+				Parameters:   variantParameters(variantInput),
+			}
+			if err := r.storeVariant(ctx, &variant); err != nil {
+				errs[i] = err
+				return
+			}
+			variants[i] = variant
+		}(i, seed)
+	}
+	wg.Wait()
+
+	completed := make([]RenderVariant, 0, len(variants))
+	var pending []*PredictionPendingError
+	for i, variant := range variants {
+		var late *PredictionPendingError
+		switch {
+		case errors.As(errs[i], &late):
+			pending = append(pending, late)
+		case errs[i] != nil:
+			r.logger.Error("Render variant failed",
+				"request_id", req.ID,
+				"variant", i,
+				"seed", seeds[i],
+				"error", errs[i])
+		default:
+			completed = append(completed, variant)
+		}
+	}
+
+	if len(pending) > 0 {
+		err := &PendingVariantsError{Pending: pending}
+		if len(completed) > 0 {
+			err.Result = newVariantsResult(req, completed, startTime, metadata)
+		}
+		return nil, err
+	}
+
+	if len(completed) == 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return completed, nil
+}
+
+// variantParameters returns the provider input worth storing with a variant. Image
+// inputs are left out; they are recorded once in the result metadata.
+func variantParameters(input map[string]interface{}) map[string]interface{} {
+	params := make(map[string]interface{}, len(input))
+	for k, v := range input {
+		switch k {
+		case "image", "depth_image", "mask":
+			continue
+		}
+		params[k] = v
+	}
+	return params
+}
+
+// newVariantsResult builds a render result whose primary image is the first variant
+func newVariantsResult(req *RenderRequest, variants []RenderVariant, startTime time.Time, metadata map[string]interface{}) *RenderResult {
+	return &RenderResult{
+		ID:             variants[0].PredictionID,
+		RequestID:      req.ID,
+		Status:         "completed",
+		ResultImageURL: variants[0].ImageURL,
+		ThumbnailURL:   variants[0].ThumbnailURL,
+		ImageHash:      variants[0].ImageHash,
+		Seed:           variants[0].Seed,
+		Variants:       variants,
+		Progress:       100,
+		ProcessingTime: time.Since(startTime).Seconds(),
+		CreatedAt:      startTime,
+		CompletedAt:    timePtr(time.Now()),
+		Metadata:       metadata,
+	}
+}
@@ -0,0 +1,195 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func int64Ptr(v int64) *int64 { return &v }
+
+func TestRenderRequestValidate(t *testing.T) {
+	tests := map[string]struct {
+		req   RenderRequest
+		valid bool
+	}{
+		"defaults":          {RenderRequest{}, true},
+		"most variants":     {RenderRequest{Variants: MaxRenderVariants}, true},
+		"too many variants": {RenderRequest{Variants: MaxRenderVariants + 1}, false},
+		"negative variants": {RenderRequest{Variants: -1}, false},
+		"largest seed":      {RenderRequest{Seed: int64Ptr(maxSeed)}, true},
+		"seed out of range": {RenderRequest{Seed: int64Ptr(maxSeed + 1)}, false},
+		"negative seed":     {RenderRequest{Seed: int64Ptr(-1)}, false},
+	}
+
+	for name, tt := range tests {
+		if err := tt.req.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid=%v, got %v", name, tt.valid, err)
+		}
+	}
+}
+
+func TestVariantSeeds(t *testing.T) {
+	// An explicit seed gives consecutive seeds, wrapping at the sampler's range
+	seeds := variantSeeds(&RenderRequest{Variants: 3, Seed: int64Ptr(maxSeed - 1)})
+	if len(seeds) != 3 || seeds[0] != maxSeed-1 || seeds[1] != maxSeed || seeds[2] != 0 {
+		t.Errorf("Expected consecutive seeds wrapping to 0, got %v", seeds)
+	}
+
+	// Random seeds are in range and distinct within a request
+	seeds = variantSeeds(&RenderRequest{Variants: MaxRenderVariants})
+	seen := make(map[int64]bool)
+	for _, seed := range seeds {
+		if seed < 0 || seed > maxSeed || seen[seed] {
+			t.Errorf("Unexpected seed %d in %v", seed, seeds)
+		}
+		seen[seed] = true
+	}
+	if seeds := variantSeeds(&RenderRequest{}); len(seeds) != 1 {
+		t.Errorf("Expected one seed by default, got %v", seeds)
+	}
+}
+
+// fakeVariantProvider answers prediction requests with the status of each seed;
+// seeds without one keep processing
+func fakeVariantProvider(statuses map[int64]string) http.RoundTripper {
+	return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		respond := func(code int, body string) (*http.Response, error) {
+			return &http.Response{StatusCode: code, Body: io.NopCloser(strings.NewReader(body)), Header: http.Header{}}, nil
+		}
+
+		switch {
+		case req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/predictions"):
+			var payload struct {
+				Input struct {
+					Seed int64 `json:"seed"`
+				} `json:"input"`
+			}
+			if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+				return nil, err
+			}
+			return respond(http.StatusCreated, fmt.Sprintf(`{"id":"p%d","status":"starting"}`, payload.Input.Seed))
+
+		case req.Method == http.MethodGet:
+			id := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+			var seed int64
+			fmt.Sscanf(id, "p%d", &seed)
+
+			switch status := statuses[seed]; status {
+			case "succeeded":
+				return respond(http.StatusOK, fmt.Sprintf(`{"id":%q,"status":"succeeded","output":["https://replicate.delivery/%s.png"]}`, id, id))
+			case "failed":
+				return respond(http.StatusOK, fmt.Sprintf(`{"id":%q,"status":"failed","error":"out of memory"}`, id))
+			}
+			return respond(http.StatusOK, fmt.Sprintf(`{"id":%q,"status":"processing"}`, id))
+		}
+		return respond(http.StatusOK, "{}")
+	})
+}
+
+func TestRenderVariantsReportsEveryPendingPrediction(t *testing.T) {
+	ctx := context.Background()
+	req := &RenderRequest{ID: "req-1", Variants: 4, Seed: int64Ptr(100)}
+
+	renderer := NewRenderer("", nil, testLogger{})
+	renderer.httpClient = &http.Client{Transport: fakeVariantProvider(map[int64]string{100: "succeeded", 101: "failed"})}
+
+	// One variant completed, one failed and two are still running at the timeout
+	_, err := renderer.renderVariants(ctx, req, "test/model", map[string]interface{}{}, 1500*time.Millisecond, time.Now(), nil)
+	var pending *PendingVariantsError
+	if !errors.As(err, &pending) {
+		t.Fatalf("Expected a PendingVariantsError, got %v", err)
+	}
+	if len(pending.Pending) != 2 || pending.Pending[0].PredictionID != "p102" || pending.Pending[1].PredictionID != "p103" {
+		t.Fatalf("Expected p102 and p103 pending, got %+v", pending.Pending)
+	}
+	if pending.Pending[1].Index != 3 || pending.Pending[1].Seed != 103 {
+		t.Errorf("Expected the variant index and seed of p103, got %+v", pending.Pending[1])
+	}
+	if pending.Result == nil || len(pending.Result.Variants) != 1 || pending.Result.Variants[0].ImageURL != "https://replicate.delivery/p100.png" {
+		t.Errorf("Expected the completed variant in the result, got %+v", pending.Result)
+	}
+	var single *PredictionPendingError
+	if !errors.As(err, &single) {
+		t.Error("Expected the error to unwrap to a PredictionPendingError")
+	}
+
+	// Every pending prediction is reconciled, not only the first
+	if ids := renderer.tracker.orphanIDs(); len(ids) != 2 {
+		t.Errorf("Expected both pending predictions to be reconciled later, got %v", ids)
+	}
+
+	// Failed variants are dropped when the others completed
+	renderer.httpClient = &http.Client{Transport: fakeVariantProvider(map[int64]string{100: "failed", 101: "succeeded"})}
+	variants, err := renderer.renderVariants(ctx, &RenderRequest{ID: "req-2", Variants: 2, Seed: int64Ptr(100)}, "test/model", map[string]interface{}{}, 5*time.Second, time.Now(), nil)
+	if err != nil || len(variants) != 1 || variants[0].Index != 1 || variants[0].Seed != 101 {
+		t.Errorf("Expected only the second variant, got %+v: %v", variants, err)
+	}
+
+	// Without any variant the failures are returned
+	renderer.httpClient = &http.Client{Transport: fakeVariantProvider(map[int64]string{100: "failed", 101: "failed"})}
+	if _, err := renderer.renderVariants(ctx, &RenderRequest{ID: "req-3", Variants: 2, Seed: int64Ptr(100)}, "test/model", map[string]interface{}{}, 5*time.Second, time.Now(), nil); err == nil || errors.As(err, &pending) {
+		t.Errorf("Expected the variant failures, got %v", err)
+	}
+}
+
+// fakeUsageRecorder keeps the status recorded for each prediction
+type fakeUsageRecorder struct {
+	mu       sync.Mutex
+	statuses map[string]string
+}
+
+func (f *fakeUsageRecorder) RecordProviderCall(ctx context.Context, call ProviderCall) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statuses[call.PredictionID] = call.Status
+}
+
+func (f *fakeUsageRecorder) SettleProviderCall(ctx context.Context, predictionID, status string, duration time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statuses[predictionID] = status
+}
+
+func (f *fakeUsageRecorder) status(predictionID string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.statuses[predictionID]
+}
+
+func TestLatePredictionsSettleTheirUsage(t *testing.T) {
+	ctx := context.Background()
+	usage := &fakeUsageRecorder{statuses: make(map[string]string)}
+
+	renderer := NewRenderer("", nil, testLogger{})
+	renderer.SetUsageRecorder(usage)
+	renderer.httpClient = &http.Client{Transport: fakeVariantProvider(map[int64]string{})}
+
+	req := &RenderRequest{ID: "req-1", Variants: 2, Seed: int64Ptr(100)}
+	if _, err := renderer.renderVariants(ctx, req, "test/model", map[string]interface{}{}, 1500*time.Millisecond, time.Now(), nil); err == nil {
+		t.Fatal("Expected the predictions to outlive the render call")
+	}
+	if usage.status("p100") != "pending" || usage.status("p101") != "pending" {
+		t.Fatalf("Expected both predictions recorded as pending, got %v", usage.statuses)
+	}
+
+	// The late result updates the usage with its final status
+	renderer.httpClient = &http.Client{Transport: fakeVariantProvider(map[int64]string{100: "succeeded"})}
+	renderer.ReconcileLatePredictions(ctx)
+	if status := usage.status("p100"); status != "succeeded" {
+		t.Errorf("Expected p100 settled as succeeded, got %s", status)
+	}
+
+	// So does cancelling a prediction nobody waits for any more
+	renderer.CancelPrediction("p101")
+	if status := usage.status("p101"); status != "failed" {
+		t.Errorf("Expected p101 settled as failed, got %s", status)
+	}
+}
@@ -0,0 +1,375 @@
+package ai
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// webhookTolerance is the maximum accepted age of a signed webhook delivery
+const webhookTolerance = 5 * time.Minute
+
+// cancelPredictionTimeout bounds asking the provider to stop an abandoned prediction
+const cancelPredictionTimeout = 30 * time.Second
+
+var (
+	// ErrInvalidWebhookSignature is returned when a webhook cannot be authenticated
+	ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+
+	// ErrWebhooksDisabled is returned when a webhook arrives without a configured secret
+	ErrWebhooksDisabled = errors.New("webhooks are not configured")
+)
+
+// PredictionPendingError is returned when a prediction is still running after the
+// render wait timeout. The result will be delivered later to the LateResultHandler.
+type PredictionPendingError struct {
+	PredictionID string
+	Index        int // variant index within the render request
+	Seed         int64
+}
+
+func (e *PredictionPendingError) Error() string {
+	return fmt.Sprintf("prediction %s still running after wait timeout", e.PredictionID)
+}
+
+// LateResultHandler receives predictions that completed after their render call gave up waiting
+type LateResultHandler func(predictionID string, result *RenderResult, err error)
+
+// pendingPrediction holds what is needed to build a RenderResult for a running prediction
+type pendingPrediction struct {
+	requestID string
+	startedAt time.Time
+	metadata  map[string]interface{}
+	index     int
+	seed      int64
+	input     map[string]interface{}
+
+	// progress observes in-progress statuses while the render call waits
+	progress func(*replicatePrediction)
+}
+
+// predictionTracker routes completed predictions to waiting render calls,
+// or to the late result handler once the render call has timed out
+type predictionTracker struct {
+	mu        sync.Mutex
+	waiters   map[string]chan *replicatePrediction
+	observers map[string]func(*replicatePrediction)
+	orphans   map[string]*pendingPrediction
+}
+
+func newPredictionTracker() *predictionTracker {
+	return &predictionTracker{
+		waiters:   make(map[string]chan *replicatePrediction),
+		observers: make(map[string]func(*replicatePrediction)),
+		orphans:   make(map[string]*pendingPrediction),
+	}
+}
+
+// register returns a channel that receives the prediction once it completes.
+// observer, if not nil, receives in-progress webhook deliveries until then.
+func (t *predictionTracker) register(predictionID string, observer func(*replicatePrediction)) <-chan *replicatePrediction {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ch := make(chan *replicatePrediction, 1)
+	t.waiters[predictionID] = ch
+	if observer != nil {
+		t.observers[predictionID] = observer
+	}
+	return ch
+}
+
+// unregister removes the waiter for a prediction
+func (t *predictionTracker) unregister(predictionID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.waiters, predictionID)
+	delete(t.observers, predictionID)
+}
+
+// forget drops every route of a prediction whose result is no longer wanted.
+// It returns the orphan entry when the prediction awaited late reconciliation.
+func (t *predictionTracker) forget(predictionID string) *pendingPrediction {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pending := t.orphans[predictionID]
+	delete(t.waiters, predictionID)
+	delete(t.observers, predictionID)
+	delete(t.orphans, predictionID)
+	return pending
+}
+
+// orphan hands a timed-out prediction over to late reconciliation
+func (t *predictionTracker) orphan(predictionID string, pending *pendingPrediction) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.waiters, predictionID)
+	delete(t.observers, predictionID)
+	t.orphans[predictionID] = pending
+}
+
+// adopt hands a prediction started by another render call, possibly in an earlier
+// process, over to late reconciliation. It reports false when the prediction is
+// already tracked.
+func (t *predictionTracker) adopt(predictionID string, pending *pendingPrediction) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.waiters[predictionID]; ok {
+		return false
+	}
+	if _, ok := t.orphans[predictionID]; ok {
+		return false
+	}
+	t.orphans[predictionID] = pending
+	return true
+}
+
+// progress passes an in-progress prediction to the observer of its render call
+func (t *predictionTracker) progress(prediction *replicatePrediction) {
+	t.mu.Lock()
+	observer := t.observers[prediction.ID]
+	t.mu.Unlock()
+
+	if observer != nil {
+		observer(prediction)
+	}
+}
+
+// deliver routes a completed prediction. It returns the orphan entry when no render
+// call is waiting for it any more.
+func (t *predictionTracker) deliver(prediction *replicatePrediction) (*pendingPrediction, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if ch, ok := t.waiters[prediction.ID]; ok {
+		delete(t.waiters, prediction.ID)
+		delete(t.observers, prediction.ID)
+		ch <- prediction
+		return nil, false
+	}
+
+	if pending, ok := t.orphans[prediction.ID]; ok {
+		delete(t.orphans, prediction.ID)
+		return pending, true
+	}
+
+	return nil, false
+}
+
+// orphanIDs returns the IDs of predictions awaiting late reconciliation
+func (t *predictionTracker) orphanIDs() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ids := make([]string, 0, len(t.orphans))
+	for id := range t.orphans {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// verifyWebhookSignature validates a Replicate webhook delivery.
+// Replicate signs "<webhook-id>.<webhook-timestamp>.<body>" with HMAC-SHA256 using the
+// base64 key that follows the "whsec_" prefix of the signing secret.
+func verifyWebhookSignature(secret string, header http.Header, body []byte, now time.Time) error {
+	id := header.Get("webhook-id")
+	timestamp := header.Get("webhook-timestamp")
+	signatures := header.Get("webhook-signature")
+	if id == "" || timestamp == "" || signatures == "" {
+		return ErrInvalidWebhookSignature
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidWebhookSignature
+	}
+	sent := time.Unix(ts, 0)
+	if now.Sub(sent) > webhookTolerance || sent.Sub(now) > webhookTolerance {
+		return fmt.Errorf("%w: timestamp outside tolerance", ErrInvalidWebhookSignature)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, "whsec_"))
+	if err != nil {
+		return fmt.Errorf("invalid webhook secret: %w", err)
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id + "." + timestamp + "."))
+	mac.Write(body)
+	expected := mac.Sum(nil)
+
+	// The header may carry several space-delimited "v1,<signature>" entries
+	for _, candidate := range strings.Fields(signatures) {
+		version, sig, found := strings.Cut(candidate, ",")
+		if !found || version != "v1" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(sig)
+		if err != nil {
+			continue
+		}
+		if hmac.Equal(decoded, expected) {
+			return nil
+		}
+	}
+
+	return ErrInvalidWebhookSignature
+}
+
+// EnableWebhooks makes new predictions report completion to callbackURL.
+// Polling remains active as a fallback.
+func (r *Renderer) EnableWebhooks(callbackURL, signingSecret string) {
+	r.webhookURL = callbackURL
+	r.webhookSecret = signingSecret
+}
+
+// SetLateResultHandler registers the handler for predictions that finish after the wait timeout
+func (r *Renderer) SetLateResultHandler(handler LateResultHandler) {
+	r.onLateResult = handler
+}
+
+// HandleWebhook verifies and processes an inbound Replicate webhook
+func (r *Renderer) HandleWebhook(header http.Header, body []byte) error {
+	if r.webhookSecret == "" {
+		return ErrWebhooksDisabled
+	}
+
+	if err := verifyWebhookSignature(r.webhookSecret, header, body, time.Now()); err != nil {
+		return err
+	}
+
+	var prediction replicatePrediction
+	if err := json.Unmarshal(body, &prediction); err != nil {
+		return fmt.Errorf("invalid webhook payload: %w", err)
+	}
+
+	r.logger.Info("Received prediction webhook", "prediction_id", prediction.ID, "status", prediction.Status)
+
+	if isTerminalStatus(prediction.Status) {
+		r.completePrediction(&prediction)
+	} else {
+		r.tracker.progress(&prediction)
+	}
+
+	return nil
+}
+
+// ReconcileLatePredictions polls predictions whose render call timed out and
+// delivers any that have since completed
+func (r *Renderer) ReconcileLatePredictions(ctx context.Context) {
+	for _, id := range r.tracker.orphanIDs() {
+		prediction, err := r.getPrediction(ctx, id)
+		if err != nil {
+			r.logger.Error("Failed to reconcile prediction", "prediction_id", id, "error", err)
+			continue
+		}
+
+		if isTerminalStatus(prediction.Status) {
+			r.completePrediction(prediction)
+		}
+	}
+}
+
+// ResumePrediction reconciles a prediction whose render call ran in an earlier
+// process, e.g. one a parked job was waiting for when its worker restarted. The
+// result reaches the LateResultHandler like any late prediction. It reports false
+// when the prediction is already tracked.
+func (r *Renderer) ResumePrediction(predictionID, requestID string, index int, seed int64, startedAt time.Time) bool {
+	return r.tracker.adopt(predictionID, &pendingPrediction{
+		requestID: requestID,
+		startedAt: startedAt,
+		index:     index,
+		seed:      seed,
+	})
+}
+
+// completePrediction delivers a finished prediction to its waiter or the late result handler
+func (r *Renderer) completePrediction(prediction *replicatePrediction) {
+	pending, late := r.tracker.deliver(prediction)
+	if !late {
+		return
+	}
+
+	r.logger.Info("Reconciled late prediction", "prediction_id", prediction.ID, "status", prediction.Status)
+	r.settleProviderCall(prediction.ID, pending, prediction.Status)
+
+	if r.onLateResult == nil {
+		r.logger.Warn("No late result handler registered, dropping prediction", "prediction_id", prediction.ID)
+		return
+	}
+
+	if prediction.Status != "succeeded" {
+		r.onLateResult(prediction.ID, nil, newPredictionError(prediction))
+		return
+	}
+
+	// Copying the output into storage can be slow; do not hold up the webhook response
+	go r.deliverLateResult(prediction, pending)
+}
+
+// deliverLateResult stores a late prediction's output and hands it to the late result handler
+func (r *Renderer) deliverLateResult(prediction *replicatePrediction, pending *pendingPrediction) {
+	variant := RenderVariant{
+		Index:        pending.index,
+		Seed:         pending.seed,
+		PredictionID: prediction.ID,
+		ImageURL:     predictionOutputURL(prediction),
+		Parameters:   pending.input,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeOutputTimeout)
+	defer cancel()
+	if err := r.storeVariant(ctx, &variant); err != nil {
+		r.onLateResult(prediction.ID, nil, err)
+		return
+	}
+
+	r.onLateResult(prediction.ID, &RenderResult{
+		ID:             prediction.ID,
+		RequestID:      pending.requestID,
+		Status:         "completed",
+		ResultImageURL: variant.ImageURL,
+		ThumbnailURL:   variant.ThumbnailURL,
+		ImageHash:      variant.ImageHash,
+		Seed:           pending.seed,
+		Variants:       []RenderVariant{variant},
+		Progress:       100,
+		Metadata:       pending.metadata,
+		ProcessingTime: time.Since(pending.startedAt).Seconds(),
+		CreatedAt:      pending.startedAt,
+		CompletedAt:    timePtr(time.Now()),
+	}, nil)
+}
+
+// isTerminalStatus reports whether a prediction status is final
+func isTerminalStatus(status string) bool {
+	return status == "succeeded" || status == "failed" || status == "canceled"
+}
+
+// predictionOutputURL extracts the first image URL from a prediction output
+func predictionOutputURL(prediction *replicatePrediction) string {
+	switch output := prediction.Output.(type) {
+	case string:
+		return output
+	case []interface{}:
+		if len(output) > 0 {
+			if url, ok := output[0].(string); ok {
+				return url
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,144 @@
+package ai
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var testWebhookSecret = "whsec_" + base64.StdEncoding.EncodeToString([]byte("test-signing-key"))
+
+// signWebhook returns the headers Replicate sends with a delivery of body
+func signWebhook(t *testing.T, secret string, body []byte, sent time.Time) http.Header {
+	t.Helper()
+	key, err := base64.StdEncoding.DecodeString(secret[len("whsec_"):])
+	if err != nil {
+		t.Fatalf("invalid test secret: %v", err)
+	}
+
+	id := "msg_1"
+	timestamp := strconv.FormatInt(sent.Unix(), 10)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id + "." + timestamp + "."))
+	mac.Write(body)
+
+	header := http.Header{}
+	header.Set("webhook-id", id)
+	header.Set("webhook-timestamp", timestamp)
+	header.Set("webhook-signature", "v1,"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	return header
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{"id":"p1","status":"succeeded"}`)
+	otherSecret := "whsec_" + base64.StdEncoding.EncodeToString([]byte("other-key"))
+
+	tests := []struct {
+		name   string
+		header func() http.Header
+		body   []byte
+		valid  bool
+	}{
+		{
+			name:   "valid signature",
+			header: func() http.Header { return signWebhook(t, testWebhookSecret, body, now) },
+			body:   body,
+			valid:  true,
+		},
+		{
+			name:   "tampered body",
+			header: func() http.Header { return signWebhook(t, testWebhookSecret, body, now) },
+			body:   []byte(`{"id":"p1","status":"failed"}`),
+		},
+		{
+			name: "stale timestamp",
+			header: func() http.Header {
+				return signWebhook(t, testWebhookSecret, body, now.Add(-webhookTolerance-time.Minute))
+			},
+			body: body,
+		},
+		{
+			name: "one of several signatures matches",
+			header: func() http.Header {
+				header := signWebhook(t, testWebhookSecret, body, now)
+				header.Set("webhook-signature", "v1,bm90LWl0 v2,ignored "+header.Get("webhook-signature"))
+				return header
+			},
+			body:  body,
+			valid: true,
+		},
+		{
+			name: "missing header",
+			header: func() http.Header {
+				header := signWebhook(t, testWebhookSecret, body, now)
+				header.Del("webhook-signature")
+				return header
+			},
+			body: body,
+		},
+		{
+			name:   "wrong secret",
+			header: func() http.Header { return signWebhook(t, otherSecret, body, now) },
+			body:   body,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyWebhookSignature(testWebhookSecret, tt.header(), tt.body, now)
+			if tt.valid && err != nil {
+				t.Errorf("Expected a valid signature, got %v", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidWebhookSignature) {
+				t.Errorf("Expected ErrInvalidWebhookSignature, got %v", err)
+			}
+		})
+	}
+}
+
+func TestHandleWebhookRoutesLatePredictionsOnce(t *testing.T) {
+	renderer := NewRenderer("", nil, testLogger{})
+	renderer.EnableWebhooks("https://api.example.com/webhooks/replicate", testWebhookSecret)
+
+	var delivered []string
+	renderer.SetLateResultHandler(func(predictionID string, result *RenderResult, err error) {
+		delivered = append(delivered, predictionID)
+	})
+	renderer.tracker.orphan("p1", &pendingPrediction{requestID: "req-1", startedAt: time.Now()})
+
+	send := func(body string) error {
+		return renderer.HandleWebhook(signWebhook(t, testWebhookSecret, []byte(body), time.Now()), []byte(body))
+	}
+
+	// Predictions nobody waits for are acknowledged and dropped
+	if err := send(`{"id":"unknown","status":"failed","error":"boom"}`); err != nil {
+		t.Errorf("Expected an unknown prediction to be accepted, got %v", err)
+	}
+	if len(delivered) != 0 {
+		t.Errorf("Expected nothing delivered for an unknown prediction, got %v", delivered)
+	}
+
+	// Replicate retries deliveries; the late result is handed over once
+	for i := 0; i < 2; i++ {
+		if err := send(`{"id":"p1","status":"failed","error":"boom"}`); err != nil {
+			t.Fatalf("HandleWebhook failed: %v", err)
+		}
+	}
+	if len(delivered) != 1 || delivered[0] != "p1" {
+		t.Errorf("Expected p1 delivered once, got %v", delivered)
+	}
+
+	body := []byte(`{"id":"p1","status":"failed"}`)
+	if err := renderer.HandleWebhook(http.Header{}, body); !errors.Is(err, ErrInvalidWebhookSignature) {
+		t.Errorf("Expected an unsigned delivery to be rejected, got %v", err)
+	}
+	if err := NewRenderer("", nil, testLogger{}).HandleWebhook(http.Header{}, body); !errors.Is(err, ErrWebhooksDisabled) {
+		t.Errorf("Expected ErrWebhooksDisabled without a secret, got %v", err)
+	}
+}
@@ -12,6 +12,10 @@ import (
 	"github.com/compozit/vision/backend/pkg/logger"
 )
 
+// blenderStopGrace is how long an interrupted Blender process may take to exit
+// before it is killed
+const blenderStopGrace = 10 * time.Second
+
 // BlenderService handles Blender operations for 3D modeling
 type BlenderService struct {
 	logger        logger.Logger
@@ -79,7 +83,7 @@ func (b *BlenderService) RenderScene(ctx context.Context, sceneData *BlenderScen
 
 	b.logger.Info("Executing Blender command", "cmd", cmd.String())
 
-	if err := cmd.Run(); err != nil {
+	if err := b.run(ctx, cmd); err != nil {
 		return nil, fmt.Errorf("blender command failed: %w", err)
 	}
 
@@ -128,7 +132,7 @@ func (b *BlenderService) GenerateThumbnail(ctx context.Context, model *BlenderOu
 		"--height", "512",
 	)
 
-	if err := cmd.Run(); err != nil {
+	if err := b.run(ctx, cmd); err != nil {
 		return "", fmt.Errorf("thumbnail generation failed: %w", err)
 	}
 
@@ -177,7 +181,7 @@ func (b *BlenderService) RenderFloorPlan(ctx context.Context, room *Room, output
 		"--format", string(outputFormat),
 	)
 
-	if err := cmd.Run(); err != nil {
+	if err := b.run(ctx, cmd); err != nil {
 		return nil, fmt.Errorf("floor plan generation failed: %w", err)
 	}
 
@@ -215,7 +219,7 @@ func (b *BlenderService) OptimizeModel(ctx context.Context, inputModel string, t
 		"--target_polygons", "5000", // Target polygon count for mobile
 	)
 
-	if err := cmd.Run(); err != nil {
+	if err := b.run(ctx, cmd); err != nil {
 		return nil, fmt.Errorf("model optimization failed: %w", err)
 	}
 
@@ -236,6 +240,23 @@ func (b *BlenderService) OptimizeModel(ctx context.Context, inputModel string, t
 	}, nil
 }
 
+// run executes a Blender command. Cancelling ctx interrupts Blender and kills it
+// if it has not exited after blenderStopGrace; the context's error is returned
+// then, so callers can tell a cancelled job from a failed script.
+func (b *BlenderService) run(ctx context.Context, cmd *exec.Cmd) error {
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = blenderStopGrace
+
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		b.logger.Info("Blender command interrupted", "cmd", cmd.String(), "reason", ctx.Err())
+		return ctx.Err()
+	}
+	return err
+}
+
 // writeSceneData writes scene data to a JSON file for Blender script
 func (b *BlenderService) writeSceneData(sceneData *BlenderSceneData) (string, error) {
 	tempFile := filepath.Join(os.TempDir(), fmt.Sprintf("scene_data_%d.json", time.Now().UnixNano()))
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrNotFound is returned when a blob does not exist
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore stores immutable blobs under slash-separated keys
+type BlobStore interface {
+	Put(ctx context.Context, key string, data io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Exists(ctx context.Context, key string) (bool, error)
+
+	// URL returns the durable public URL of a key
+	URL(key string) string
+}
+
+// Backend names
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+// Config holds blob storage configuration
+type Config struct {
+	Backend string
+
+	// Local filesystem backend
+	LocalDir     string
+	LocalBaseURL string
+
+	// S3-compatible backend (AWS S3 or MinIO)
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3PublicURL string // defaults to <endpoint>/<bucket>
+}
+
+// LoadConfig loads storage configuration from environment variables
+func LoadConfig() *Config {
+	config := &Config{
+		Backend:      BackendLocal,
+		LocalDir:     "./data/blobs",
+		LocalBaseURL: "/api/v1/visualization/assets",
+		S3Region:     "us-east-1",
+	}
+
+	if backend := os.Getenv("STORAGE_BACKEND"); backend != "" {
+		config.Backend = backend
+	}
+
+	if dir := os.Getenv("STORAGE_LOCAL_DIR"); dir != "" {
+		config.LocalDir = dir
+	}
+
+	if baseURL := os.Getenv("STORAGE_LOCAL_BASE_URL"); baseURL != "" {
+		config.LocalBaseURL = baseURL
+	}
+
+	if endpoint := os.Getenv("STORAGE_S3_ENDPOINT"); endpoint != "" {
+		config.S3Endpoint = endpoint
+	}
+
+	if region := os.Getenv("STORAGE_S3_REGION"); region != "" {
+		config.S3Region = region
+	}
+
+	if bucket := os.Getenv("STORAGE_S3_BUCKET"); bucket != "" {
+		config.S3Bucket = bucket
+	}
+
+	if accessKey := os.Getenv("STORAGE_S3_ACCESS_KEY"); accessKey != "" {
+		config.S3AccessKey = accessKey
+	}
+
+	if secretKey := os.Getenv("STORAGE_S3_SECRET_KEY"); secretKey != "" {
+		config.S3SecretKey = secretKey
+	}
+
+	if publicURL := os.Getenv("STORAGE_S3_PUBLIC_URL"); publicURL != "" {
+		config.S3PublicURL = publicURL
+	}
+
+	return config
+}
+
+// Validate checks if the configuration is valid
+func (c *Config) Validate() error {
+	switch c.Backend {
+	case BackendLocal:
+		if c.LocalDir == "" {
+			return fmt.Errorf("STORAGE_LOCAL_DIR is required for the local backend")
+		}
+	case BackendS3:
+		if c.S3Endpoint == "" || c.S3Bucket == "" {
+			return fmt.Errorf("STORAGE_S3_ENDPOINT and STORAGE_S3_BUCKET are required for the s3 backend")
+		}
+		if c.S3AccessKey == "" || c.S3SecretKey == "" {
+			return fmt.Errorf("STORAGE_S3_ACCESS_KEY and STORAGE_S3_SECRET_KEY are required for the s3 backend")
+		}
+	default:
+		return fmt.Errorf("unknown storage backend: %s", c.Backend)
+	}
+	return nil
+}
+
+// New creates the blob store selected by the configuration
+func New(config *Config) (BlobStore, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch config.Backend {
+	case BackendS3:
+		return NewS3Store(config.S3Endpoint, config.S3Region, config.S3Bucket, config.S3AccessKey, config.S3SecretKey, config.S3PublicURL), nil
+	default:
+		return NewLocalStore(config.LocalDir, config.LocalBaseURL)
+	}
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStore(t.TempDir(), "/assets/")
+	if err != nil {
+		t.Fatalf("NewLocalStore failed: %v", err)
+	}
+
+	if exists, _ := store.Exists(ctx, "renders/ab/abc.png"); exists {
+		t.Fatal("Expected blob not to exist")
+	}
+
+	if err := store.Put(ctx, "renders/ab/abc.png", strings.NewReader("png"), 3, "image/png"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	r, err := store.Get(ctx, "renders/ab/abc.png")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "png" {
+		t.Errorf("Expected stored data, got %q", data)
+	}
+
+	if url := store.URL("renders/ab/abc.png"); url != "/assets/renders/ab/abc.png" {
+		t.Errorf("Unexpected URL: %s", url)
+	}
+
+	if _, err := store.Get(ctx, "renders/missing.png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	if err := store.Put(ctx, "../escape", strings.NewReader("x"), 1, "text/plain"); err == nil {
+		t.Error("Expected key escaping the root to be rejected")
+	}
+}
+
+func TestS3StoreSignsRequests(t *testing.T) {
+	objects := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=access/20240115/us-east-1/s3/aws4_request") ||
+			!strings.Contains(auth, "host;x-amz-content-sha256;x-amz-date, Signature=") {
+			http.Error(w, "bad signature: "+auth, http.StatusForbidden)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			objects[r.URL.Path] = string(body)
+		case http.MethodHead, http.MethodGet:
+			body, ok := objects[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			io.WriteString(w, body)
+		}
+	}))
+	defer server.Close()
+
+	store := NewS3Store(server.URL, "us-east-1", "renders", "access", "secret", "https://cdn.example.com")
+	store.now = func() time.Time { return time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC) }
+
+	ctx := context.Background()
+	if err := store.Put(ctx, "renders/ab/abc.png", strings.NewReader("png"), 3, "image/png"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if _, ok := objects["/renders/renders/ab/abc.png"]; !ok {
+		t.Fatalf("Expected path-style object key, got %v", objects)
+	}
+
+	if exists, err := store.Exists(ctx, "renders/ab/abc.png"); err != nil || !exists {
+		t.Errorf("Expected blob to exist, got %v %v", exists, err)
+	}
+	if exists, _ := store.Exists(ctx, "renders/missing.png"); exists {
+		t.Error("Expected missing blob not to exist")
+	}
+
+	if url := store.URL("renders/ab/abc.png"); url != "https://cdn.example.com/renders/ab/abc.png" {
+		t.Errorf("Unexpected URL: %s", url)
+	}
+}
@@ -290,6 +290,21 @@ func (a *Analyzer) detectCorners(img gocv.Mat) []Point2D {
 	return a.nonMaximumSuppression(cornerPoints, 20)
 }
 
+// EstimateDepthMap returns the estimated distance map (meters) for an image
+func (a *Analyzer) EstimateDepthMap(ctx context.Context, img image.Image) ([][]float64, error) {
+	mat, err := a.imageToMat(img)
+	if err != nil {
+		return nil, err
+	}
+	defer mat.Close()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return a.estimateDepth(mat), nil
+}
+
 // estimateDepth creates a simple depth map estimation
 func (a *Analyzer) estimateDepth(img gocv.Mat) [][]float64 {
 	// Simplified depth estimation using image gradients and perspective cues
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"image"
 	"time"
 
 	"github.com/google/uuid"
@@ -176,4 +177,29 @@ func (a *SimpleAnalyzer) AnalyzeRoom(ctx context.Context, request AnalysisReques
 	}
 
 	return measurement, nil
-}
\ No newline at end of file
+}
+
+// EstimateDepthMap returns a perspective-based distance map (meters) for the image.
+// Rows near the top of the frame are treated as farther from the camera.
+func (a *SimpleAnalyzer) EstimateDepthMap(ctx context.Context, img image.Image) ([][]float64, error) {
+	bounds := img.Bounds()
+	rows, cols := bounds.Dy(), bounds.Dx()
+	if rows == 0 || cols == 0 {
+		return nil, errors.New("image has no pixels")
+	}
+
+	depthMap := make([][]float64, rows)
+	for i := range depthMap {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		depth := 5.0 - (float64(i)/float64(rows))*3.0
+		depthMap[i] = make([]float64, cols)
+		for j := range depthMap[i] {
+			depthMap[i][j] = depth
+		}
+	}
+
+	return depthMap, nil
+}
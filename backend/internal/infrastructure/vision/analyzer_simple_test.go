@@ -2,6 +2,7 @@ package vision
 
 import (
 	"context"
+	"image"
 	"testing"
 	"time"
 )
@@ -275,4 +276,28 @@ func TestSimpleAnalyzerOpeningValidation(t *testing.T) {
 			t.Error("Expected window wall to be specified")
 		}
 	}
-}
\ No newline at end of file
+}
+
+func TestSimpleAnalyzerEstimateDepthMap(t *testing.T) {
+	analyzer := NewSimpleAnalyzer()
+
+	img := image.NewRGBA(image.Rect(0, 0, 40, 30))
+
+	depthMap, err := analyzer.EstimateDepthMap(context.Background(), img)
+	if err != nil {
+		t.Fatalf("Expected depth map, got error: %v", err)
+	}
+
+	if len(depthMap) != 30 || len(depthMap[0]) != 40 {
+		t.Fatalf("Expected 30x40 depth map, got %dx%d", len(depthMap), len(depthMap[0]))
+	}
+
+	// Top of the frame should be farther than the bottom
+	if depthMap[0][0] <= depthMap[29][0] {
+		t.Errorf("Expected top depth %f to exceed bottom depth %f", depthMap[0][0], depthMap[29][0])
+	}
+
+	if _, err := analyzer.EstimateDepthMap(context.Background(), image.NewRGBA(image.Rect(0, 0, 0, 0))); err == nil {
+		t.Error("Expected error for empty image")
+	}
+}
@@ -2,6 +2,7 @@ package vision
 
 import (
 	"context"
+	"image"
 )
 
 // RoomAnalyzer defines the interface for room analysis services
@@ -9,5 +10,13 @@ type RoomAnalyzer interface {
 	AnalyzeRoom(ctx context.Context, request AnalysisRequest) (*RoomMeasurement, error)
 }
 
-// Ensure SimpleAnalyzer implements the interface
-var _ RoomAnalyzer = (*SimpleAnalyzer)(nil)
\ No newline at end of file
+// DepthEstimator defines the interface for per-pixel depth estimation
+type DepthEstimator interface {
+	EstimateDepthMap(ctx context.Context, img image.Image) ([][]float64, error)
+}
+
+// Ensure SimpleAnalyzer implements the interfaces
+var (
+	_ RoomAnalyzer   = (*SimpleAnalyzer)(nil)
+	_ DepthEstimator = (*SimpleAnalyzer)(nil)
+)
\ No newline at end of file
@@ -0,0 +1,31 @@
+-- Migration for AI usage metering
+-- Creates tables for provider usage records and per-user credit balances
+
+-- AI Usage Records Table
+CREATE TABLE IF NOT EXISTS ai_usage_records (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    project_id TEXT,
+    prediction_id TEXT NOT NULL,
+    render_type TEXT NOT NULL,
+    model TEXT NOT NULL,
+    inference_steps INTEGER NOT NULL DEFAULT 0,
+    duration_ns BIGINT NOT NULL DEFAULT 0,
+    estimated_cost_usd DECIMAL(12,6) NOT NULL DEFAULT 0,
+    status TEXT NOT NULL CHECK (status IN ('succeeded', 'failed', 'pending')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Create indexes for ai_usage_records
+CREATE INDEX idx_ai_usage_records_user_created ON ai_usage_records(user_id, created_at DESC);
+CREATE INDEX idx_ai_usage_records_project_created ON ai_usage_records(project_id, created_at DESC);
+
+-- AI Credit Balances Table
+CREATE TABLE IF NOT EXISTS ai_credit_balances (
+    user_id TEXT PRIMARY KEY,
+    plan TEXT NOT NULL DEFAULT 'free' CHECK (plan IN ('free', 'pro', 'business')),
+    credits BIGINT NOT NULL DEFAULT 0,
+    reserved BIGINT NOT NULL DEFAULT 0 CHECK (reserved >= 0),
+    period_start TIMESTAMPTZ NOT NULL DEFAULT 'epoch',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,16 @@
+-- Migration for versioned prompt templates
+-- Templates override the built-in prompts by name; several enabled versions of one name form an A/B test
+
+-- Prompt Templates Table
+CREATE TABLE IF NOT EXISTS prompt_templates (
+    name TEXT NOT NULL,
+    version TEXT NOT NULL,
+    variant TEXT NOT NULL DEFAULT '',
+    weight INTEGER NOT NULL DEFAULT 1 CHECK (weight >= 0),
+    body TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (name, version, variant)
+);
+
+-- Create indexes for prompt_templates
+CREATE INDEX idx_prompt_templates_enabled ON prompt_templates(name) WHERE weight > 0;
@@ -0,0 +1,46 @@
+-- Migration seeding a style reference for each built-in render style
+-- Renders requested with a legacy style name (ai.StyleType) use the reference whose slug matches it,
+-- so curators can edit these styles like any other
+
+INSERT INTO style_references (name, slug, description, category, characteristic_tags, color_palettes, furniture_styles) VALUES
+('Modern', 'modern', 'Clean lines, neutral colors and sleek materials with geometric shapes.', 'modern',
+ ARRAY['clean lines', 'minimalist furniture', 'geometric shapes'],
+ '[{"name": "Modern Neutrals", "primary_colors": [{"hex": "#FFFFFF", "rgb": {"r": 255, "g": 255, "b": 255}, "name": "White", "prominence": 0.4}], "accent_colors": [{"hex": "#2F2F2F", "rgb": {"r": 47, "g": 47, "b": 47}, "name": "Charcoal", "prominence": 0.15}], "neutral_colors": [{"hex": "#BEBEBE", "rgb": {"r": 190, "g": 190, "b": 190}, "name": "Gray", "prominence": 0.3}], "usage": "mixed"}]',
+ '[{"category_name": "seating", "characteristics": ["sleek", "low-profile"], "materials": ["glass", "metal"], "shapes": ["geometric", "rectangular"]}]'),
+
+('Minimalist', 'minimalist', 'Extreme simplicity with essential furniture only, lots of negative space and functional aesthetics.', 'minimalist',
+ ARRAY['extreme simplicity', 'essential furniture only', 'negative space', 'functional'],
+ '[{"name": "Monochrome", "primary_colors": [{"hex": "#FAFAFA", "rgb": {"r": 250, "g": 250, "b": 250}, "name": "Off White", "prominence": 0.5}], "accent_colors": [{"hex": "#000000", "rgb": {"r": 0, "g": 0, "b": 0}, "name": "Black", "prominence": 0.1}], "neutral_colors": [{"hex": "#DCDCDC", "rgb": {"r": 220, "g": 220, "b": 220}, "name": "Light Gray", "prominence": 0.3}], "usage": "mixed"}]',
+ '[{"category_name": "seating", "characteristics": ["simple", "functional"], "materials": ["wood", "fabric"], "shapes": ["rectangular"]}]'),
+
+('Scandinavian', 'scandinavian', 'Light wood furniture, white walls, cozy textiles and natural materials for a hygge atmosphere.', 'scandinavian',
+ ARRAY['light wood furniture', 'white walls', 'cozy textiles', 'hygge'],
+ '[{"name": "Soft Nordic", "primary_colors": [{"hex": "#FFFFFF", "rgb": {"r": 255, "g": 255, "b": 255}, "name": "White", "prominence": 0.4}], "accent_colors": [{"hex": "#A3B9C9", "rgb": {"r": 163, "g": 185, "b": 201}, "name": "Dusty Blue", "prominence": 0.15}], "neutral_colors": [{"hex": "#E3C9A8", "rgb": {"r": 227, "g": 201, "b": 168}, "name": "Birch", "prominence": 0.3}], "usage": "walls"}]',
+ '[{"category_name": "seating", "characteristics": ["simple", "comfortable"], "materials": ["light-wood", "wool"], "shapes": ["organic", "rounded"]}]'),
+
+('Industrial', 'industrial', 'Exposed brick, metal fixtures, reclaimed wood, concrete and Edison bulb lighting.', 'industrial',
+ ARRAY['exposed brick', 'metal fixtures', 'Edison bulb lighting', 'raw materials'],
+ '[{"name": "Warehouse", "primary_colors": [{"hex": "#8E8E8E", "rgb": {"r": 142, "g": 142, "b": 142}, "name": "Concrete Gray", "prominence": 0.35}], "accent_colors": [{"hex": "#A0522D", "rgb": {"r": 160, "g": 82, "b": 45}, "name": "Brick Red", "prominence": 0.2}], "neutral_colors": [{"hex": "#3B3B3B", "rgb": {"r": 59, "g": 59, "b": 59}, "name": "Iron", "prominence": 0.25}], "usage": "mixed"}]',
+ '[{"category_name": "seating", "characteristics": ["rugged", "utilitarian"], "materials": ["reclaimed-wood", "metal", "concrete", "leather"], "shapes": ["angular"]}]'),
+
+('Bohemian', 'bohemian', 'Eclectic mix of patterns, vibrant colors, vintage furniture, plants and layered textiles.', 'bohemian',
+ ARRAY['eclectic patterns', 'vintage furniture', 'plants', 'layered textiles', 'artistic'],
+ '[{"name": "Vibrant Eclectic", "primary_colors": [{"hex": "#C1440E", "rgb": {"r": 193, "g": 68, "b": 14}, "name": "Terracotta", "prominence": 0.3}], "accent_colors": [{"hex": "#008080", "rgb": {"r": 0, "g": 128, "b": 128}, "name": "Teal", "prominence": 0.2}, {"hex": "#E1AD01", "rgb": {"r": 225, "g": 173, "b": 1}, "name": "Mustard", "prominence": 0.15}], "neutral_colors": [{"hex": "#F3E5AB", "rgb": {"r": 243, "g": 229, "b": 171}, "name": "Vanilla", "prominence": 0.25}], "usage": "mixed"}]',
+ '[{"category_name": "seating", "characteristics": ["vintage", "low-lying"], "materials": ["rattan", "velvet", "macrame"], "shapes": ["curved", "organic"]}]'),
+
+('Traditional', 'traditional', 'Classic furniture, rich wood tones, ornate details, formal symmetry and elegant fabrics.', 'traditional',
+ ARRAY['classic furniture', 'ornate details', 'formal symmetry', 'elegant'],
+ '[{"name": "Warm Classic", "primary_colors": [{"hex": "#6F4E37", "rgb": {"r": 111, "g": 78, "b": 55}, "name": "Walnut", "prominence": 0.3}], "accent_colors": [{"hex": "#800020", "rgb": {"r": 128, "g": 0, "b": 32}, "name": "Burgundy", "prominence": 0.2}], "neutral_colors": [{"hex": "#F5E6D3", "rgb": {"r": 245, "g": 230, "b": 211}, "name": "Cream", "prominence": 0.4}], "usage": "mixed"}]',
+ '[{"category_name": "seating", "characteristics": ["tufted", "rolled-arms"], "materials": ["mahogany", "damask", "velvet"], "shapes": ["curved", "ornamental"]}]'),
+
+('Contemporary', 'contemporary', 'Current trends with mixed materials, bold accents, comfortable furniture and balanced proportions.', 'modern',
+ ARRAY['current trends', 'bold accents', 'balanced proportions', 'sophisticated'],
+ '[{"name": "Sophisticated Contrast", "primary_colors": [{"hex": "#F2F0EB", "rgb": {"r": 242, "g": 240, "b": 235}, "name": "Warm White", "prominence": 0.35}], "accent_colors": [{"hex": "#1F3A5F", "rgb": {"r": 31, "g": 58, "b": 95}, "name": "Navy", "prominence": 0.2}], "neutral_colors": [{"hex": "#A89F91", "rgb": {"r": 168, "g": 159, "b": 145}, "name": "Greige", "prominence": 0.3}], "usage": "mixed"}]',
+ '[{"category_name": "seating", "characteristics": ["comfortable", "sculptural"], "materials": ["boucle", "brass", "marble"], "shapes": ["rounded", "linear"]}]'),
+
+('Rustic', 'rustic', 'Natural wood, stone elements, warm earthy tones, vintage accessories and handcrafted furniture.', 'traditional',
+ ARRAY['natural wood', 'stone elements', 'handcrafted furniture', 'organic textures'],
+ '[{"name": "Earthy Warmth", "primary_colors": [{"hex": "#8B5A2B", "rgb": {"r": 139, "g": 90, "b": 43}, "name": "Oak Brown", "prominence": 0.35}], "accent_colors": [{"hex": "#556B2F", "rgb": {"r": 85, "g": 107, "b": 47}, "name": "Olive", "prominence": 0.15}], "neutral_colors": [{"hex": "#D2B48C", "rgb": {"r": 210, "g": 180, "b": 140}, "name": "Tan", "prominence": 0.3}], "usage": "mixed"}]',
+ '[{"category_name": "seating", "characteristics": ["chunky", "handcrafted"], "materials": ["reclaimed-wood", "stone", "wool"], "shapes": ["organic"]}]')
+
+ON CONFLICT (slug) DO NOTHING;
@@ -0,0 +1,31 @@
+-- Migration for durable background jobs
+-- Persists the job queue so queued and running jobs survive restarts
+
+-- Background Jobs Table
+CREATE TABLE IF NOT EXISTS background_jobs (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    project_id TEXT,
+    type TEXT NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('queued', 'processing', 'completed', 'failed', 'cancelled')),
+    progress INTEGER NOT NULL DEFAULT 0,
+    data JSONB NOT NULL DEFAULT '{}',
+    result JSONB,
+    error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    retry_count INTEGER NOT NULL DEFAULT 0,
+    max_retries INTEGER NOT NULL DEFAULT 0,
+    reserved_credits BIGINT NOT NULL DEFAULT 0,
+
+    -- Lease of the worker running the job; expired leases are requeued
+    worker_id TEXT,
+    lease_expires_at TIMESTAMPTZ
+);
+
+-- Create indexes for background_jobs
+CREATE INDEX idx_background_jobs_user_created ON background_jobs(user_id, created_at DESC);
+CREATE INDEX idx_background_jobs_project_created ON background_jobs(project_id, created_at DESC);
+CREATE INDEX idx_background_jobs_active ON background_jobs(status, lease_expires_at)
+    WHERE status IN ('queued', 'processing');
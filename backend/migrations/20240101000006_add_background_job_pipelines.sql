@@ -0,0 +1,14 @@
+-- Migration for job pipelines
+-- Links background jobs to the pipeline they belong to and adds the waiting status
+
+ALTER TABLE background_jobs
+    ADD COLUMN IF NOT EXISTS pipeline_id TEXT,
+    ADD COLUMN IF NOT EXISTS pipeline JSONB;
+
+-- Pipeline steps wait in the 'waiting' status until their parents complete
+ALTER TABLE background_jobs DROP CONSTRAINT IF EXISTS background_jobs_status_check;
+ALTER TABLE background_jobs ADD CONSTRAINT background_jobs_status_check
+    CHECK (status IN ('waiting', 'queued', 'processing', 'completed', 'failed', 'cancelled'));
+
+-- Create indexes for pipeline lookups
+CREATE INDEX idx_background_jobs_pipeline ON background_jobs(pipeline_id) WHERE pipeline_id IS NOT NULL;
@@ -0,0 +1,20 @@
+-- Migration for delayed retries and dead letters
+-- Records when a job waiting to be retried is due and keeps jobs that exhausted their retries
+
+ALTER TABLE background_jobs
+    ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMPTZ;
+
+-- Jobs that failed after their last retry, kept for inspection and requeueing
+CREATE TABLE IF NOT EXISTS background_job_dead_letters (
+    job_id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    type TEXT NOT NULL,
+    job JSONB NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    failed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Create indexes for dead-letter queries
+CREATE INDEX idx_background_job_dead_letters_user ON background_job_dead_letters(user_id);
+CREATE INDEX idx_background_job_dead_letters_failed_at ON background_job_dead_letters(failed_at DESC);
@@ -0,0 +1,14 @@
+-- Migration for idempotent job submission
+-- Maps client-supplied idempotency keys, scoped per user, to the job their first request created
+
+CREATE TABLE IF NOT EXISTS background_job_idempotency_keys (
+    user_id TEXT NOT NULL,
+    key TEXT NOT NULL,
+    request_hash TEXT NOT NULL,
+    job_id TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id, key)
+);
+
+-- Create indexes for purging expired keys
+CREATE INDEX idx_background_job_idempotency_keys_expires ON background_job_idempotency_keys(expires_at);
@@ -0,0 +1,6 @@
+-- Migration for typed job payloads
+-- Records the payload version job data was written with and the classified error of failed jobs
+
+ALTER TABLE background_jobs
+    ADD COLUMN IF NOT EXISTS data_version INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS failure JSONB;
@@ -0,0 +1,21 @@
+-- Migration for job retention
+-- Keeps finished jobs moved out of background_jobs by the retention sweeper
+
+CREATE TABLE IF NOT EXISTS background_job_archive (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    project_id TEXT,
+    pipeline_id TEXT,
+    type TEXT NOT NULL,
+    status TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    archived_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    job JSONB NOT NULL
+);
+
+-- Create indexes for paging through a user's history
+CREATE INDEX idx_background_job_archive_user_created ON background_job_archive(user_id, created_at DESC);
+CREATE INDEX idx_background_job_archive_pipeline ON background_job_archive(pipeline_id);
+
+-- Retention finds finished jobs by status and completion time
+CREATE INDEX IF NOT EXISTS idx_background_jobs_status_completed ON background_jobs(status, completed_at);
@@ -0,0 +1,5 @@
+-- Migration for late render results
+-- Records the provider predictions a job waits for after they outlived the render wait timeout
+
+ALTER TABLE background_jobs
+    ADD COLUMN IF NOT EXISTS late_render JSONB;
@@ -0,0 +1,4 @@
+-- Migration for settling late provider calls
+-- Indexes usage records by prediction so a late prediction's pending record can be updated
+
+CREATE INDEX IF NOT EXISTS idx_ai_usage_records_prediction_id ON ai_usage_records(prediction_id);